@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/**
+* JobRow is a single line of a <prefix>-jobs.csv written by the load generator, with the quoted arrays parsed.
+* Timestamps in the "offset" format are not wall-clock times, they are kept in TimestampOffsetNs instead.
+ */
+type JobRow struct {
+	Timestamp          time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	TimestampOffsetNs  int64     `parquet:"timestampOffsetNs"`
+	JobId              string    `parquet:"jobId"`
+	IsUserSession      bool      `parquet:"isUserSession"`
+	SessionId          int64     `parquet:"sessionId"`
+	Step               int64     `parquet:"step"`
+	QueryVector        []float32 `parquet:"queryVector,list"`
+	TopResultIds       []int64   `parquet:"topResultIds,list"`
+	TopResultScores    []float32 `parquet:"topResultScores,list"`
+	LatencyMus         int64     `parquet:"latencyMus"`
+	SchedulingDelayMus int64     `parquet:"schedulingDelayMus"`
+	VectorField        string    `parquet:"vectorField"`
+	SearchEffort       int64     `parquet:"searchEffort"`
+	PayloadBytes       int64     `parquet:"payloadBytes"`
+	Partitions         []int64   `parquet:"partitions,list"` // empty if the query searched all partitions
+}
+
+// Wall-clock timestamp formats of the job log, see SetTimestampFormat of the load generator, which logs local time
+var timestampLayouts = []string{time.DateTime, "2006-01-02 15:04:05.000", time.RFC3339Nano}
+
+/**
+* Columns every job log has, topResultScores, vectorField, searchEffort, payloadBytes and partitions are missing in
+* logs of older runs
+ */
+var requiredColumns = []string{
+	"timestamp", "jobId", "isUserSession", "sessionId", "step",
+	"queryVector", "topResultIds", "latencyMus", "schedulingDelayMus",
+}
+
+/**
+* Converts the job logs of live runs to Parquet, so that latencies can be analyzed without the recall calculation.
+* Every <prefix>-jobs.csv is written next to it as <prefix>-jobs.parquet.
+ */
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: jobs-parquet <prefix>-jobs.csv...")
+		os.Exit(2)
+	}
+	failed := false
+	for _, path := range os.Args[1:] {
+		rows, err := convert(path, strings.TrimSuffix(path, ".csv")+".parquet")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: converted %d jobs\n", path, rows)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func convert(csvPath string, parquetPath string) (int, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	rows, err := readJobRows(file)
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), parquet.WriteFile(parquetPath, rows)
+}
+
+// readJobRows parses a job log, its columns are looked up by the header so that older logs are read as well.
+func readJobRows(r io.Reader) ([]JobRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var rows []JobRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row, err := parseJobRow(record, columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseJobRow(record []string, columns map[string]int) (JobRow, error) {
+	var row JobRow
+	var errs []error
+	// field returns the value of the column, empty if the log does not have it
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	parseInt := func(name string) int64 {
+		value := field(name)
+		if value == "" {
+			return 0
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return parsed
+	}
+
+	if err := row.parseTimestamp(field("timestamp")); err != nil {
+		errs = append(errs, err)
+	}
+	row.JobId = field("jobId")
+	isUserSession, err := strconv.ParseBool(field("isUserSession"))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("isUserSession: %w", err))
+	}
+	row.IsUserSession = isUserSession
+	row.SessionId = parseInt("sessionId")
+	row.Step = parseInt("step")
+	row.LatencyMus = parseInt("latencyMus")
+	row.SchedulingDelayMus = parseInt("schedulingDelayMus")
+	row.VectorField = field("vectorField")
+	row.SearchEffort = parseInt("searchEffort")
+	row.PayloadBytes = parseInt("payloadBytes")
+
+	row.QueryVector, err = parseArray(field("queryVector"), parseFloat32)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("queryVector: %w", err))
+	}
+	row.TopResultIds, err = parseArray(field("topResultIds"), func(s string) (int64, error) {
+		return strconv.ParseInt(s, 10, 64)
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("topResultIds: %w", err))
+	}
+	if scores := field("topResultScores"); scores != "" {
+		row.TopResultScores, err = parseArray(scores, parseFloat32)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("topResultScores: %w", err))
+		}
+	}
+	if partitions := field("partitions"); partitions != "" {
+		row.Partitions, err = parseArray(partitions, func(s string) (int64, error) {
+			return strconv.ParseInt(s, 10, 64)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("partitions: %w", err))
+		}
+	}
+	return row, errors.Join(errs...)
+}
+
+/**
+* parseTimestamp accepts all timestamp formats of the load generator, plain integers are offsets in nanoseconds.
+* Timestamps without a zone are in the local time of the load generator, which is assumed to be the local time here.
+ */
+func (row *JobRow) parseTimestamp(value string) error {
+	if offset, err := strconv.ParseInt(value, 10, 64); err == nil {
+		row.TimestampOffsetNs = offset
+		return nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			row.Timestamp = t
+			return nil
+		}
+	}
+	return fmt.Errorf("timestamp: unknown format %q", value)
+}
+
+func parseFloat32(s string) (float32, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	return float32(f), err
+}
+
+// parseArray parses a slice formatted with %v, e.g. "[1 2 3]".
+func parseArray[T any](value string, parse func(string) (T, error)) ([]T, error) {
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("expected a bracketed array, got %q", value)
+	}
+	fields := strings.Fields(value[1 : len(value)-1])
+	array := make([]T, len(fields))
+	for i, f := range fields {
+		var err error
+		if array[i], err = parse(f); err != nil {
+			return nil, err
+		}
+	}
+	return array, nil
+}
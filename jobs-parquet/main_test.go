@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const jobLog = `timestamp,jobId,isUserSession,sessionId,step,queryVector,topResultIds,topResultScores,latencyMus,schedulingDelayMus,vectorField,searchEffort,payloadBytes,partitions
+2025-01-02 03:04:05,J-0,false,-1,-1,"[0.5 -1.25]","[7 3]","[0.1 0.2]",1500,20,vector,64,42,"[0 2]"
+2025-01-02 03:04:06.250,S-1-0,true,1,0,"[1 2]","[]","[]",900,0,,0,0,""
+`
+
+func TestReadJobRows(t *testing.T) {
+	rows, err := readJobRows(strings.NewReader(jobLog))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []JobRow{
+		{
+			Timestamp:          time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local),
+			JobId:              "J-0",
+			SessionId:          -1,
+			Step:               -1,
+			QueryVector:        []float32{0.5, -1.25},
+			TopResultIds:       []int64{7, 3},
+			TopResultScores:    []float32{0.1, 0.2},
+			LatencyMus:         1500,
+			SchedulingDelayMus: 20,
+			VectorField:        "vector",
+			SearchEffort:       64,
+			PayloadBytes:       42,
+			Partitions:         []int64{0, 2},
+		},
+		{
+			Timestamp:       time.Date(2025, 1, 2, 3, 4, 6, 250_000_000, time.Local),
+			JobId:           "S-1-0",
+			IsUserSession:   true,
+			SessionId:       1,
+			QueryVector:     []float32{1, 2},
+			TopResultIds:    []int64{},
+			TopResultScores: []float32{},
+			LatencyMus:      900,
+		},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, rows)
+	}
+}
+
+func TestReadJobRows_OffsetTimestampsAndOlderColumns(t *testing.T) {
+	// Logs written before the scores were logged have no topResultScores
+	log := "timestamp,jobId,isUserSession,sessionId,step,queryVector,topResultIds,latencyMus,schedulingDelayMus\n" +
+		"123456789,J-0,false,-1,-1,\"[1]\",\"[2]\",10,1\n"
+	rows, err := readJobRows(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].TimestampOffsetNs != 123456789 || !rows[0].Timestamp.IsZero() {
+		t.Fatalf("Expected the offset in TimestampOffsetNs, got %+v", rows)
+	}
+	if rows[0].LatencyMus != 10 || rows[0].TopResultScores != nil {
+		t.Errorf("Expected the latency and no scores, got %+v", rows[0])
+	}
+}
+
+func TestReadJobRows_Invalid(t *testing.T) {
+	header := "timestamp,jobId,isUserSession,sessionId,step,queryVector,topResultIds,topResultScores,latencyMus,schedulingDelayMus\n"
+	for name, log := range map[string]string{
+		"missing column":   "timestamp,jobId\n",
+		"unquoted array":   header + "2025-01-02 03:04:05,J-0,false,-1,-1,1,2,3,10,1\n",
+		"invalid latency":  header + "2025-01-02 03:04:05,J-0,false,-1,-1,\"[1]\",\"[2]\",\"[3]\",fast,1\n",
+		"invalid datetime": header + "yesterday,J-0,false,-1,-1,\"[1]\",\"[2]\",\"[3]\",10,1\n",
+	} {
+		if _, err := readJobRows(strings.NewReader(log)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestConvert_WritesParquet(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "benchmark-jobs.csv")
+	parquetPath := filepath.Join(dir, "benchmark-jobs.parquet")
+	if err := os.WriteFile(csvPath, []byte(jobLog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := convert(csvPath, parquetPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rows, err := parquet.ReadFile[JobRow](parquetPath)
+	if err != nil {
+		t.Fatalf("Failed to read the parquet file: %v", err)
+	}
+	if count != 2 || len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, converted %d and read %d", count, len(rows))
+	}
+	if rows[0].JobId != "J-0" || rows[0].LatencyMus != 1500 || !reflect.DeepEqual(rows[0].TopResultIds, []int64{7, 3}) {
+		t.Errorf("Unexpected first row %+v", rows[0])
+	}
+}
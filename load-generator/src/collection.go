@@ -1,5 +1,10 @@
 package main
 
+import (
+	"maps"
+	"slices"
+)
+
 func MapSessionsToJobs(sessions []UserSession) (jobs []Job) {
 	for _, session := range sessions {
 		jobs = append(jobs, session.Jobs...)
@@ -7,21 +12,37 @@ func MapSessionsToJobs(sessions []UserSession) (jobs []Job) {
 	return
 }
 
-func Collection(datasource DataSource, jobs []Job, sessions []UserSession) error {
+// Collection calculates the recall of all executed queries and returns its summary by kind of query.
+func Collection(datasource DataSource, jobs []Job, sessions []UserSession, options RecallOptions) (RecallSummary, error) {
 	logger, err := NewLogger("collection")
 	if err != nil {
-		return err
+		return RecallSummary{}, err
 	}
 	defer logger.Close()
 
 	rows, err := datasource.ReadDataRows()
 	if err != nil {
-		return err
+		return RecallSummary{}, err
 	}
 
 	sessionJobs := MapSessionsToJobs(sessions)
 	allJobs := append(jobs, sessionJobs...)
 
-	enhancedResults := EnhanceJobResults(rows, allJobs)
-	return logger.LogEnhancedResults(enhancedResults)
+	enhancedResults := EnhanceJobResults(rows, allJobs, options)
+	summary := SummarizeRecall(enhancedResults, options)
+	logger.Logf("Mean recall: overall=%.4f (%d), independent=%.4f (%d), session-first=%.4f (%d), session-follow-up=%.4f (%d)",
+		summary.Overall.MeanRecall, summary.Overall.Count,
+		summary.Independent.MeanRecall, summary.Independent.Count,
+		summary.SessionFirst.MeanRecall, summary.SessionFirst.Count,
+		summary.SessionFollowUp.MeanRecall, summary.SessionFollowUp.Count)
+	if summary.Retried != nil && summary.Retried.Count > 0 {
+		logger.Logf("Mean recall: first-try=%.4f (%d), retried=%.4f (%d)",
+			summary.FirstTry.MeanRecall, summary.FirstTry.Count, summary.Retried.MeanRecall, summary.Retried.Count)
+	}
+	efforts := slices.Sorted(maps.Keys(summary.BySearchEffort))
+	for _, effort := range efforts {
+		group := summary.BySearchEffort[effort]
+		logger.Logf("Mean recall at search effort %d: %.4f (%d)", effort, group.MeanRecall, group.Count)
+	}
+	return summary, logger.LogEnhancedResults(enhancedResults)
 }
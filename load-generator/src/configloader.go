@@ -4,17 +4,69 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// configDir holds the index-<id>.txt and dim-<id>.txt configurations, relative to the working directory
+var configDir = "configs"
+
+func indexConfigFile(configID int) string {
+	return filepath.Join(configDir, fmt.Sprintf("index-%d.txt", configID))
+}
+
+func dimConfigFile(datasetID int) string {
+	return filepath.Join(configDir, fmt.Sprintf("dim-%d.txt", datasetID))
+}
+
+// availableConfigIds returns the sorted ids of the configurations of the kind, i.e. "index" or "dim".
+func availableConfigIds(kind string) []int {
+	paths, _ := filepath.Glob(filepath.Join(configDir, kind+"-*.txt"))
+	var ids []int
+	for _, path := range paths {
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), kind+"-"), ".txt"))
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+/**
+* checkConfigFiles asserts that the configurations of the ids exist, so that a new configuration is picked up by
+* adding its file. The error lists the available ids.
+ */
+func checkConfigFiles(configID int, datasetID int) error {
+	if _, err := os.Stat(indexConfigFile(configID)); err != nil {
+		return fmt.Errorf("invalid config_id %d: no %s, available: %v", configID, indexConfigFile(configID),
+			availableConfigIds("index"))
+	}
+	if _, err := os.Stat(dimConfigFile(datasetID)); err != nil {
+		return fmt.Errorf("invalid dimensionality %d: no %s, available: %v", datasetID, dimConfigFile(datasetID),
+			availableConfigIds("dim"))
+	}
+	return nil
+}
+
 /**
 * LoadIndexConfig reads index configuration in the following format:
 * M = 30
 * efConstruction = 360
+* distanceMetric = L2 (optional, L2 | IP | COSINE | HAMMING)
+* vectorType = float (optional, float | float16 | binary)
+* ef = 400 (optional, search parameter)
+* effortSweep = 16,32,64,128 (optional, ef, nprobe or itopkSize values the queries cycle through)
+*
+* GPU indexes are selected with indexType and take their own build and search parameters:
+* indexType = GPU_IVF_FLAT (nlist, nprobe) or GPU_CAGRA (intermediateGraphDegree, graphDegree, itopkSize, searchWidth)
+* Binary vectors use indexType = BIN_IVF_FLAT (nlist, nprobe) with distanceMetric = HAMMING.
  */
 func LoadIndexConfig(configID int, config *Config) error {
-	filename := fmt.Sprintf("configs/index-%d.txt", configID)
+	filename := indexConfigFile(configID)
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open config file %s: %w", filename, err)
@@ -44,6 +96,67 @@ func LoadIndexConfig(configID int, config *Config) error {
 			if err != nil {
 				return fmt.Errorf("invalid efConstruction value in line: %s", line)
 			}
+		case "distanceMetric":
+			switch value {
+			case metricL2, metricIP, metricCosine, metricHamming:
+				config.indexParameters.distanceMetric = value
+			default:
+				return fmt.Errorf("invalid distanceMetric value in line: %s", line)
+			}
+		case "indexType":
+			switch value {
+			case indexTypeHNSW, indexTypeGPUIvfFlat, indexTypeGPUCagra, indexTypeBinIvfFlat:
+				config.indexParameters.indexType = value
+			default:
+				return fmt.Errorf("invalid indexType value in line: %s", line)
+			}
+		case "vectorType":
+			switch value {
+			case vectorTypeFloat, vectorTypeFloat16, vectorTypeBinary:
+				config.indexParameters.vectorType = value
+			default:
+				return fmt.Errorf("invalid vectorType value in line: %s", line)
+			}
+		case "nlist":
+			config.indexParameters.nlist, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid nlist value in line: %s", line)
+			}
+		case "intermediateGraphDegree":
+			config.indexParameters.intermediateGraphDegree, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid intermediateGraphDegree value in line: %s", line)
+			}
+		case "graphDegree":
+			config.indexParameters.graphDegree, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid graphDegree value in line: %s", line)
+			}
+		case "ef":
+			config.indexSearchParams.ef, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid ef value in line: %s", line)
+			}
+		case "effortSweep":
+			config.indexSearchParams.effortSweep, err = parseEffortSweep(value)
+			if err != nil {
+				return fmt.Errorf("invalid effortSweep value in line %s: %w", line, err)
+			}
+		case "nprobe":
+			config.indexSearchParams.nprobe, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid nprobe value in line: %s", line)
+			}
+		case "itopkSize":
+			config.indexSearchParams.itopkSize, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid itopkSize value in line: %s", line)
+			}
+		case "searchWidth":
+			config.indexSearchParams.searchWidth, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid searchWidth value in line: %s", line)
+			}
 		default:
 			return fmt.Errorf("unknown parameter in line: %s", line)
 		}
@@ -53,12 +166,29 @@ func LoadIndexConfig(configID int, config *Config) error {
 		return fmt.Errorf("error reading config file: %w", err)
 	}
 
-	// Verify that all required fields are set
-	if config.indexParameters.M == 0 {
-		return fmt.Errorf("missing required parameter: M")
-	}
-	if config.indexParameters.efConstruction == 0 {
-		return fmt.Errorf("missing required parameter: efConstruction")
+	// Verify that all required fields of the index type are set
+	switch config.indexParameters.indexType {
+	case indexTypeHNSW:
+		if config.indexParameters.M == 0 {
+			return fmt.Errorf("missing required parameter: M")
+		}
+		if config.indexParameters.efConstruction == 0 {
+			return fmt.Errorf("missing required parameter: efConstruction")
+		}
+		if err := checkHNSWParameters(config.indexParameters.M, config.indexParameters.efConstruction); err != nil {
+			return err
+		}
+	case indexTypeGPUIvfFlat, indexTypeBinIvfFlat:
+		if config.indexParameters.nlist == 0 {
+			return fmt.Errorf("missing required parameter: nlist")
+		}
+	case indexTypeGPUCagra:
+		if config.indexParameters.intermediateGraphDegree == 0 {
+			return fmt.Errorf("missing required parameter: intermediateGraphDegree")
+		}
+		if config.indexParameters.graphDegree == 0 {
+			return fmt.Errorf("missing required parameter: graphDegree")
+		}
 	}
 
 	return nil
@@ -68,9 +198,15 @@ func LoadIndexConfig(configID int, config *Config) error {
 * LoadDimConfig reads dimensionality configuration in the following format:
 * dim = 50
 * dataFile = ./glove/glove-50.txt
+* dataSha256 = <checksum> (optional, verified by -fetch)
+* idSource = sequential (optional, sequential | field)
+* duplicateIds = error (optional, error | reassign)
+* malformedLines = error (optional, error | skip)
+* scalarFields = category:int64:20,score:float,flag:bool (optional, see ParseScalarFields)
+* extraVectorFields = title,body (optional, additional vector fields searched at random)
  */
 func LoadDimConfig(datasetID int, config *Config) error {
-	filename := fmt.Sprintf("configs/dim-%d.txt", datasetID)
+	filename := dimConfigFile(datasetID)
 	file, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("failed to open dimensionality config file %s: %w", filename, err)
@@ -91,6 +227,55 @@ func LoadDimConfig(datasetID int, config *Config) error {
 		switch key {
 		case "dataFile":
 			config.dataFile = value
+		case "dataSha256":
+			config.dataSha256 = value
+		case "format":
+			if value != dataFormatText && value != dataFormatParquet {
+				return fmt.Errorf("invalid format value in line: %s", line)
+			}
+			config.dataFormat = value
+		case "source":
+			if value != dataSourceFile && value != dataSourceGenerated {
+				return fmt.Errorf("invalid source value in line: %s", line)
+			}
+			config.dataSource = value
+		case "size":
+			config.dataSize, err = strconv.Atoi(value)
+			if err != nil || config.dataSize <= 0 {
+				return fmt.Errorf("invalid size value in line: %s", line)
+			}
+		case "mean":
+			config.dataMean, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid mean value in line: %s", line)
+			}
+		case "stdDev":
+			config.dataStdDev, err = strconv.ParseFloat(value, 64)
+			if err != nil || config.dataStdDev < 0 {
+				return fmt.Errorf("invalid stdDev value in line: %s", line)
+			}
+		case "idSource":
+			if value != idSourceSequential && value != idSourceField {
+				return fmt.Errorf("invalid idSource value in line: %s", line)
+			}
+			config.idSource = value
+		case "duplicateIds":
+			if value != duplicateIdsError && value != duplicateIdsReassign {
+				return fmt.Errorf("invalid duplicateIds value in line: %s", line)
+			}
+			config.duplicateIds = value
+		case "malformedLines":
+			if value != malformedLinesError && value != malformedLinesSkip {
+				return fmt.Errorf("invalid malformedLines value in line: %s", line)
+			}
+			config.malformedLines = value
+		case "scalarFields":
+			config.scalarFields, err = ParseScalarFields(value)
+			if err != nil {
+				return fmt.Errorf("invalid scalarFields value in line %s: %w", line, err)
+			}
+		case "extraVectorFields":
+			config.extraVectorFields = strings.Split(value, ",")
 		case "dim":
 			config.dim, err = strconv.Atoi(value)
 			if err != nil {
@@ -106,12 +291,82 @@ func LoadDimConfig(datasetID int, config *Config) error {
 	}
 
 	// Validate that all required fields are set
+	if config.dataSource == dataSourceGenerated {
+		if config.dataSize == 0 {
+			return fmt.Errorf("missing required parameter: size")
+		}
+		if config.dim == 0 {
+			return fmt.Errorf("missing required parameter: dim")
+		}
+		return nil
+	}
 	if config.dataFile == "" {
 		return fmt.Errorf("missing required parameter: dataFile")
 	}
-	if config.dim == 0 {
+	// The dimension of a Parquet dataset is detected from the file if not given
+	if config.dim == 0 && config.dataFormat != dataFormatParquet {
 		return fmt.Errorf("missing required parameter: dim")
 	}
 
 	return nil
 }
+
+/**
+* LoadScheduleConfig reads a load schedule of offset = targetQPS lines in the following format:
+* interpolation = step (optional, step | ramp)
+* 0s = 50
+* 5m = 100
+* 10m = 200
+*
+* The offsets are relative to the start of the benchmark, in increasing order and starting at 0s.
+ */
+func LoadScheduleConfig(filename string) (*LoadSchedule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open load schedule file %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	schedule := &LoadSchedule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid format in line: %s", line)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		if key == "interpolation" {
+			switch value {
+			case "step", "ramp":
+				schedule.ramp = value == "ramp"
+			default:
+				return nil, fmt.Errorf("invalid interpolation value in line: %s", line)
+			}
+			continue
+		}
+		offset, err := time.ParseDuration(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in line: %s", line)
+		}
+		targetQPS, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid targetQPS value in line: %s", line)
+		}
+		schedule.steps = append(schedule.steps, LoadStep{offset: offset, targetQPS: targetQPS})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading load schedule file: %w", err)
+	}
+	if err := checkLoadSchedule(*schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Environment variables of the connection settings, unset variables keep the defaults of a local Milvus
+const (
+	envMilvusUser     = "MILVUS_USER"
+	envMilvusPassword = "MILVUS_PASSWORD"
+	envMilvusTLS      = "MILVUS_TLS"     // true enables TLS with the system root certificates
+	envMilvusCACert   = "MILVUS_CA_CERT" // PEM file of the CA of the server certificate, implies TLS
+)
+
+// ConnectionConfig holds the credentials and transport security of the Milvus connection.
+type ConnectionConfig struct {
+	username string
+	password string
+	tls      bool
+	caCert   string // path of a PEM file, empty uses the system root certificates
+}
+
+// getConnectionConfig reads the connection settings from the environment, falling back to root/Milvus without TLS.
+func getConnectionConfig() ConnectionConfig {
+	connection := ConnectionConfig{username: "root", password: "Milvus"}
+	if user := os.Getenv(envMilvusUser); user != "" {
+		connection.username = user
+	}
+	if password := os.Getenv(envMilvusPassword); password != "" {
+		connection.password = password
+	}
+	if value := os.Getenv(envMilvusTLS); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			fmt.Printf("Invalid %s value %q, connecting without TLS\n", envMilvusTLS, value)
+		}
+		connection.tls = enabled
+	}
+	connection.caCert = os.Getenv(envMilvusCACert)
+	if connection.caCert != "" {
+		connection.tls = true
+	}
+	return connection
+}
+
+// clientConfig builds the client configuration for the Milvus at address.
+func (cc ConnectionConfig) clientConfig(address string) (*milvusclient.ClientConfig, error) {
+	clientConfig := &milvusclient.ClientConfig{
+		Address:       address,
+		Username:      cc.username,
+		Password:      cc.password,
+		EnableTLSAuth: cc.tls,
+	}
+	if cc.caCert == "" {
+		return clientConfig, nil
+	}
+
+	pem, err := os.ReadFile(cc.caCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cc.caCert)
+	}
+	// The client only adds its default options without custom ones, the last transport credentials take effect
+	clientConfig.DialOptions = append(slices.Clone(milvusclient.DefaultGrpcOpts),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})))
+	return clientConfig, nil
+}
+
+// Backoff before the second connection attempt, doubled for every further attempt up to maxConnectBackoff
+const (
+	connectBackoff    = time.Second
+	maxConnectBackoff = 30 * time.Second
+)
+
+/**
+* ConnectMilvus creates the client and checks that Milvus serves requests, e.g. in containerized setups where the
+* benchmark may start before Milvus is up. Each attempt is bounded by attemptTimeout, a failed attempt is retried
+* up to retries times with exponential backoff.
+ */
+func ConnectMilvus(
+	ctx context.Context,
+	clientConfig *milvusclient.ClientConfig,
+	retries int,
+	attemptTimeout time.Duration,
+	logger *Logger,
+) (*milvusclient.Client, error) {
+	backoff := connectBackoff
+	var err error
+	for attempt := range retries + 1 {
+		if attempt > 0 {
+			logger.Warnf("Connecting to Milvus failed: %v, retrying in %v (attempt %d of %d)", err, backoff, attempt+1, retries+1)
+			if !sleepContext(ctx, backoff) {
+				return nil, ctx.Err()
+			}
+			backoff = min(2*backoff, maxConnectBackoff)
+		}
+		var c *milvusclient.Client
+		c, err = tryConnectMilvus(ctx, clientConfig, attemptTimeout)
+		if err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to Milvus at %s after %d attempts: %w", clientConfig.Address, retries+1, err)
+}
+
+// tryConnectMilvus makes a single connection attempt, the client is only returned once a request succeeded.
+func tryConnectMilvus(
+	ctx context.Context,
+	clientConfig *milvusclient.ClientConfig,
+	attemptTimeout time.Duration,
+) (*milvusclient.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	c, err := milvusclient.New(ctx, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	// The connection may be established before Milvus is ready to serve requests
+	_, err = c.ListDatabase(ctx, milvusclient.NewListDatabaseOption())
+	if err != nil {
+		c.Close(context.Background())
+		return nil, err
+	}
+	return c, nil
+}
+
+// redacted returns a copy of the config that is safe to log.
+func (c Config) redacted() Config {
+	if c.connection.password != "" {
+		c.connection.password = "<redacted>"
+	}
+	return c
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetConnectionConfig_Defaults(t *testing.T) {
+	for _, env := range []string{envMilvusUser, envMilvusPassword, envMilvusTLS, envMilvusCACert} {
+		t.Setenv(env, "")
+	}
+
+	connection := getConnectionConfig()
+
+	if connection != (ConnectionConfig{username: "root", password: "Milvus"}) {
+		t.Errorf("Expected the local defaults, got %+v", connection)
+	}
+}
+
+func TestGetConnectionConfig_FromEnvironment(t *testing.T) {
+	t.Setenv(envMilvusUser, "bench")
+	t.Setenv(envMilvusPassword, "secret")
+	t.Setenv(envMilvusTLS, "")
+	t.Setenv(envMilvusCACert, "/etc/milvus/ca.pem")
+
+	connection := getConnectionConfig()
+
+	// A CA certificate implies TLS
+	if connection.username != "bench" || connection.password != "secret" || !connection.tls || connection.caCert != "/etc/milvus/ca.pem" {
+		t.Errorf("Unexpected connection config %+v", connection)
+	}
+}
+
+func TestConnectionConfig_MissingCACert(t *testing.T) {
+	connection := ConnectionConfig{tls: true, caCert: t.TempDir() + "/missing.pem"}
+	if _, err := connection.clientConfig("localhost:19530"); err == nil {
+		t.Error("Expected an error for a missing CA certificate")
+	}
+}
+
+func TestConfig_RedactedHidesPassword(t *testing.T) {
+	cfg := Config{connection: ConnectionConfig{username: "root", password: "secret"}}
+	if printed := fmt.Sprintf("%+v", cfg.redacted()); strings.Contains(printed, "secret") {
+		t.Errorf("Expected the password to be redacted, got %s", printed)
+	}
+	if cfg.connection.password != "secret" {
+		t.Error("Expected the original config to keep its password")
+	}
+}
+
+func TestConnectMilvus_GivesUpAfterRetries(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	// Nothing listens on port 1
+	clientConfig, err := ConnectionConfig{}.clientConfig("127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	c, err := ConnectMilvus(context.Background(), clientConfig, 0, 200*time.Millisecond, logger)
+
+	if err == nil {
+		c.Close(context.Background())
+		t.Fatal("Expected an error without a Milvus to connect to")
+	}
+	if !strings.Contains(err.Error(), "after 1 attempts") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the attempt to be bounded by its timeout, took %v", elapsed)
+	}
+}
@@ -12,16 +12,30 @@ func GenerateVector(generator *rand.Rand, dim int, stdDev float32, mean float32)
 	return
 }
 
+/**
+* GenerateUnitVector draws a vector like GenerateVector and scales it to unit length, like the embeddings of normalized
+* datasets searched with IP or COSINE. Otherwise, the norm of the queries grows with the dimension.
+ */
+func GenerateUnitVector(generator *rand.Rand, dim int, stdDev float32, mean float32) []float32 {
+	return normalizeVector(GenerateVector(generator, dim, stdDev, mean))
+}
+
+// GenerateQueryVectors draws numQueries vectors, scaled to unit length if normalize is set.
 func GenerateQueryVectors(
 	generator *rand.Rand,
 	dim int,
 	numQueries int,
 	stdDev float32,
 	mean float32,
+	normalize bool,
 ) [][]float32 {
 	vectors := make([][]float32, numQueries)
 	for i := range numQueries {
-		vectors[i] = GenerateVector(generator, dim, stdDev, mean)
+		if normalize {
+			vectors[i] = GenerateUnitVector(generator, dim, stdDev, mean)
+		} else {
+			vectors[i] = GenerateVector(generator, dim, stdDev, mean)
+		}
 	}
 	return vectors
 }
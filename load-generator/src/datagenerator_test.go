@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func vectorNorm(v []float32) float64 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	return math.Sqrt(norm)
+}
+
+func TestGenerateQueryVectors_Normalize(t *testing.T) {
+	for _, dim := range []int{25, 200} {
+		raw := GenerateQueryVectors(rand.New(rand.NewSource(1)), dim, 10, 7.5, 0.0, false)
+		normalized := GenerateQueryVectors(rand.New(rand.NewSource(1)), dim, 10, 7.5, 0.0, true)
+		for i := range normalized {
+			if norm := vectorNorm(normalized[i]); math.Abs(norm-1) > 1e-5 {
+				t.Errorf("dim %d: expected a unit vector, got norm %f", dim, norm)
+			}
+			// Same direction as the raw vector drawn with the same seed
+			scale := float32(vectorNorm(raw[i]))
+			for j := range raw[i] {
+				if math.Abs(float64(raw[i][j]/scale-normalized[i][j])) > 1e-5 {
+					t.Fatalf("dim %d: expected the normalized vector to keep the direction", dim)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateQuery_NormalizeQueries(t *testing.T) {
+	params := JobGenerationParameters{workloadStdDev: 7.5, normalizeQueries: true}
+	if norm := vectorNorm(params.generateQuery(rand.New(rand.NewSource(1)), 100)); math.Abs(norm-1) > 1e-5 {
+		t.Errorf("Expected a unit query, got norm %f", norm)
+	}
+	params.normalizeQueries = false
+	if norm := vectorNorm(params.generateQuery(rand.New(rand.NewSource(1)), 100)); norm < 10 {
+		t.Errorf("Expected the norm to grow with the dimension without normalization, got %f", norm)
+	}
+}
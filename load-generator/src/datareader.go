@@ -2,7 +2,12 @@ package main
 
 import (
 	"bufio"
-	"encoding/gob"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -11,71 +16,308 @@ import (
 type Vector []float32
 
 type DataRow struct {
-	Id     int64
-	Vector Vector
-	Word   string
+	Id        int64
+	Vector    Vector
+	Word      string
+	Partition int            // index of the partition the row is inserted into, 0 without partitions
+	Scalars   map[string]any // values of the additional scalar fields by field name, nil without scalar fields
 }
 
 type DataSource interface {
-	GetDataSet() ([]DataRow, error)
+	GetDataSet(logger *Logger) ([]DataRow, error)
+	// StreamDataSet passes the dataset on in batches of at most batchSize rows, so that it never has to be resident at once
+	StreamDataSet(logger *Logger, batchSize int, yield func(batch []DataRow) error) error
 	ReadDataRows() ([]DataRow, error)
 }
 
+// Where the primary key of a data row comes from
+const (
+	idSourceSequential = "sequential" // ids are assigned by line number: <word> <v...>
+	idSourceField      = "field"      // ids are the first field of each line: <id> <word> <v...>
+)
+
+// How lines of a text dataset that cannot be parsed are handled
+const (
+	malformedLinesError = "error" // abort reading the dataset with the line number
+	malformedLinesSkip  = "skip"  // skip the line and report the number of skipped lines
+)
+
+// How duplicate primary keys in the dataset are handled
+const (
+	duplicateIdsError    = "error"    // abort reading the dataset
+	duplicateIdsReassign = "reassign" // keep the first occurrence and assign fresh ids to the others
+)
+
 type DataReader struct {
-	sourceFile string
+	sourceFile   string
+	idSource     string
+	duplicateIds string
+	dim          int    // expected dimension of every vector, 0 skips the check
+	malformed    string // error or skip lines that cannot be parsed, empty is treated as error
 }
 
-// Note: Not used currently
+// Where the dataset comes from
+const (
+	dataSourceFile      = "file"      // dataFile in dataFormat
+	dataSourceGenerated = "generated" // Gaussian vectors of DataGenerator, e.g. to benchmark at an arbitrary scale
+)
+
+// dataGeneratorSeed seeds the generated dataset, so that all runs insert the same rows
+const dataGeneratorSeed = 7890
+
+/**
+* DataGenerator is a dataset of size Gaussian vectors as drawn by GenerateVector, with ids in generation order.
+* The rows are generated again from the seed whenever the dataset is streamed instead of being kept in memory.
+ */
 type DataGenerator struct {
 	size   int // number of vectors to generate
 	mean   float64
 	stdDev float64
 	dim    int
+	seed   int64
+}
+
+// StreamDataSet generates the dataset and passes it on in batches of batchSize rows.
+func (g DataGenerator) StreamDataSet(logger *Logger, batchSize int, yield func(batch []DataRow) error) error {
+	generator := rand.New(rand.NewSource(g.seed))
+	for start := 0; start < g.size; start += batchSize {
+		batch := make([]DataRow, min(batchSize, g.size-start))
+		for i := range batch {
+			batch[i] = DataRow{
+				Id:     int64(start + i),
+				Vector: GenerateVector(generator, g.dim, float32(g.stdDev), float32(g.mean)),
+			}
+		}
+		if err := yield(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g DataGenerator) GetDataSet(logger *Logger) ([]DataRow, error) {
+	return collectDataSet(g, logger)
+}
+
+func (g DataGenerator) ReadDataRows() ([]DataRow, error) {
+	return readPersistedDataRows()
 }
 
-func parseVector(vector []string) Vector {
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// datasetFile reads a dataset file, decompressing it on the fly if it is gzip-compressed.
+type datasetFile struct {
+	io.Reader
+	file *os.File
+	gzip *gzip.Reader // nil if the file is not compressed
+}
+
+func (f *datasetFile) Close() error {
+	if f.gzip != nil {
+		f.gzip.Close()
+	}
+	return f.file.Close()
+}
+
+/**
+* openDataset opens a dataset file for sequential reading, transparently decompressing gzip-compressed files.
+* They are detected by their magic header rather than by a .gz suffix, so that renamed files are read as well.
+ */
+func openDataset(path string) (*datasetFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	// Files shorter than the header are read as they are
+	if header, err := buffered.Peek(len(gzipMagic)); err != nil || !bytes.Equal(header, gzipMagic) {
+		return &datasetFile{Reader: buffered, file: file}, nil
+	}
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return &datasetFile{Reader: gz, file: file, gzip: gz}, nil
+}
+
+func parseVector(vector []string) (Vector, error) {
 	ret := make([]float32, len(vector))
 	for idx, num := range vector {
 		parsedNum, err := strconv.ParseFloat(num, 32)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid vector value %q at position %d", num, idx)
 		}
 		ret[idx] = float32(parsedNum)
 	}
-	return ret
+	return ret, nil
 }
 
-func (r DataReader) GetDataSet() ([]DataRow, error) {
-	file, err := os.Open(r.sourceFile)
+/**
+* parseLine parses a line of the layout [<id>] <word> <v...> into a data row, with id as the sequential id.
+* Fields are separated by any whitespace, so that trailing or repeated spaces do not yield empty values.
+* The vector must have dim values, or as many as the first row if dim is 0.
+ */
+func (r DataReader) parseLine(line string, id int64, dim int) (DataRow, error) {
+	parts := strings.Fields(line)
+	if r.idSource == idSourceField {
+		if len(parts) == 0 {
+			return DataRow{}, fmt.Errorf("missing id")
+		}
+		var err error
+		id, err = strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return DataRow{}, fmt.Errorf("invalid id %q: %w", parts[0], err)
+		}
+		parts = parts[1:]
+	}
+	if len(parts) < 2 {
+		return DataRow{}, fmt.Errorf("no vector values")
+	}
+	vector, err := parseVector(parts[1:])
 	if err != nil {
-		return nil, err
+		return DataRow{}, err
+	}
+	if dim > 0 && len(vector) != dim {
+		return DataRow{}, fmt.Errorf("dimension mismatch: expected dim %d but the vector has dim %d", dim, len(vector))
+	}
+	return DataRow{Id: id, Word: parts[0], Vector: vector}, nil
+}
+
+// StreamDataSet reads the dataset line by line and passes it on in batches of batchSize rows.
+func (r DataReader) StreamDataSet(logger *Logger, batchSize int, yield func(batch []DataRow) error) error {
+	file, err := openDataset(r.sourceFile)
+	if err != nil {
+		return err
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-
-	var rows []DataRow
+	resolver := newDuplicateIdResolver(r.duplicateIds)
+	batch := make([]DataRow, 0, batchSize)
+	lineNumber := 0
+	dim := r.dim
+	skipped := 0
+	var firstSkipped error
 	for id := int64(0); scanner.Scan(); id++ {
+		lineNumber++
 		line := scanner.Text()
 		// skip empty lines
 		if strings.TrimSpace(line) == "" {
 			continue
 		}
-		parts := strings.Split(line, " ")
-		rows = append(rows, DataRow{Id: id, Word: parts[0], Vector: parseVector(parts[1:])})
+		// A mismatching dimension fails here instead of being rejected by Milvus after a long insert
+		row, err := r.parseLine(line, id, dim)
+		if err != nil {
+			err = fmt.Errorf("line %d of %s: %w", lineNumber, r.sourceFile, err)
+			if r.malformed != malformedLinesSkip {
+				return err
+			}
+			if skipped == 0 {
+				firstSkipped = err
+			}
+			skipped++
+			continue
+		}
+		dim = len(row.Vector)
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			if err := resolver.yield(batch, yield); err != nil {
+				return err
+			}
+			batch = make([]DataRow, 0, batchSize)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := resolver.yield(batch, yield); err != nil {
+		return err
 	}
 
-	return rows, nil
+	if resolver.remapped > 0 {
+		logger.Logf("Reassigned %d duplicate ids", resolver.remapped)
+	}
+	if skipped > 0 {
+		logger.Warnf("Warning: skipped %d malformed lines, the first one: %v", skipped, firstSkipped)
+	}
+	return nil
 }
 
-func (r DataReader) ReadDataRows() ([]DataRow, error) {
-	gobFile, err := os.Open(outputPath("data-rows.gob"))
+func (r DataReader) GetDataSet(logger *Logger) ([]DataRow, error) {
+	return collectDataSet(r, logger)
+}
+
+// collectBatchSize is the batch size in which GetDataSet collects a streamed dataset
+const collectBatchSize = 4096
+
+// collectDataSet reads all batches of a streamed dataset into memory.
+func collectDataSet(source DataSource, logger *Logger) ([]DataRow, error) {
+	var rows []DataRow
+	err := source.StreamDataSet(logger, collectBatchSize, func(batch []DataRow) error {
+		rows = append(rows, batch...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return rows, nil
+}
+
+/**
+* duplicateIdResolver detects rows sharing a primary key, which would overwrite each other on insert.
+* Depending on the policy, it either fails or reassigns all but the first occurrence. The first row using an id always
+* keeps it, duplicates get ids counting down from MaxInt64, which the rows of a dataset do not reach.
+* Only the ids are kept across batches, so that datasets can be resolved while they are streamed.
+ */
+type duplicateIdResolver struct {
+	policy   string
+	seen     map[int64]bool
+	nextId   int64 // next id for a duplicate
+	remapped int   // number of reassigned ids
+}
 
-	var data []DataRow
-	decoder := gob.NewDecoder(gobFile)
-	err = decoder.Decode(&data)
-	return data, err
+func newDuplicateIdResolver(policy string) *duplicateIdResolver {
+	return &duplicateIdResolver{policy: policy, seen: make(map[int64]bool), nextId: math.MaxInt64}
+}
+
+func (d *duplicateIdResolver) resolve(rows []DataRow) error {
+	for i := range rows {
+		if d.seen[rows[i].Id] {
+			if d.policy != duplicateIdsReassign {
+				return fmt.Errorf("dataset contains duplicate id %d (word %q)", rows[i].Id, rows[i].Word)
+			}
+			for d.seen[d.nextId] {
+				d.nextId--
+			}
+			rows[i].Id = d.nextId
+			d.remapped++
+		}
+		d.seen[rows[i].Id] = true
+	}
+	return nil
+}
+
+// yield resolves the duplicate ids of a non-empty batch and passes it on.
+func (d *duplicateIdResolver) yield(batch []DataRow, yield func(batch []DataRow) error) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := d.resolve(batch); err != nil {
+		return err
+	}
+	return yield(batch)
+}
+
+func (r DataReader) ReadDataRows() ([]DataRow, error) {
+	return readPersistedDataRows()
+}
+
+// readPersistedDataRows reads the data rows persisted by this run, following the reference to shared data rows if there is one.
+func readPersistedDataRows() ([]DataRow, error) {
+	if _, err := os.Stat(outputPath(dataRowsRefFile)); err == nil {
+		return readSharedDataRows(outputPath(dataRowsRefFile))
+	}
+	return readDataRowsFile(outputPath(dataRowsFile))
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDuplicateIdResolver_NoDuplicates(t *testing.T) {
+	rows := []DataRow{{Id: 0}, {Id: 1}, {Id: 2}}
+
+	resolver := newDuplicateIdResolver(duplicateIdsError)
+	err := resolver.resolve(rows)
+
+	if err != nil || resolver.remapped != 0 {
+		t.Errorf("Expected no remapping and no error, got %d / %v", resolver.remapped, err)
+	}
+}
+
+func TestDuplicateIdResolver_Error(t *testing.T) {
+	rows := []DataRow{{Id: 0}, {Id: 1}, {Id: 0}}
+
+	err := newDuplicateIdResolver(duplicateIdsError).resolve(rows)
+
+	if err == nil {
+		t.Error("Expected error for duplicate ids")
+	}
+}
+
+func TestDuplicateIdResolver_Reassign(t *testing.T) {
+	rows := []DataRow{{Id: 5}, {Id: 1}, {Id: 5}, {Id: 1}}
+
+	resolver := newDuplicateIdResolver(duplicateIdsReassign)
+	err := resolver.resolve(rows)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resolver.remapped != 2 {
+		t.Errorf("Expected 2 remapped ids, got %d", resolver.remapped)
+	}
+	expected := []int64{5, 1, math.MaxInt64, math.MaxInt64 - 1}
+	if ids := []int64{rows[0].Id, rows[1].Id, rows[2].Id, rows[3].Id}; !slices.Equal(ids, expected) {
+		t.Errorf("Expected ids %v, got %v", expected, ids)
+	}
+}
+
+func TestDuplicateIdResolver_AcrossBatches(t *testing.T) {
+	resolver := newDuplicateIdResolver(duplicateIdsReassign)
+	first := []DataRow{{Id: 3}, {Id: 1}}
+	second := []DataRow{{Id: 1}, {Id: 4}}
+
+	if err := resolver.resolve(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.resolve(second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unique id 4 following the duplicate is kept
+	if second[0].Id != math.MaxInt64 || second[1].Id != 4 || resolver.remapped != 1 {
+		t.Errorf("Expected ids [MaxInt64 4] and 1 remapped id, got %v / %d", []int64{second[0].Id, second[1].Id}, resolver.remapped)
+	}
+}
+
+func TestDataReader_StreamDataSet_Batches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("the 1 2\nof 3 4\n\nand 5 6\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var batches [][]DataRow
+	err := DataReader{sourceFile: path, idSource: idSourceSequential}.StreamDataSet(nil, 2, func(batch []DataRow) error {
+		batches = append(batches, batch)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("Expected batches of 2 and 1 rows, got %v", batches)
+	}
+	// Empty lines count towards the sequential ids
+	if batches[1][0].Word != "and" || batches[1][0].Id != 3 {
+		t.Errorf("Unexpected last row %+v", batches[1][0])
+	}
+}
+
+func TestDataGenerator_StreamDataSet(t *testing.T) {
+	generator := DataGenerator{size: 5, mean: 1.0, stdDev: 2.0, dim: 3, seed: 1}
+	var batches [][]DataRow
+	err := generator.StreamDataSet(nil, 2, func(batch []DataRow) error {
+		batches = append(batches, batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(batches) != 3 || len(batches[2]) != 1 {
+		t.Fatalf("Expected batches of 2, 2 and 1 rows, got %v", batches)
+	}
+	if batches[2][0].Id != 4 || len(batches[2][0].Vector) != 3 {
+		t.Errorf("Unexpected last row %+v", batches[2][0])
+	}
+
+	// The same seed generates the same rows, regardless of the batch size
+	rows, err := generator.GetDataSet(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(rows, slices.Concat(batches...)) {
+		t.Error("Expected the same rows for the same seed")
+	}
+}
+
+func TestDataReader_StreamDataSet_Gzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("the 1 2\nof 3 4\n"))
+	gz.Close()
+	// Detected by the header, the suffix does not matter
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []DataRow
+	err := DataReader{sourceFile: path, idSource: idSourceSequential}.StreamDataSet(nil, 10, func(batch []DataRow) error {
+		rows = append(rows, batch...)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[1].Word != "of" || len(rows[1].Vector) != 2 {
+		t.Errorf("Expected the 2 rows of the compressed file, got %+v", rows)
+	}
+	if dim, err := detectTextDimension(path, idSourceSequential); err != nil || dim != 2 {
+		t.Errorf("Expected dimension 2, got %d / %v", dim, err)
+	}
+}
+
+func TestDataReader_StreamDataSet_DimensionMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("the 1 2\n\nof 3 4 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := DataReader{sourceFile: path, idSource: idSourceSequential, dim: 2}.StreamDataSet(nil, 10, func(batch []DataRow) error {
+		t.Error("Expected no batch to be passed on")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected a dimension mismatch on line 3, got %v", err)
+	}
+}
+
+func TestParseVector_NonNumeric(t *testing.T) {
+	if _, err := parseVector([]string{"0.1", "abc"}); err == nil {
+		t.Error("Expected an error for a non-numeric value")
+	}
+	if vector, err := parseVector([]string{"0.5", "-1e-3"}); err != nil || len(vector) != 2 || vector[0] != 0.5 {
+		t.Errorf("Unexpected vector %v / %v", vector, err)
+	}
+}
+
+func TestDataReader_ParseLine(t *testing.T) {
+	reader := DataReader{idSource: idSourceSequential}
+
+	// Trailing and repeated spaces do not yield empty values
+	row, err := reader.parseLine("the  0.1 0.2 ", 4, 2)
+	if err != nil || row.Id != 4 || row.Word != "the" || len(row.Vector) != 2 {
+		t.Errorf("Unexpected row %+v / %v", row, err)
+	}
+
+	for _, line := range []string{"the 0.1", "the 0.1 0.2 0.3", "the 0.1 x", "the"} {
+		if _, err := reader.parseLine(line, 0, 2); err == nil {
+			t.Errorf("Expected an error for line %q", line)
+		}
+	}
+	if _, err := (DataReader{idSource: idSourceField}).parseLine("x the 0.1 0.2", 0, 2); err == nil {
+		t.Error("Expected an error for an invalid id")
+	}
+}
+
+func TestDataReader_StreamDataSet_MalformedLines(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("the 1 2\nof 3 x\nand 5 6 7\nto 8 9 \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	strict := DataReader{sourceFile: path, idSource: idSourceSequential, malformed: malformedLinesError}
+	if _, err := strict.GetDataSet(logger); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+
+	lenient := DataReader{sourceFile: path, idSource: idSourceSequential, malformed: malformedLinesSkip}
+	rows, err := lenient.GetDataSet(logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The skipped lines keep their sequential ids
+	if len(rows) != 2 || rows[0].Word != "the" || rows[1].Word != "to" || rows[1].Id != 3 {
+		t.Errorf("Expected the first and the last row, got %+v", rows)
+	}
+}
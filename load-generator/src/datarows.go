@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	dataRowsFile    = "data-rows.gob"
+	dataRowsRefFile = "data-rows.ref.json" // written instead of dataRowsFile if the data rows are shared
+)
+
+/**
+* DataRowsRef points a run to data rows stored once in a shared location, e.g. when sweeping
+* configurations over the same dataset. The fingerprint is checked when the rows are read back.
+ */
+type DataRowsRef struct {
+	Path        string
+	Fingerprint string
+}
+
+// fingerprintDataRows hashes ids, words, partitions and vectors of all rows in order.
+func fingerprintDataRows(rows []DataRow) string {
+	hash := sha256.New()
+	addToFingerprint(hash, rows)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// addToFingerprint feeds the rows into the fingerprint hash, so that it can be computed batch by batch.
+func addToFingerprint(digest hash.Hash, rows []DataRow) {
+	buf := make([]byte, 8)
+	for _, row := range rows {
+		binary.LittleEndian.PutUint64(buf, uint64(row.Id))
+		digest.Write(buf)
+		binary.LittleEndian.PutUint64(buf, uint64(len(row.Word)))
+		digest.Write(buf)
+		digest.Write([]byte(row.Word))
+		binary.LittleEndian.PutUint64(buf, uint64(row.Partition))
+		digest.Write(buf)
+		for _, v := range row.Vector {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(v))
+			digest.Write(buf[:4])
+		}
+	}
+}
+
+// sharedDataRowsPath names the shared file after the fingerprint, so that different datasets never collide.
+func sharedDataRowsPath(sharedDir string, fingerprint string) string {
+	return filepath.Join(sharedDir, fmt.Sprintf("data-rows-%s.gob", fingerprint[:16]))
+}
+
+/**
+* dataRowsWriter persists data rows batch by batch as a sequence of gob-encoded slices.
+* A file holding a single slice, as written before rows were streamed, is read the same way.
+ */
+type dataRowsWriter struct {
+	file        *os.File
+	encoder     *gob.Encoder
+	fingerprint hash.Hash
+}
+
+func newDataRowsWriter(path string) (*dataRowsWriter, error) {
+	gobFile, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &dataRowsWriter{file: gobFile, encoder: gob.NewEncoder(gobFile), fingerprint: sha256.New()}, nil
+}
+
+func (w *dataRowsWriter) Write(rows []DataRow) error {
+	addToFingerprint(w.fingerprint, rows)
+	return w.encoder.Encode(rows)
+}
+
+// Close closes the file and returns the fingerprint of all written rows.
+func (w *dataRowsWriter) Close() (string, error) {
+	return hex.EncodeToString(w.fingerprint.Sum(nil)), w.file.Close()
+}
+
+func writeDataRows(path string, rows []DataRow) error {
+	writer, err := newDataRowsWriter(path)
+	if err != nil {
+		return err
+	}
+	err = writer.Write(rows)
+	_, closeErr := writer.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func readDataRowsFile(path string) ([]DataRow, error) {
+	gobFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer gobFile.Close()
+
+	var data []DataRow
+	decoder := gob.NewDecoder(gobFile)
+	for {
+		var batch []DataRow
+		err = decoder.Decode(&batch)
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, batch...)
+	}
+}
+
+/**
+* sharedDataRowsWriter streams the rows into sharedDir unless an earlier run already stored the same rows.
+* The fingerprint in the file name identifies the dataset, which is only known once all rows are written.
+* The rows are therefore written to a temporary file, which is either renamed or, if the dataset is already stored, discarded.
+ */
+type sharedDataRowsWriter struct {
+	*dataRowsWriter
+	sharedDir string
+	tmpPath   string
+}
+
+func newSharedDataRowsWriter(sharedDir string) (*sharedDataRowsWriter, error) {
+	err := os.MkdirAll(sharedDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	// A unique temporary file, so that concurrent or aborted runs never leave a partial file behind
+	tmpFile, err := os.CreateTemp(sharedDir, "data-rows-*.gob.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close()
+	writer, err := newDataRowsWriter(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return nil, err
+	}
+	return &sharedDataRowsWriter{dataRowsWriter: writer, sharedDir: sharedDir, tmpPath: tmpFile.Name()}, nil
+}
+
+// Close stores the written rows under their fingerprint and returns the reference to them and whether they were stored before.
+func (w *sharedDataRowsWriter) Close() (DataRowsRef, bool, error) {
+	fingerprint, err := w.dataRowsWriter.Close()
+	if err != nil {
+		os.Remove(w.tmpPath)
+		return DataRowsRef{}, false, err
+	}
+	path, err := filepath.Abs(sharedDataRowsPath(w.sharedDir, fingerprint))
+	if err != nil {
+		os.Remove(w.tmpPath)
+		return DataRowsRef{}, false, err
+	}
+	ref := DataRowsRef{Path: path, Fingerprint: fingerprint}
+
+	if _, err := os.Stat(path); err == nil {
+		return ref, true, os.Remove(w.tmpPath)
+	}
+	return ref, false, os.Rename(w.tmpPath, path)
+}
+
+// Abort discards the partially written rows.
+func (w *sharedDataRowsWriter) Abort() {
+	w.dataRowsWriter.Close()
+	os.Remove(w.tmpPath)
+}
+
+// readSharedDataRows reads the referenced rows and verifies that they still match the fingerprint.
+func readSharedDataRows(refPath string) ([]DataRow, error) {
+	data, err := os.ReadFile(refPath)
+	if err != nil {
+		return nil, err
+	}
+	var ref DataRowsRef
+	err = json.Unmarshal(data, &ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data rows reference %s: %w", refPath, err)
+	}
+
+	rows, err := readDataRowsFile(ref.Path)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprint := fingerprintDataRows(rows); fingerprint != ref.Fingerprint {
+		return nil, fmt.Errorf("shared data rows %s do not match the dataset of this run: fingerprint %s, expected %s",
+			ref.Path, fingerprint, ref.Fingerprint)
+	}
+	return rows, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogDataRows_SharedDataRowsAreReused(t *testing.T) {
+	sharedDir := t.TempDir()
+	rows := []DataRow{
+		{Id: 0, Vector: Vector{1, 2}, Word: "the"},
+		{Id: 1, Vector: Vector{3, 4}, Word: "of"},
+	}
+
+	// Two runs over the same dataset share a single file
+	for _, run := range []string{"run-1", "run-2"} {
+		SetOutputDir(filepath.Join(t.TempDir(), run))
+		logger, err := NewLogger("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = logger.LogDataRows(rows, sharedDir)
+		logger.Close()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", run, err)
+		}
+		if _, err := os.Stat(outputPath(dataRowsFile)); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no per-run data rows", run)
+		}
+
+		read, err := DataReader{}.ReadDataRows()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", run, err)
+		}
+		if len(read) != len(rows) || read[1].Word != "of" {
+			t.Errorf("%s: unexpected data rows %+v", run, read)
+		}
+	}
+	SetOutputDir("output")
+
+	entries, err := os.ReadDir(sharedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected a single shared file, got %d", len(entries))
+	}
+}
+
+func TestReadDataRows_FingerprintMismatch(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	sharedDir := t.TempDir()
+	err = logger.LogDataRows([]DataRow{{Id: 0, Vector: Vector{1, 2}, Word: "the"}}, sharedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the shared file with a different dataset
+	entries, _ := os.ReadDir(sharedDir)
+	err = writeDataRows(filepath.Join(sharedDir, entries[0].Name()), []DataRow{{Id: 0, Vector: Vector{2, 1}, Word: "the"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (DataReader{}).ReadDataRows(); err == nil {
+		t.Error("Expected a fingerprint mismatch")
+	}
+}
+
+func TestFingerprintDataRows_DependsOnContent(t *testing.T) {
+	a := []DataRow{{Id: 0, Vector: Vector{1, 2}, Word: "the"}}
+	b := []DataRow{{Id: 0, Vector: Vector{1, 2}, Word: "of"}}
+	if fingerprintDataRows(a) == fingerprintDataRows(b) {
+		t.Error("Expected different fingerprints for different words")
+	}
+	if fingerprintDataRows(a) != fingerprintDataRows([]DataRow{{Id: 0, Vector: Vector{1, 2}, Word: "the"}}) {
+		t.Error("Expected identical fingerprints for identical rows")
+	}
+}
+
+func TestDataRowsWriter_Batches(t *testing.T) {
+	rows := []DataRow{
+		{Id: 0, Vector: Vector{1, 2}, Word: "the"},
+		{Id: 1, Vector: Vector{3, 4}, Word: "of"},
+		{Id: 2, Vector: Vector{5, 6}, Word: "and"},
+	}
+	path := filepath.Join(t.TempDir(), dataRowsFile)
+	writer, err := newDataRowsWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range [][]DataRow{rows[:2], rows[2:]} {
+		if err := writer.Write(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fingerprint, err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fingerprint != fingerprintDataRows(rows) {
+		t.Error("Expected the fingerprint of the batches to match the fingerprint of all rows")
+	}
+	read, err := readDataRowsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 3 || read[2].Word != "and" {
+		t.Errorf("Expected all batches to be read back, got %+v", read)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// datasetSource describes where a known dataset can be downloaded from.
+type datasetSource struct {
+	url    string // zip archive containing the dataset
+	member string // dataset file within the archive
+	sha256 string // checksum of the extracted dataset file, empty if not pinned
+}
+
+const gloveURL = "https://nlp.stanford.edu/data/glove.6B.zip"
+
+// datasetRegistry maps the known dataset ids (see validDatasetIds) to their sources.
+var datasetRegistry = map[int]datasetSource{
+	50:  {url: gloveURL, member: "glove.6B.50d.txt"},
+	100: {url: gloveURL, member: "glove.6B.100d.txt"},
+	200: {url: gloveURL, member: "glove.6B.200d.txt"},
+}
+
+/**
+* FetchDataset downloads the dataset into path if it does not exist yet and verifies its checksum.
+* expectedSha256 takes precedence over the checksum of the registry. Without any checksum,
+* the computed one is logged so that it can be pinned via dataSha256 in the dataset configuration.
+ */
+func FetchDataset(datasetId int, path string, expectedSha256 string, logger *Logger) error {
+	source, ok := datasetRegistry[datasetId]
+	if !ok {
+		return fmt.Errorf("no download source known for dataset %d", datasetId)
+	}
+	if expectedSha256 == "" {
+		expectedSha256 = source.sha256
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		logger.Logf("Dataset %s already exists, verifying...", path)
+		return verifyChecksum(path, expectedSha256, logger)
+	}
+
+	logger.Logf("Downloading dataset %d from %s...", datasetId, source.url)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	archive, err := os.CreateTemp(filepath.Dir(path), "dataset-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	err = download(source.url, archive)
+	if err != nil {
+		return err
+	}
+
+	logger.Logf("Extracting %s to %s...", source.member, path)
+	tmpPath := path + ".tmp"
+	err = extractZipMember(archive.Name(), source.member, tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = verifyChecksum(tmpPath, expectedSha256, logger)
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func download(url string, dst io.Writer) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s failed: %s", url, resp.Status)
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return err
+}
+
+func extractZipMember(archivePath string, member string, dstPath string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	src, err := reader.Open(member)
+	if err != nil {
+		return fmt.Errorf("%s not found in archive: %w", member, err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// verifyChecksum compares the sha256 of the file with the expected checksum, if there is one.
+func verifyChecksum(path string, expectedSha256 string, logger *Logger) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+
+	if expectedSha256 == "" {
+		logger.Logf("No checksum pinned for %s, computed sha256 %s", path, actual)
+		return nil
+	}
+	if actual != expectedSha256 {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", path, expectedSha256, actual)
+	}
+	logger.Logf("Checksum of %s verified", path)
+	return nil
+}
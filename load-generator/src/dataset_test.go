@@ -0,0 +1,92 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func serveZip(t *testing.T, member string, content string) *httptest.Server {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	file, err := writer.Create(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(content))
+	writer.Close()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+}
+
+func withRegistryEntry(t *testing.T, datasetId int, source datasetSource) {
+	previous, existed := datasetRegistry[datasetId]
+	datasetRegistry[datasetId] = source
+	t.Cleanup(func() {
+		if existed {
+			datasetRegistry[datasetId] = previous
+		} else {
+			delete(datasetRegistry, datasetId)
+		}
+	})
+}
+
+func TestFetchDataset_DownloadsAndVerifies(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	content := "the 0.1 0.2\nof 0.3 0.4\n"
+	sum := sha256.Sum256([]byte(content))
+	server := serveZip(t, "glove.test.txt", content)
+	defer server.Close()
+	withRegistryEntry(t, 2, datasetSource{url: server.URL, member: "glove.test.txt"})
+
+	path := filepath.Join(t.TempDir(), "glove", "glove-2.txt")
+	err = FetchDataset(2, path, hex.EncodeToString(sum[:]), logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("expected %q, got %q", content, data)
+	}
+}
+
+func TestFetchDataset_ChecksumMismatch(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	server := serveZip(t, "glove.test.txt", "the 0.1 0.2\n")
+	defer server.Close()
+	withRegistryEntry(t, 2, datasetSource{url: server.URL, member: "glove.test.txt", sha256: "00"})
+
+	path := filepath.Join(t.TempDir(), "glove-2.txt")
+	err = FetchDataset(2, path, "", logger)
+	if err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+		t.Errorf("expected no dataset file after a failed verification")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const debugSampleSeed = 5678
+
+// DebugSample holds the complete search request and raw response of a single sampled query.
+type DebugSample struct {
+	JobId       string
+	QueryVector Vector
+	Request     json.RawMessage // SearchRequest without the search input, which encodes QueryVector
+	Responses   []DebugResponse
+	Error       string `json:",omitempty"`
+}
+
+// DebugResponse is the raw content of a single result set.
+type DebugResponse struct {
+	Ids    []any
+	Scores []float32
+	Fields map[string][]any
+}
+
+/**
+* debugSampler records the full request and response of a random subset of the queries.
+* It allows to diagnose discrepancies between the intended and the actual search without verbose logging of the whole run.
+ */
+type debugSampler struct {
+	mu         sync.Mutex
+	gen        *rand.Rand
+	rate       float64
+	maxSamples int
+	samples    []DebugSample
+}
+
+// newDebugSampler returns nil if sampling is disabled.
+func newDebugSampler(rate float64, maxSamples int, seed int64) *debugSampler {
+	if rate <= 0 || maxSamples <= 0 {
+		return nil
+	}
+	return &debugSampler{gen: rand.New(rand.NewSource(seed)), rate: rate, maxSamples: maxSamples}
+}
+
+// sample decides whether the next query is recorded.
+func (s *debugSampler) sample() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.samples) < s.maxSamples && s.gen.Float64() < s.rate
+}
+
+// record stores the request and response of a sampled query.
+func (s *debugSampler) record(
+	job *Job,
+	option milvusclient.SearchOption,
+	resultSets []milvusclient.ResultSet,
+	searchErr error,
+) {
+	sample := DebugSample{JobId: job.Id, QueryVector: job.QueryVector}
+	if searchErr != nil {
+		sample.Error = searchErr.Error()
+	}
+
+	if request, err := option.Request(); err == nil {
+		request = proto.Clone(request).(*milvuspb.SearchRequest)
+		request.SearchInput = nil
+		sample.Request, _ = protojson.Marshal(request)
+	}
+
+	for _, resultSet := range resultSets {
+		response := DebugResponse{Scores: resultSet.Scores, Fields: make(map[string][]any)}
+		if resultSet.IDs != nil {
+			response.Ids = columnValues(resultSet.IDs)
+		}
+		for _, field := range resultSet.Fields {
+			response.Fields[field.Name()] = columnValues(field)
+		}
+		sample.Responses = append(sample.Responses, response)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) < s.maxSamples {
+		s.samples = append(s.samples, sample)
+	}
+}
+
+func (s *debugSampler) collected() []DebugSample {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.samples
+}
+
+func columnValues(col column.Column) []any {
+	values := make([]any, col.Len())
+	for i := range values {
+		values[i], _ = col.Get(i)
+	}
+	return values
+}
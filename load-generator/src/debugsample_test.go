@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+func TestDebugSampler_DisabledByDefault(t *testing.T) {
+	sampler := newDebugSampler(0, 100, 1)
+
+	if sampler != nil || sampler.sample() || sampler.collected() != nil {
+		t.Error("Expected no sampling with a sample rate of 0")
+	}
+}
+
+func TestDebugSampler_RespectsMaxSamples(t *testing.T) {
+	sampler := newDebugSampler(1.0, 2, 1)
+	params := &SearchParameters{collection: "c", vecFieldName: "vector", dim: 2, k: 3}
+
+	for range 5 {
+		if sampler.sample() {
+			job := &Job{Id: "J-0", QueryVector: Vector{1, 2}}
+			sampler.record(job, params.newSearchOption(job.QueryVector, "", 0, false, nil, ""), nil, nil)
+		}
+	}
+
+	if len(sampler.collected()) != 2 {
+		t.Errorf("Expected 2 samples, got %d", len(sampler.collected()))
+	}
+}
+
+func TestDebugSampler_RecordsRequestAndResponse(t *testing.T) {
+	sampler := newDebugSampler(1.0, 1, 1)
+	params := &SearchParameters{collection: "c", vecFieldName: "vector", dim: 2, k: 3, filterExpr: "id > 10"}
+	job := &Job{Id: "J-0", QueryVector: Vector{1, 2}}
+	resultSets := []milvusclient.ResultSet{{
+		IDs:    column.NewColumnInt64("id", []int64{11, 12}),
+		Scores: []float32{0.5, 0.7},
+		Fields: milvusclient.DataSet{column.NewColumnVarChar("word", []string{"a", "b"})},
+	}}
+
+	sampler.record(job, params.newSearchOption(job.QueryVector, "", 0, false, nil, ""), resultSets, nil)
+
+	sample := sampler.collected()[0]
+	var request map[string]any
+	if err := json.Unmarshal(sample.Request, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request["collectionName"] != "c" || request["dsl"] != "id > 10" {
+		t.Errorf("Unexpected request: %s", sample.Request)
+	}
+	response := sample.Responses[0]
+	if len(response.Ids) != 2 || response.Ids[0] != int64(11) || response.Fields["word"][1] != "b" {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+}
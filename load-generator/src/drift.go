@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Drift models of sessions, i.e. how the next query of a session follows from the previous step
+const (
+	driftAdditive    = "additive"    // top result plus the offset generated for the step
+	driftInterpolate = "interpolate" // the previous query moved toward the top result by driftRate, without offset
+	driftRandomWalk  = "randomwalk"  // the previous query plus the offset, which shrinks by driftDecay every step
+	driftKthResult   = "kthresult"   // result at position driftRank plus the offset, instead of the top result
+)
+
+/**
+* driftModel computes the next query of a session from the executed query of the previous step, the vectors of
+* its results in result order and the offset generated for the next step. step is the index of the next step,
+* starting at 1. The results are never empty, a session without result vectors ends early.
+ */
+type driftModel interface {
+	next(step int, previous Vector, results []Vector, offset Vector) Vector
+}
+
+// checkDriftParameters fails early on a drift model that cannot be applied.
+func checkDriftParameters(jobGenParams JobGenerationParameters) error {
+	switch jobGenParams.sessionDrift {
+	case driftAdditive:
+	case driftInterpolate:
+		if jobGenParams.driftRate <= 0 || jobGenParams.driftRate > 1 {
+			return fmt.Errorf("driftRate must be in (0, 1], got %f", jobGenParams.driftRate)
+		}
+	case driftRandomWalk:
+		if jobGenParams.driftDecay <= 0 || jobGenParams.driftDecay > 1 {
+			return fmt.Errorf("driftDecay must be in (0, 1], got %f", jobGenParams.driftDecay)
+		}
+	case driftKthResult:
+		if jobGenParams.driftRank < 1 {
+			return fmt.Errorf("driftRank must be at least 1, got %d", jobGenParams.driftRank)
+		}
+	default:
+		return fmt.Errorf("unknown session drift %q (supported: %s, %s, %s, %s)",
+			jobGenParams.sessionDrift, driftAdditive, driftInterpolate, driftRandomWalk, driftKthResult)
+	}
+	return nil
+}
+
+// newDriftModel returns the configured drift model, the additive one unless another is selected.
+func newDriftModel(jobGenParams JobGenerationParameters) driftModel {
+	switch jobGenParams.sessionDrift {
+	case driftInterpolate:
+		return interpolateDrift{rate: float32(jobGenParams.driftRate)}
+	case driftRandomWalk:
+		return randomWalkDrift{decay: jobGenParams.driftDecay}
+	case driftKthResult:
+		return kthResultDrift{rank: jobGenParams.driftRank}
+	default:
+		return additiveDrift{}
+	}
+}
+
+// additiveDrift models the attention drifting from the top result by a random offset.
+type additiveDrift struct{}
+
+func (additiveDrift) next(_ int, _ Vector, results []Vector, offset Vector) Vector {
+	return addVectors(results[0], offset, 1)
+}
+
+// interpolateDrift models a user converging on the top result, consecutive queries are strongly correlated.
+type interpolateDrift struct {
+	rate float32
+}
+
+func (d interpolateDrift) next(_ int, previous Vector, results []Vector, _ Vector) Vector {
+	next := make(Vector, len(previous))
+	for i := range next {
+		next[i] = previous[i] + d.rate*(results[0][i]-previous[i])
+	}
+	return next
+}
+
+// randomWalkDrift models a user refining the query independently of the results, with ever smaller changes.
+type randomWalkDrift struct {
+	decay float64
+}
+
+func (d randomWalkDrift) next(step int, previous Vector, _ []Vector, offset Vector) Vector {
+	return addVectors(previous, offset, float32(math.Pow(d.decay, float64(step-1))))
+}
+
+// kthResultDrift models the attention drifting from a lower-ranked result, the last one if there are fewer results.
+type kthResultDrift struct {
+	rank int
+}
+
+func (d kthResultDrift) next(_ int, _ Vector, results []Vector, offset Vector) Vector {
+	return addVectors(results[min(d.rank, len(results))-1], offset, 1)
+}
+
+// addVectors returns a + scale * b as a new vector.
+func addVectors(a Vector, b Vector, scale float32) Vector {
+	sum := make(Vector, len(a))
+	for i := range sum {
+		sum[i] = a[i] + scale*b[i]
+	}
+	return sum
+}
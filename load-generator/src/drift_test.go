@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckDriftParameters(t *testing.T) {
+	valid := []JobGenerationParameters{
+		{sessionDrift: driftAdditive},
+		{sessionDrift: driftInterpolate, driftRate: 1},
+		{sessionDrift: driftRandomWalk, driftDecay: 0.5},
+		{sessionDrift: driftKthResult, driftRank: 1},
+	}
+	for _, params := range valid {
+		if err := checkDriftParameters(params); err != nil {
+			t.Errorf("%s: unexpected error: %v", params.sessionDrift, err)
+		}
+	}
+	invalid := []JobGenerationParameters{
+		{sessionDrift: "teleport"},
+		{sessionDrift: driftInterpolate},
+		{sessionDrift: driftRandomWalk, driftDecay: 1.5},
+		{sessionDrift: driftKthResult},
+	}
+	for _, params := range invalid {
+		if err := checkDriftParameters(params); err == nil {
+			t.Errorf("%s: expected an error for %+v", params.sessionDrift, params)
+		}
+	}
+}
+
+func TestDriftModels(t *testing.T) {
+	previous := Vector{0, 0}
+	results := []Vector{{2, 4}, {10, 10}, {20, 20}}
+	offset := Vector{1, -1}
+
+	cases := map[string]struct {
+		model    driftModel
+		step     int
+		expected Vector
+	}{
+		"additive":          {additiveDrift{}, 1, Vector{3, 3}},
+		"interpolate":       {interpolateDrift{rate: 0.5}, 1, Vector{1, 2}},
+		"random walk":       {randomWalkDrift{decay: 0.5}, 1, Vector{1, -1}},
+		"random walk decay": {randomWalkDrift{decay: 0.5}, 3, Vector{0.25, -0.25}},
+		"kth result":        {kthResultDrift{rank: 2}, 1, Vector{11, 9}},
+		"kth beyond result": {kthResultDrift{rank: 5}, 1, Vector{21, 19}},
+	}
+	for name, c := range cases {
+		if next := c.model.next(c.step, previous, results, offset); !reflect.DeepEqual(next, c.expected) {
+			t.Errorf("%s: expected %v, got %v", name, c.expected, next)
+		}
+	}
+	if !reflect.DeepEqual(results[0], Vector{2, 4}) || !reflect.DeepEqual(previous, Vector{0, 0}) {
+		t.Errorf("Expected the inputs to stay unchanged, got %v and %v", previous, results[0])
+	}
+}
+
+func TestUserSession_DefaultsToAdditiveDrift(t *testing.T) {
+	if _, ok := (&UserSession{}).driftModel().(additiveDrift); !ok {
+		t.Error("Expected sessions without a drift model to drift additively")
+	}
+	params := testJobGenParams(100.0, 0.0, 2, 2)
+	params.sessionDrift = driftKthResult
+	params.driftRank = 2
+	session := NewArrivalController(params, 4, 0, 42, 10).GenerateWorkload().(*UserSession)
+	if session.driftModel() != (kthResultDrift{rank: 2}) {
+		t.Errorf("Expected the configured drift model, got %#v", session.driftModel())
+	}
+}
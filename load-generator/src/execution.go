@@ -2,60 +2,235 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
+// arrivalSeed offsets the seed of the arrival controller from JobGenerationParameters.seed
 const arrivalSeed = 3456
 
+// How the workload is issued
+const (
+	workloadModePoisson    = "poisson"    // open loop, queries arrive with exponentially distributed inter-arrival times
+	workloadModeClosed     = "closed"     // every worker issues its next query as soon as the previous one completed
+	workloadModeSequential = "sequential" // a single worker issues the queries back to back, in the same order for the same seed
+)
+
+/**
+* checkWorkloadMode fails early on phases in sequential mode.
+* The phase boundaries depend on the elapsed time, so the workload mix would switch at a different query in every run.
+ */
+func checkWorkloadMode(mode string, jobGenParams JobGenerationParameters) error {
+	if mode == workloadModeSequential && len(jobGenParams.phases) > 0 {
+		return fmt.Errorf("benchmark phases are not supported in %s mode, their boundaries depend on timing", mode)
+	}
+	return nil
+}
+
+// Handling of Poisson arrivals while all workers are busy and the work channel is full
+const (
+	overloadPolicyDrop  = "drop"  // drop the workload right away to keep the arrival process, counted in the stats
+	overloadPolicyBlock = "block" // wait for a free worker, which delays the following arrivals but never loses work
+)
+
+/**
+* ExecuteBenchmark runs the workload for the configured duration or until ctx is cancelled, e.g. by an interrupt.
+* In both cases the work collected so far is returned.
+ */
 func ExecuteBenchmark(
 	c *milvusclient.Client,
-	collection string,
-	vecFieldName string,
+	ctx context.Context,
+	params *SearchParameters,
 	datasource DataSource,
-	dim int,
 	jobGenParams JobGenerationParameters,
-	k int,
 	concurrency int,
-) ([]Job, []UserSession, error) {
-	ctx := context.Background()
+	concurrencyStages []ConcurrencyStage,
+	loadTimeout time.Duration,
+	loadRetries int,
+	reportArrivalStats bool,
+	adaptToRateLimits bool,
+	sheddingThreshold time.Duration,
+	overloadPolicy string,
+	throughputWindow time.Duration,
+	numPartitions int,
+	mode string,
+	spillThreshold int,
+	replay []Workload,
+) ([]Job, []UserSession, ExecutionStats, error) {
 	logger, err := NewLogger("benchmark")
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, ExecutionStats{}, err
 	}
 	defer logger.Close()
+	SetBenchmarkStart(time.Now())
 	logger.Log("Executing Benchmark...")
+	if err := checkWorkloadMode(mode, jobGenParams); err != nil {
+		return nil, nil, ExecutionStats{}, err
+	}
+	if overloadPolicy != overloadPolicyDrop && overloadPolicy != overloadPolicyBlock {
+		return nil, nil, ExecutionStats{}, fmt.Errorf("unknown overload policy %q, expected %q or %q",
+			overloadPolicy, overloadPolicyDrop, overloadPolicyBlock)
+	}
 
 	/* Load Collection */
-	task, err := c.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(collection))
+	err = LoadCollection(c, ctx, params.collection, loadTimeout, loadRetries, logger)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, ExecutionStats{}, err
+	}
+
+	/* Without explicit stages, the benchmark is a single stage with fixed concurrency */
+	phases := resolvePhases(jobGenParams)
+	stages := concurrencyStages
+	if len(stages) == 0 {
+		stages = []ConcurrencyStage{{workers: concurrency, duration: totalPhaseDuration(phases)}}
+	} else if len(jobGenParams.phases) > 0 && totalStageDuration(stages) != totalPhaseDuration(phases) {
+		return nil, nil, ExecutionStats{}, fmt.Errorf("concurrency stages (%v) and benchmark phases (%v) must have the same total duration",
+			totalStageDuration(stages), totalPhaseDuration(phases))
+	}
+
+	if mode == workloadModeSequential {
+		if len(concurrencyStages) > 0 {
+			logger.Log("Concurrency stages are ignored in sequential mode, a single worker issues all queries")
+		}
+		stages = []ConcurrencyStage{{workers: 1, duration: totalPhaseDuration(phases)}}
+	}
+
+	/* Bound the sessions in flight, so that the continuations always fit into the backlog */
+	if jobGenParams.maxInFlightSessions == 0 {
+		jobGenParams.maxInFlightSessions = 2 * maxStageWorkers(stages)
 	}
-	task.Await(ctx)
 
 	/* Create Arrival Controller for Poisson-Process based workload */
 	arrivalController := NewArrivalController(
 		jobGenParams,
-		dim,
-		arrivalSeed,
-		concurrency,
+		params.dim,
+		numPartitions,
+		jobGenParams.seed+arrivalSeed,
+		maxStageWorkers(stages),
 	)
+	// Offset so that the field draws are not correlated with the partition and filter draws
+	arrivalController.vectorFields = newVectorFieldChooser(rand.New(rand.NewSource(jobGenParams.seed+arrivalSeed+2)), params.vectorFields)
+	arrivalController.searchEfforts = params.indexSearchParams.effortSweep
+	arrivalController.replay = newReplayQueue(replay)
+	if len(replay) > 0 {
+		logger.Logf("Replaying %d workloads of a previous run instead of generating them", len(replay))
+	}
 
-	logger.Logf("Starting Benchmark with Poisson arrivals: targetQPS=%.2f, duration=%v, jobProbability=%.2f",
-		jobGenParams.targetQPS, jobGenParams.benchmarkDuration, jobGenParams.jobProbability)
-
-	/* Execute Workload with Poisson arrivals */
-	jobs, sessions := ExecuteWorkloadPoisson(
-		arrivalController,
-		c,
-		collection,
-		vecFieldName,
-		dim,
-		k,
-		logger,
-		concurrency,
-	)
+	collector := newResultCollector(spillThreshold, params.metric, logger)
+	var jobs []Job
+	var sessions []UserSession
+	var stats ExecutionStats
+	switch mode {
+	case workloadModeClosed:
+		logger.Logf("Starting closed-loop Benchmark: duration=%v, jobProbability=%.2f, stages=%d, phases=%d",
+			totalStageDuration(stages), phases[0].jobProbability, len(stages), len(phases))
+		if reportArrivalStats || adaptToRateLimits || sheddingThreshold > 0 || jobGenParams.loadSchedule != nil {
+			logger.Log("Arrival statistics, rate-limit adaptation, load shedding and load schedules only apply to Poisson arrivals")
+		}
+		jobs, sessions, stats = ExecuteWorkloadClosedLoop(arrivalController, c, ctx, params, logger, stages, collector)
+	case workloadModeSequential:
+		// With a single worker, every session runs to completion before the next workload is generated, since
+		// continuations take priority. The workloads therefore execute in the order of the seeded arrival controller,
+		// so that runs with the same seed issue the same query sequence, up to the query at which the duration ends.
+		logger.Logf("Starting sequential Benchmark: duration=%v, jobProbability=%.2f, seed=%d",
+			totalStageDuration(stages), phases[0].jobProbability, jobGenParams.seed)
+		if reportArrivalStats || adaptToRateLimits || sheddingThreshold > 0 || jobGenParams.loadSchedule != nil {
+			logger.Log("Arrival statistics, rate-limit adaptation, load shedding and load schedules only apply to Poisson arrivals")
+		}
+		jobs, sessions, stats = ExecuteWorkloadClosedLoop(arrivalController, c, ctx, params, logger, stages, collector)
+	default:
+		logger.Logf("Starting Benchmark with Poisson arrivals: targetQPS=%.2f, duration=%v, jobProbability=%.2f, stages=%d, phases=%d",
+			arrivalController.currentTargetQPS(), totalStageDuration(stages), phases[0].jobProbability, len(stages), len(phases))
+		if jobGenParams.loadSchedule != nil {
+			logger.Logf("targetQPS follows the load schedule %s", jobGenParams.loadSchedule)
+		}
+
+		/* Execute Workload with Poisson arrivals */
+		jobs, sessions, stats = ExecuteWorkloadPoisson(
+			arrivalController,
+			c,
+			ctx,
+			params,
+			logger,
+			stages,
+			reportArrivalStats,
+			adaptToRateLimits,
+			sheddingThreshold,
+			overloadPolicy,
+			throughputWindow,
+			collector,
+		)
+	}
 	logger.Log("Finished Execution")
 
-	return jobs, sessions, nil
+	return jobs, sessions, stats, nil
+}
+
+// totalStageDuration returns the duration of all concurrency stages run back to back.
+func totalStageDuration(stages []ConcurrencyStage) (total time.Duration) {
+	for _, stage := range stages {
+		total += stage.duration
+	}
+	return
+}
+
+// stageAt returns the index of the stage the benchmark is in after elapsed, the last stage if all elapsed.
+func stageAt(stages []ConcurrencyStage, elapsed time.Duration) int {
+	var stageEnd time.Duration
+	for i, stage := range stages {
+		stageEnd += stage.duration
+		if elapsed < stageEnd {
+			return i
+		}
+	}
+	return len(stages) - 1
+}
+
+// maxStageWorkers returns the largest number of workers active in any stage.
+func maxStageWorkers(stages []ConcurrencyStage) (workers int) {
+	for _, stage := range stages {
+		workers = max(workers, stage.workers)
+	}
+	return
+}
+
+// resolvePhases returns the configured benchmark phases, or a single phase of the top-level job generation parameters.
+func resolvePhases(jobGenParams JobGenerationParameters) []BenchmarkPhase {
+	if len(jobGenParams.phases) > 0 {
+		return jobGenParams.phases
+	}
+	return []BenchmarkPhase{{
+		name:           "default",
+		duration:       jobGenParams.benchmarkDuration,
+		targetQPS:      jobGenParams.targetQPS,
+		jobProbability: jobGenParams.jobProbability,
+	}}
+}
+
+// totalPhaseDuration returns the duration of all benchmark phases run back to back.
+func totalPhaseDuration(phases []BenchmarkPhase) (total time.Duration) {
+	for _, phase := range phases {
+		total += phase.duration
+	}
+	return
+}
+
+// phaseAt returns the index of the phase the benchmark is in after elapsed, the last phase if all elapsed.
+func phaseAt(phases []BenchmarkPhase, elapsed time.Duration) int {
+	var phaseEnd time.Duration
+	for i, phase := range phases {
+		phaseEnd += phase.duration
+		if elapsed < phaseEnd {
+			return i
+		}
+	}
+	return len(phases) - 1
+}
+
+// meanTargetQPS returns the targeted arrival rate of the load schedule averaged over the duration of all phases.
+func meanTargetQPS(jobGenParams JobGenerationParameters) float64 {
+	return resolveLoadSchedule(jobGenParams).Mean(totalPhaseDuration(resolvePhases(jobGenParams)))
 }
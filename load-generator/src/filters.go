@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// filterPlaceholder is replaced by a random value in [0, filterMaxValue) for every generated filter
+const filterPlaceholder = "{random}"
+
+// checkFilterParameters rejects per-query filter settings that cannot generate filters before the benchmark starts.
+func checkFilterParameters(jobGenParams JobGenerationParameters) error {
+	if jobGenParams.filterProbability < 0 || jobGenParams.filterProbability > 1 {
+		return fmt.Errorf("filterProbability must be between 0 and 1, got %f", jobGenParams.filterProbability)
+	}
+	if jobGenParams.filterProbability == 0 {
+		return nil
+	}
+	if jobGenParams.filterTemplate == "" {
+		return fmt.Errorf("filterProbability %f requires a filterTemplate", jobGenParams.filterProbability)
+	}
+	if strings.Contains(jobGenParams.filterTemplate, filterPlaceholder) && jobGenParams.filterMaxValue <= 0 {
+		return fmt.Errorf("filterTemplate %q requires a positive filterMaxValue", jobGenParams.filterTemplate)
+	}
+	return nil
+}
+
+// filterGenerator draws the scalar filters of the queries from the filter template.
+type filterGenerator struct {
+	gen         *rand.Rand
+	probability float64
+	template    string
+	maxValue    int64
+}
+
+// newFilterGenerator returns nil if no query is filtered.
+func newFilterGenerator(gen *rand.Rand, probability float64, template string, maxValue int64) *filterGenerator {
+	if probability <= 0 {
+		return nil
+	}
+	return &filterGenerator{gen: gen, probability: probability, template: template, maxValue: maxValue}
+}
+
+// generate returns the filter of the next query, or an empty string if the query is not filtered.
+func (fg *filterGenerator) generate() string {
+	if fg == nil || fg.gen.Float64() >= fg.probability {
+		return ""
+	}
+	if !strings.Contains(fg.template, filterPlaceholder) {
+		return fg.template
+	}
+	return strings.ReplaceAll(fg.template, filterPlaceholder, strconv.FormatInt(fg.gen.Int63n(fg.maxValue), 10))
+}
+
+// combineFilters joins the filter applied to every search with the filter of a single query.
+func combineFilters(global string, query string) string {
+	if global == "" {
+		return query
+	}
+	if query == "" {
+		return global
+	}
+	return fmt.Sprintf("(%s) and (%s)", global, query)
+}
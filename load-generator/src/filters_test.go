@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFilterGenerator_ProbabilityAndTemplate(t *testing.T) {
+	generator := newFilterGenerator(rand.New(rand.NewSource(42)), 0.5, "id > "+filterPlaceholder, 100)
+
+	filtered := 0
+	for range 1000 {
+		filter := generator.generate()
+		if filter == "" {
+			continue
+		}
+		filtered++
+		value, err := strconv.Atoi(strings.TrimPrefix(filter, "id > "))
+		if err != nil || value < 0 || value >= 100 {
+			t.Fatalf("Unexpected filter %q", filter)
+		}
+	}
+	if filtered < 400 || filtered > 600 {
+		t.Errorf("Expected about half of the queries to be filtered, got %d of 1000", filtered)
+	}
+}
+
+func TestFilterGenerator_DisabledReturnsNoFilter(t *testing.T) {
+	if generator := newFilterGenerator(rand.New(rand.NewSource(42)), 0, "id > 1", 0); generator.generate() != "" {
+		t.Error("Expected no filter without a filter probability")
+	}
+}
+
+func TestCombineFilters(t *testing.T) {
+	cases := map[[2]string]string{
+		{"", ""}:             "",
+		{"id > 1", ""}:       "id > 1",
+		{"", "id < 5"}:       "id < 5",
+		{"id > 1", "id < 5"}: "(id > 1) and (id < 5)",
+	}
+	for filters, expected := range cases {
+		if actual := combineFilters(filters[0], filters[1]); actual != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, filters, actual)
+		}
+	}
+}
+
+func TestCheckFilterParameters(t *testing.T) {
+	valid := JobGenerationParameters{filterProbability: 0.5, filterTemplate: "id > " + filterPlaceholder, filterMaxValue: 10}
+	if err := checkFilterParameters(valid); err != nil {
+		t.Errorf("Expected valid filter parameters, got %v", err)
+	}
+
+	invalid := []JobGenerationParameters{
+		{filterProbability: 1.5, filterTemplate: "id > 1"},
+		{filterProbability: 0.5},
+		{filterProbability: 0.5, filterTemplate: "id > " + filterPlaceholder},
+	}
+	for _, params := range invalid {
+		if err := checkFilterParameters(params); err == nil {
+			t.Errorf("Expected error for %+v", params)
+		}
+	}
+}
+
+func TestArrivalController_SessionsShareFilter(t *testing.T) {
+	params := testJobGenParams(100.0, 0.0, 5, 10) // only sessions
+	params.filterProbability = 1.0
+	params.filterTemplate = "id > " + filterPlaceholder
+	params.filterMaxValue = 1000
+	ac := NewArrivalController(params, 50, 0, 42, 10)
+
+	session := ac.GenerateWorkload().(*UserSession)
+
+	for _, job := range session.Jobs {
+		if job.Filter == "" || job.Filter != session.Jobs[0].Filter {
+			t.Fatalf("Expected all session queries to share a filter, got %q and %q", job.Filter, session.Jobs[0].Filter)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+// Rerankers fusing the sub-searches of a hybrid search
+const (
+	hybridRerankerRRF      = "rrf"      // reciprocal rank fusion, only the ranks of the sub-searches count
+	hybridRerankerWeighted = "weighted" // weighted sum of the normalized scores of the sub-searches
+)
+
+// hybridFieldSeparator joins the vector fields of a hybrid search in Job.VectorField
+const hybridFieldSeparator = "+"
+
+/**
+* newHybridReranker builds the reranker of hybrid searches over numFields vector fields.
+* Without weights, every field is weighted equally.
+ */
+func newHybridReranker(reranker string, rrfK float64, weights []float64, numFields int) (milvusclient.Reranker, error) {
+	switch reranker {
+	case hybridRerankerRRF:
+		return milvusclient.NewRRFReranker().WithK(rrfK), nil
+	case hybridRerankerWeighted:
+		if len(weights) == 0 {
+			weights = make([]float64, numFields)
+			for i := range weights {
+				weights[i] = 1
+			}
+		}
+		if len(weights) != numFields {
+			return nil, fmt.Errorf("%d hybrid weights for %d vector fields", len(weights), numFields)
+		}
+		return milvusclient.NewWeightedReranker(weights), nil
+	default:
+		return nil, fmt.Errorf("unknown hybrid reranker %q", reranker)
+	}
+}
+
+// checkHybridParameters fails early if hybrid jobs are generated but cannot be searched.
+func checkHybridParameters(jobGenParams JobGenerationParameters, vectorFields []string) error {
+	if jobGenParams.hybridProbability < 0 || jobGenParams.hybridProbability > 1 {
+		return fmt.Errorf("hybridProbability must be between 0 and 1, got %f", jobGenParams.hybridProbability)
+	}
+	if jobGenParams.hybridProbability > 0 && len(vectorFields) < 2 {
+		return fmt.Errorf("hybridProbability %f requires at least two vector fields, see extraVectorFields",
+			jobGenParams.hybridProbability)
+	}
+	return nil
+}
+
+/**
+* HybridJob is a single query searched on all vector fields at once, with the sub-search results fused by the
+* reranker of the search parameters. Since all vector fields share the ground truth, the fused results are
+* evaluated like those of a Job.
+*
+* Job Ids of hybrid jobs are encoded as "H-{index}".
+ */
+type HybridJob struct {
+	Job
+}
+
+func (ac *ArrivalController) generateHybridJob() *HybridJob {
+	query := ac.jobGenParams.generateQuery(ac.gen, ac.dim)
+	jobId := fmt.Sprintf("H-%d", ac.hybridCounter)
+	ac.hybridCounter++
+	return &HybridJob{Job: Job{
+		Id:           jobId,
+		QueryVector:  query,
+		Partitions:   ac.partitions.choose(),
+		Filter:       ac.filters.generate(),
+		SearchEffort: ac.nextSearchEffort(),
+		perturbation: ac.generatePerturbation(),
+	}}
+}
+
+/**
+* newHybridSearchOption builds the hybrid search request for a single query, one sub-search per vector field.
+* The configured filter, the filter of the job and the index-specific search parameters with the search effort of
+* the job apply to every sub-search.
+ */
+func (p *SearchParameters) newHybridSearchOption(
+	query Vector,
+	effort int,
+	partitions []int,
+	filter string,
+) milvusclient.HybridSearchOption {
+	requests := make([]*milvusclient.AnnRequest, 0, len(p.vectorFields))
+	expr := combineFilters(p.filterExpr, filter)
+	for _, field := range p.vectorFields {
+		request := milvusclient.NewAnnRequest(field, p.k, p.searchVector(query, field))
+		if annParam := p.annParamFor(effort); annParam != nil {
+			request = request.WithAnnParam(annParam)
+		}
+		if expr != "" {
+			request = request.WithFilter(expr)
+		}
+		requests = append(requests, request)
+	}
+	option := milvusclient.NewHybridSearchOption(p.collection, p.k, requests...).WithReranker(p.hybridReranker)
+	if len(partitions) > 0 {
+		option = option.WithPartitions(partitionNames(partitions)...)
+	}
+	if len(p.outputFields) > 0 {
+		option = option.WithOutputFields(p.outputFields...)
+	}
+	return option
+}
+
+func (h *HybridJob) Execute(
+	ctx context.Context,
+	c *milvusclient.Client,
+	params *SearchParameters,
+	logger *Logger,
+	schedulingDelay time.Duration,
+	stage int,
+	phase int,
+) (Workload, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	h.SchedulingDelay = schedulingDelay
+	h.Stage = stage
+	h.Phase = phase
+	h.VectorField = strings.Join(params.vectorFields, hybridFieldSeparator)
+	h.applyPerturbation()
+	start := time.Now()
+
+	option := params.newHybridSearchOption(h.QueryVector, h.SearchEffort, h.Partitions, h.Filter)
+	searchRes, err := params.withRetries(ctx, &h.Job, func(ctx context.Context) ([]milvusclient.ResultSet, error) {
+		return c.HybridSearch(ctx, option)
+	})
+	if isQueryTimeout(err) {
+		params.recordTimeout(&h.Job, start)
+		logger.LogJob(&h.Job, -1, -1)
+		return h, err
+	}
+	if err != nil {
+		h.Latency = time.Since(start)
+		h.StartTimestamp = start
+		return nil, err
+	}
+
+	if len(searchRes) != 1 {
+		logger.Warnf("Unexpected number of result sets: %d", len(searchRes))
+	}
+	for _, resultSet := range searchRes {
+		_, err = params.processResult(&h.Job, resultSet)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Latency covers all sub-searches and the fusion of their results
+	h.Latency = time.Since(start)
+	h.StartTimestamp = start
+	logger.LogJob(&h.Job, -1, -1) // -1 indicates not part of a session
+	return h, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewHybridReranker(t *testing.T) {
+	rrf, err := newHybridReranker(hybridRerankerRRF, 60, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := rrf.GetParams(); params[0].GetValue() != "rrf" || !strings.Contains(params[1].GetValue(), `"k":60`) {
+		t.Errorf("Unexpected rrf parameters: %v", params)
+	}
+
+	weighted, err := newHybridReranker(hybridRerankerWeighted, 0, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params := weighted.GetParams(); !strings.Contains(params[1].GetValue(), "[1,1,1]") {
+		t.Errorf("Expected equal weights, got %v", params)
+	}
+
+	if _, err := newHybridReranker(hybridRerankerWeighted, 0, []float64{0.7}, 2); err == nil {
+		t.Error("Expected error for a weight count not matching the vector fields")
+	}
+	if _, err := newHybridReranker("max", 0, nil, 2); err == nil {
+		t.Error("Expected error for an unknown reranker")
+	}
+}
+
+func TestCheckHybridParameters(t *testing.T) {
+	params := JobGenerationParameters{hybridProbability: 0.2}
+	if err := checkHybridParameters(params, []string{"vector", "title"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkHybridParameters(params, []string{"vector"}); err == nil {
+		t.Error("Expected error for hybrid jobs on a single vector field")
+	}
+	if err := checkHybridParameters(JobGenerationParameters{hybridProbability: 1.5}, nil); err == nil {
+		t.Error("Expected error for a probability above 1")
+	}
+}
+
+func TestArrivalController_GenerateHybridJob(t *testing.T) {
+	params := testJobGenParams(100.0, 1.0, 5, 10)
+	params.hybridProbability = 1.0
+	ac := NewArrivalController(params, 8, 0, 42, 10)
+
+	job, ok := ac.GenerateWorkload().(*HybridJob)
+	if !ok {
+		t.Fatal("Expected a hybrid job")
+	}
+	if job.Id != "H-0" || len(job.QueryVector) != 8 {
+		t.Errorf("Unexpected hybrid job: %+v", job.Job)
+	}
+}
+
+func TestSearchParameters_HybridSearchOption(t *testing.T) {
+	fields := []string{"vector", "title"}
+	reranker, err := newHybridReranker(hybridRerankerRRF, 60, nil, len(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := &SearchParameters{
+		collection:     "c",
+		vecFieldName:   "vector",
+		dim:            4,
+		k:              10,
+		filterExpr:     "id > 5",
+		vectorFields:   fields,
+		permutations:   vectorFieldPermutations(fields, 4),
+		hybridReranker: reranker,
+	}
+
+	request, err := params.newHybridSearchOption(Vector{1, 2, 3, 4}, 0, []int{1}, "").HybridRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(request.GetRequests()) != 2 || request.GetPartitionNames()[0] != partitionName(1) {
+		t.Fatalf("Expected one sub-search per field on partition 1, got %v", request)
+	}
+	for i, sub := range request.GetRequests() {
+		if sub.GetDsl() != "id > 5" {
+			t.Errorf("Expected the configured filter on sub-search %d, got %q", i, sub.GetDsl())
+		}
+		for _, param := range sub.GetSearchParams() {
+			if param.GetKey() == "anns_field" && param.GetValue() != fields[i] {
+				t.Errorf("Expected sub-search %d on field %s, got %s", i, fields[i], param.GetValue())
+			}
+		}
+	}
+}
+
+func TestResultCollector_CollectsHybridJobsAsJobs(t *testing.T) {
+	collector := newResultCollector(0, metricL2, nil)
+	collector.add(&HybridJob{Job: Job{Id: "H-0"}})
+
+	jobs, _, _ := collector.results()
+	if len(jobs) != 1 || jobs[0].Id != "H-0" {
+		t.Errorf("Expected the hybrid job among the jobs, got %v", jobs)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus/client/v2/index"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+// Supported index types of the vector field
+const (
+	indexTypeHNSW       = "HNSW"
+	indexTypeGPUIvfFlat = "GPU_IVF_FLAT"
+	indexTypeGPUCagra   = "GPU_CAGRA"
+	indexTypeBinIvfFlat = "BIN_IVF_FLAT" // the only supported index of binary vectors
+)
+
+func isGPUIndex(indexType string) bool {
+	return strings.HasPrefix(indexType, "GPU_")
+}
+
+/**
+* buildIndex creates the index definition of the vector field for the configured index type.
+* GPU indexes are built as generic indexes, since the SDK builders do not set all of their build parameters.
+ */
+func buildIndex(params ConstructionIndexParameters) (index.Index, error) {
+	metricType := index.MetricType(params.distanceMetric)
+	switch params.indexType {
+	case indexTypeHNSW:
+		return index.NewHNSWIndex(metricType, params.efConstruction, params.M), nil
+	case indexTypeBinIvfFlat:
+		return index.NewBinIvfFlatIndex(metricType, params.nlist), nil
+	case indexTypeGPUIvfFlat:
+		return index.NewGenericIndex("", map[string]string{
+			index.IndexTypeKey:  indexTypeGPUIvfFlat,
+			index.MetricTypeKey: params.distanceMetric,
+			"nlist":             strconv.Itoa(params.nlist),
+		}), nil
+	case indexTypeGPUCagra:
+		return index.NewGenericIndex("", map[string]string{
+			index.IndexTypeKey:          indexTypeGPUCagra,
+			index.MetricTypeKey:         params.distanceMetric,
+			"intermediate_graph_degree": strconv.Itoa(params.intermediateGraphDegree),
+			"graph_degree":              strconv.Itoa(params.graphDegree),
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported index type %s", params.indexType)
+	}
+}
+
+// Valid range of the HNSW parameter M in Milvus
+const (
+	hnswMinM = 2
+	hnswMaxM = 2048
+)
+
+/**
+* checkHNSWParameters fails before the insert phase on HNSW build parameters Milvus would only reject when the index
+* is built. An efConstruction below M cannot fill the M links of a node with good candidates.
+ */
+func checkHNSWParameters(M int, efConstruction int) error {
+	if M < hnswMinM || M > hnswMaxM {
+		return fmt.Errorf("M must be between %d and %d, got %d", hnswMinM, hnswMaxM, M)
+	}
+	if efConstruction < M {
+		return fmt.Errorf("efConstruction must be at least M (%d), got %d", M, efConstruction)
+	}
+	return nil
+}
+
+/**
+* buildAnnParam returns the index-specific search parameters of the configured index type.
+* nil leaves the search parameters to the Milvus defaults.
+ */
+func buildAnnParam(indexType string, params IndexSearchParameters) index.AnnParam {
+	switch indexType {
+	case indexTypeHNSW:
+		if params.ef <= 0 {
+			return nil
+		}
+		return index.NewHNSWAnnParam(params.ef)
+	case indexTypeGPUIvfFlat, indexTypeBinIvfFlat:
+		return index.NewIvfAnnParam(params.nprobe)
+	case indexTypeGPUCagra:
+		annParam := index.NewCustomAnnParam()
+		annParam.WithExtraParam("itopk_size", params.itopkSize)
+		annParam.WithExtraParam("search_width", params.searchWidth)
+		return annParam
+	default:
+		return nil
+	}
+}
+
+// withEffort returns the search parameters with the search effort of the index type replaced by effort.
+func (params IndexSearchParameters) withEffort(indexType string, effort int) IndexSearchParameters {
+	switch indexType {
+	case indexTypeHNSW:
+		params.ef = effort
+	case indexTypeGPUIvfFlat, indexTypeBinIvfFlat:
+		params.nprobe = effort
+	case indexTypeGPUCagra:
+		params.itopkSize = effort
+	}
+	return params
+}
+
+/**
+* checkSearchEffort fails early if Milvus would reject every HNSW search, since it requires ef to be at least the
+* search limit. This applies to the configured ef and every swept value.
+ */
+func checkSearchEffort(indexType string, params IndexSearchParameters, limit int) error {
+	if indexType != indexTypeHNSW {
+		return nil
+	}
+	for _, ef := range append([]int{params.ef}, params.effortSweep...) {
+		if ef > 0 && ef < limit {
+			return fmt.Errorf("ef %d is below the search limit %d, Milvus requires ef >= k", ef, limit)
+		}
+	}
+	return nil
+}
+
+// parseEffortSweep parses a comma-separated list of positive search efforts.
+func parseEffortSweep(value string) ([]int, error) {
+	var efforts []int
+	for _, part := range strings.Split(value, ",") {
+		effort, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if effort <= 0 {
+			return nil, fmt.Errorf("search effort must be positive, got %d", effort)
+		}
+		efforts = append(efforts, effort)
+	}
+	return efforts, nil
+}
+
+// annParamFor returns the index-specific search parameters of a query with the search effort, 0 uses annParam.
+func (p *SearchParameters) annParamFor(effort int) index.AnnParam {
+	if effort == 0 {
+		return p.annParam
+	}
+	return buildAnnParam(p.indexType, p.indexSearchParams.withEffort(p.indexType, effort))
+}
+
+// indexNameOf returns the name of the index on the given field.
+func indexNameOf(c *milvusclient.Client, ctx context.Context, collection string, fieldName string) (string, error) {
+	indexNames, err := c.ListIndexes(ctx, milvusclient.NewListIndexOption(collection).WithFieldName(fieldName))
+	if err != nil {
+		return "", err
+	}
+	if len(indexNames) == 0 {
+		return "", fmt.Errorf("no index found on field %s", fieldName)
+	}
+	return indexNames[0], nil
+}
+
+/**
+* logIndexType reports the index type and parameters Milvus actually built on the field, and warns if they differ
+* from the requested ones. A GPU index silently replaced by a CPU index would invalidate a GPU vs CPU comparison.
+ */
+func logIndexType(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	fieldName string,
+	params ConstructionIndexParameters,
+	logger *Logger,
+) error {
+	expected, err := buildIndex(params)
+	if err != nil {
+		return err
+	}
+	indexName, err := indexNameOf(c, ctx, collection, fieldName)
+	if err != nil {
+		return err
+	}
+	description, err := c.DescribeIndex(ctx, milvusclient.NewDescribeIndexOption(collection, indexName))
+	if err != nil {
+		return err
+	}
+
+	actual := description.Params()
+	actualType := actual[index.IndexTypeKey]
+	searchPath := "CPU"
+	if isGPUIndex(actualType) {
+		searchPath = "GPU"
+	}
+	logger.Logf("%s search path active: index %s on field %s is of type %s with %s",
+		searchPath, indexName, fieldName, actualType, formatIndexParams(actual))
+	if actualType != params.indexType {
+		logger.Warnf("Warning: requested index type %s but Milvus reports %s on field %s", params.indexType, actualType, fieldName)
+	} else if err := compareIndexParams(expected.Params(), actual); err != nil {
+		logger.Warnf("Warning: index %s on field %s: %v", indexName, fieldName, err)
+	}
+	return nil
+}
+
+// formatIndexParams formats the parameters of an index description besides its type, sorted by key.
+func formatIndexParams(params map[string]string) string {
+	var pairs []string
+	for key, value := range params {
+		if key != index.IndexTypeKey {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, " ")
+}
+
+/**
+* validateExistingIndex asserts that the index on the field was built with the configured index parameters.
+* Milvus may report the build parameters either flat or JSON-encoded in a params entry.
+ */
+func validateExistingIndex(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	fieldName string,
+	params ConstructionIndexParameters,
+) error {
+	expected, err := buildIndex(params)
+	if err != nil {
+		return err
+	}
+	indexName, err := indexNameOf(c, ctx, collection, fieldName)
+	if err != nil {
+		return err
+	}
+	description, err := c.DescribeIndex(ctx, milvusclient.NewDescribeIndexOption(collection, indexName))
+	if err != nil {
+		return err
+	}
+	return compareIndexParams(expected.Params(), description.Params())
+}
+
+// compareIndexParams returns an error naming the first expected parameter the actual index differs in.
+func compareIndexParams(expected map[string]string, actual map[string]string) error {
+	nested := make(map[string]any)
+	if encoded, ok := actual["params"]; ok {
+		// Not every version encodes the params, a failure leaves them to the flat entries
+		_ = json.Unmarshal([]byte(encoded), &nested)
+	}
+	for key, value := range expected {
+		actualValue, ok := actual[key]
+		if !ok {
+			if nestedValue, found := nested[key]; found {
+				actualValue, ok = fmt.Sprint(nestedValue), true
+			}
+		}
+		if !ok || actualValue != value {
+			return fmt.Errorf("index does not match the configuration: %s is %q, expected %q", key, actualValue, value)
+		}
+	}
+	return nil
+}
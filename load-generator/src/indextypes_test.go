@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/index"
+)
+
+func TestBuildIndex_GPUCagra(t *testing.T) {
+	idx, err := buildIndex(ConstructionIndexParameters{
+		indexType:               indexTypeGPUCagra,
+		distanceMetric:          "L2",
+		intermediateGraphDegree: 128,
+		graphDegree:             64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := idx.Params()
+	if params[index.IndexTypeKey] != indexTypeGPUCagra || params["graph_degree"] != "64" ||
+		params["intermediate_graph_degree"] != "128" {
+		t.Errorf("Unexpected index parameters: %v", params)
+	}
+}
+
+func TestBuildIndex_BinIvfFlat(t *testing.T) {
+	idx, err := buildIndex(ConstructionIndexParameters{
+		indexType:      indexTypeBinIvfFlat,
+		distanceMetric: metricHamming,
+		nlist:          256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := idx.Params()
+	if params[index.IndexTypeKey] != indexTypeBinIvfFlat || params[index.MetricTypeKey] != metricHamming || params["nlist"] != "256" {
+		t.Errorf("Unexpected index parameters: %v", params)
+	}
+}
+
+func TestCompareIndexParams(t *testing.T) {
+	expected := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "L2", "M": "16"}
+
+	flat := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "L2", "M": "16"}
+	if err := compareIndexParams(expected, flat); err != nil {
+		t.Errorf("Expected flat params to match: %v", err)
+	}
+	nested := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "L2", "params": `{"M":16}`}
+	if err := compareIndexParams(expected, nested); err != nil {
+		t.Errorf("Expected nested params to match: %v", err)
+	}
+	mismatch := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "IP", "M": "16"}
+	if err := compareIndexParams(expected, mismatch); err == nil {
+		t.Error("Expected error for a different metric")
+	}
+	missing := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "L2"}
+	if err := compareIndexParams(expected, missing); err == nil {
+		t.Error("Expected error for a missing parameter")
+	}
+}
+
+func TestFormatIndexParams(t *testing.T) {
+	params := map[string]string{index.IndexTypeKey: indexTypeHNSW, index.MetricTypeKey: "L2", "M": "16", "efConstruction": "200"}
+	if formatted := formatIndexParams(params); formatted != "M=16 efConstruction=200 metric_type=L2" {
+		t.Errorf("Expected the sorted params without the type, got %q", formatted)
+	}
+}
+
+func TestBuildIndex_Unsupported(t *testing.T) {
+	if _, err := buildIndex(ConstructionIndexParameters{indexType: "DISKANN"}); err == nil {
+		t.Error("Expected error for unsupported index type")
+	}
+}
+
+func TestBuildAnnParam(t *testing.T) {
+	searchParams := IndexSearchParameters{nprobe: 8, itopkSize: 32, searchWidth: 2}
+
+	if annParam := buildAnnParam(indexTypeHNSW, searchParams); annParam != nil {
+		t.Errorf("Expected default search parameters for HNSW, got %v", annParam.Params())
+	}
+	if nprobe := buildAnnParam(indexTypeGPUIvfFlat, searchParams).Params()["nprobe"]; nprobe != 8 {
+		t.Errorf("Expected nprobe 8, got %v", nprobe)
+	}
+	cagra := buildAnnParam(indexTypeGPUCagra, searchParams).Params()
+	if cagra["itopk_size"] != 32 || cagra["search_width"] != 2 {
+		t.Errorf("Unexpected GPU_CAGRA search parameters: %v", cagra)
+	}
+}
+
+func TestSearchParameters_AnnParamForEffort(t *testing.T) {
+	searchParams := IndexSearchParameters{ef: 400, nprobe: 8, itopkSize: 32, searchWidth: 2}
+	hnsw := &SearchParameters{indexType: indexTypeHNSW, indexSearchParams: searchParams,
+		annParam: buildAnnParam(indexTypeHNSW, searchParams)}
+
+	if ef := hnsw.annParamFor(0).Params()["ef"]; ef != 400 {
+		t.Errorf("Expected the configured ef 400 without an effort, got %v", ef)
+	}
+	if ef := hnsw.annParamFor(64).Params()["ef"]; ef != 64 {
+		t.Errorf("Expected ef 64, got %v", ef)
+	}
+	ivf := &SearchParameters{indexType: indexTypeGPUIvfFlat, indexSearchParams: searchParams}
+	if nprobe := ivf.annParamFor(32).Params()["nprobe"]; nprobe != 32 {
+		t.Errorf("Expected nprobe 32, got %v", nprobe)
+	}
+	cagra := &SearchParameters{indexType: indexTypeGPUCagra, indexSearchParams: searchParams}
+	if params := cagra.annParamFor(128).Params(); params["itopk_size"] != 128 || params["search_width"] != 2 {
+		t.Errorf("Expected itopk_size 128 with the configured search width, got %v", params)
+	}
+}
+
+func TestParseEffortSweep(t *testing.T) {
+	efforts, err := parseEffortSweep("16, 32,64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(efforts) != 3 || efforts[0] != 16 || efforts[2] != 64 {
+		t.Errorf("Unexpected efforts: %v", efforts)
+	}
+	for _, value := range []string{"16,abc", "16,0"} {
+		if _, err := parseEffortSweep(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestCheckSearchEffort(t *testing.T) {
+	if err := checkSearchEffort(indexTypeHNSW, IndexSearchParameters{ef: 400}, 10); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkSearchEffort(indexTypeHNSW, IndexSearchParameters{ef: 5}, 10); err == nil {
+		t.Error("Expected error for ef below k")
+	}
+	if err := checkSearchEffort(indexTypeHNSW, IndexSearchParameters{ef: 400, effortSweep: []int{8, 64}}, 10); err == nil {
+		t.Error("Expected error for a swept ef below k")
+	}
+	if err := checkSearchEffort(indexTypeGPUIvfFlat, IndexSearchParameters{nprobe: 4}, 10); err != nil {
+		t.Errorf("Expected nprobe to be independent of k, got %v", err)
+	}
+}
+
+func TestCheckHNSWParameters(t *testing.T) {
+	cases := []struct {
+		M, efConstruction int
+		valid             bool
+	}{
+		{16, 200, true},
+		{hnswMinM, hnswMinM, true},
+		{hnswMaxM, hnswMaxM, true},
+		{1, 200, false},
+		{hnswMaxM + 1, 4096, false},
+		{-16, 200, false},
+		{16, 15, false},
+		{16, 0, false},
+	}
+	for _, c := range cases {
+		err := checkHNSWParameters(c.M, c.efConstruction)
+		if c.valid && err != nil {
+			t.Errorf("M %d, efConstruction %d: unexpected error %v", c.M, c.efConstruction, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("M %d, efConstruction %d: expected an error", c.M, c.efConstruction)
+		}
+	}
+}
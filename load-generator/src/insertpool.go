@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+/**
+* insertPool inserts the batches of the streamed dataset with several workers at once, so that the preparation is
+* not bound by the latency of a single insert request.
+* The first failed insert cancels the remaining ones and is returned by submit and wait.
+ */
+type insertPool struct {
+	batches chan []DataRow
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+	done    chan struct{} // closed on the first error
+}
+
+func newInsertPool(ctx context.Context, workers int, insert func(ctx context.Context, batch []DataRow) error) *insertPool {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &insertPool{
+		batches: make(chan []DataRow),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	for range max(1, workers) {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for batch := range p.batches {
+				if err := insert(ctx, batch); err != nil {
+					p.fail(err)
+					return
+				}
+			}
+		}()
+	}
+	return p
+}
+
+func (p *insertPool) fail(err error) {
+	p.errOnce.Do(func() {
+		p.err = err
+		p.cancel()
+		close(p.done)
+	})
+}
+
+// submit hands the batch to the next idle worker, it returns the error of a failed insert instead.
+func (p *insertPool) submit(batch []DataRow) error {
+	select {
+	case p.batches <- batch:
+		return nil
+	case <-p.done:
+		return p.err
+	}
+}
+
+// wait returns once all submitted batches are inserted, submit must not be called afterwards.
+func (p *insertPool) wait() error {
+	close(p.batches)
+	p.wg.Wait()
+	p.cancel()
+	return p.err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestInsertPool_InsertsEveryRowOnce(t *testing.T) {
+	for _, workers := range []int{1, 3, 8} {
+		var mu sync.Mutex
+		inserted := make(map[int64]int)
+		pool := newInsertPool(context.Background(), workers, func(ctx context.Context, batch []DataRow) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, row := range batch {
+				inserted[row.Id]++
+			}
+			return nil
+		})
+
+		for start := int64(0); start < 1000; start += 10 {
+			batch := make([]DataRow, 10)
+			for i := range batch {
+				batch[i].Id = start + int64(i)
+			}
+			if err := pool.submit(batch); err != nil {
+				t.Fatalf("%d workers: unexpected error %v", workers, err)
+			}
+		}
+		if err := pool.wait(); err != nil {
+			t.Fatalf("%d workers: unexpected error %v", workers, err)
+		}
+
+		if len(inserted) != 1000 {
+			t.Errorf("%d workers: expected 1000 rows, got %d", workers, len(inserted))
+		}
+		for id, count := range inserted {
+			if count != 1 {
+				t.Errorf("%d workers: row %d inserted %d times", workers, id, count)
+			}
+		}
+	}
+}
+
+func TestInsertPool_PropagatesError(t *testing.T) {
+	failure := errors.New("insert failed")
+	pool := newInsertPool(context.Background(), 4, func(ctx context.Context, batch []DataRow) error {
+		if batch[0].Id == 3 {
+			return failure
+		}
+		return nil
+	})
+
+	var submitErr error
+	for id := int64(0); id < 100 && submitErr == nil; id++ {
+		submitErr = pool.submit([]DataRow{{Id: id}})
+	}
+
+	if err := pool.wait(); !errors.Is(err, failure) {
+		t.Errorf("Expected the insert error from wait, got %v", err)
+	}
+	if submitErr != nil && !errors.Is(submitErr, failure) {
+		t.Errorf("Expected submit to fail with the insert error, got %v", submitErr)
+	}
+}
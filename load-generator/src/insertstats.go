@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const insertStatsFile = "insert-stats.csv"
+
+// InsertRequest records a single insert request of the preparation.
+type InsertRequest struct {
+	Start     time.Time
+	Partition int // partition the rows were inserted into, 0 without partitions
+	Rows      int
+	Latency   time.Duration
+}
+
+/**
+* insertRecorder measures the ingestion performance of the preparation, e.g. to compare insert batch sizes.
+* It is safe for concurrent use.
+ */
+type insertRecorder struct {
+	mu          sync.Mutex
+	start       time.Time
+	rows        int
+	busy        time.Duration // sum of the insert latencies, exceeds the wall-clock time with concurrent inserts
+	keepResults bool          // keep every request for the CSV, otherwise only the totals are kept
+	requests    []InsertRequest
+}
+
+func newInsertRecorder(keepResults bool) *insertRecorder {
+	return &insertRecorder{start: time.Now(), keepResults: keepResults}
+}
+
+func (r *insertRecorder) record(start time.Time, partition int, rows int) {
+	if r == nil {
+		return
+	}
+	latency := time.Since(start)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows += rows
+	r.busy += latency
+	if r.keepResults {
+		r.requests = append(r.requests, InsertRequest{Start: start, Partition: partition, Rows: rows, Latency: latency})
+	}
+}
+
+/**
+* logSummary reports the insert rate over the wall-clock time of the insert phase as well as over the time spent in
+* insert requests only, the difference is spent reading and persisting the dataset.
+ */
+func (r *insertRecorder) logSummary(logger *Logger) {
+	elapsed := time.Since(r.start)
+	logger.Logf("Insert completed: %d rows in %v (%.0f rows/s)", r.rows, elapsed, float64(r.rows)/elapsed.Seconds())
+	if r.busy > 0 {
+		logger.Logf("Insert requests took %v in total (%.0f rows/s)", r.busy, float64(r.rows)/r.busy.Seconds())
+	}
+}
+
+func (l *Logger) LogInsertStats(requests []InsertRequest) error {
+	var b strings.Builder
+	b.WriteString("timestamp,partition,rows,latency_ms,rows_per_s\n")
+	for _, request := range requests {
+		fmt.Fprintf(&b, "%s,%d,%d,%.3f,%.0f\n",
+			formatTimestamp(request.Start),
+			request.Partition,
+			request.Rows,
+			float64(request.Latency.Microseconds())/1000,
+			float64(request.Rows)/request.Latency.Seconds(),
+		)
+	}
+	return os.WriteFile(outputPath(insertStatsFile), []byte(b.String()), 0644)
+}
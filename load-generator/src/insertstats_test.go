@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInsertRecorder_Totals(t *testing.T) {
+	totals := newInsertRecorder(false)
+	perRequest := newInsertRecorder(true)
+	start := time.Now().Add(-10 * time.Millisecond)
+
+	for _, r := range []*insertRecorder{totals, perRequest} {
+		r.record(start, 0, 100)
+		r.record(start, 1, 50)
+	}
+
+	if totals.rows != 150 || totals.busy < 20*time.Millisecond || totals.requests != nil {
+		t.Errorf("Expected 150 rows in at least 20ms and no requests, got %d in %v / %v", totals.rows, totals.busy, totals.requests)
+	}
+	if len(perRequest.requests) != 2 || perRequest.requests[1].Partition != 1 || perRequest.requests[1].Rows != 50 {
+		t.Errorf("Unexpected requests %+v", perRequest.requests)
+	}
+}
+
+func TestLogInsertStats(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	requests := []InsertRequest{{Start: time.Now(), Partition: 2, Rows: 1000, Latency: 250 * time.Millisecond}}
+	if err := logger.LogInsertStats(requests); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(insertStatsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], ",2,1000,250.000,4000") {
+		t.Errorf("Unexpected insert statistics:\n%s", data)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/milvus-io/milvus/client/v2/column"
 	"github.com/milvus-io/milvus/client/v2/entity"
+	"github.com/milvus-io/milvus/client/v2/index"
 	"github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
@@ -21,15 +25,65 @@ type ArrivalController struct {
 	dim              int // dim is not part of the JobGenerationParameters because it is used in many places
 	gen              *rand.Rand
 	continuationChan chan *UserSession
+	rate             *adaptiveRate   // nil unless the arrival rate adapts to rate limits
+	shedder          *latencyShedder // nil unless the client sheds load based on the observed latency
+	phases           []BenchmarkPhase
+	phase            int                 // index of the current phase, only accessed by the arrival goroutine
+	schedule         LoadSchedule        // targetQPS over time, the targetQPS of the phases unless configured
+	elapsed          time.Duration       // time since the arrivals started, only accessed by the arrival goroutine
+	partitions       *partitionChooser   // nil if queries search all partitions
+	filters          *filterGenerator    // nil if no query is filtered
+	vectorFields     *vectorFieldChooser // nil if all queries search vecFieldName
+	searchEfforts    []int               // search efforts the queries cycle through, sessions keep theirs throughout
+	replay           *replayQueue        // workloads of a previous run issued instead of generated ones, nil generates them
+	drift            driftModel          // how the follow-up queries of sessions follow from the results
+	sessions         *sessionLimiter     // bounds the sessions in flight, nil if unbounded
+	cappedSessions   int                 // sessions replaced by jobs because the limit of sessions in flight was reached
+	clock            arrivalClock        // time source of the arrival schedule, the wall clock outside of tests
 
 	// Counters for Id generation
-	jobCounter     int
-	sessionCounter int
+	jobCounter      int
+	sessionCounter  int
+	hybridCounter   int
+	mutationCounter int
+	effortCounter   int
 }
 
 type TimedWorkload struct {
 	Work          Workload
 	ScheduledTime time.Time // Captures the wait time until a worker was able to pick up the work
+	Stage         int       // Concurrency stage during which the work arrived
+	Phase         int       // Benchmark phase during which the work arrived
+}
+
+/**
+* SearchParameters bundles the settings shared by all searches of a benchmark run.
+* If rerankFieldName is set, the approximate search runs on the quantized (float16) vecFieldName
+* and the top rerankCandidates are re-ranked using the full-precision vectors of rerankFieldName.
+ */
+type SearchParameters struct {
+	collection        string
+	vecFieldName      string
+	dim               int
+	k                 int
+	rerankFieldName   string
+	rerankCandidates  int
+	metric            string                // distance metric of the index, used for re-ranking
+	vectorType        string                // data type of the searched vector field, empty for float
+	filterExpr        string                // scalar filter applied to every search, empty disables filtering
+	outputFields      []string              // scalar fields returned with every result
+	recordCandidates  bool                  // keep the first-stage candidate ids of re-ranked searches
+	annParam          index.AnnParam        // index-specific search parameters, nil uses the Milvus defaults
+	indexType         string                // index type of the searched field, to apply the search effort of a query
+	indexSearchParams IndexSearchParameters // the configured search parameters annParam is built from
+	sampler           *debugSampler         // records the request and response of sampled queries, nil if disabled
+	metrics           *benchmarkMetrics     // live Prometheus metrics of the Poisson workers, nil if disabled
+	vectorFields      []string              // searchable vector fields with vecFieldName first, nil searches vecFieldName only
+	permutations      map[string][]int      // dimension permutation of the additional vector fields, see vectorFieldPermutations
+	hybridReranker    milvusclient.Reranker // fuses the sub-searches of hybrid jobs, nil if no hybrid jobs are generated
+	retries           int                   // how often a failed search is retried before the job fails
+	queryTimeout      time.Duration         // upper bound of a single search attempt, 0 waits until the benchmark ends
+	rows              rowSchema             // fields of the collection rows, addressed by mutation workloads
 }
 
 // Workload is the interface for executable benchmark work units.
@@ -37,12 +91,11 @@ type Workload interface {
 	Execute(
 		ctx context.Context,
 		c *milvusclient.Client,
-		collection string,
-		vecFieldName string,
-		dim int,
-		k int,
+		params *SearchParameters,
 		logger *Logger,
 		schedulingDelay time.Duration,
+		stage int,
+		phase int,
 	) (Workload, error)
 }
 
@@ -51,9 +104,23 @@ type Job struct {
 	Id              string // Unique identifier (for independent jobs: "J-{index}", for session jobs: "S-{sessionId}-{step}")
 	QueryVector     Vector
 	ResultIds       []int64
+	ResultStringIds []string  // Only set if the collection uses VarChar primary keys, recall requires int keys
+	ResultScores    []float32 // Distances or similarities reported by Milvus, in the order of the result ids
 	Latency         time.Duration
 	StartTimestamp  time.Time
 	SchedulingDelay time.Duration // Time between scheduled arrival and actual execution start
+	Stage           int           // Index of the concurrency stage the job was executed in
+	Phase           int           // Index of the benchmark phase the job was executed in
+	CandidateIds    []int64       // First-stage ids in approximate order, only set with re-ranking and rerankRecall
+	Retries         int           // Number of failed attempts before the search succeeded, included in the latency
+	Partitions      []int         // Partitions the search is restricted to, nil searches all partitions
+	Filter          string        // Scalar filter of this search on top of the configured filterExpr, empty if unfiltered
+	VectorField     string        // Vector field the search runs on, empty for vecFieldName, joined by "+" for hybrid jobs
+	SearchEffort    int           // ef, nprobe or itopkSize of a swept search, 0 if the configured value applies
+	TimedOut        bool          // the search exceeded the query timeout, the latency is the timeout and there are no results
+	PayloadBytes    int           // Size of the output fields returned with the results, including fetched vectors
+
+	perturbation Vector // noise added to QueryVector right before the search, nil if disabled
 }
 
 /**
@@ -68,30 +135,56 @@ type UserSession struct {
 	Jobs            []Job
 	StartTimestamp  time.Time
 	Duration        time.Duration
-	SchedulingDelay time.Duration // Time between scheduled arrival and actual execution start
+	SchedulingDelay time.Duration // Sum of the scheduling delays of all executed steps, see Job.SchedulingDelay for each step
+	Truncated       bool          // the benchmark ended before all steps were executed, only the executed steps have results
+	Dropped         bool          // the continuation backlog was full, only the executed steps have results
 
 	currentStep      int
 	continuationChan chan *UserSession
+	replayed         bool            // the queries of all steps are fixed instead of following the results, see LoadReplayWorkloads
+	normalizeQueries bool            // scale the follow-up queries to unit length, see JobGenerationParameters.normalizeQueries
+	drift            driftModel      // computes the follow-up queries, nil drifts additively
+	limiter          *sessionLimiter // released once the session ended, nil if sessions are not limited or replayed
 }
 
+/**
+* NewArrivalController creates the arrival controller of a benchmark run.
+* The continuation channel holds at least maxInFlightSessions sessions, so that sessions within the limit never wait
+* for room in it.
+ */
 func NewArrivalController(
 	jobGenParams JobGenerationParameters,
 	dim int,
+	numPartitions int,
 	seed int64,
 	continuationBufferSize int,
 ) *ArrivalController {
-	continuationChan := make(chan *UserSession, continuationBufferSize)
+	continuationChan := make(chan *UserSession, max(continuationBufferSize, jobGenParams.maxInFlightSessions))
+	// A separate generator keeps the generated queries identical to runs without partition selection
+	partitionGen := rand.New(rand.NewSource(seed))
+	// Same for the filters, offset so that filter and partition draws are not correlated
+	filterGen := rand.New(rand.NewSource(seed + 1))
 
 	return &ArrivalController{
 		jobGenParams:     jobGenParams,
 		dim:              dim,
 		gen:              rand.New(rand.NewSource(seed)),
 		continuationChan: continuationChan,
-		jobCounter:       0,
-		sessionCounter:   0,
+		phases:           resolvePhases(jobGenParams),
+		schedule:         resolveLoadSchedule(jobGenParams),
+		partitions: newPartitionChooser(partitionGen, numPartitions,
+			jobGenParams.partitionsPerQuery, jobGenParams.partitionDistribution),
+		filters: newFilterGenerator(filterGen, jobGenParams.filterProbability,
+			jobGenParams.filterTemplate, jobGenParams.filterMaxValue),
+		drift:          newDriftModel(jobGenParams),
+		sessions:       newSessionLimiter(jobGenParams.maxInFlightSessions),
+		clock:          wallClock{},
+		jobCounter:     0,
+		sessionCounter: 0,
 	}
 }
 
+// NextSleepDuration draws the exponentially distributed time from the previous arrival to the next one.
 func (ac *ArrivalController) NextSleepDuration() time.Duration {
 	// Exponential distribution: -ln(U) / lambda where U ~ Uniform(0,1)
 	u := ac.gen.Float64()
@@ -99,23 +192,91 @@ func (ac *ArrivalController) NextSleepDuration() time.Duration {
 	for u == 0 {
 		u = ac.gen.Float64()
 	}
-	interval := -math.Log(u) / ac.jobGenParams.targetQPS
+	interval := -math.Log(u) / (ac.currentTargetQPS() * ac.rate.Factor() * ac.shedder.Factor())
 	return time.Duration(interval * float64(time.Second))
 }
 
-// GenerateWorkload creates either a Job or SessionQuery (first query of a session) based on jobProbability
+// currentTargetQPS returns the target arrival rate of the load schedule at the current time of the arrivals.
+func (ac *ArrivalController) currentTargetQPS() float64 {
+	return ac.schedule.At(ac.elapsed)
+}
+
+/**
+* GenerateWorkload creates either a Job or SessionQuery (first query of a session) based on jobProbability.
+* With a hybridProbability, that fraction of the workloads are HybridJobs instead.
+* With a mutationProbability, that fraction of the workloads are MutationWorkloads instead of searches.
+ */
 func (ac *ArrivalController) GenerateWorkload() Workload {
-	if ac.gen.Float64() < ac.jobGenParams.jobProbability {
+	if ac.replay != nil {
+		return ac.nextReplayed()
+	}
+	// Only drawn if enabled, so that the generated workloads stay identical to runs without mutations
+	if ac.jobGenParams.mutationProbability > 0 && ac.gen.Float64() < ac.jobGenParams.mutationProbability {
+		return ac.generateMutation()
+	}
+	// Only drawn if enabled, so that the generated workloads stay identical to runs without hybrid jobs
+	if ac.jobGenParams.hybridProbability > 0 && ac.gen.Float64() < ac.jobGenParams.hybridProbability {
+		return ac.generateHybridJob()
+	}
+	if ac.gen.Float64() < ac.phases[ac.phase].jobProbability {
+		return ac.generateJob()
+	}
+	if !ac.sessions.tryAcquire() {
+		// Another session could fill the continuation backlog, so the arrival is issued as a job instead
+		ac.cappedSessions++
 		return ac.generateJob()
 	}
 	return ac.generateSession()
 }
 
+// generateQuery draws an independent query or the first query of a session.
+func (p JobGenerationParameters) generateQuery(generator *rand.Rand, dim int) Vector {
+	if p.normalizeQueries {
+		return GenerateUnitVector(generator, dim, p.workloadStdDev, p.workloadMean)
+	}
+	return GenerateVector(generator, dim, p.workloadStdDev, p.workloadMean)
+}
+
 func (ac *ArrivalController) generateJob() *Job {
-	query := GenerateVector(ac.gen, ac.dim, ac.jobGenParams.workloadStdDev, ac.jobGenParams.workloadMean)
+	query := ac.jobGenParams.generateQuery(ac.gen, ac.dim)
 	jobId := fmt.Sprintf("J-%d", ac.jobCounter)
 	ac.jobCounter++
-	return &Job{Id: jobId, QueryVector: query}
+	return &Job{
+		Id:           jobId,
+		QueryVector:  query,
+		Partitions:   ac.partitions.choose(),
+		Filter:       ac.filters.generate(),
+		VectorField:  ac.vectorFields.choose(),
+		SearchEffort: ac.nextSearchEffort(),
+		perturbation: ac.generatePerturbation(),
+	}
+}
+
+// nextReplayed returns the next workload of the replayed run, nil once all were issued.
+func (ac *ArrivalController) nextReplayed() Workload {
+	work := ac.replay.pop()
+	if session, ok := work.(*UserSession); ok {
+		session.continuationChan = ac.continuationChan
+	}
+	return work
+}
+
+// nextSearchEffort cycles through the search efforts of the sweep, 0 if no sweep is configured.
+func (ac *ArrivalController) nextSearchEffort() int {
+	if len(ac.searchEfforts) == 0 {
+		return 0
+	}
+	effort := ac.searchEfforts[ac.effortCounter%len(ac.searchEfforts)]
+	ac.effortCounter++
+	return effort
+}
+
+// generatePerturbation draws the query noise for a single search, or nil if perturbation is disabled.
+func (ac *ArrivalController) generatePerturbation() Vector {
+	if ac.jobGenParams.perturbationStdDev <= 0 {
+		return nil
+	}
+	return GenerateVector(ac.gen, ac.dim, ac.jobGenParams.perturbationStdDev, 0.0)
 }
 
 func (ac *ArrivalController) generateSession() *UserSession {
@@ -123,17 +284,29 @@ func (ac *ArrivalController) generateSession() *UserSession {
 	maxLen := ac.jobGenParams.maxSessionLength
 	sessionLength := ac.gen.Intn(maxLen-minLen+1) + minLen
 	jobs := make([]Job, sessionLength)
+	partitions := ac.partitions.choose()
+	filter := ac.filters.generate()
+	vectorField := ac.vectorFields.choose()
+	searchEffort := ac.nextSearchEffort()
 
 	for j := range sessionLength {
 		var query []float32
 		// The first query uses the same distribution as independent jobs, follow-up offsets use a different distribution
 		if j == 0 {
-			query = GenerateVector(ac.gen, ac.dim, ac.jobGenParams.workloadStdDev, ac.jobGenParams.workloadMean)
+			query = ac.jobGenParams.generateQuery(ac.gen, ac.dim)
 		} else {
 			query = GenerateVector(ac.gen, ac.dim, ac.jobGenParams.followUpStdDev, ac.jobGenParams.followUpMean)
 		}
 		jobId := fmt.Sprintf("S-%d-%d", ac.sessionCounter, j)
-		jobs[j] = Job{Id: jobId, QueryVector: query}
+		jobs[j] = Job{
+			Id:           jobId,
+			QueryVector:  query,
+			Partitions:   partitions,
+			Filter:       filter,
+			VectorField:  vectorField,
+			SearchEffort: searchEffort,
+			perturbation: ac.generatePerturbation(),
+		}
 	}
 
 	session := &UserSession{
@@ -141,131 +314,596 @@ func (ac *ArrivalController) generateSession() *UserSession {
 		Jobs:             jobs,
 		currentStep:      0,
 		continuationChan: ac.continuationChan,
+		normalizeQueries: ac.jobGenParams.normalizeQueries,
+		drift:            ac.drift,
+		limiter:          ac.sessions,
 	}
 	ac.sessionCounter++
 	return session
 }
 
+/**
+* workerPool manages a dynamically sized set of workers consuming from the same work channel.
+* Shrinking the pool stops the most recently started workers once they finished their current work.
+* The pool must only be resized from a single goroutine.
+ */
+type workerPool struct {
+	wg     sync.WaitGroup
+	stops  []chan struct{}
+	nextId int
+	work   func(workerId int, stop <-chan struct{})
+}
+
+func newWorkerPool(work func(workerId int, stop <-chan struct{})) *workerPool {
+	return &workerPool{work: work}
+}
+
+// resize starts or stops workers until exactly n workers are active.
+func (p *workerPool) resize(n int) {
+	for len(p.stops) < n {
+		stop := make(chan struct{})
+		p.stops = append(p.stops, stop)
+		p.wg.Add(1)
+		go func(workerId int) {
+			defer p.wg.Done()
+			p.work(workerId, stop)
+		}(p.nextId)
+		p.nextId++
+	}
+	for len(p.stops) > n {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
+	}
+}
+
+func (p *workerPool) size() int {
+	return len(p.stops)
+}
+
+// wait blocks until all workers, including stopped ones, have returned.
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
+
 /**
 * ExecuteWorkloadPoisson runs workloads concurrently with Poisson-distributed arrivals.
+* The number of active workers follows the given concurrency stages, which run back to back.
 * It returns the executed Jobs and UserSessions to enable recall analysis.
  */
 func ExecuteWorkloadPoisson(
 	ac *ArrivalController,
 	c *milvusclient.Client,
-	collection string,
-	vecFieldName string,
-	dim int,
-	k int,
+	ctx context.Context,
+	params *SearchParameters,
 	logger *Logger,
-	numWorkers int,
-) ([]Job, []UserSession) {
-	workChan := make(chan TimedWorkload, numWorkers*2)
+	stages []ConcurrencyStage,
+	reportArrivalStats bool,
+	adaptToRateLimits bool,
+	sheddingThreshold time.Duration,
+	overloadPolicy string,
+	throughputWindow time.Duration,
+	collector *resultCollector,
+) ([]Job, []UserSession, ExecutionStats) {
+	workChan := make(chan TimedWorkload, maxStageWorkers(stages)*2)
 
-	// Allows to communicate benchmark end to workers
-	ctx, cancel := context.WithCancel(context.Background())
+	// Allows to communicate benchmark end to workers, an interrupt of the parent context ends the benchmark early
+	ctx, cancel := context.WithCancel(ctx)
 
-	var mu sync.Mutex
-	var executedJobs []Job
-	var executedSessions []UserSession
+	var arrivals arrivalRecorder
+	var dropped atomic.Int64
+	var lastDropWarning time.Time // only accessed by the arrival goroutine
+	var timeouts atomic.Int64
+	var truncatedInFlight atomic.Int64 // sessions interrupted by the end of the benchmark while executing a step
+	searchErrors := newSearchErrorCounter()
+	throughput := newThroughputRecorder(time.Now(), throughputWindow)
+	if adaptToRateLimits {
+		ac.rate = newAdaptiveRate()
+	}
+	if sheddingThreshold > 0 {
+		ac.shedder = newLatencyShedder(sheddingThreshold, time.Now())
+	}
 
 	/* Worker goroutines */
-	var wg sync.WaitGroup
-	for i := range numWorkers {
-		wg.Add(1)
-		go func(workerId int) {
-			defer wg.Done()
-			for timedWork := range workChan {
-				actualStart := time.Now()
-				schedulingDelay := actualStart.Sub(timedWork.ScheduledTime)
-
-				res, err := timedWork.Work.Execute(
-					ctx,
-					c,
-					collection,
-					vecFieldName,
-					dim,
-					k,
-					logger,
-					schedulingDelay,
-				)
-				if err != nil && err != context.Canceled { // Errors are expected on benchmark end
-					logger.Logf("Worker %d: error executing work: %v", workerId, err)
-					continue
+	pool := newWorkerPool(func(workerId int, stop <-chan struct{}) {
+		for {
+			var timedWork TimedWorkload
+			select {
+			case <-stop:
+				return
+			case work, ok := <-workChan:
+				if !ok {
+					return
 				}
+				timedWork = work
+			}
+			actualStart := time.Now()
+			schedulingDelay := actualStart.Sub(timedWork.ScheduledTime)
 
-				if res == nil {
-					// Continuation enqueued, skip collecting result
-					continue
+			if mutation, ok := timedWork.Work.(*MutationWorkload); ok {
+				// Recorded apart from the searches, so that the writes do not distort the search statistics
+				res, err := mutation.Execute(ctx, c, params, logger, schedulingDelay, timedWork.Stage, timedWork.Phase)
+				if err == nil {
+					throughput.recordCompletion(actualStart)
+					collector.add(res)
 				}
+				continue
+			}
 
-				// Collect results
-				mu.Lock()
-				switch r := res.(type) {
-				case *Job:
-					executedJobs = append(executedJobs, *r)
-				case *UserSession:
-					executedSessions = append(executedSessions, *r)
-				}
-				mu.Unlock()
+			finishQuery := params.metrics.startQuery()
+			res, err := timedWork.Work.Execute(
+				ctx,
+				c,
+				params,
+				logger,
+				schedulingDelay,
+				timedWork.Stage,
+				timedWork.Phase,
+			)
+			finishQuery(time.Since(actualStart), err)
+			searchErrors.record(ctx, err)
+			if ac.shedder != nil && err == nil && ac.shedder.record(time.Since(actualStart), time.Now()) {
+				logger.Logf("Observed latency above %v, shedding load to %.0f%% of targetQPS",
+					sheddingThreshold, ac.shedder.Factor()*100)
+			}
+			if ac.rate != nil && ac.rate.record(err, time.Now()) {
+				logger.Logf("Rate limited by Milvus, reducing arrival rate to %.0f%% of targetQPS",
+					ac.rate.Factor()*100)
+			}
+			if isQueryTimeout(err) {
+				timeouts.Add(1)
+				collector.add(res) // reported with the timeout as latency
+				continue
+			}
+			if ac.rate != nil && isRateLimitError(err) {
+				continue // reported through the adaptive rate instead of one log line per rejected query
+			}
+			if err != nil && err != context.Canceled { // Errors are expected on benchmark end
+				logger.Errorf("Worker %d: error executing work: %v", workerId, err)
+				continue
+			}
+			if isTruncatedSession(res) {
+				truncatedInFlight.Add(1)
+			}
+			if err == nil {
+				throughput.recordCompletion(actualStart)
 			}
-		}(i)
-	}
+
+			if res == nil {
+				// Continuation enqueued, skip collecting result
+				continue
+			}
+
+			collector.add(res)
+		}
+	})
+	pool.resize(stages[0].workers)
 
 	/* Arrival goroutine */
+	arrivalDone := make(chan struct{})
 	go func() {
+		defer close(arrivalDone)
 		defer close(workChan)
-		startTime := time.Now()
-		duration := ac.jobGenParams.benchmarkDuration
+		ac.runArrivals(
+			ctx,
+			stages,
+			func(stage int) {
+				pool.resize(stages[stage].workers)
+				logger.Logf("Entering concurrency stage %d: %d workers for %v",
+					stage, pool.size(), stages[stage].duration)
+			},
+			func(phase int) {
+				logger.Logf("Entering benchmark phase %d (%s): targetQPS=%.2f, jobProbability=%.2f for %v",
+					phase, ac.phases[phase].name, ac.currentTargetQPS(), ac.phases[phase].jobProbability,
+					ac.phases[phase].duration)
+			},
+			func(work TimedWorkload) {
+				arrivals.record(work.ScheduledTime)
+				throughput.recordArrival(work.ScheduledTime, ac.currentTargetQPS())
+				if overloadPolicy == overloadPolicyBlock {
+					select {
+					case workChan <- work:
+					case <-ctx.Done():
+					}
+					return
+				}
+				// Waiting for a free worker would stall the arrival schedule, so the arrival is dropped right away
+				select {
+				case workChan <- work:
+				default:
+					dropped.Add(1)
+					params.metrics.recordDrop()
+					throughput.recordDrop(work.ScheduledTime)
+					if work.ScheduledTime.Sub(lastDropWarning) >= dropWarningInterval {
+						lastDropWarning = work.ScheduledTime
+						logger.Warnf("Warning: all workers are busy, dropped %d workloads so far", dropped.Load())
+					}
+				}
+			},
+		)
+		if ctx.Err() != nil {
+			logger.Log("Benchmark interrupted, stopping arrivals")
+		} else {
+			logger.Log("Benchmark duration reached, stopping arrivals")
+		}
+		cancel()
+	}()
 
-		for {
-			sleepTime := ac.NextSleepDuration()
-			time.Sleep(sleepTime)
+	// Wait for all workers to complete remaining work, workers are only started while arrivals run
+	<-arrivalDone
+	pool.wait()
 
-			// Check if the benchmark duration is already over
-			if time.Since(startTime) >= duration {
-				logger.Log("Benchmark duration reached, stopping arrivals")
-				cancel()
-				return
-			}
+	// Sessions still waiting for their next step are recorded with the steps they executed
+	truncated := ac.collectPendingContinuations(collector, logger)
+	executedJobs, executedSessions, segments := collector.results()
+	logger.Logf("Executed %d jobs and %d sessions", len(executedJobs), len(executedSessions))
+
+	stats := ExecutionStats{
+		SpilledSegments:   segments,
+		DroppedWorkloads:  int(dropped.Load()),
+		TimedOutQueries:   int(timeouts.Load()),
+		TruncatedSessions: truncated + int(truncatedInFlight.Load()),
+		CappedSessions:    ac.cappedSessions,
+		SearchErrors:      searchErrors.byCategory(),
+		Mutations:         collector.mutationStats(),
+	}
+	logTruncatedSessions(logger, stats.TruncatedSessions)
+	logTimeouts(logger, stats.TimedOutQueries)
+	logCappedSessions(logger, stats.CappedSessions)
+	logSearchErrors(logger, stats.SearchErrors)
+	logMutations(logger, stats.Mutations)
+	if stats.DroppedWorkloads > 0 {
+		logger.Warnf("Dropped %d workloads because all workers were busy, the achieved QPS is below the target",
+			stats.DroppedWorkloads)
+	}
+	if segments > 0 {
+		logger.Logf("Spilled the results to %d segments", segments)
+	}
+	if reportArrivalStats {
+		arrivalStats := arrivals.stats(ac.schedule.Mean(totalStageDuration(stages)))
+		logger.Logf("Measured arrival rate %.2f QPS (target %.2f QPS) over %d arrivals: %s",
+			arrivalStats.MeasuredQPS, arrivalStats.TargetQPS, arrivalStats.Arrivals, arrivalStats.Note)
+		stats.Arrivals = &arrivalStats
+	}
+	if series := throughput.series(); series != nil {
+		if err := logger.LogThroughput(series, throughputWindow); err != nil {
+			logger.Errorf("Failed to write the throughput time series: %v", err)
+		}
+	}
+	if samples := params.sampler.collected(); samples != nil {
+		if err := logger.LogDebugSamples(samples); err != nil {
+			logger.Errorf("Failed to write debug samples: %v", err)
+		}
+	}
+	if ac.rate != nil {
+		rateStats := ac.rate.stats(ac.currentTargetQPS())
+		logger.Logf("Cluster sustains ~%.2f QPS for this collection: %d rate-limited queries, %d backoffs",
+			rateStats.SustainableQPS, rateStats.RateLimitedQueries, rateStats.Backoffs)
+		stats.RateLimit = &rateStats
+	}
+	if ac.shedder != nil {
+		sheddingStats := ac.shedder.stats(ac.schedule)
+		logger.Logf("Client shed load %d times, ending at %.0f%% of targetQPS after %d adjustments",
+			sheddingStats.Backoffs, sheddingStats.FinalFactor*100, len(sheddingStats.Trajectory))
+		stats.LoadShedding = &sheddingStats
+	}
+	return executedJobs, executedSessions, stats
+}
+
+/**
+* ExecuteWorkloadClosedLoop runs workloads back to back without inter-arrival times, so that every worker
+* issues its next query as soon as the previous one completed. This measures the throughput ceiling of the
+* cluster for the given concurrency, whereas the Poisson arrivals measure the latency at a given load.
+* The job mix follows the benchmark phases and the number of workers the concurrency stages.
+ */
+func ExecuteWorkloadClosedLoop(
+	ac *ArrivalController,
+	c *milvusclient.Client,
+	ctx context.Context,
+	params *SearchParameters,
+	logger *Logger,
+	stages []ConcurrencyStage,
+	collector *resultCollector,
+) ([]Job, []UserSession, ExecutionStats) {
+	ctx, cancel := context.WithTimeout(ctx, totalStageDuration(stages))
+	defer cancel()
+	startTime := time.Now()
+	var timeouts atomic.Int64
+	var truncatedInFlight atomic.Int64 // sessions interrupted by the end of the benchmark while executing a step
+	searchErrors := newSearchErrorCounter()
+
+	// The arrival controller is not safe for concurrent use, so workers take turns generating their next workload
+	var generateMu sync.Mutex
+	next := func() TimedWorkload {
+		generateMu.Lock()
+		defer generateMu.Unlock()
+		elapsed := time.Since(startTime)
+		if phase := phaseAt(ac.phases, elapsed); phase != ac.phase {
+			ac.phase = phase
+			logger.Logf("Entering benchmark phase %d (%s): jobProbability=%.2f for %v",
+				phase, ac.phases[phase].name, ac.phases[phase].jobProbability, ac.phases[phase].duration)
+		}
+		// Prioritize continuations over new workloads
+		var work Workload
+		select {
+		case continuation := <-ac.continuationChan:
+			work = continuation
+		default:
+			work = ac.GenerateWorkload()
+		}
+		return TimedWorkload{Work: work, ScheduledTime: time.Now(), Stage: stageAt(stages, elapsed), Phase: ac.phase}
+	}
 
-			// Prioritize continuations over new workloads
-			var work Workload
+	/* Worker goroutines */
+	pool := newWorkerPool(func(workerId int, stop <-chan struct{}) {
+		for {
 			select {
-			case continuation := <-ac.continuationChan:
-				work = continuation
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
 			default:
-				work = ac.GenerateWorkload()
 			}
 
-			scheduledTime := time.Now()
-
-			select {
-			case workChan <- TimedWorkload{Work: work, ScheduledTime: scheduledTime}:
-			case <-time.After(1 * time.Second):
-				logger.Log("Warning: work channel full, dropping workload")
+			timedWork := next()
+			if timedWork.Work == nil {
+				// All replayed workloads were issued, wait for the continuations of the remaining sessions
+				select {
+				case <-stop:
+					return
+				case <-ctx.Done():
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+				continue
+			}
+			// Without arrivals there is no scheduling delay
+			res, err := timedWork.Work.Execute(ctx, c, params, logger, 0, timedWork.Stage, timedWork.Phase)
+			if _, ok := timedWork.Work.(*MutationWorkload); ok {
+				// Recorded apart from the searches, a failed mutation is returned without an error
+				if err == nil {
+					collector.add(res)
+				}
+				continue
+			}
+			searchErrors.record(ctx, err)
+			if isQueryTimeout(err) {
+				timeouts.Add(1)
+				collector.add(res) // reported with the timeout as latency
+				continue
+			}
+			if err != nil && ctx.Err() == nil { // Errors are expected on benchmark end
+				logger.Errorf("Worker %d: error executing work: %v", workerId, err)
+				continue
+			}
+			if isTruncatedSession(res) {
+				truncatedInFlight.Add(1)
+				collector.add(res)
+				continue
+			}
+			if res == nil || err != nil {
+				// Continuation enqueued or cancelled on benchmark end, skip collecting result
+				continue
 			}
+
+			collector.add(res)
 		}
-	}()
+	})
 
-	// Wait for all workers to complete remaining work
-	wg.Wait()
+	/* Follow the concurrency stages until the benchmark duration is reached */
+	stageEnd := startTime
+	for stage, concurrencyStage := range stages {
+		pool.resize(concurrencyStage.workers)
+		logger.Logf("Entering concurrency stage %d: %d workers for %v (closed loop)",
+			stage, pool.size(), concurrencyStage.duration)
+		stageEnd = stageEnd.Add(concurrencyStage.duration)
+		select {
+		case <-time.After(time.Until(stageEnd)):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() == context.Canceled {
+		logger.Log("Benchmark interrupted, stopping workers")
+	} else {
+		logger.Log("Benchmark duration reached, stopping workers")
+	}
+	cancel()
+	pool.wait()
 
-	// Note: ac.continuationChan may still have pending sessions that won't complete
+	truncated := ac.collectPendingContinuations(collector, logger) + int(truncatedInFlight.Load())
+	executedJobs, executedSessions, segments := collector.results()
 	logger.Logf("Executed %d jobs and %d sessions", len(executedJobs), len(executedSessions))
-	return executedJobs, executedSessions
+	logTruncatedSessions(logger, truncated)
+	if segments > 0 {
+		logger.Logf("Spilled the results to %d segments", segments)
+	}
+	if samples := params.sampler.collected(); samples != nil {
+		if err := logger.LogDebugSamples(samples); err != nil {
+			logger.Errorf("Failed to write debug samples: %v", err)
+		}
+	}
+	logTimeouts(logger, int(timeouts.Load()))
+	stats := ExecutionStats{
+		SpilledSegments:   segments,
+		TimedOutQueries:   int(timeouts.Load()),
+		TruncatedSessions: truncated,
+		CappedSessions:    ac.cappedSessions,
+		SearchErrors:      searchErrors.byCategory(),
+		Mutations:         collector.mutationStats(),
+	}
+	logCappedSessions(logger, stats.CappedSessions)
+	logSearchErrors(logger, stats.SearchErrors)
+	logMutations(logger, stats.Mutations)
+	return executedJobs, executedSessions, stats
+}
+
+/**
+* runArrivals generates workloads with exponentially distributed inter-arrival times until all stages elapsed.
+* The arrivals are scheduled at absolute times, the inter-arrival times are added to the previous scheduled arrival
+* instead of the end of the previous sleep. Oversleeping or a slow dispatch thus delays the next arrival but does not
+* lower the arrival rate, arrivals that are already due are dispatched right away. Their ScheduledTime is the
+* scheduled arrival, so the scheduling delay of the workers includes the delay of the arrivals.
+* The last sleep is capped at the deadline, so arrivals end at the configured duration instead of overrunning it by
+* the last (potentially long) inter-arrival time.
+* The arrival rate follows the load schedule and the job probability the benchmark phases, which run back to back
+* like the stages.
+* enterStage and enterPhase are called whenever the next stage or phase begins, dispatch for every arrival.
+* Arrivals stop early once ctx is cancelled.
+ */
+func (ac *ArrivalController) runArrivals(
+	ctx context.Context,
+	stages []ConcurrencyStage,
+	enterStage func(stage int),
+	enterPhase func(phase int),
+	dispatch func(work TimedWorkload),
+) {
+	startTime := ac.clock.now()
+	deadline := startTime.Add(totalStageDuration(stages))
+	stage := 0
+	stageEnd := stages[0].duration
+	ac.phase = 0
+	ac.elapsed = 0
+	phaseEnd := ac.phases[0].duration
+
+	arrival := startTime
+	for {
+		arrival = arrival.Add(ac.NextSleepDuration())
+		if !arrival.Before(deadline) {
+			// The next arrival would fall past the deadline
+			ac.clock.sleepUntil(ctx, deadline)
+			return
+		}
+		if !ac.clock.sleepUntil(ctx, arrival) {
+			return
+		}
+
+		// Arrivals that are due after the benchmark duration is over are not dispatched anymore
+		if !ac.clock.now().Before(deadline) {
+			return
+		}
+		elapsed := arrival.Sub(startTime)
+		ac.elapsed = elapsed
+
+		// Advance to the concurrency stage the benchmark is currently in
+		for elapsed >= stageEnd && stage < len(stages)-1 {
+			stage++
+			stageEnd += stages[stage].duration
+			enterStage(stage)
+		}
+
+		// Advance to the benchmark phase the benchmark is currently in
+		for elapsed >= phaseEnd && ac.phase < len(ac.phases)-1 {
+			ac.phase++
+			phaseEnd += ac.phases[ac.phase].duration
+			enterPhase(ac.phase)
+		}
+
+		// Prioritize continuations over new workloads
+		var work Workload
+		select {
+		case continuation := <-ac.continuationChan:
+			work = continuation
+		default:
+			work = ac.GenerateWorkload()
+		}
+		if work == nil {
+			continue // all replayed workloads were issued, only session continuations remain
+		}
+
+		dispatch(TimedWorkload{Work: work, ScheduledTime: arrival, Stage: stage, Phase: ac.phase})
+	}
+}
+
+/**
+* collectPendingContinuations records the sessions still waiting for their next step once all workers stopped,
+* so that long sessions are not underrepresented at the end of the benchmark. It returns their number.
+ */
+func (ac *ArrivalController) collectPendingContinuations(collector *resultCollector, logger *Logger) int {
+	pending := 0
+	for {
+		select {
+		case session := <-ac.continuationChan:
+			session.truncate()
+			logger.LogSession(session)
+			collector.add(session)
+			pending++
+		default:
+			return pending
+		}
+	}
+}
+
+// dropWarningInterval bounds how often dropped workloads are reported while running, the total is logged at the end.
+const dropWarningInterval = 10 * time.Second
+
+// logTruncatedSessions reports how many sessions the end of the benchmark interrupted, if any.
+func logTruncatedSessions(logger *Logger, truncated int) {
+	if truncated > 0 {
+		logger.Logf("%d sessions were truncated by the end of the benchmark, they are recorded with their executed steps",
+			truncated)
+	}
+}
+
+// logCappedSessions reports how many sessions were issued as jobs because of maxInFlightSessions, if any.
+func logCappedSessions(logger *Logger, capped int) {
+	if capped > 0 {
+		logger.Logf("%d sessions arrived while maxInFlightSessions sessions were in flight, they were issued as jobs",
+			capped)
+	}
+}
+
+// logTimeouts reports how many searches exceeded the query timeout, if any.
+func logTimeouts(logger *Logger, timeouts int) {
+	if timeouts > 0 {
+		logger.Logf("%d queries exceeded the query timeout, they are reported with the timeout as latency", timeouts)
+	}
+}
+
+// arrivalClock is the time source of the arrivals, so that tests can control the passing of time.
+type arrivalClock interface {
+	now() time.Time
+	// sleepUntil returns once t is reached, right away if it already passed. It returns false if ctx is cancelled.
+	sleepUntil(ctx context.Context, t time.Time) bool
+}
+
+type wallClock struct{}
+
+func (wallClock) now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) sleepUntil(ctx context.Context, t time.Time) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	wait := time.Until(t)
+	if wait <= 0 {
+		return true
+	}
+	return sleepContext(ctx, wait)
+}
+
+// sleepContext sleeps for d unless ctx is cancelled first, it returns false if ctx was cancelled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // Execute performs the k-NN search for this job and records metrics.
 func (j *Job) Execute(
 	ctx context.Context,
 	c *milvusclient.Client,
-	collection string,
-	vecFieldName string,
-	dim int,
-	k int,
+	params *SearchParameters,
 	logger *Logger,
 	schedulingDelay time.Duration,
+	stage int,
+	phase int,
 ) (Workload, error) {
 	select {
 	case <-ctx.Done():
@@ -274,130 +912,410 @@ func (j *Job) Execute(
 	}
 
 	j.SchedulingDelay = schedulingDelay
+	j.Stage = stage
+	j.Phase = phase
+	j.applyPerturbation()
 	start := time.Now()
 
-	searchRes, err := c.Search(ctx,
-		milvusclient.NewSearchOption(
-			collection,
-			k,
-			[]entity.Vector{entity.FloatVector(j.QueryVector)},
-		).WithANNSField(vecFieldName),
-	)
-	j.Latency = time.Since(start)
-	j.StartTimestamp = start
+	option := params.newSearchOption(j.QueryVector, j.VectorField, j.SearchEffort, false, j.Partitions, j.Filter)
+	searchRes, err := params.search(ctx, c, option, j)
+	if params.sampler.sample() {
+		params.sampler.record(j, option, searchRes, err)
+	}
+	if isQueryTimeout(err) {
+		// Reported with the timeout as latency, so that hung queries show up in the percentiles
+		params.recordTimeout(j, start)
+		logger.LogJob(j, -1, -1)
+		return j, err
+	}
 	if err != nil {
+		j.Latency = time.Since(start)
+		j.StartTimestamp = start
 		return nil, err
 	}
 
 	if len(searchRes) != 1 {
-		logger.Logf("Unexpected number of result sets: %d", len(searchRes))
+		logger.Warnf("Unexpected number of result sets: %d", len(searchRes))
 	}
 	for _, resultSet := range searchRes {
-		j.ResultIds = resultSet.IDs.FieldData().GetScalars().GetLongData().Data
+		_, err = params.processResult(j, resultSet)
+		if err != nil {
+			return nil, err
+		}
 	}
+	// Latency includes the re-ranking, as it is part of the two-stage retrieval
+	j.Latency = time.Since(start)
+	j.StartTimestamp = start
 	logger.LogJob(j, -1, -1) // -1 indicates not part of a session
 	return j, nil
 }
 
-// Execute runs a single session query and enqueues the next query if the session continues.
+// Backoff before the first retry of a failed search, doubled for every further retry
+const searchRetryBackoff = 10 * time.Millisecond
+
+/**
+* search issues the search and retries it up to params.retries times if it fails, counting the retries in the job.
+* Rate-limit errors are not retried, as they are handled by the adaptive arrival rate instead.
+ */
+func (p *SearchParameters) search(
+	ctx context.Context,
+	c *milvusclient.Client,
+	option milvusclient.SearchOption,
+	job *Job,
+) ([]milvusclient.ResultSet, error) {
+	return p.withRetries(ctx, job, func(ctx context.Context) ([]milvusclient.ResultSet, error) {
+		return c.Search(ctx, option)
+	})
+}
+
+/**
+* withRetries issues a search of any kind with the retry policy of search.
+* Every attempt is bounded by the query timeout, a timed-out attempt is retried like any other failure.
+ */
+func (p *SearchParameters) withRetries(
+	ctx context.Context,
+	job *Job,
+	search func(ctx context.Context) ([]milvusclient.ResultSet, error),
+) ([]milvusclient.ResultSet, error) {
+	backoff := searchRetryBackoff
+	for {
+		searchRes, err := p.searchWithTimeout(ctx, search)
+		if err == nil || job.Retries >= p.retries || isRateLimitError(err) || ctx.Err() != nil {
+			return searchRes, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		job.Retries++
+		backoff *= 2
+	}
+}
+
+// errQueryTimeout marks searches that exceeded the query timeout, as opposed to the end of the benchmark.
+var errQueryTimeout = errors.New("query timed out")
+
+func isQueryTimeout(err error) bool {
+	return errors.Is(err, errQueryTimeout)
+}
+
+// searchWithTimeout runs a single search attempt, bounded by the query timeout if one is configured.
+func (p *SearchParameters) searchWithTimeout(
+	ctx context.Context,
+	search func(ctx context.Context) ([]milvusclient.ResultSet, error),
+) ([]milvusclient.ResultSet, error) {
+	if p.queryTimeout <= 0 {
+		return search(ctx)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, p.queryTimeout)
+	defer cancel()
+	searchRes, err := search(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w after %v: %w", errQueryTimeout, p.queryTimeout, err)
+	}
+	return searchRes, err
+}
+
+// recordTimeout marks the job as timed out, with the timeout as its latency regardless of any retries.
+func (p *SearchParameters) recordTimeout(job *Job, start time.Time) {
+	job.TimedOut = true
+	job.Latency = p.queryTimeout
+	job.StartTimestamp = start
+}
+
+/**
+* extractResultIds reads the primary keys of a result set according to the type of the ID field.
+* Integer keys are widened to int64, VarChar keys are returned as strings.
+ */
+func extractResultIds(ids column.Column) ([]int64, []string, error) {
+	if ids == nil {
+		return nil, nil, nil
+	}
+	switch ids.Type() {
+	case entity.FieldTypeInt64:
+		return ids.(*column.ColumnInt64).Data(), nil, nil
+	case entity.FieldTypeInt32:
+		return widenIds(ids.(*column.ColumnInt32).Data()), nil, nil
+	case entity.FieldTypeInt16:
+		return widenIds(ids.(*column.ColumnInt16).Data()), nil, nil
+	case entity.FieldTypeInt8:
+		return widenIds(ids.(*column.ColumnInt8).Data()), nil, nil
+	case entity.FieldTypeVarChar:
+		return nil, ids.(*column.ColumnVarChar).Data(), nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported primary key type %s of field %s", ids.Type(), ids.Name())
+	}
+}
+
+func widenIds[T int8 | int16 | int32](ids []T) []int64 {
+	wide := make([]int64, len(ids))
+	for i, id := range ids {
+		wide[i] = int64(id)
+	}
+	return wide
+}
+
+/**
+* applyPerturbation adds the pre-generated noise to the query vector.
+* The perturbed vector replaces the original one, so that the ground truth is computed against the
+* query that was actually issued.
+ */
+func (j *Job) applyPerturbation() {
+	if j.perturbation == nil {
+		return
+	}
+	for i := range j.QueryVector {
+		j.QueryVector[i] += j.perturbation[i]
+	}
+	j.perturbation = nil
+}
+
+/**
+* startStep records the start of the current step.
+* Every job keeps the scheduling delay of its own step, while the session accumulates the delays of all its steps,
+* i.e. the total time the session waited for a free worker.
+ */
+func (us *UserSession) startStep(schedulingDelay time.Duration, stage int, phase int) *Job {
+	job := &us.Jobs[us.currentStep]
+	job.StartTimestamp = time.Now()
+	job.SchedulingDelay = schedulingDelay
+	job.Stage = stage
+	job.Phase = phase
+	if us.StartTimestamp.IsZero() {
+		us.StartTimestamp = job.StartTimestamp
+	}
+	us.SchedulingDelay += schedulingDelay
+	return job
+}
+
+// elapsed returns the time since the first step started, 0 if the session never started.
+func (us *UserSession) elapsed() time.Duration {
+	if us.StartTimestamp.IsZero() {
+		return 0
+	}
+	return time.Since(us.StartTimestamp)
+}
+
+/**
+* sessionLimiter bounds the sessions in flight, i.e. executing a step or waiting for a worker to execute the next one.
+* A nil limiter does not limit the sessions.
+ */
+type sessionLimiter struct {
+	max      int64
+	inFlight atomic.Int64
+}
+
+// newSessionLimiter returns nil for a limit of 0, which leaves the sessions unbounded.
+func newSessionLimiter(maxInFlight int) *sessionLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &sessionLimiter{max: int64(maxInFlight)}
+}
+
+// tryAcquire reserves room for a new session, it returns false if the limit is reached.
+func (l *sessionLimiter) tryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	for {
+		n := l.inFlight.Load()
+		if n >= l.max {
+			return false
+		}
+		if l.inFlight.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+func (l *sessionLimiter) release() {
+	if l != nil {
+		l.inFlight.Add(-1)
+	}
+}
+
+func (us *UserSession) driftModel() driftModel {
+	if us.drift == nil {
+		return additiveDrift{}
+	}
+	return us.drift
+}
+
+/**
+* enqueueContinuation hands the session to the next free worker to execute its next step.
+* It never blocks the worker, if the continuation backlog is full the session is dropped with the steps it executed.
+ */
+func (us *UserSession) enqueueContinuation(ctx context.Context) (Workload, error) {
+	select {
+	case <-ctx.Done():
+		// Context cancelled, return partial session
+		us.truncate()
+		return us, ctx.Err()
+	default:
+	}
+	select {
+	case us.continuationChan <- us:
+		return nil, nil
+	default:
+		us.Dropped = true
+		us.Duration = us.elapsed()
+		return us, nil
+	}
+}
+
+// truncate ends a session interrupted by the end of the benchmark, keeping the steps it executed.
+func (us *UserSession) truncate() {
+	us.Truncated = true
+	us.Duration = us.elapsed()
+}
+
+// executedSteps counts the steps that were started, fewer than planned if the session ended early.
+func (us *UserSession) executedSteps() (steps int) {
+	for _, job := range us.Jobs {
+		if !job.StartTimestamp.IsZero() {
+			steps++
+		}
+	}
+	return
+}
+
+func isTruncatedSession(work Workload) bool {
+	session, ok := work.(*UserSession)
+	return ok && session.Truncated
+}
+
+/**
+* Execute runs a single session query and enqueues the next query if the session continues.
+* Once the session ended, it makes room for the next session in flight.
+ */
 func (us *UserSession) Execute(
 	ctx context.Context,
 	c *milvusclient.Client,
-	collection string,
-	vecFieldName string,
-	dim int,
-	k int,
+	params *SearchParameters,
+	logger *Logger,
+	schedulingDelay time.Duration,
+	stage int,
+	phase int,
+) (Workload, error) {
+	res, err := us.executeStep(ctx, c, params, logger, schedulingDelay, stage, phase)
+	// Only an enqueued continuation returns neither a result nor an error
+	if res != nil || err != nil {
+		us.limiter.release()
+		us.limiter = nil
+	}
+	if res != nil && (us.Truncated || us.Dropped) {
+		// Interrupted sessions are logged with the steps they executed, the other ones log themselves when they end
+		logger.LogSession(us)
+	}
+	return res, err
+}
+
+func (us *UserSession) executeStep(
+	ctx context.Context,
+	c *milvusclient.Client,
+	params *SearchParameters,
 	logger *Logger,
 	schedulingDelay time.Duration,
+	stage int,
+	phase int,
 ) (Workload, error) {
 	select {
 	case <-ctx.Done():
-		us.Duration = time.Since(us.StartTimestamp)
 		logger.Logf("Session %d cancelled after %d of %d steps", us.SessionId, us.currentStep, len(us.Jobs))
-		return nil, ctx.Err()
+		if us.currentStep == 0 {
+			return nil, ctx.Err() // nothing was executed
+		}
+		us.truncate()
+		return us, ctx.Err()
 	default:
 	}
 
-	job := &us.Jobs[us.currentStep]
-	us.SchedulingDelay += schedulingDelay // Accumulate scheduling delays
-	if us.currentStep == 0 {
-		// For the first query, record session start time and scheduling delay
-		us.StartTimestamp = time.Now()
-	}
-
-	// Execute the k-NN search
-	jobStart := time.Now()
-	searchRes, err := c.Search(ctx,
-		milvusclient.NewSearchOption(
-			collection,
-			k,
-			[]entity.Vector{entity.FloatVector(job.QueryVector)},
-		).WithANNSField(vecFieldName).
-			WithOutputFields(vecFieldName), // Need vector field for computing next query
-	)
+	job := us.startStep(schedulingDelay, stage, phase)
+	jobStart := job.StartTimestamp
+	// Follow-up queries are only known now, so the perturbation is applied on top of the drifted query
+	job.applyPerturbation()
 
-	job.Latency = time.Since(jobStart)
-	job.StartTimestamp = jobStart
-	job.SchedulingDelay = schedulingDelay
+	// Execute the k-NN search, the vector of the top result is needed for computing the next query
+	withVectors := !us.replayed // replayed steps do not depend on the results
+	option := params.newSearchOption(job.QueryVector, job.VectorField, job.SearchEffort, withVectors, job.Partitions, job.Filter)
+	searchRes, err := params.search(ctx, c, option, job)
+	if params.sampler.sample() {
+		params.sampler.record(job, option, searchRes, err)
+	}
 
+	if isQueryTimeout(err) {
+		// Without results there is no next query, the session ends with the timed-out step
+		params.recordTimeout(job, jobStart)
+		logger.LogJob(job, us.SessionId, us.currentStep)
+		us.Duration = us.elapsed()
+		logger.LogSession(us)
+		return us, err
+	}
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by the end of the benchmark, the step has no outcome
+		job.resetForReplay()
+		if us.currentStep == 0 {
+			return nil, ctx.Err()
+		}
+		us.truncate()
+		return us, ctx.Err()
+	}
 	if err != nil {
 		// On error, return partial session
-		us.Duration = time.Since(us.StartTimestamp)
+		job.Latency = time.Since(jobStart)
+		us.Duration = us.elapsed()
 		return us, err
 	}
 
 	if len(searchRes) != 1 {
-		logger.Logf("Unexpected number of result sets: %d", len(searchRes))
+		logger.Warnf("Unexpected number of result sets: %d", len(searchRes))
 	}
 
-	var topResult Vector
+	var results []Vector
 	for _, resultSet := range searchRes {
-		job.ResultIds = resultSet.IDs.FieldData().GetScalars().GetLongData().Data
-		vectors := resultSet.GetColumn(vecFieldName)
-		if vectors == nil {
-			logger.Logf("Session %d: No vector field '%s' in search result", us.SessionId, vecFieldName)
-			continue
+		results, err = params.processResult(job, resultSet)
+		if err != nil {
+			us.Duration = us.elapsed()
+			return us, err
+		}
+		if len(results) == 0 && !us.replayed {
+			logger.Logf("Session %d: No vector field '%s' in search result", us.SessionId, params.vectorOutputField())
 		}
-		// Don't ask why but this concatenates all the vectors so we must slice to get the first one
-		combinedVector := vectors.FieldData().GetVectors().GetFloatVector().Data
-		topResult = combinedVector[:dim]
 	}
+	job.Latency = time.Since(jobStart)
 
 	logger.LogJob(job, us.SessionId, us.currentStep)
 
 	// Check if more queries remain in the session
 	if us.currentStep+1 < len(us.Jobs) {
-		if topResult == nil {
-			// Cannot compute next query without top result vector, end session early
+		if us.replayed {
+			us.currentStep++
+			return us.enqueueContinuation(ctx)
+		}
+		if len(results) == 0 {
+			// Cannot compute next query without result vectors, end session early
 			logger.Logf("Session %d: No vector field '%s' in result, ending session early at step %d",
-				us.SessionId, vecFieldName, us.currentStep)
-			us.Duration = time.Since(us.StartTimestamp)
+				us.SessionId, params.vectorOutputField(), us.currentStep)
+			us.Duration = us.elapsed()
 			logger.LogSession(us)
 			return us, nil
 		}
 
 		us.currentStep++
-		// Compute next query vector based on last result + offset
+		// Compute next query vector based on the results and the offset generated for the step
 		offset := us.Jobs[us.currentStep].QueryVector
-		nextQuery := make(Vector, dim)
-		for i := range dim {
-			nextQuery[i] = topResult[i] + offset[i]
+		nextQuery := us.driftModel().next(us.currentStep, job.QueryVector, results, offset)
+		if us.normalizeQueries {
+			nextQuery = normalizeVector(nextQuery)
 		}
 		us.Jobs[us.currentStep].QueryVector = nextQuery
-
-		// Enqueue continuation
-		select {
-		case us.continuationChan <- us:
-			return nil, nil
-		case <-ctx.Done():
-			// Context cancelled, return partial session
-			us.Duration = time.Since(us.StartTimestamp)
-			return us, ctx.Err()
-		}
+		return us.enqueueContinuation(ctx)
 	}
 
 	// Session complete
-	us.Duration = time.Since(us.StartTimestamp)
+	us.Duration = us.elapsed()
 	logger.LogSession(us)
 	return us, nil
 }
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"slices"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
 // testJobGenParams creates a JobGenerationParameters for testing with common defaults
@@ -23,7 +29,7 @@ func testJobGenParams(targetQPS float64, jobProbability float64, minSessionLen,
 
 func TestArrivalController_GenerateJob_UniqueIds(t *testing.T) {
 	params := testJobGenParams(100.0, 1.0, 5, 10) // 100% jobs
-	ac := NewArrivalController(params, 50, 42, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
 
 	ids := make(map[string]bool)
 	for range 100 {
@@ -38,7 +44,7 @@ func TestArrivalController_GenerateJob_UniqueIds(t *testing.T) {
 
 func TestArrivalController_GenerateSession_UniqueIds(t *testing.T) {
 	params := testJobGenParams(100.0, 0.0, 5, 10) // 100% sessions
-	ac := NewArrivalController(params, 50, 42, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
 
 	ids := make(map[int]bool)
 	for range 100 {
@@ -55,7 +61,7 @@ func TestArrivalController_SessionLength(t *testing.T) {
 	minLen := 5
 	maxLen := 10
 	params := testJobGenParams(100.0, 0.0, minLen, maxLen) // 100% sessions
-	ac := NewArrivalController(params, 50, 42, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
 
 	for range 100 {
 		work := ac.GenerateWorkload()
@@ -68,7 +74,7 @@ func TestArrivalController_SessionLength(t *testing.T) {
 
 func TestArrivalController_Session_StartsAtStepZero(t *testing.T) {
 	params := testJobGenParams(100.0, 0.0, 5, 10) // 100% sessions
-	ac := NewArrivalController(params, 50, 42, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
 
 	work := ac.GenerateWorkload()
 	session := work.(*UserSession)
@@ -80,7 +86,7 @@ func TestArrivalController_Session_StartsAtStepZero(t *testing.T) {
 
 func TestArrivalController_Session_HasContinuationChannel(t *testing.T) {
 	params := testJobGenParams(100.0, 0.0, 5, 10) // 100% sessions
-	ac := NewArrivalController(params, 50, 42, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
 
 	work := ac.GenerateWorkload()
 	session := work.(*UserSession)
@@ -276,16 +282,722 @@ func TestWorkloadInterface(t *testing.T) {
 
 func TestUserSession_AccumulatedSchedulingDelay(t *testing.T) {
 	session := &UserSession{
-		SessionId:       1,
-		Jobs:            []Job{{Id: "S-1-0"}, {Id: "S-1-1"}},
-		SchedulingDelay: 0,
+		SessionId: 1,
+		Jobs:      []Job{{Id: "S-1-0"}, {Id: "S-1-1"}, {Id: "S-1-2"}},
+	}
+
+	delays := []time.Duration{10 * time.Millisecond, 5 * time.Millisecond, 2 * time.Millisecond}
+	for step, delay := range delays {
+		session.currentStep = step
+		job := session.startStep(delay, 0, step)
+		if job != &session.Jobs[step] {
+			t.Fatalf("Step %d: expected the job of the current step", step)
+		}
+	}
+
+	// Each job keeps the delay of its own step
+	for step, delay := range delays {
+		if session.Jobs[step].SchedulingDelay != delay {
+			t.Errorf("Step %d: expected delay %v, got %v", step, delay, session.Jobs[step].SchedulingDelay)
+		}
+		if session.Jobs[step].Phase != step {
+			t.Errorf("Step %d: expected phase %d, got %d", step, step, session.Jobs[step].Phase)
+		}
+	}
+	// The session reports the sum of all step delays
+	if session.SchedulingDelay != 17*time.Millisecond {
+		t.Errorf("Expected accumulated delay of 17ms, got %v", session.SchedulingDelay)
+	}
+	if !session.StartTimestamp.Equal(session.Jobs[0].StartTimestamp) {
+		t.Errorf("Expected the session to start with its first step")
+	}
+}
+
+func TestArrivalController_NoPerturbationByDefault(t *testing.T) {
+	params := testJobGenParams(100.0, 1.0, 5, 10) // 100% jobs
+	ac := NewArrivalController(params, 50, 0, 42, 10)
+
+	job := ac.GenerateWorkload().(*Job)
+
+	if job.perturbation != nil {
+		t.Errorf("Expected no perturbation when perturbationStdDev is 0, got %v", job.perturbation)
+	}
+}
+
+func TestArrivalController_PerturbationPerSessionStep(t *testing.T) {
+	params := testJobGenParams(100.0, 0.0, 5, 10) // 100% sessions
+	params.perturbationStdDev = 0.5
+	ac := NewArrivalController(params, 50, 0, 42, 10)
+
+	session := ac.GenerateWorkload().(*UserSession)
+
+	for i, job := range session.Jobs {
+		if len(job.perturbation) != 50 {
+			t.Errorf("Expected perturbation of length 50 for step %d, got %d", i, len(job.perturbation))
+		}
+	}
+}
+
+func TestJob_ApplyPerturbation(t *testing.T) {
+	job := &Job{
+		Id:           "J-0",
+		QueryVector:  Vector{1.0, 2.0},
+		perturbation: Vector{0.5, -0.5},
+	}
+
+	job.applyPerturbation()
+	job.applyPerturbation() // must not be applied twice
+
+	expectedVec := Vector{1.5, 1.5}
+	for i, v := range job.QueryVector {
+		if v != expectedVec[i] {
+			t.Errorf("Expected vec[%d] to be %f, got %f", i, expectedVec[i], v)
+		}
+	}
+}
+
+func TestWorkerPool_Resize(t *testing.T) {
+	var mu sync.Mutex
+	active := 0
+	pool := newWorkerPool(func(workerId int, stop <-chan struct{}) {
+		mu.Lock()
+		active++
+		mu.Unlock()
+		<-stop
+		mu.Lock()
+		active--
+		mu.Unlock()
+	})
+
+	pool.resize(5)
+	if pool.size() != 5 {
+		t.Errorf("Expected pool size 5, got %d", pool.size())
+	}
+
+	pool.resize(2)
+	if pool.size() != 2 {
+		t.Errorf("Expected pool size 2, got %d", pool.size())
+	}
+
+	pool.resize(0)
+	pool.wait()
+	if active != 0 {
+		t.Errorf("Expected all workers to have stopped, %d still active", active)
+	}
+}
+
+func TestExtractResultIds_Int64(t *testing.T) {
+	ids, stringIds, err := extractResultIds(column.NewColumnInt64("id", []int64{3, 1, 2}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != 3 || stringIds != nil {
+		t.Errorf("Expected int64 ids [3 1 2], got %v / %v", ids, stringIds)
+	}
+}
+
+func TestExtractResultIds_Int32(t *testing.T) {
+	ids, _, err := extractResultIds(column.NewColumnInt32("id", []int32{7, 8}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 7 || ids[1] != 8 {
+		t.Errorf("Expected widened ids [7 8], got %v", ids)
+	}
+}
+
+func TestExtractResultIds_VarChar(t *testing.T) {
+	ids, stringIds, err := extractResultIds(column.NewColumnVarChar("id", []string{"a", "b"}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ids != nil || len(stringIds) != 2 || stringIds[1] != "b" {
+		t.Errorf("Expected string ids [a b], got %v / %v", ids, stringIds)
+	}
+}
+
+func TestExtractResultIds_Unsupported(t *testing.T) {
+	_, _, err := extractResultIds(column.NewColumnFloat("id", []float32{1.0}))
+
+	if err == nil {
+		t.Error("Expected error for unsupported primary key type")
+	}
+}
+
+func TestPayloadBytes(t *testing.T) {
+	if size := payloadBytes(nil); size != 0 {
+		t.Errorf("Expected no payload without output fields, got %d bytes", size)
+	}
+	short := payloadBytes([]column.Column{column.NewColumnVarChar("word", []string{"a", "b"})})
+	long := payloadBytes([]column.Column{column.NewColumnVarChar("word", []string{"apple", "banana"})})
+	if short == 0 || long-short != 9 {
+		t.Errorf("Expected the payload to grow with the returned words, got %d and %d bytes", short, long)
+	}
+	both := payloadBytes([]column.Column{
+		column.NewColumnVarChar("word", []string{"a", "b"}),
+		column.NewColumnInt64("count", []int64{1, 2}),
+	})
+	if both <= short {
+		t.Errorf("Expected every output field to add to the payload, got %d and %d bytes", short, both)
+	}
+}
+
+func TestSplitVectors(t *testing.T) {
+	vectors := splitVectors([]float32{1, 2, 3, 4, 5, 6}, 3)
+
+	if len(vectors) != 2 {
+		t.Fatalf("Expected 2 vectors, got %d", len(vectors))
+	}
+	if vectors[1][0] != 4 || vectors[1][2] != 6 {
+		t.Errorf("Expected second vector [4 5 6], got %v", vectors[1])
+	}
+}
+
+func TestRerankCandidates_OrdersByExactDistance(t *testing.T) {
+	query := Vector{0, 0}
+	ids := []int64{1, 2, 3}
+	vectors := []Vector{{3, 0}, {1, 0}, {2, 0}}
+
+	rerankedIds, rerankedVectors := rerankCandidates(query, ids, vectors, 2, euclideanDistance)
+
+	if len(rerankedIds) != 2 || rerankedIds[0] != 2 || rerankedIds[1] != 3 {
+		t.Errorf("Expected ids [2 3], got %v", rerankedIds)
+	}
+	if rerankedVectors[0][0] != 1 {
+		t.Errorf("Expected vectors to follow their ids, got %v", rerankedVectors)
+	}
+}
+
+func TestProcessResult_ScoresFollowRerankedIds(t *testing.T) {
+	params := &SearchParameters{vecFieldName: "vector", rerankFieldName: "vector_full", dim: 2, k: 1, rerankCandidates: 2}
+	job := &Job{QueryVector: Vector{0, 0}}
+	resultSet := milvusclient.ResultSet{
+		IDs:    column.NewColumnInt64("id", []int64{1, 2}),
+		Scores: []float32{0.9, 0.1},
+		Fields: milvusclient.DataSet{column.NewColumnFloatVector("vector_full", 2, [][]float32{{3, 0}, {1, 0}})},
+	}
+
+	_, err := params.processResult(job, resultSet)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(job.ResultIds) != 1 || job.ResultIds[0] != 2 || len(job.ResultScores) != 1 || job.ResultScores[0] != 0.1 {
+		t.Errorf("Expected id 2 with score 0.1, got %v / %v", job.ResultIds, job.ResultScores)
+	}
+}
+
+func TestSearchParameters_RerankDisabledByDefault(t *testing.T) {
+	params := &SearchParameters{vecFieldName: "vector", k: 10}
+
+	if params.rerankEnabled() {
+		t.Error("Expected re-ranking to be disabled without a rerank field")
+	}
+	if params.vectorOutputField() != "vector" {
+		t.Errorf("Expected output field vector, got %s", params.vectorOutputField())
+	}
+}
+
+func TestSearchParameters_OutputFieldsNotModified(t *testing.T) {
+	outputFields := make([]string, 1, 2)
+	outputFields[0] = "word"
+	params := &SearchParameters{collection: "c", vecFieldName: "vector", dim: 2, k: 10, outputFields: outputFields}
+
+	params.newSearchOption(Vector{1, 2}, "", 0, true, nil, "")
+
+	if len(params.outputFields) != 1 || outputFields[:2][1] != "" {
+		t.Errorf("Expected configured output fields to stay unchanged, got %v", outputFields[:2])
+	}
+}
+
+func TestArrivalController_RunArrivals_EndsAtDuration(t *testing.T) {
+	// Mean inter-arrival time of 1s, far longer than the benchmark itself
+	ac := NewArrivalController(testJobGenParams(1.0, 1.0, 1, 1), 4, 0, 42, 10)
+	clock := &fakeClock{time: time.Unix(0, 0)}
+	ac.clock = clock
+	duration := 200 * time.Millisecond
+	stages := []ConcurrencyStage{{workers: 1, duration: duration}}
+
+	var dispatched []TimedWorkload
+	ac.runArrivals(context.Background(), stages, func(int) {}, func(int) {},
+		func(work TimedWorkload) { dispatched = append(dispatched, work) })
+
+	// The last sleep is capped at the deadline instead of waiting for the next arrival
+	if elapsed := clock.time.Sub(time.Unix(0, 0)); elapsed != duration || len(dispatched) != 0 {
+		t.Errorf("Expected arrivals to end after %v without dispatching, took %v and dispatched %d",
+			duration, elapsed, len(dispatched))
+	}
+}
+
+func TestArrivalController_RunArrivals_StopsOnCancel(t *testing.T) {
+	ac := NewArrivalController(testJobGenParams(1.0, 1.0, 1, 1), 4, 0, 42, 10)
+	stages := []ConcurrencyStage{{workers: 1, duration: time.Minute}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ac.runArrivals(ctx, stages, func(int) {}, func(int) {}, func(TimedWorkload) {})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected arrivals to stop on cancellation, took %v", elapsed)
+	}
+}
+
+// fakeClock advances only by sleeping, every sleep overshoots by jitter like on a loaded scheduler.
+type fakeClock struct {
+	time   time.Time
+	jitter time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.time
+}
+
+func (c *fakeClock) sleepUntil(ctx context.Context, t time.Time) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if t.After(c.time) {
+		c.time = t.Add(c.jitter)
+	}
+	return true
+}
+
+func TestArrivalController_RunArrivals_TracksTargetQPSUnderJitter(t *testing.T) {
+	// Overshooting every sleep by half the mean inter-arrival time would lower the rate to 667 arrivals per second
+	ac := NewArrivalController(testJobGenParams(1000.0, 1.0, 1, 1), 4, 0, 42, 10)
+	clock := &fakeClock{time: time.Unix(0, 0), jitter: 500 * time.Microsecond}
+	ac.clock = clock
+	stages := []ConcurrencyStage{{workers: 1, duration: 10 * time.Second}}
+
+	var dispatched []TimedWorkload
+	ac.runArrivals(context.Background(), stages, func(int) {}, func(int) {},
+		func(work TimedWorkload) { dispatched = append(dispatched, work) })
+
+	if arrivals := len(dispatched); arrivals < 9700 || arrivals > 10300 {
+		t.Errorf("Expected about 10000 arrivals at 1000 QPS for 10s, got %d", arrivals)
+	}
+	deadline := time.Unix(0, 0).Add(10 * time.Second)
+	for i, work := range dispatched {
+		if (i > 0 && work.ScheduledTime.Before(dispatched[i-1].ScheduledTime)) || !work.ScheduledTime.Before(deadline) {
+			t.Fatalf("Expected ordered arrivals before the deadline, got %v at %d", work.ScheduledTime, i)
+		}
+	}
+	if clock.time.Before(deadline) {
+		t.Errorf("Expected the arrivals to end at the deadline, ended at %v", clock.time)
+	}
+}
+
+func TestArrivalController_RunArrivals_DispatchesWithinStages(t *testing.T) {
+	ac := NewArrivalController(testJobGenParams(500.0, 1.0, 1, 1), 4, 0, 42, 10)
+	stages := []ConcurrencyStage{
+		{workers: 1, duration: 100 * time.Millisecond},
+		{workers: 2, duration: 100 * time.Millisecond},
+	}
+
+	start := time.Unix(0, 0)
+	ac.clock = &fakeClock{time: start}
+
+	var enteredStages []int
+	var dispatched []TimedWorkload
+	ac.runArrivals(
+		context.Background(),
+		stages,
+		func(stage int) { enteredStages = append(enteredStages, stage) },
+		func(int) {},
+		func(work TimedWorkload) { dispatched = append(dispatched, work) },
+	)
+
+	if len(enteredStages) != 1 || enteredStages[0] != 1 {
+		t.Errorf("Expected to enter stage 1 once, got %v", enteredStages)
+	}
+	if len(dispatched) == 0 {
+		t.Fatal("Expected workloads to be dispatched")
+	}
+	last := dispatched[len(dispatched)-1]
+	if last.Stage != 1 || last.ScheduledTime.Sub(start) >= totalStageDuration(stages) {
+		t.Errorf("Expected last arrival in stage 1 before the deadline, got stage %d after %v",
+			last.Stage, last.ScheduledTime.Sub(start))
+	}
+}
+
+func TestArrivalController_RunArrivals_AdvancesPhases(t *testing.T) {
+	params := testJobGenParams(500.0, 1.0, 1, 1)
+	params.phases = []BenchmarkPhase{
+		{name: "jobs", duration: 100 * time.Millisecond, targetQPS: 500, jobProbability: 1.0},
+		{name: "sessions", duration: 100 * time.Millisecond, targetQPS: 500, jobProbability: 0.0},
+	}
+	ac := NewArrivalController(params, 4, 0, 42, 10)
+	stages := []ConcurrencyStage{{workers: 1, duration: 200 * time.Millisecond}}
+
+	var enteredPhases []int
+	var dispatched []TimedWorkload
+	ac.runArrivals(
+		context.Background(),
+		stages,
+		func(int) {},
+		func(phase int) { enteredPhases = append(enteredPhases, phase) },
+		func(work TimedWorkload) { dispatched = append(dispatched, work) },
+	)
+
+	if len(enteredPhases) != 1 || enteredPhases[0] != 1 {
+		t.Errorf("Expected to enter phase 1 once, got %v", enteredPhases)
+	}
+	for _, work := range dispatched {
+		_, isJob := work.Work.(*Job)
+		if isJob != (work.Phase == 0) {
+			t.Errorf("Expected only jobs in phase 0 and only sessions in phase 1, got %T in phase %d", work.Work, work.Phase)
+			break
+		}
+	}
+}
+
+func TestCheckTopK(t *testing.T) {
+	var logger *Logger // not logged to without clamping
+	withinLimit := &SearchParameters{k: 10}
+	if err := CheckTopK(withinLimit, 16384, topKPolicyError, logger); err != nil {
+		t.Errorf("Expected no error within the limit, got %v", err)
+	}
+
+	tooLarge := &SearchParameters{k: 20000}
+	if err := CheckTopK(tooLarge, 16384, topKPolicyError, logger); err == nil {
+		t.Error("Expected error for k above the limit")
+	}
+}
+
+func TestCheckTopK_Clamp(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	params := &SearchParameters{k: 20000, rerankFieldName: "vector_full", rerankCandidates: 30000}
+
+	if err := CheckTopK(params, 16384, topKPolicyClamp, logger); err != nil {
+		t.Fatalf("Expected clamping instead of an error, got %v", err)
+	}
+	if params.k != 16384 || params.searchLimit() != 16384 {
+		t.Errorf("Expected k and search limit 16384, got %d and %d", params.k, params.searchLimit())
+	}
+}
+
+func TestArrivalController_CyclesSearchEfforts(t *testing.T) {
+	ac := NewArrivalController(testJobGenParams(100.0, 1.0, 5, 10), 4, 0, 42, 10)
+	ac.searchEfforts = []int{16, 64}
+
+	var efforts []int
+	for range 4 {
+		efforts = append(efforts, ac.GenerateWorkload().(*Job).SearchEffort)
+	}
+	if !slices.Equal(efforts, []int{16, 64, 16, 64}) {
+		t.Errorf("Expected the jobs to cycle through the efforts, got %v", efforts)
+	}
+
+	sessions := NewArrivalController(testJobGenParams(100.0, 0.0, 3, 3), 4, 0, 42, 10)
+	sessions.searchEfforts = []int{16, 64}
+	session := sessions.GenerateWorkload().(*UserSession)
+	for _, job := range session.Jobs {
+		if job.SearchEffort != 16 {
+			t.Errorf("Expected all steps of a session to keep effort 16, got %d", job.SearchEffort)
+		}
+	}
+}
+
+// searchParamsOf returns the search parameters Milvus receives with the search option.
+func searchParamsOf(t *testing.T, option milvusclient.SearchOption) map[string]any {
+	request, err := option.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range request.GetSearchParams() {
+		if param.GetKey() == "params" {
+			params := make(map[string]any)
+			if err := json.Unmarshal([]byte(param.GetValue()), &params); err != nil {
+				t.Fatal(err)
+			}
+			return params
+		}
+	}
+	return nil
+}
+
+func TestSearchParameters_SendsConfiguredEf(t *testing.T) {
+	searchParams := IndexSearchParameters{ef: 400}
+	params := &SearchParameters{
+		collection:        "c",
+		vecFieldName:      "vector",
+		dim:               2,
+		k:                 10,
+		annParam:          buildAnnParam(indexTypeHNSW, searchParams),
+		indexType:         indexTypeHNSW,
+		indexSearchParams: searchParams,
+	}
+	job := &Job{QueryVector: Vector{1, 2}}
+
+	options := map[string]milvusclient.SearchOption{
+		"job":     params.newSearchOption(job.QueryVector, job.VectorField, job.SearchEffort, false, job.Partitions, job.Filter),
+		"session": params.newSearchOption(job.QueryVector, job.VectorField, job.SearchEffort, true, job.Partitions, job.Filter),
+		"warmup":  params.newSearchOption(job.QueryVector, "", 0, false, nil, ""),
+	}
+	for name, option := range options {
+		if ef := searchParamsOf(t, option)["ef"]; ef != 400.0 {
+			t.Errorf("Expected the %s search to carry ef 400, got %v", name, ef)
+		}
+	}
+}
+
+func TestSearchParameters_QueryTimeout(t *testing.T) {
+	params := &SearchParameters{queryTimeout: 10 * time.Millisecond, retries: 1}
+	job := &Job{}
+	hang := func(ctx context.Context) ([]milvusclient.ResultSet, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	_, err := params.withRetries(context.Background(), job, hang)
+	if !isQueryTimeout(err) {
+		t.Fatalf("Expected a query timeout, got %v", err)
+	}
+	if job.Retries != 1 {
+		t.Errorf("Expected the timed-out search to be retried once, got %d retries", job.Retries)
+	}
+
+	params.recordTimeout(job, time.Now())
+	if !job.TimedOut || job.Latency != params.queryTimeout {
+		t.Errorf("Expected a timed-out job with latency %v, got %+v", params.queryTimeout, job)
+	}
+}
+
+func TestSearchParameters_QueryTimeout_BenchmarkEnd(t *testing.T) {
+	params := &SearchParameters{queryTimeout: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := params.searchWithTimeout(ctx, func(ctx context.Context) ([]milvusclient.ResultSet, error) {
+		return nil, ctx.Err()
+	})
+	if isQueryTimeout(err) || err != context.Canceled {
+		t.Errorf("Expected the end of the benchmark not to count as a timeout, got %v", err)
+	}
+}
+
+func TestCheckWorkloadMode(t *testing.T) {
+	params := testJobGenParams(100, 0.5, 2, 4)
+	for _, mode := range []string{workloadModePoisson, workloadModeClosed, workloadModeSequential} {
+		if err := checkWorkloadMode(mode, params); err != nil {
+			t.Errorf("unexpected error for mode %s: %v", mode, err)
+		}
 	}
 
-	// Simulate accumulating scheduling delays across queries
-	session.SchedulingDelay += 10 * time.Millisecond
-	session.SchedulingDelay += 5 * time.Millisecond
+	params.phases = []BenchmarkPhase{{duration: time.Minute, targetQPS: 100, jobProbability: 0.5}}
+	if err := checkWorkloadMode(workloadModeSequential, params); err == nil {
+		t.Error("Expected an error for phases in sequential mode")
+	}
+}
+
+func TestArrivalController_SameSeedSameWorkloads(t *testing.T) {
+	params := testJobGenParams(100, 0.5, 2, 4)
+	first := NewArrivalController(params, 8, 0, arrivalSeed, 1)
+	second := NewArrivalController(params, 8, 0, arrivalSeed, 1)
+
+	for i := range 50 {
+		a, b := first.GenerateWorkload(), second.GenerateWorkload()
+		var queryA, queryB Vector
+		switch w := a.(type) {
+		case *Job:
+			queryA = w.QueryVector
+		case *UserSession:
+			queryA = w.Jobs[0].QueryVector
+		}
+		switch w := b.(type) {
+		case *Job:
+			queryB = w.QueryVector
+		case *UserSession:
+			queryB = w.Jobs[0].QueryVector
+		}
+		if !slices.Equal(queryA, queryB) {
+			t.Fatalf("Workload %d differs between runs with the same seed", i)
+		}
+	}
+}
+
+func TestArrivalController_CollectPendingContinuations(t *testing.T) {
+	params := testJobGenParams(100.0, 0.0, 5, 10) // 100% sessions
+	ac := NewArrivalController(params, 50, 0, 42, 10)
+	collector := newResultCollector(0, metricL2, nil)
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	for range 3 {
+		session := ac.GenerateWorkload().(*UserSession)
+		session.startStep(0, 0, 0)
+		session.currentStep++
+		if _, err := session.enqueueContinuation(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pending := ac.collectPendingContinuations(collector, logger); pending != 3 {
+		t.Errorf("Expected 3 pending sessions, got %d", pending)
+	}
+	_, sessions, _ := collector.results()
+	if len(sessions) != 3 {
+		t.Fatalf("Expected the pending sessions to be collected, got %d", len(sessions))
+	}
+	for _, session := range sessions {
+		if !session.Truncated || session.Jobs[0].StartTimestamp.IsZero() {
+			t.Errorf("Expected session %d to be truncated with its executed step", session.SessionId)
+		}
+	}
+	if pending := ac.collectPendingContinuations(collector, logger); pending != 0 {
+		t.Errorf("Expected no sessions left, got %d", pending)
+	}
+}
+
+func TestUserSession_EnqueueContinuation_TruncatedOnBenchmarkEnd(t *testing.T) {
+	session := &UserSession{Jobs: make([]Job, 2), continuationChan: make(chan *UserSession)}
+	session.startStep(0, 0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
-	if session.SchedulingDelay != 15*time.Millisecond {
-		t.Errorf("Expected accumulated delay of 15ms, got %v", session.SchedulingDelay)
+	res, err := session.enqueueContinuation(ctx)
+
+	if err != context.Canceled || !isTruncatedSession(res) {
+		t.Errorf("Expected the truncated session and the cancellation, got %v / %v", res, err)
+	}
+}
+
+func TestUserSession_CancelledAtFirstStep(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	session := &UserSession{Jobs: make([]Job, 3), continuationChan: make(chan *UserSession, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, err := session.Execute(ctx, nil, &SearchParameters{}, logger, 0, 0, 0)
+
+	if res != nil || err != context.Canceled {
+		t.Errorf("Expected no result for a session that never started, got %v / %v", res, err)
+	}
+	if !session.StartTimestamp.IsZero() || session.Duration != 0 {
+		t.Errorf("Expected no start and no duration, got %v and %v", session.StartTimestamp, session.Duration)
+	}
+
+	// Truncating a session that never started must not measure the time since the zero time
+	session.truncate()
+	if session.Duration != 0 {
+		t.Errorf("Expected no duration for a session that never started, got %v", session.Duration)
+	}
+}
+
+func TestUserSession_StartStep_StartsSessionOnce(t *testing.T) {
+	session := &UserSession{Jobs: make([]Job, 2)}
+	first := session.startStep(time.Millisecond, 0, 0)
+	if session.StartTimestamp != first.StartTimestamp {
+		t.Errorf("Expected the session to start with its first step, got %v and %v", session.StartTimestamp, first.StartTimestamp)
+	}
+	session.currentStep++
+	time.Sleep(time.Millisecond)
+	second := session.startStep(2*time.Millisecond, 0, 0)
+	if session.StartTimestamp != first.StartTimestamp || !second.StartTimestamp.After(first.StartTimestamp) {
+		t.Errorf("Expected the session to keep the start of its first step, got %v", session.StartTimestamp)
+	}
+	if session.SchedulingDelay != 3*time.Millisecond || session.elapsed() <= 0 {
+		t.Errorf("Unexpected scheduling delay %v or elapsed time %v", session.SchedulingDelay, session.elapsed())
+	}
+}
+
+func TestUserSession_EnqueueContinuation_DroppedOnFullBacklog(t *testing.T) {
+	// Nobody reads the unbuffered channel, so it is full
+	session := &UserSession{Jobs: make([]Job, 3), continuationChan: make(chan *UserSession)}
+	session.startStep(0, 0, 0)
+	session.currentStep++
+
+	done := make(chan struct{})
+	var res Workload
+	var err error
+	go func() {
+		res, err = session.enqueueContinuation(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the enqueue to return on a full backlog")
+	}
+
+	if err != nil || res != session || !session.Dropped || session.Truncated {
+		t.Errorf("Expected the dropped session without error, got %v / %v", res, err)
+	}
+	if stats := ComputeSessionStats([]UserSession{*session}); stats.Dropped != 1 || stats.Completed != 0 {
+		t.Errorf("Expected the session to be counted as dropped, got %+v", stats)
+	}
+}
+
+func TestArrivalController_MaxInFlightSessions(t *testing.T) {
+	params := testJobGenParams(100.0, 0.0, 2, 2) // 100% sessions
+	params.maxInFlightSessions = 1
+	ac := NewArrivalController(params, 4, 0, 42, 0)
+	if cap(ac.continuationChan) != 1 {
+		t.Errorf("Expected room for the sessions in flight, got a capacity of %d", cap(ac.continuationChan))
+	}
+
+	first, ok := ac.GenerateWorkload().(*UserSession)
+	if !ok {
+		t.Fatal("Expected a session below the limit")
+	}
+	if _, ok := ac.GenerateWorkload().(*Job); !ok || ac.cappedSessions != 1 {
+		t.Fatalf("Expected a job once the limit is reached, %d capped", ac.cappedSessions)
+	}
+
+	// Ending the session makes room for the next one
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := first.Execute(ctx, nil, &SearchParameters{}, logger, 0, 0, 0); err != context.Canceled {
+		t.Fatalf("Expected the cancellation, got %v", err)
+	}
+	if _, ok := ac.GenerateWorkload().(*UserSession); !ok {
+		t.Error("Expected a session after the first one ended")
+	}
+}
+
+func TestSessionLimiter(t *testing.T) {
+	unbounded := newSessionLimiter(0)
+	for range 3 {
+		if !unbounded.tryAcquire() {
+			t.Fatal("Expected no limit without a limiter")
+		}
+	}
+	unbounded.release()
+
+	limiter := newSessionLimiter(2)
+	if !limiter.tryAcquire() || !limiter.tryAcquire() || limiter.tryAcquire() {
+		t.Fatal("Expected exactly 2 sessions in flight")
+	}
+	limiter.release()
+	if !limiter.tryAcquire() {
+		t.Error("Expected room after a release")
 	}
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LoadStep sets the target arrival rate from offset on, relative to the start of the benchmark.
+type LoadStep struct {
+	offset    time.Duration
+	targetQPS float64
+}
+
+/**
+* LoadSchedule defines the target arrival rate over the course of the benchmark, e.g. a staircase that steps up the
+* load to see at which rate the latency degrades.
+* Between two steps, the rate either stays at the rate of the earlier step or ramps linearly to the rate of the
+* later one. After the last step, its rate applies until the end of the benchmark.
+ */
+type LoadSchedule struct {
+	steps []LoadStep // sorted by offset, the first one at offset 0
+	ramp  bool
+}
+
+// phaseSchedule returns the step schedule of the targetQPS of the phases, which run back to back.
+func phaseSchedule(phases []BenchmarkPhase) LoadSchedule {
+	steps := make([]LoadStep, len(phases))
+	var offset time.Duration
+	for i, phase := range phases {
+		steps[i] = LoadStep{offset: offset, targetQPS: phase.targetQPS}
+		offset += phase.duration
+	}
+	return LoadSchedule{steps: steps}
+}
+
+// resolveLoadSchedule returns the configured load schedule, or the step schedule of the benchmark phases.
+func resolveLoadSchedule(jobGenParams JobGenerationParameters) LoadSchedule {
+	if jobGenParams.loadSchedule != nil {
+		return *jobGenParams.loadSchedule
+	}
+	return phaseSchedule(resolvePhases(jobGenParams))
+}
+
+// checkLoadSchedule asserts that the schedule starts at the beginning of the benchmark and never stops the arrivals.
+func checkLoadSchedule(schedule LoadSchedule) error {
+	if len(schedule.steps) == 0 {
+		return fmt.Errorf("load schedule has no steps")
+	}
+	if schedule.steps[0].offset != 0 {
+		return fmt.Errorf("load schedule must start at offset 0, got %v", schedule.steps[0].offset)
+	}
+	for i, step := range schedule.steps {
+		if step.targetQPS <= 0 {
+			return fmt.Errorf("targetQPS at %v must be greater than 0, got %f", step.offset, step.targetQPS)
+		}
+		if i > 0 && step.offset <= schedule.steps[i-1].offset {
+			return fmt.Errorf("load schedule offsets must be increasing, %v follows %v", step.offset, schedule.steps[i-1].offset)
+		}
+	}
+	return nil
+}
+
+// At returns the target arrival rate after elapsed.
+func (s LoadSchedule) At(elapsed time.Duration) float64 {
+	i := len(s.steps) - 1
+	for i > 0 && s.steps[i].offset > elapsed {
+		i--
+	}
+	step := s.steps[i]
+	if !s.ramp || i == len(s.steps)-1 {
+		return step.targetQPS
+	}
+	next := s.steps[i+1]
+	progress := float64(elapsed-step.offset) / float64(next.offset-step.offset)
+	return step.targetQPS + progress*(next.targetQPS-step.targetQPS)
+}
+
+// String lists the steps as offset:targetQPS, e.g. "0s:50 -> 5m0s:100 (ramp)".
+func (s LoadSchedule) String() string {
+	steps := make([]string, len(s.steps))
+	for i, step := range s.steps {
+		steps[i] = fmt.Sprintf("%v:%g", step.offset, step.targetQPS)
+	}
+	if s.ramp {
+		return strings.Join(steps, " -> ") + " (ramp)"
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// Mean returns the target arrival rate averaged over the first duration of the benchmark.
+func (s LoadSchedule) Mean(duration time.Duration) float64 {
+	var arrivals float64
+	for i, step := range s.steps {
+		if step.offset >= duration {
+			break
+		}
+		end := duration
+		if i < len(s.steps)-1 {
+			end = min(s.steps[i+1].offset, duration)
+		}
+		// The rate is linear within a step, so its mean is the rate in the middle
+		arrivals += s.At(step.offset+(end-step.offset)/2) * (end - step.offset).Seconds()
+	}
+	return arrivals / duration.Seconds()
+}
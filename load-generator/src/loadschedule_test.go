@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSchedule_Steps(t *testing.T) {
+	schedule := LoadSchedule{steps: []LoadStep{{0, 50}, {time.Minute, 100}, {2 * time.Minute, 200}}}
+
+	cases := map[time.Duration]float64{0: 50, 59 * time.Second: 50, time.Minute: 100, 90 * time.Second: 100, time.Hour: 200}
+	for elapsed, expected := range cases {
+		if qps := schedule.At(elapsed); qps != expected {
+			t.Errorf("Expected %.2f QPS after %v, got %.2f", expected, elapsed, qps)
+		}
+	}
+	if mean := schedule.Mean(3 * time.Minute); math.Abs(mean-350.0/3) > 1e-9 {
+		t.Errorf("Expected mean %.2f QPS, got %.2f", 350.0/3, mean)
+	}
+}
+
+func TestLoadSchedule_Ramp(t *testing.T) {
+	schedule := LoadSchedule{steps: []LoadStep{{0, 50}, {time.Minute, 150}}, ramp: true}
+
+	cases := map[time.Duration]float64{0: 50, 30 * time.Second: 100, time.Minute: 150, time.Hour: 150}
+	for elapsed, expected := range cases {
+		if qps := schedule.At(elapsed); math.Abs(qps-expected) > 1e-9 {
+			t.Errorf("Expected %.2f QPS after %v, got %.2f", expected, elapsed, qps)
+		}
+	}
+	// 100 QPS on average during the ramp, 150 QPS afterwards
+	if mean := schedule.Mean(2 * time.Minute); math.Abs(mean-125) > 1e-9 {
+		t.Errorf("Expected mean 125 QPS, got %.2f", mean)
+	}
+}
+
+func TestResolveLoadSchedule_ConstantRate(t *testing.T) {
+	schedule := resolveLoadSchedule(JobGenerationParameters{targetQPS: 100, benchmarkDuration: time.Hour})
+	if len(schedule.steps) != 1 || schedule.At(0) != 100 || schedule.At(2*time.Hour) != 100 {
+		t.Errorf("Expected a single step at 100 QPS, got %s", schedule)
+	}
+
+	phases := []BenchmarkPhase{{duration: time.Minute, targetQPS: 100}, {duration: time.Minute, targetQPS: 200}}
+	schedule = resolveLoadSchedule(JobGenerationParameters{targetQPS: 100, phases: phases})
+	if schedule.At(59*time.Second) != 100 || schedule.At(time.Minute) != 200 {
+		t.Errorf("Expected the schedule to follow the phases, got %s", schedule)
+	}
+}
+
+func TestCheckLoadSchedule(t *testing.T) {
+	invalid := []LoadSchedule{
+		{},
+		{steps: []LoadStep{{time.Second, 50}}},
+		{steps: []LoadStep{{0, 50}, {0, 100}}},
+		{steps: []LoadStep{{0, 50}, {time.Minute, 0}}},
+	}
+	for _, schedule := range invalid {
+		if checkLoadSchedule(schedule) == nil {
+			t.Errorf("Expected an error for %s", schedule)
+		}
+	}
+}
+
+func TestLoadScheduleConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.txt")
+	if err := os.WriteFile(path, []byte("interpolation = ramp\n0s = 50\n\n5m = 100\n10m = 200\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := LoadScheduleConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !schedule.ramp || len(schedule.steps) != 3 || schedule.steps[2] != (LoadStep{10 * time.Minute, 200}) {
+		t.Errorf("Unexpected schedule %s", schedule)
+	}
+
+	if err := os.WriteFile(path, []byte("5m = 100\n0s = 50\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScheduleConfig(path); err == nil {
+		t.Error("Expected an error for decreasing offsets")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Parameters of the latency-based load shedding, which follows an additive-increase/multiplicative-decrease scheme
+const (
+	sheddingBackoffFactor = 0.8             // the rate is reduced to this fraction if the window latency exceeds the threshold
+	sheddingRecoveryStep  = 0.05            // fraction of targetQPS added back after a window below the threshold
+	sheddingMinFactor     = 0.01            // lower bound, so that arrivals never stop entirely
+	sheddingInterval      = 2 * time.Second // window over which the latency is averaged before each adjustment
+)
+
+// SheddingPoint is a single adjustment of the arrival rate by the load shedding.
+type SheddingPoint struct {
+	Elapsed     time.Duration // since the start of the benchmark
+	MeanLatency time.Duration // of the queries completed within the window
+	Factor      float64       // fraction of targetQPS after the adjustment
+	TargetQPS   float64       // effective arrival rate after the adjustment, before any rate-limit adaptation
+}
+
+// LoadSheddingStats reports how the arrival rate evolved while the client shed load.
+type LoadSheddingStats struct {
+	Threshold   time.Duration
+	Backoffs    int
+	FinalFactor float64
+	Trajectory  []SheddingPoint
+}
+
+/**
+* latencyShedder models a well-behaved client that reduces its arrival rate while the observed latency exceeds a
+* threshold and slowly raises it again once the latency recovers. Unlike the open-loop Poisson arrivals,
+* the rate reacts to the state of the server and settles at an equilibrium.
+ */
+type latencyShedder struct {
+	mu            sync.Mutex
+	threshold     time.Duration
+	factor        float64
+	start         time.Time
+	windowStart   time.Time
+	windowLatency time.Duration
+	windowQueries int
+	backoffs      int
+	trajectory    []SheddingPoint
+}
+
+func newLatencyShedder(threshold time.Duration, now time.Time) *latencyShedder {
+	return &latencyShedder{threshold: threshold, factor: 1, start: now, windowStart: now}
+}
+
+// Factor returns the fraction of targetQPS arrivals are currently generated with.
+func (s *latencyShedder) Factor() float64 {
+	if s == nil {
+		return 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.factor
+}
+
+// record adds the latency of a completed query, it returns true if the rate was reduced.
+func (s *latencyShedder) record(latency time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.windowLatency += latency
+	s.windowQueries++
+	if now.Sub(s.windowStart) < sheddingInterval {
+		return false
+	}
+
+	mean := s.windowLatency / time.Duration(s.windowQueries)
+	backoff := mean > s.threshold
+	if backoff {
+		s.factor = max(sheddingMinFactor, s.factor*sheddingBackoffFactor)
+		s.backoffs++
+	} else {
+		s.factor = min(1, s.factor+sheddingRecoveryStep)
+	}
+	s.trajectory = append(s.trajectory, SheddingPoint{Elapsed: now.Sub(s.start), MeanLatency: mean, Factor: s.factor})
+	s.windowStart = now
+	s.windowLatency = 0
+	s.windowQueries = 0
+	return backoff
+}
+
+// stats resolves the effective arrival rate of each adjustment from the load schedule at its time.
+func (s *latencyShedder) stats(schedule LoadSchedule) LoadSheddingStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trajectory := make([]SheddingPoint, len(s.trajectory))
+	for i, point := range s.trajectory {
+		point.TargetQPS = schedule.At(point.Elapsed) * point.Factor
+		trajectory[i] = point
+	}
+	return LoadSheddingStats{
+		Threshold:   s.threshold,
+		Backoffs:    s.backoffs,
+		FinalFactor: s.factor,
+		Trajectory:  trajectory,
+	}
+}
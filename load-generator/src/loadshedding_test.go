@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLatencyShedder_BackoffAndRecovery(t *testing.T) {
+	start := time.Now()
+	shedder := newLatencyShedder(50*time.Millisecond, start)
+
+	// Adjustments only happen once per window, based on the mean latency within it
+	if shedder.record(200*time.Millisecond, start.Add(time.Second)) {
+		t.Error("Expected no adjustment within the window")
+	}
+	if !shedder.record(10*time.Millisecond, start.Add(sheddingInterval)) {
+		t.Error("Expected backoff after a window with a mean latency above the threshold")
+	}
+	if shedder.Factor() != sheddingBackoffFactor {
+		t.Errorf("Expected factor %.2f, got %.2f", sheddingBackoffFactor, shedder.Factor())
+	}
+
+	if shedder.record(10*time.Millisecond, start.Add(2*sheddingInterval)) {
+		t.Error("Expected no backoff after a window below the threshold")
+	}
+	if math.Abs(shedder.Factor()-(sheddingBackoffFactor+sheddingRecoveryStep)) > 1e-9 {
+		t.Errorf("Expected factor %.2f after recovery, got %.2f", sheddingBackoffFactor+sheddingRecoveryStep, shedder.Factor())
+	}
+
+	stats := shedder.stats(phaseSchedule([]BenchmarkPhase{{duration: sheddingInterval, targetQPS: 100}, {duration: time.Hour, targetQPS: 200}}))
+	if stats.Backoffs != 1 || len(stats.Trajectory) != 2 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+	if stats.Trajectory[0].MeanLatency != 105*time.Millisecond {
+		t.Errorf("Expected mean latency 105ms, got %v", stats.Trajectory[0].MeanLatency)
+	}
+	// The first adjustment falls on the boundary and therefore into the second phase
+	if stats.Trajectory[0].TargetQPS != 200*sheddingBackoffFactor {
+		t.Errorf("Expected effective rate %.2f, got %.2f", 200*sheddingBackoffFactor, stats.Trajectory[0].TargetQPS)
+	}
+}
+
+func TestLatencyShedder_NilFactor(t *testing.T) {
+	var shedder *latencyShedder
+	if shedder.Factor() != 1 {
+		t.Errorf("Expected factor 1 without load shedding, got %.2f", shedder.Factor())
+	}
+}
@@ -1,28 +1,176 @@
 package main
 
 import (
-	"encoding/gob"
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/parquet-go/parquet-go"
 )
 
 type Logger struct {
+	prefix         string
+	format         string // logFormat at the time the logger was created
 	logFile        os.File
-	jobLogFile     os.File
-	sessionLogFile os.File
+	jobLogFile     *bufferedFile
+	sessionLogFile *bufferedFile
+	stopFlush      chan struct{}
+	flushDone      chan struct{}
 }
 
 const (
 	basePath = "log"
-	// CSV format for logging queries
-	jobFormat     = "timestamp,jobId,isUserSession,sessionId,step,queryVector,topResultIds,latencyMus,schedulingDelayMus\n"
-	sessionFormat = "timestamp,sessionId,numSteps,totalDurationMus,schedulingDelayMus\n"
+	// CSV format for logging queries, vectorField is empty for vecFieldName, searchEffort 0 without a sweep and
+	// partitions empty if all partitions are searched
+	jobFormat = "timestamp,jobId,isUserSession,sessionId,step,queryVector,topResultIds,topResultScores,latencyMus,schedulingDelayMus,vectorField,searchEffort,payloadBytes,partitions\n"
+	// numSteps counts the executed steps, schedulingDelayMus sums their delays
+	sessionFormat = "timestamp,sessionId,numSteps,totalDurationMus,schedulingDelayMus,truncated,dropped\n"
 )
 
+// Timestamp formats of the job and session logs
+const (
+	timestampDateTime    = "datetime"    // second precision, e.g. 2006-01-02 15:04:05
+	timestampMillis      = "millis"      // millisecond precision, e.g. 2006-01-02 15:04:05.000
+	timestampRFC3339Nano = "rfc3339nano" // nanosecond precision including the time zone
+	timestampOffset      = "offset"      // nanoseconds since the benchmark started, from the monotonic clock
+)
+
+// timestampFormat holds the format of job and session timestamps, set by SetTimestampFormat
+var timestampFormat = timestampDateTime
+
+// benchmarkStart is the reference point of offset timestamps, it carries a monotonic clock reading
+var benchmarkStart = time.Now()
+
+// SetTimestampFormat sets the timestamp format of the job and session logs
+func SetTimestampFormat(format string) error {
+	switch format {
+	case timestampDateTime, timestampMillis, timestampRFC3339Nano, timestampOffset:
+		timestampFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unknown timestamp format %q", format)
+	}
+}
+
+// SetBenchmarkStart sets the reference point of offset timestamps, before the workers start logging
+func SetBenchmarkStart(start time.Time) {
+	benchmarkStart = start
+}
+
+// formatTimestamp formats a job or session timestamp according to the configured format.
+func formatTimestamp(t time.Time) string {
+	switch timestampFormat {
+	case timestampMillis:
+		return t.Format("2006-01-02 15:04:05.000")
+	case timestampRFC3339Nano:
+		return t.Format(time.RFC3339Nano)
+	case timestampOffset:
+		// Sub uses the monotonic clock readings of both times, unaffected by wall clock adjustments
+		return fmt.Sprintf("%d", t.Sub(benchmarkStart).Nanoseconds())
+	default:
+		return t.Format(time.DateTime)
+	}
+}
+
+// Formats of the main log, the job and session logs are always CSV
+const (
+	logFormatText = "text" // "[timestamp] - message" lines in <prefix>-log.txt
+	logFormatJSON = "json" // one JSON object per line in <prefix>-log.jsonl, e.g. to ship into Loki or Elasticsearch
+)
+
+// logFormat holds the format of the main log of new loggers, set by SetLogFormat
+var logFormat = logFormatText
+
+// SetLogFormat sets the format of the main log of all loggers created afterwards
+func SetLogFormat(format string) error {
+	switch format {
+	case logFormatText, logFormatJSON:
+		logFormat = format
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// Levels of the main log entries in JSON format
+const (
+	logLevelInfo  = "info"
+	logLevelWarn  = "warn"
+	logLevelError = "error"
+)
+
+// LogEntry is a line of the main log in JSON format.
+type LogEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Component string    `json:"component"` // prefix of the logger, e.g. benchmark or warmup
+	Message   string    `json:"message"`
+}
+
+// logBufferSize holds the buffer size of the job and session logs in bytes, set by SetLogBufferSize
+var logBufferSize = 64 * 1024
+
+// logFlushInterval bounds how much of the job and session logs is lost on a crash
+const logFlushInterval = time.Second
+
+// SetLogBufferSize sets the buffer size of the job and session logs, 0 writes every entry directly to the file
+func SetLogBufferSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("log buffer size must not be negative, got %d", size)
+	}
+	logBufferSize = size
+	return nil
+}
+
+/**
+* bufferedFile collects log entries in memory to avoid a write syscall per query.
+* The workers log concurrently, so all access to the buffer is serialized.
+ */
+type bufferedFile struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer // nil writes through to the file
+}
+
+func newBufferedFile(file *os.File, size int) *bufferedFile {
+	b := &bufferedFile{file: file}
+	if size > 0 {
+		b.writer = bufio.NewWriterSize(file, size)
+	}
+	return b
+}
+
+func (b *bufferedFile) WriteString(s string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.writer == nil {
+		b.file.WriteString(s)
+		return
+	}
+	b.writer.WriteString(s)
+}
+
+func (b *bufferedFile) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.writer == nil {
+		return nil
+	}
+	return b.writer.Flush()
+}
+
+func (b *bufferedFile) Close() error {
+	flushErr := b.Flush()
+	if err := b.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
 // outputDir holds the current output directory, set by SetOutputDir
 var outputDir = "output"
 
@@ -36,12 +184,9 @@ func GetOutputDir() string {
 	return outputDir
 }
 
+// ensureOutputDir creates the output directory along with its parents, e.g. a dated results root.
 func ensureOutputDir() error {
-	err := os.Mkdir(outputDir, 0755)
-	if err != nil && !os.IsExist(err) {
-		return err
-	}
-	return nil
+	return os.MkdirAll(outputDir, 0755)
 }
 
 // outputPath prefixes the output directory to create a full file path.
@@ -54,8 +199,12 @@ func NewLogger(prefix string) (*Logger, error) {
 		return nil, err
 	}
 
+	extension := "txt"
+	if logFormat == logFormatJSON {
+		extension = "jsonl"
+	}
 	logFile, err := os.OpenFile(
-		outputPath(fmt.Sprintf("%s-%s.txt", prefix, basePath)),
+		outputPath(fmt.Sprintf("%s-%s.%s", prefix, basePath, extension)),
 		os.O_APPEND|os.O_CREATE|os.O_WRONLY,
 		0644,
 	)
@@ -82,17 +231,52 @@ func NewLogger(prefix string) (*Logger, error) {
 	jobFile.WriteString(jobFormat)
 	sessionFile.WriteString(sessionFormat)
 
-	return &Logger{
+	logger := &Logger{
+		prefix:         prefix,
+		format:         logFormat,
 		logFile:        *logFile,
-		jobLogFile:     *jobFile,
-		sessionLogFile: *sessionFile,
-	}, nil
+		jobLogFile:     newBufferedFile(jobFile, logBufferSize),
+		sessionLogFile: newBufferedFile(sessionFile, logBufferSize),
+		stopFlush:      make(chan struct{}),
+		flushDone:      make(chan struct{}),
+	}
+	go logger.flushPeriodically(logFlushInterval)
+	return logger, nil
+}
+
+// flushPeriodically writes the buffered job and session logs to disk until the logger is closed.
+func (l *Logger) flushPeriodically(interval time.Duration) {
+	defer close(l.flushDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stopFlush:
+			return
+		case <-ticker.C:
+			l.jobLogFile.Flush()
+			l.sessionLogFile.Flush()
+		}
+	}
 }
 
 func (l *Logger) Log(msg string) {
-	timestamp := time.Now().Format(time.DateTime)
-	logEntry := fmt.Sprintf("[%s] - %s\n", timestamp, msg)
+	l.log(logLevelInfo, msg)
+}
+
+// log writes the message at the level, which only the JSON format records.
+func (l *Logger) log(level string, msg string) {
+	now := time.Now()
+	logEntry := fmt.Sprintf("[%s] - %s\n", now.Format(time.DateTime), msg)
 	fmt.Println(logEntry)
+	if l.format == logFormatJSON {
+		// The console keeps the text format, only the file is meant for machines
+		data, err := json.Marshal(LogEntry{Timestamp: now, Level: level, Component: l.prefix, Message: msg})
+		if err != nil {
+			return
+		}
+		logEntry = string(data) + "\n"
+	}
 	l.logFile.WriteString(logEntry)
 }
 
@@ -102,69 +286,162 @@ func (l *Logger) Logf(format string, args ...any) {
 	fmt.Println(logEntry)
 }
 
+// Warnf logs a message at warn level, e.g. about lost work or a degraded measurement.
+func (l *Logger) Warnf(format string, args ...any) {
+	l.log(logLevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Errorf logs a message at error level, e.g. about a failed operation.
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(logLevelError, fmt.Sprintf(format, args...))
+}
+
 // LogJob logs the details of a Job in CSV format.
 func (l *Logger) LogJob(job *Job, sessionId int, step int) {
 	var isSession = sessionId >= 0 && step >= 0
 	logEntry := fmt.Sprintf(
-		"%s,%s,%t,%d,%d,\"%v\",\"%v\",%d,%d\n",
-		job.StartTimestamp.Format(time.DateTime),
+		"%s,%s,%t,%d,%d,\"%v\",\"%v\",\"%v\",%d,%d,%s,%d,%d,\"%s\"\n",
+		formatTimestamp(job.StartTimestamp),
 		job.Id,
 		isSession,
 		sessionId,
 		step,
 		job.QueryVector,
 		job.ResultIds,
+		job.ResultScores,
 		job.Latency.Microseconds(),
 		job.SchedulingDelay.Microseconds(),
+		job.VectorField,
+		job.SearchEffort,
+		job.PayloadBytes,
+		formatPartitions(job.Partitions),
 	)
 	l.jobLogFile.WriteString(logEntry)
 }
 
 func (l *Logger) LogSession(session *UserSession) {
 	logEntry := fmt.Sprintf(
-		"%s,%d,%d,%d,%d\n",
-		session.StartTimestamp.Format(time.DateTime),
+		"%s,%d,%d,%d,%d,%t,%t\n",
+		formatTimestamp(session.StartTimestamp),
 		session.SessionId,
-		len(session.Jobs),
+		session.executedSteps(),
 		session.Duration.Microseconds(),
 		session.SchedulingDelay.Microseconds(),
+		session.Truncated,
+		session.Dropped,
 	)
 	l.sessionLogFile.WriteString(logEntry)
 }
 
-func (l *Logger) LogDataRows(data []DataRow) error {
-	gobFile, err := os.Create(outputPath("data-rows.gob"))
+/**
+* DataRowsLog persists the data rows for the recall calculation batch by batch while they are inserted.
+* With a sharedDir, the rows are stored there once per dataset and the run only keeps a reference to them.
+ */
+type DataRowsLog struct {
+	logger *Logger
+	writer *dataRowsWriter
+	shared *sharedDataRowsWriter
+}
+
+func (l *Logger) OpenDataRowsLog(sharedDir string) (*DataRowsLog, error) {
+	if sharedDir == "" {
+		writer, err := newDataRowsWriter(outputPath(dataRowsFile))
+		if err != nil {
+			return nil, err
+		}
+		return &DataRowsLog{logger: l, writer: writer}, nil
+	}
+
+	shared, err := newSharedDataRowsWriter(sharedDir)
 	if err != nil {
+		return nil, err
+	}
+	return &DataRowsLog{logger: l, shared: shared}, nil
+}
+
+func (d *DataRowsLog) Write(rows []DataRow) error {
+	if d.shared != nil {
+		return d.shared.Write(rows)
+	}
+	return d.writer.Write(rows)
+}
+
+// Close completes the persisted data rows, shared rows are only referenced once all of them are written.
+func (d *DataRowsLog) Close() error {
+	if d.shared == nil {
+		_, err := d.writer.Close()
 		return err
 	}
 
-	encoder := gob.NewEncoder(gobFile)
-	err = encoder.Encode(data)
-	return err
+	ref, reused, err := d.shared.Close()
+	if err != nil {
+		return err
+	}
+	if reused {
+		d.logger.Logf("Reusing shared data rows %s", ref.Path)
+	} else {
+		d.logger.Logf("Stored shared data rows %s", ref.Path)
+	}
+	encoded, err := json.MarshalIndent(ref, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath(dataRowsRefFile), encoded, 0644)
+}
+
+// Abort stops persisting the data rows without referencing them.
+func (d *DataRowsLog) Abort() {
+	if d.shared != nil {
+		d.shared.Abort()
+		return
+	}
+	d.writer.Close()
 }
 
-func (l *Logger) LogJobsAndSessionsGob(jobs []Job, sessions []UserSession) error {
-	gobFile, err := os.Create(outputPath("jobs-sessions.gob"))
+// LogDataRows persists a complete set of data rows at once.
+func (l *Logger) LogDataRows(data []DataRow, sharedDir string) error {
+	log, err := l.OpenDataRowsLog(sharedDir)
 	if err != nil {
 		return err
 	}
+	if err := log.Write(data); err != nil {
+		log.Abort()
+		return err
+	}
+	return log.Close()
+}
 
-	encoder := gob.NewEncoder(gobFile)
-	err = encoder.Encode(struct {
-		Jobs     []Job
-		Sessions []UserSession
-	}{
-		Jobs:     jobs,
-		Sessions: sessions,
-	})
-	return err
+// LogJobsAndSessionsGob persists the executed queries along with the metric needed for their ground truth.
+func (l *Logger) LogJobsAndSessionsGob(jobs []Job, sessions []UserSession, metric string) error {
+	return writeJobsAndSessions(outputPath(jobsSessionsFile), jobs, sessions, metric)
 }
 
 func (l *Logger) LogEnhancedResults(results []EnhancedJobResult) error {
 	return parquet.WriteFile(outputPath("enhanced-results.parquet"), results)
 }
 
+// LogSummary writes the aggregate results of the run as indented JSON.
+func (l *Logger) LogSummary(summary *Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath("summary.json"), data, 0644)
+}
+
+// LogDebugSamples writes the sampled search requests and responses as indented JSON.
+func (l *Logger) LogDebugSamples(samples []DebugSample) error {
+	data, err := json.MarshalIndent(samples, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath("debug-samples.json"), data, 0644)
+}
+
+// Close flushes the buffered logs and closes all log files.
 func (l *Logger) Close() {
+	close(l.stopFlush)
+	<-l.flushDone
 	l.logFile.Close()
 	l.jobLogFile.Close()
 	l.sessionLogFile.Close()
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	defer SetTimestampFormat(timestampDateTime)
+	ts := time.Date(2024, 5, 1, 12, 30, 45, 123456789, time.UTC)
+
+	cases := map[string]string{
+		timestampDateTime:    "2024-05-01 12:30:45",
+		timestampMillis:      "2024-05-01 12:30:45.123",
+		timestampRFC3339Nano: "2024-05-01T12:30:45.123456789Z",
+	}
+	for format, expected := range cases {
+		if err := SetTimestampFormat(format); err != nil {
+			t.Fatal(err)
+		}
+		if actual := formatTimestamp(ts); actual != expected {
+			t.Errorf("Expected %s timestamp %s, got %s", format, expected, actual)
+		}
+	}
+}
+
+func TestFormatTimestamp_Offset(t *testing.T) {
+	defer SetTimestampFormat(timestampDateTime)
+	if err := SetTimestampFormat(timestampOffset); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(time.Hour) // e.g. after preparing the collection
+	SetBenchmarkStart(start)
+	offset, err := strconv.ParseInt(formatTimestamp(start.Add(1500*time.Microsecond)), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 1500000 {
+		t.Errorf("Expected offset 1500000ns, got %d", offset)
+	}
+}
+
+func TestSetTimestampFormat_Unknown(t *testing.T) {
+	if err := SetTimestampFormat("unix"); err == nil {
+		t.Error("Expected error for unknown timestamp format")
+	}
+}
+
+// readCSV parses a log file written by the logger into its header and rows.
+func readCSV(t *testing.T, filename string) ([]string, [][]string) {
+	file, err := os.Open(outputPath(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records[0], records[1:]
+}
+
+func TestLogSession_RowMatchesHeader(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	session := &UserSession{
+		SessionId:       7,
+		Jobs:            []Job{{StartTimestamp: start}, {StartTimestamp: start}, {StartTimestamp: start}},
+		StartTimestamp:  start,
+		Duration:        1500 * time.Microsecond,
+		SchedulingDelay: 20 * time.Microsecond,
+	}
+	logger.LogSession(session)
+	// Only the first of the planned steps was executed before the benchmark ended
+	truncated := &UserSession{
+		SessionId:      8,
+		Jobs:           []Job{{StartTimestamp: start}, {}, {}},
+		StartTimestamp: start,
+		Duration:       500 * time.Microsecond,
+		Truncated:      true,
+	}
+	logger.LogSession(truncated)
+	logger.Close()
+
+	header, rows := readCSV(t, fmt.Sprintf("test-%s-session.csv", basePath))
+	if strings.Join(header, ",")+"\n" != sessionFormat {
+		t.Errorf("Unexpected header %v", header)
+	}
+	if len(rows) != 2 || len(rows[0]) != len(header) || len(rows[1]) != len(header) {
+		t.Fatalf("Expected two rows with %d columns, got %v", len(header), rows)
+	}
+	expected := []map[string]string{
+		{"sessionId": "7", "numSteps": "3", "totalDurationMus": "1500", "schedulingDelayMus": "20", "truncated": "false", "dropped": "false"},
+		{"sessionId": "8", "numSteps": "1", "totalDurationMus": "500", "truncated": "true", "dropped": "false"},
+	}
+	for row, values := range expected {
+		for i, column := range header {
+			if value, ok := values[column]; ok && rows[row][i] != value {
+				t.Errorf("Row %d: expected %s %s, got %s", row, column, value, rows[row][i])
+			}
+		}
+	}
+}
+
+func TestLogJob_RowMatchesHeader(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &Job{Id: "S-1-2", QueryVector: Vector{1, 2}, ResultIds: []int64{3, 4}, ResultScores: []float32{0.5, 0.25}, Latency: 250 * time.Microsecond}
+	logger.LogJob(job, 1, 2)
+	logger.Close()
+
+	header, rows := readCSV(t, "test-jobs.csv")
+	if len(rows) != 1 || len(rows[0]) != len(header) {
+		t.Fatalf("Expected a single row with %d columns, got %v", len(header), rows)
+	}
+	expected := map[string]string{"jobId": "S-1-2", "isUserSession": "true", "step": "2", "topResultScores": "[0.5 0.25]", "latencyMus": "250"}
+	for i, column := range header {
+		if value, ok := expected[column]; ok && rows[0][i] != value {
+			t.Errorf("Expected %s %s, got %s", column, value, rows[0][i])
+		}
+	}
+}
+
+func TestSetLogBufferSize_Negative(t *testing.T) {
+	if err := SetLogBufferSize(-1); err == nil {
+		t.Error("Expected error for negative log buffer size")
+	}
+}
+
+func TestLog_JSONFormat(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	defer SetLogFormat(logFormatText)
+	if err := SetLogFormat(logFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Logf("Executed %d jobs", 3)
+	logger.Warnf("Warning: all workers are busy, dropped %d workloads so far", 2)
+	logger.Errorf("Metrics server stopped: %v", os.ErrClosed)
+	logger.Log("Failed attempts are not errors by their wording")
+	logger.Close()
+
+	data, err := os.ReadFile(outputPath(fmt.Sprintf("test-%s.jsonl", basePath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 entries, got %d: %s", len(lines), data)
+	}
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Level != logLevelInfo || entry.Component != "test" || entry.Message != "Executed 3 jobs" || entry.Timestamp.IsZero() {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	for i, level := range []string{logLevelWarn, logLevelError, logLevelInfo} {
+		if err := json.Unmarshal([]byte(lines[i+1]), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Level != level {
+			t.Errorf("%q: expected level %s, got %s", entry.Message, level, entry.Level)
+		}
+	}
+}
+
+func TestSetLogFormat_Unknown(t *testing.T) {
+	if err := SetLogFormat("xml"); err == nil {
+		t.Error("Expected error for unknown log format")
+	}
+}
+
+// BenchmarkLogJob compares writing every job directly to the file with the buffered log.
+func BenchmarkLogJob(b *testing.B) {
+	defer SetLogBufferSize(logBufferSize)
+	defer SetOutputDir("output")
+	job := &Job{Id: "J-1", QueryVector: make(Vector, 100), ResultIds: make([]int64, 10), Latency: time.Millisecond}
+
+	for _, size := range []int{0, 64 * 1024} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			SetOutputDir(b.TempDir())
+			SetLogBufferSize(size)
+			logger, err := NewLogger("bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer logger.Close()
+
+			b.ResetTimer()
+			for range b.N {
+				logger.LogJob(job, -1, -1)
+			}
+		})
+	}
+}
+
+func TestNewLogger_NestedOutputDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "results", "2024-06-01", "output-config1-dim50")
+	SetOutputDir(dir)
+	defer SetOutputDir("output")
+
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatalf("Expected the missing parents to be created, got %v", err)
+	}
+	defer logger.Close()
+	if _, err := os.Stat(outputPath("test-log.txt")); err != nil {
+		t.Errorf("Expected the log in the nested output directory: %v", err)
+	}
+}
@@ -2,228 +2,1006 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
-
-	"github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
 type ConstructionIndexParameters struct {
-	distanceMetric string
-	M              int
-	efConstruction int
+	indexType               string // HNSW, GPU_IVF_FLAT, GPU_CAGRA or BIN_IVF_FLAT
+	distanceMetric          string
+	vectorType              string // float, float16 or binary
+	M                       int    // HNSW
+	efConstruction          int    // HNSW
+	nlist                   int    // GPU_IVF_FLAT, BIN_IVF_FLAT
+	intermediateGraphDegree int    // GPU_CAGRA
+	graphDegree             int    // GPU_CAGRA
+}
+
+// IndexSearchParameters holds the index-specific search parameters of the index types.
+type IndexSearchParameters struct {
+	ef          int // HNSW, how many neighbors to evaluate during the search
+	nprobe      int // GPU_IVF_FLAT, BIN_IVF_FLAT
+	itopkSize   int // GPU_CAGRA
+	searchWidth int // GPU_CAGRA
+	// Search efforts the queries cycle through, i.e. ef, nprobe or itopkSize, nil applies the value above to every query
+	effortSweep []int
 }
 
 type JobGenerationParameters struct {
-	workloadStdDev    float32
-	workloadMean      float32
-	followUpStdDev    float32
-	followUpMean      float32
-	minSessionLength  int
-	maxSessionLength  int
-	targetQPS         float64 // Target queires per second
-	benchmarkDuration time.Duration
-	jobProbability    float64 // Probability of generating a Job vs UserSession (0.0-1.0)
+	workloadStdDev     float32
+	workloadMean       float32
+	followUpStdDev     float32
+	followUpMean       float32
+	minSessionLength   int
+	maxSessionLength   int
+	targetQPS          float64 // Target queires per second
+	benchmarkDuration  time.Duration
+	jobProbability     float64 // Probability of generating a Job vs UserSession (0.0-1.0)
+	perturbationStdDev float32 // Std. deviation of the noise added to each query right before the search (0 disables)
+	// Number of partitions searched by each query (0 searches all), sessions search the same partitions throughout
+	partitionsPerQuery    int
+	partitionDistribution string // uniform or zipf
+	// Fraction of queries with an additional scalar filter (0 disables), sessions use the same filter throughout
+	filterProbability float64
+	filterTemplate    string // filter expression, {random} is replaced by a random value, e.g. "id > {random}"
+	filterMaxValue    int64  // exclusive upper bound of {random}
+	// Fraction of workloads that are hybrid searches on all vector fields (0 disables), requires extraVectorFields
+	hybridProbability float64
+	// Fraction of workloads that delete or upsert a random row instead of searching (0 disables)
+	mutationProbability float64
+	mutationKind        string // delete, upsert or mixed
+	mutationMaxId       int64  // exclusive upper bound of the mutated ids
+	// Optional targetQPS over time, replacing the targetQPS of the phases, see LoadScheduleConfig
+	loadSchedule *LoadSchedule
+	// Optional phases run back to back, replacing targetQPS, jobProbability and benchmarkDuration
+	phases []BenchmarkPhase
+	// Scale the generated queries to unit length, e.g. for normalized datasets searched with IP or COSINE
+	normalizeQueries bool
+	// Sessions executing a step or waiting for the next one at once, further sessions arrive as jobs instead.
+	// 0 allows twice the number of workers, negative values do not limit the sessions.
+	maxInFlightSessions int
+	// How the follow-up queries of sessions follow from the previous step: additive, interpolate, randomwalk or kthresult
+	sessionDrift string
+	driftRate    float64 // fraction of the way toward the top result per step of the interpolate model
+	driftDecay   float64 // factor the offset shrinks by every step of the randomwalk model
+	driftRank    int     // position of the result the kthresult model drifts from, 1 is the top result
+	// Seed of the generated queries, set by -seed or drawn per run, the same seed generates the same workload
+	seed int64
+}
+
+// BenchmarkPhase defines the arrival rate and workload mix for a period of the benchmark.
+type BenchmarkPhase struct {
+	name           string
+	duration       time.Duration
+	targetQPS      float64
+	jobProbability float64
+}
+
+// ConcurrencyStage defines the number of active workers for a period of the benchmark.
+type ConcurrencyStage struct {
+	workers  int
+	duration time.Duration
 }
 
 type Config struct {
 	milvusAddr          string
+	connection          ConnectionConfig // credentials and TLS, read from MILVUS_USER, MILVUS_PASSWORD, MILVUS_TLS and MILVUS_CA_CERT
+	connectRetries      int              // how often a failed connection attempt is retried with exponential backoff on startup
+	connectTimeout      time.Duration    // upper bound for a single connection attempt
 	dbName              string
 	collection          string
 	idFieldName         string
 	vecFieldName        string
+	extraVectorFields   []string // additional vector fields holding permuted copies of the dataset vectors, each job searches one field at random
 	fieldName           string
 	dim                 int
 	concurrency         int
-	ef                  int
+	workloadMode        string // poisson (open loop at targetQPS), closed (workers issue queries back to back) or sequential (one worker, reproducible order)
 	k                   int
 	insertBatchSize     int
+	insertBatchBytes    int  // upper bound of the payload of an insert request, splitting batches of high-dim vectors, 0 disables
+	insertConcurrency   int  // workers inserting batches of the dataset at once during the preparation
+	insertStats         bool // write the latency of every insert request of the preparation to insert-stats.csv
 	numberWarmupQueries int
+	warmupTranche       float64 // fraction of warmup queries at the beginning and end whose latency is compared, 0 disables
+	warmupSource        string  // random (Gaussian queries) or dataset (sampled dataset vectors)
+	warmupJitter        float64 // standard deviation of the noise added to sampled warmup queries, 0 disables
+	warmupConcurrency   int     // workers of the closed-loop warmup, 0 uses concurrency
+	recallBatchSize     int     // consecutive queries sharing one pass over the data during recall calculation
 	dataFile            string
+	dataSha256          string        // expected checksum of dataFile, verified by -fetch
+	dataFormat          string        // text or parquet
+	dataSource          string        // file (dataFile) or generated (dataSize Gaussian vectors of dim, see DataGenerator)
+	dataSize            int           // number of rows of a generated dataset
+	dataMean            float64       // mean of the generated dataset
+	dataStdDev          float64       // standard deviation of the generated dataset
+	idSource            string        // sequential ids by line or ids read from the first field of each line
+	duplicateIds        string        // error or reassign when the dataset contains duplicate ids
+	malformedLines      string        // error or skip when a line of a text dataset cannot be parsed
+	collectServerStats  bool          // query segment and system statistics from Milvus after the benchmark
+	loadTimeout         time.Duration // upper bound for a single attempt to load the collection
+	loadRetries         int           // how often a failed or stalled load is retried
+	searchRetries       int           // how often a failed benchmark search is retried, retried jobs are reported separately
+	queryTimeout        time.Duration // upper bound of a single benchmark search, timed-out searches count with this latency, 0 disables
+	recallByRetries     bool          // break out the recall of retried and first-try jobs in the recall summary
+	recallCache         bool          // compute the ground truth of identical queries only once, false scans the data for every job
+	recallTieAware      bool          // count results as close as the k-th true neighbor as correct, e.g. with duplicate vectors
+	recallUnrolled      bool          // compute the ground-truth distances with unrolled loops, faster but may break ties differently
+	spillThreshold      int           // completed jobs and sessions held in memory before they are written to a gob segment, 0 disables
+	indexBuildTimeout   time.Duration // upper bound for all rows to be indexed after creating the index, 0 skips the check
+	keepCollection      bool          // keep the collection and database after the run, e.g. to reuse them with -skip-prepare
+	checkDimensions     bool          // assert that config, dataset and collection schema agree on dim before inserting
+	sharedDataRowsDir   string        // store the data rows once per dataset in this directory instead of per run
+	numPartitions       int           // partitions the rows are distributed over, 0 keeps the default partition
+	partitionAssignment string        // how rows are assigned to partitions: roundrobin, id or word
+	maxTopK             int           // top-k limit of the server (common.topKLimit)
+	topKPolicy          string        // clamp or error if k exceeds maxTopK
+	stabilityQueries    int           // queries of the result-stability test after the benchmark, 0 disables it
+	stabilityRepeats    int           // how often each query of the stability test is repeated
+	reportArrivalStats  bool          // measure the realized arrival rate and compare it with targetQPS
+	adaptToRateLimits   bool          // back off the arrival rate when Milvus rejects queries due to rate limits
+	sheddingThreshold   time.Duration // mean latency above which the client reduces its arrival rate, 0 disables
+	loadScheduleFile    string        // time -> targetQPS pairs the arrival rate follows, e.g. a step-load staircase, empty disables
+	overloadPolicy      string        // drop arrivals while all workers are busy (honor the arrival process) or block (never lose work)
+	printWrkSummary     bool          // print a wrk2-style summary to the console at the end of the run
+	timeSeriesInterval  time.Duration // bucket width of the latency time series CSV, 0 disables it
+	throughputWindow    time.Duration // bucket width of the target versus achieved QPS CSV of Poisson runs, 0 disables it
+	latencyPlotSpec     bool          // emit a Vega-Lite spec charting the latency time series
+	driftThreshold      float64       // relative latency increase of the trend over the run flagged as degradation, 0 disables
+	timestampFormat     string        // precision of job and session timestamps: datetime, millis, rfc3339nano or offset
+	logBufferSize       int           // buffer of the job and session logs in bytes, flushed every second, 0 writes every query directly
+	logFormat           string        // format of the main log: text (<prefix>-log.txt) or json (<prefix>-log.jsonl)
+	debugSampleRate     float64       // fraction of queries whose full request and response is dumped, 0 disables
+	debugMaxSamples     int           // upper bound of dumped queries
+	rerankFieldName     string        // full-precision copy of the vectors, enables a quantized index with re-ranking
+	rerankCandidates    int           // number of candidates fetched from the quantized index for re-ranking
+	rerankRecall        bool          // additionally measure the first-stage recall before re-ranking
+	filterExpr          string        // boolean expression filtering every search, e.g. "id > 1000"
+	outputFields        []string      // scalar fields returned with every search result
+	scalarFields        []ScalarField // additional scalar fields of the collection, e.g. to filter on
+	hybridReranker      string        // rrf or weighted fusion of the sub-searches of hybrid jobs
+	hybridRRFK          float64       // smoothing constant k of the rrf reranker
+	hybridWeights       []float64     // weight of each vector field for the weighted reranker, nil weights all fields equally
 	indexParameters     ConstructionIndexParameters
+	indexSearchParams   IndexSearchParameters
 	jobGenParams        JobGenerationParameters
+	// Optional stages run back to back, replacing concurrency and benchmarkDuration, e.g. to step up the worker count
+	concurrencyStages []ConcurrencyStage
 }
 
-const milvusPort = "19530"
+const defaultMilvusPort = "19530"
 
-// getMilvusAddr returns the Milvus address from environment variable MILVUS_IP or localhost as fallback.
+/**
+* getMilvusAddr returns the Milvus address from environment variable MILVUS_IP or localhost as fallback.
+* The port is read from MILVUS_PORT, unless MILVUS_IP already contains one, e.g. "milvus.example.com:443".
+ */
 func getMilvusAddr() string {
 	ip := os.Getenv("MILVUS_IP")
 	if ip == "" {
 		fmt.Println("MILVUS_IP not set, defaulting to localhost")
 		ip = "localhost"
 	}
-	return ip + ":" + milvusPort
+	if strings.Contains(ip, ":") {
+		return ip
+	}
+	port := os.Getenv("MILVUS_PORT")
+	if port == "" {
+		port = defaultMilvusPort
+	}
+	return ip + ":" + port
 }
 
 var config Config = Config{
 	milvusAddr:          getMilvusAddr(),
+	connection:          getConnectionConfig(),
+	connectRetries:      8, // about 2.5 minutes of backoff in total
+	connectTimeout:      10 * time.Second,
 	dbName:              "benchmark",
 	collection:          "benchmarkData",
 	idFieldName:         "id",
 	vecFieldName:        "vector",
+	extraVectorFields:   nil, // e.g. {"title", "body"}
 	fieldName:           "word",
 	concurrency:         50,
-	ef:                  400, // how many neighbors to evaluate during the search
-	k:                   10,  // number of results returned from the query
+	workloadMode:        workloadModePoisson,
+	k:                   10, // number of results returned from the query
 	insertBatchSize:     1000,
+	insertBatchBytes:    8 << 20, // well below the gRPC message size limit of Milvus
+	insertConcurrency:   1,       // e.g. 4
+	insertStats:         false,
 	numberWarmupQueries: 5000,
+	warmupTranche:       0.1,
+	warmupSource:        warmupSourceRandom,
+	warmupJitter:        0.0, // e.g. 0.05
+	warmupConcurrency:   0,
+	recallBatchSize:     DefaultRecallOptions().BatchSize,
+	dataFormat:          dataFormatText,
+	dataSource:          dataSourceFile,
+	dataSize:            0,   // e.g. 1000000
+	dataMean:            0.0, // like the generated queries
+	dataStdDev:          7.5,
+	idSource:            idSourceSequential,
+	duplicateIds:        duplicateIdsError,
+	malformedLines:      malformedLinesError,
+	collectServerStats:  false,
+	loadTimeout:         10 * time.Minute,
+	loadRetries:         2,
+	searchRetries:       0,
+	queryTimeout:        0, // e.g. 5 * time.Second
+	recallByRetries:     true,
+	recallCache:         DefaultRecallOptions().CacheGroundTruth,
+	recallTieAware:      DefaultRecallOptions().TieAware,
+	recallUnrolled:      false,
+	spillThreshold:      0, // e.g. 100000
+	indexBuildTimeout:   30 * time.Minute,
+	keepCollection:      false,
+	checkDimensions:     true,
+	sharedDataRowsDir:   "", // e.g. "shared", empty persists the data rows in the output directory
+	numPartitions:       0,
+	partitionAssignment: partitionAssignmentRoundRobin,
+	maxTopK:             16384, // Milvus default
+	topKPolicy:          topKPolicyError,
+	stabilityQueries:    0,
+	stabilityRepeats:    10,
+	reportArrivalStats:  true,
+	adaptToRateLimits:   false,
+	sheddingThreshold:   0,  // e.g. 50 * time.Millisecond
+	loadScheduleFile:    "", // e.g. "schedule.txt", see LoadScheduleConfig
+	overloadPolicy:      overloadPolicyDrop,
+	printWrkSummary:     true,
+	timeSeriesInterval:  time.Second,
+	throughputWindow:    time.Second,
+	latencyPlotSpec:     false,
+	driftThreshold:      0.2,
+	timestampFormat:     timestampDateTime,
+	logBufferSize:       64 * 1024,
+	logFormat:           logFormatText,
+	debugSampleRate:     0.0,
+	debugMaxSamples:     100,
+	rerankFieldName:     "", // e.g. "vector_full", empty disables re-ranking
+	rerankCandidates:    50,
+	rerankRecall:        true,
+	filterExpr:          "",  // empty disables filtered search
+	outputFields:        nil, // e.g. []string{"word"}, the payload size per query is reported at the end
+	scalarFields:        nil, // e.g. ParseScalarFields("category:int64:20,score:float,flag:bool")
+	hybridReranker:      hybridRerankerRRF,
+	hybridRRFK:          60, // Milvus default
+	hybridWeights:       nil,
 	jobGenParams: JobGenerationParameters{
-		workloadStdDev:    7.5,
-		workloadMean:      0.0,
-		followUpStdDev:    0.15,
-		followUpMean:      1.25,
-		minSessionLength:  5,
-		maxSessionLength:  50,
-		targetQPS:         100.0,
-		benchmarkDuration: 30 * time.Minute,
-		jobProbability:    0.85,
+		workloadStdDev:        7.5,
+		workloadMean:          0.0,
+		followUpStdDev:        0.15,
+		followUpMean:          1.25,
+		minSessionLength:      5,
+		maxSessionLength:      50,
+		targetQPS:             100.0,
+		benchmarkDuration:     30 * time.Minute,
+		jobProbability:        0.85,
+		perturbationStdDev:    0.0,
+		partitionsPerQuery:    0,
+		partitionDistribution: partitionDistributionUniform,
+		filterProbability:     0.0,
+		filterTemplate:        "id > " + filterPlaceholder,
+		filterMaxValue:        400000, // size of the GloVe datasets
+		hybridProbability:     0.0,
+		mutationProbability:   0.0,
+		mutationKind:          mutationKindDelete,
+		mutationMaxId:         400000, // size of the GloVe datasets
+		normalizeQueries:      false,
+		maxInFlightSessions:   0,
+		sessionDrift:          driftAdditive,
+		driftRate:             0.5,
+		driftDecay:            0.8,
+		driftRank:             3,
+		loadSchedule:          nil, // loaded from loadScheduleFile
+		phases:                nil, // e.g. {{"read-heavy", 10 * time.Minute, 200, 0.95}, {"sessions", 10 * time.Minute, 100, 0.5}}
 	},
 	indexParameters: ConstructionIndexParameters{
-		distanceMetric: "L2", // euclidean distance (constant)
+		indexType:      indexTypeHNSW,
+		distanceMetric: metricL2, // L2, IP, COSINE or HAMMING (binary vectors)
+		vectorType:     vectorTypeFloat,
 	},
+	indexSearchParams: IndexSearchParameters{
+		ef:          400,
+		nprobe:      16,
+		itopkSize:   64,
+		searchWidth: 1,
+		effortSweep: nil, // e.g. {16, 32, 64, 128, 256}
+	},
+	concurrencyStages: nil, // e.g. {{10, 5 * time.Minute}, {50, 5 * time.Minute}, {100, 5 * time.Minute}}
 }
 
-var validDatasetIds = map[int]bool{50: true, 100: true, 200: true}
+// Arguments is the parsed command line, overrides are only applied if the flag was given.
+type Arguments struct {
+	configId             int
+	dimId                int
+	recallAfterBenchmark bool
+	fetch                bool
+	validate             bool
+	skipPrepare          bool
+	version              bool
+	metricsAddr          string
+	replayDir            string
+	outDir               string          // root of the output directory, e.g. results/2024-06-01, empty uses the working directory
+	overrides            map[string]bool // names of the given override flags
+	targetQPS            float64
+	benchmarkDuration    time.Duration
+	concurrency          int
+	jobProbability       float64
+	mode                 string
+	schedule             string
+	seed                 int64 // drawn from the clock if -seed is not given
+}
 
-func parseArgs() (configId int, dimId int, recallAfterBenchmark bool, err error) {
-	if len(os.Args) < 3 || len(os.Args) > 4 {
-		return 0, 0, true, fmt.Errorf(`usage: %s <config_id> <dataset_id> <offline_recall>
-			config_id:  index configuration number (1-3)
-			dataset_id: dataset dimensionality (50, 100, 200)
-			Optional: recall_after_benchmark (true/false) whether to calculate recall directly after benchmark execution (defaults to true)`,
-			os.Args[0])
+/**
+* parseArgs reads the configuration and dataset ids either from -config and -dataset or positionally,
+* e.g. "-config 1 -dataset 50 -qps 250 -duration 10m" or "1 50 true".
+ */
+func parseArgs(arguments []string) (args Arguments, err error) {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.IntVar(&args.configId, "config", 0, "index configuration number, see configs/index-<id>.txt")
+	flags.IntVar(&args.dimId, "dataset", 0, "dataset dimensionality, see configs/dim-<id>.txt")
+	flags.BoolVar(&args.recallAfterBenchmark, "recall", true, "calculate recall directly after benchmark execution")
+	flags.BoolVar(&args.fetch, "fetch", false, "download and verify the dataset if it is missing")
+	flags.BoolVar(&args.validate, "validate", false, "check the configuration and dataset and print the effective configuration without connecting to Milvus")
+	flags.BoolVar(&args.version, "version", false, "print the build version and commit and exit")
+	flags.StringVar(&args.metricsAddr, "metrics-addr", "",
+		"serve live Prometheus metrics of the benchmark on this address, e.g. :2112, empty disables the metrics server")
+	flags.StringVar(&args.replayDir, "replay", "",
+		"re-issue the queries of a previous run from its output directory instead of generating new ones")
+	flags.StringVar(&args.outDir, "outdir", os.Getenv("BENCHMARK_OUTDIR"),
+		"directory the output-config<id>-dim<id> directory is created in, defaults to $BENCHMARK_OUTDIR or the working directory")
+	flags.BoolVar(&args.skipPrepare, "skip-prepare", false,
+		"reuse the existing collection of a previous run instead of preparing it, the collection is kept afterwards")
+	flags.Float64Var(&args.targetQPS, "qps", config.jobGenParams.targetQPS, "target queries per second")
+	flags.DurationVar(&args.benchmarkDuration, "duration", config.jobGenParams.benchmarkDuration, "benchmark duration, e.g. 10m")
+	flags.IntVar(&args.concurrency, "concurrency", config.concurrency, "number of workers")
+	flags.Float64Var(&args.jobProbability, "job-probability", config.jobGenParams.jobProbability,
+		"probability of an independent job instead of a session (0.0-1.0)")
+	flags.StringVar(&args.mode, "mode", config.workloadMode,
+		"workload mode: poisson, closed or sequential (a single worker, reproducible query order)")
+	flags.StringVar(&args.schedule, "schedule", config.loadScheduleFile,
+		"load schedule file of time = targetQPS lines the arrival rate follows instead of -qps")
+	flags.Int64Var(&args.seed, "seed", 0,
+		"seed of the generated workload, e.g. the logged seed of a previous run to repeat its workload, omitted draws a fresh seed")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), `usage: %s [flags] [<config_id> <dataset_id> [recall_after_benchmark]]
+			config_id:  index configuration number of configs/index-<config_id>.txt, alternatively -config
+			dataset_id: dataset dimensionality of configs/dim-<dataset_id>.txt, alternatively -dataset
+			Optional: recall_after_benchmark (true/false) whether to calculate recall directly after benchmark execution (defaults to true)
+`, os.Args[0])
+		flags.PrintDefaults()
 	}
-
-	configId, err = strconv.Atoi(os.Args[1])
-	if err != nil || configId < 1 || configId > 3 {
-		return 0, 0, true, fmt.Errorf("invalid config_id: must be a number between 1 and 3")
+	err = flags.Parse(arguments)
+	if err != nil {
+		return Arguments{}, err
+	}
+	args.overrides = make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { args.overrides[f.Name] = true })
+	if args.version {
+		return args, nil
 	}
-	dimId, err = strconv.Atoi(os.Args[2])
-	if err != nil || !validDatasetIds[dimId] {
-		return 0, 0, true, fmt.Errorf("invalid dimensionality: must be one of [50, 100, 200]")
+	if !args.overrides["seed"] {
+		args.seed = time.Now().UnixNano()
 	}
 
-	recallAfterBenchmark, err = strconv.ParseBool(os.Args[3])
-	if err != nil {
-		recallAfterBenchmark = true // default to true if not provided or invalid
+	positional := flags.Args()
+	if !args.overrides["config"] && !args.overrides["dataset"] {
+		if len(positional) < 2 || len(positional) > 3 {
+			flags.Usage()
+			return Arguments{}, fmt.Errorf("expected 2 or 3 arguments, got %d", len(positional))
+		}
+		args.configId, err = strconv.Atoi(positional[0])
+		if err != nil {
+			args.configId = 0 // rejected below
+		}
+		args.dimId, err = strconv.Atoi(positional[1])
+		if err != nil {
+			args.dimId = 0 // rejected below
+		}
+		if len(positional) == 3 {
+			if parsed, parseErr := strconv.ParseBool(positional[2]); parseErr == nil {
+				args.recallAfterBenchmark = parsed
+			}
+		}
+	} else if len(positional) > 0 {
+		flags.Usage()
+		return Arguments{}, fmt.Errorf("unexpected arguments %v after -config and -dataset", positional)
 	}
 
-	return
+	// Whether a configuration exists is checked by checkConfigFiles
+	if args.configId < 1 {
+		return Arguments{}, fmt.Errorf("invalid config_id: must be a positive number")
+	}
+	if args.dimId < 1 {
+		return Arguments{}, fmt.Errorf("invalid dimensionality: must be a positive number")
+	}
+	if args.targetQPS <= 0 {
+		return Arguments{}, fmt.Errorf("invalid qps: must be greater than 0")
+	}
+	if args.benchmarkDuration <= 0 {
+		return Arguments{}, fmt.Errorf("invalid duration: must be greater than 0")
+	}
+	if args.concurrency <= 0 {
+		return Arguments{}, fmt.Errorf("invalid concurrency: must be greater than 0")
+	}
+	if args.jobProbability < 0 || args.jobProbability > 1 {
+		return Arguments{}, fmt.Errorf("invalid job-probability: must be between 0.0 and 1.0")
+	}
+	if args.mode != workloadModePoisson && args.mode != workloadModeClosed && args.mode != workloadModeSequential {
+		return Arguments{}, fmt.Errorf("invalid mode: must be %s, %s or %s", workloadModePoisson, workloadModeClosed,
+			workloadModeSequential)
+	}
+	return args, nil
 }
 
+// applyOverrides replaces the configured values with the ones given on the command line.
+func (args Arguments) applyOverrides(config *Config) {
+	if args.overrides["qps"] {
+		config.jobGenParams.targetQPS = args.targetQPS
+	}
+	if args.overrides["duration"] {
+		config.jobGenParams.benchmarkDuration = args.benchmarkDuration
+	}
+	if args.overrides["concurrency"] {
+		config.concurrency = args.concurrency
+	}
+	if args.overrides["job-probability"] {
+		config.jobGenParams.jobProbability = args.jobProbability
+	}
+	if args.overrides["mode"] {
+		config.workloadMode = args.mode
+	}
+	if args.overrides["schedule"] {
+		config.loadScheduleFile = args.schedule
+	}
+	// Without -seed, parseArgs drew a fresh one
+	config.jobGenParams.seed = args.seed
+}
+
+// Exit codes of the load generator
+const (
+	exitConfigError    = 1 // invalid arguments or configuration
+	exitBenchmarkError = 2 // a phase of the benchmark failed
+)
+
 func main() {
 	/* Parse CLI arguments and load configurations */
-	configId, dimId, recallAfterBenchmark, err := parseArgs()
+	args, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfigError)
+	}
+	if args.version {
+		fmt.Println(getBuildInfo())
+		return
+	}
+	configId, dimId := args.configId, args.dimId
+	err = checkConfigFiles(configId, dimId)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 	}
 	err = LoadIndexConfig(configId, &config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load index configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 	}
 	err = LoadDimConfig(dimId, &config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load dataset configuration: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitConfigError)
 	}
-	SetOutputDir(fmt.Sprintf("output-config%d-dim%d", configId, dimId))
+	args.applyOverrides(&config)
+	if config.loadScheduleFile != "" {
+		config.jobGenParams.loadSchedule, err = LoadScheduleConfig(config.loadScheduleFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load the load schedule: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	SetOutputDir(filepath.Join(args.outDir, fmt.Sprintf("output-config%d-dim%d", configId, dimId)))
+	err = SetTimestampFormat(config.timestampFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfigError)
+	}
+	err = SetLogBufferSize(config.logBufferSize)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfigError)
+	}
+	err = SetLogFormat(config.logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfigError)
+	}
+
+	/* Dry run: check the configuration before any output is written or Milvus is contacted */
+	if args.validate {
+		err = ValidateConfig(&config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		fmt.Printf("Configuration of config Id %d, dataset dimensionality %d is valid:\n%+v\n", configId, dimId, config.redacted())
+		return
+	}
+
+	err = run(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Benchmark failed: %v\n", err)
+		os.Exit(exitBenchmarkError)
+	}
+}
+
+/**
+* run executes all phases of the benchmark with the loaded configuration.
+* The first failing phase ends the run, while the collection is still cleaned up and the failure is logged.
+ */
+func run(args Arguments) (err error) {
+	configId, dimId, recallAfterBenchmark := args.configId, args.dimId, args.recallAfterBenchmark
+	start := time.Now()
 
 	/* Initialize Benchmark */
 	logger, err := NewLogger("main")
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer logger.Close()
-	logger.Logf("Benchmark started with config Id %d, dataset dimensionality %d:\n%+v", configId, dimId, config)
+	defer func() {
+		if err != nil {
+			logger.Errorf("Benchmark failed: %v", err)
+		}
+	}()
+	/* Record what produced the results, with the configuration as resolved during the run */
+	defer func() {
+		metadata := newRunMetadata(configId, dimId, start, config)
+		metadata.End = time.Now()
+		if err != nil {
+			metadata.Error = err.Error()
+		}
+		if logErr := logger.LogRunMetadata(metadata); logErr != nil {
+			logger.Errorf("%v", logErr)
+		}
+	}()
+	logger.Logf("Benchmark started with config Id %d, dataset dimensionality %d:\n%+v", configId, dimId, config.redacted())
+	logger.Logf("Build: %s", getBuildInfo())
+	logger.Logf("Workload seed: %d, pass -seed %d to generate the same workload again",
+		config.jobGenParams.seed, config.jobGenParams.seed)
+
+	/* Download the dataset if requested */
+	if args.fetch && config.dataSource != dataSourceGenerated {
+		err = FetchDataset(dimId, config.dataFile, config.dataSha256, logger)
+		if err != nil {
+			return fmt.Errorf("failed to fetch the dataset: %w", err)
+		}
+	}
 
 	ctx := context.Background()
 	logger.Logf("Connecting to Milvus at %s...", config.milvusAddr)
-	c, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
-		Address:  config.milvusAddr,
-		Username: "root",
-		Password: "Milvus",
-	})
+	clientConfig, err := config.connection.clientConfig(config.milvusAddr)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	c, err := ConnectMilvus(ctx, clientConfig, config.connectRetries, config.connectTimeout, logger)
+	if err != nil {
+		return err
 	}
 	defer c.Close(ctx) // close connection after experiments are run
 	logger.Log("Successfully connected")
 
-	datasource := DataReader{config.dataFile}
+	textReader := DataReader{
+		sourceFile:   config.dataFile,
+		idSource:     config.idSource,
+		duplicateIds: config.duplicateIds,
+		malformed:    config.malformedLines,
+	}
+	if config.checkDimensions && config.dataFormat != dataFormatParquet && config.dataSource != dataSourceGenerated {
+		/* Fail fast on the first row before the collection is created, and on every further row before it is inserted */
+		err = checkFirstRowDimension(config.dataFile, config.idSource, config.dim)
+		if err != nil {
+			return err
+		}
+		textReader.dim = config.dim
+	}
+	var datasource DataSource = textReader
+	if config.dataFormat == dataFormatParquet {
+		datasource = ParquetDataReader{
+			sourceFile:   config.dataFile,
+			duplicateIds: config.duplicateIds,
+			scalarFields: config.scalarFields,
+		}
+		if config.dim == 0 {
+			config.dim, err = DetectParquetDimension(config.dataFile)
+			if err != nil {
+				return fmt.Errorf("failed to detect the dimension of %s: %w", config.dataFile, err)
+			}
+			logger.Logf("Detected dimension %d of %s", config.dim, config.dataFile)
+		}
+	}
+	if config.dataSource == dataSourceGenerated {
+		datasource = DataGenerator{
+			size:   config.dataSize,
+			mean:   config.dataMean,
+			stdDev: config.dataStdDev,
+			dim:    config.dim,
+			seed:   dataGeneratorSeed,
+		}
+		logger.Logf("Generating %d rows of dim %d instead of reading a dataset", config.dataSize, config.dim)
+	}
+
+	searchParams := &SearchParameters{
+		collection:        config.collection,
+		vecFieldName:      config.vecFieldName,
+		vectorFields:      config.vectorFields(),
+		permutations:      vectorFieldPermutations(config.vectorFields(), config.dim),
+		dim:               config.dim,
+		k:                 config.k,
+		rerankFieldName:   config.rerankFieldName,
+		rerankCandidates:  config.rerankCandidates,
+		metric:            config.indexParameters.distanceMetric,
+		vectorType:        config.indexParameters.vectorType,
+		recordCandidates:  config.rerankRecall,
+		filterExpr:        config.filterExpr,
+		outputFields:      config.outputFields,
+		annParam:          buildAnnParam(config.indexParameters.indexType, config.indexSearchParams),
+		indexType:         config.indexParameters.indexType,
+		indexSearchParams: config.indexSearchParams,
+		sampler:           newDebugSampler(config.debugSampleRate, config.debugMaxSamples, debugSampleSeed),
+		retries:           config.searchRetries,
+		queryTimeout:      config.queryTimeout,
+		rows: rowSchema{
+			idFieldName:         config.idFieldName,
+			fieldName:           config.fieldName,
+			scalarFields:        config.scalarFields,
+			numPartitions:       config.numPartitions,
+			partitionAssignment: config.partitionAssignment,
+		},
+	}
 
-	/* Prepare the benchmark: create collection, insert data, create index */
-	err = Prepare(
-		c,
-		config.dbName,
-		config.collection,
-		config.idFieldName,
-		config.vecFieldName,
+	/* Fail before preparing if every search would exceed the top-k limit */
+	err = CheckTopK(searchParams, config.maxTopK, config.topKPolicy, logger)
+	if err != nil {
+		return err
+	}
+	err = checkVectorType(
+		config.indexParameters.vectorType,
 		config.dim,
-		config.fieldName,
-		config.indexParameters,
-		config.insertBatchSize,
-		datasource,
+		config.indexParameters.distanceMetric,
+		config.indexParameters.indexType,
+		config.rerankFieldName != "",
 	)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	err = checkPartitionParameters(config.numPartitions, config.partitionAssignment, config.jobGenParams)
+	if err != nil {
+		return err
+	}
+	err = checkFilterParameters(config.jobGenParams)
+	if err != nil {
+		return err
+	}
+	err = checkSearchEffort(config.indexParameters.indexType, config.indexSearchParams, searchParams.searchLimit())
+	if err != nil {
+		return err
+	}
+	err = checkVectorFields(config.vectorFields(), config.rerankFieldName)
+	if err != nil {
+		return err
+	}
+	err = checkHybridParameters(config.jobGenParams, config.vectorFields())
+	if err != nil {
+		return err
+	}
+	err = checkMutationParameters(config.jobGenParams, config.numPartitions, config.partitionAssignment)
+	if err != nil {
+		return err
+	}
+	err = checkDriftParameters(config.jobGenParams)
+	if err != nil {
+		return err
+	}
+	if config.jobGenParams.hybridProbability > 0 {
+		searchParams.hybridReranker, err = newHybridReranker(
+			config.hybridReranker,
+			config.hybridRRFK,
+			config.hybridWeights,
+			len(config.vectorFields()),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Serve live metrics of the benchmark for dashboards */
+	if args.metricsAddr != "" {
+		searchParams.metrics, err = startMetricsServer(args.metricsAddr, logger)
+		if err != nil {
+			return fmt.Errorf("failed to start the metrics server: %w", err)
+		}
+		defer searchParams.metrics.shutdown()
+	}
+
+	/* Read the queries of the replayed run before spending time on the preparation */
+	var replay []Workload
+	if args.replayDir != "" {
+		replay, err = LoadReplayWorkloads(args.replayDir)
+		if err != nil {
+			return fmt.Errorf("failed to load the replayed run: %w", err)
+		}
+		if searchParams.hybridReranker == nil && slices.ContainsFunc(replay, isHybridJob) {
+			return fmt.Errorf("the replayed run contains hybrid jobs, which require a hybridProbability")
+		}
+		logger.Logf("Loaded %d workloads to replay from %s", len(replay), args.replayDir)
+	}
+
+	/* Drop the collection and database however the benchmark ends, so that they do not pile up on the cluster */
+	cleanup := sync.OnceFunc(func() {
+		if config.keepCollection || args.skipPrepare {
+			logger.Logf("Keeping collection %s in database %s", config.collection, config.dbName)
+			return
+		}
+		logger.Log("Cleaning up: deleting collection and database...")
+		if err := Cleanup(c, config.dbName, config.collection); err != nil {
+			logger.Errorf("%v", err)
+		}
+	})
+	defer cleanup()
+
+	/* Prepare the benchmark: create collection, insert data, create index */
+	if args.skipPrepare {
+		err = ReusePreparedCollection(
+			c,
+			config.dbName,
+			config.collection,
+			config.vectorFields(),
+			config.dim,
+			config.indexParameters,
+			config.checkDimensions,
+			config.sharedDataRowsDir,
+			config.numPartitions,
+			config.partitionAssignment,
+			config.scalarFields,
+			datasource,
+		)
+	} else {
+		err = Prepare(
+			c,
+			config.dbName,
+			config.collection,
+			config.idFieldName,
+			config.vectorFields(),
+			config.dim,
+			config.fieldName,
+			config.rerankFieldName,
+			config.scalarFields,
+			config.indexParameters,
+			config.insertBatchSize,
+			config.insertBatchBytes,
+			config.insertConcurrency,
+			config.indexBuildTimeout,
+			config.checkDimensions,
+			config.sharedDataRowsDir,
+			config.numPartitions,
+			config.partitionAssignment,
+			config.insertStats,
+			datasource,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("preparation failed: %w", err)
 	}
 
 	/* Warmup */
-	err = Warmup(
+	warmupConcurrency := config.warmupConcurrency
+	if warmupConcurrency <= 0 {
+		warmupConcurrency = config.concurrency
+	}
+	warmupStats, err := Warmup(
 		c,
 		config.numberWarmupQueries,
-		config.dim,
-		config.collection,
-		config.vecFieldName,
-		config.k,
+		searchParams,
+		config.loadTimeout,
+		config.loadRetries,
+		config.warmupTranche,
+		config.warmupSource,
+		config.warmupJitter,
+		datasource,
+		warmupConcurrency,
+		config.jobGenParams,
 	)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("warmup failed: %w", err)
 	}
 
-	/* Execute Benchmark */
-	jobs, sessions, err := ExecuteBenchmark(
+	/* Execute Benchmark, an interrupt ends it early but still reports and persists the collected results */
+	benchmarkCtx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	jobs, sessions, executionStats, err := ExecuteBenchmark(
 		c,
-		config.collection,
-		config.vecFieldName,
+		benchmarkCtx,
+		searchParams,
 		datasource,
-		config.dim,
 		config.jobGenParams,
-		config.k,
 		config.concurrency,
+		config.concurrencyStages,
+		config.loadTimeout,
+		config.loadRetries,
+		config.reportArrivalStats,
+		config.adaptToRateLimits,
+		config.sheddingThreshold,
+		config.overloadPolicy,
+		config.throughputWindow,
+		config.numPartitions,
+		config.workloadMode,
+		config.spillThreshold,
+		replay,
 	)
+	interrupted := benchmarkCtx.Err() != nil
+	stopSignals() // a second interrupt terminates immediately
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("execution failed: %w", err)
 	}
 
-	logger.Log("Benchmark completed successfully")
+	if interrupted {
+		logger.Log("Benchmark interrupted, reporting the results collected so far")
+	} else {
+		logger.Log("Benchmark completed successfully")
+	}
+	summary := Summary{
+		Overall:   ComputeOverallStats(jobs, sessions),
+		Warmup:    warmupStats,
+		Execution: executionStats,
+	}
+	if config.printWrkSummary {
+		workers := config.concurrency
+		if len(config.concurrencyStages) > 0 {
+			workers = maxStageWorkers(config.concurrencyStages)
+		}
+		wrkSummary := FormatWrkSummary(summary.Overall, workers, meanTargetQPS(config.jobGenParams))
+		fmt.Print(wrkSummary)
+		logger.Log(wrkSummary)
+	}
 
-	/* Cleanup */
-	logger.Log("Cleaning up: deleting collection and database...")
-	err = Cleanup(c, config.dbName, config.collection)
-	if err != nil {
-		logger.Log(err.Error())
+	/* Report latency and throughput per concurrency stage */
+	if len(config.concurrencyStages) > 0 {
+		summary.Stages = ComputeStageStats(jobs, sessions, config.concurrencyStages)
+		for _, stage := range summary.Stages {
+			logger.Logf("Stage %d (%d workers, %v): %d queries, %.2f QPS, mean latency %v, p99 latency %v",
+				stage.Stage, stage.Workers, stage.Duration, stage.Queries, stage.QPS,
+				stage.Latency.Mean, stage.Latency.P99)
+		}
+	}
+
+	/* Report latency and throughput per benchmark phase */
+	if len(config.jobGenParams.phases) > 0 {
+		summary.Phases = ComputePhaseStats(jobs, sessions, config.jobGenParams.phases)
+		for _, phase := range summary.Phases {
+			logger.Logf("Phase %d (%s, target %.2f QPS, %v): %d queries, %.2f QPS, mean latency %v, p99 latency %v",
+				phase.Phase, phase.Name, phase.TargetQPS, phase.Duration, phase.Queries, phase.QPS,
+				phase.Latency.Mean, phase.Latency.P99)
+		}
+	}
+
+	/* Compare the latency of filtered and unfiltered queries */
+	if config.jobGenParams.filterProbability > 0 {
+		filterStats := ComputeFilterStats(jobs, sessions)
+		logger.Logf("Filtered queries: %d, mean latency %v, p99 latency %v; unfiltered queries: %d, mean latency %v, p99 latency %v",
+			filterStats.Filtered.Count, filterStats.Filtered.Mean, filterStats.Filtered.P99,
+			filterStats.Unfiltered.Count, filterStats.Unfiltered.Mean, filterStats.Unfiltered.P99)
+		summary.Filters = &filterStats
+	}
+
+	/* Report the size of the returned output fields, they add to the latency and network cost */
+	if len(config.outputFields) > 0 {
+		payloadStats := ComputePayloadStats(jobs, sessions)
+		logger.Logf("Output fields %v: mean payload %.0f bytes per query, max %d bytes, %d bytes in total",
+			config.outputFields, payloadStats.MeanBytes, payloadStats.MaxBytes, payloadStats.TotalBytes)
+		summary.Payload = &payloadStats
 	}
 
+	/* Characterize the executed user sessions */
+	if len(sessions) > 0 {
+		sessionStats := ComputeSessionStats(sessions)
+		logger.Logf("Sessions: %d completed (mean %.1f steps), %d truncated, %d dropped; duration mean %v, p95 %v; step latency mean %v, p95 %v",
+			sessionStats.Completed, sessionStats.MeanLength, sessionStats.Truncated, sessionStats.Dropped,
+			sessionStats.Duration.Mean, sessionStats.Duration.P95,
+			sessionStats.StepLatency.Mean, sessionStats.StepLatency.P95)
+		logger.Logf("Completed session lengths: %s", formatSessionLengths(sessionStats.Lengths))
+		summary.Sessions = &sessionStats
+	}
+
+	/* Write the latency over time, optionally with a ready-to-render chart */
+	if config.timeSeriesInterval > 0 {
+		series := ComputeLatencyTimeSeries(jobs, sessions, config.timeSeriesInterval)
+		if config.driftThreshold > 0 {
+			drift := ComputeLatencyDrift(series, config.driftThreshold)
+			logger.Logf("Latency drift %v per minute: %s", drift.SlopePerMinute, drift.Note)
+			summary.Drift = &drift
+		}
+		err = logger.LogLatencyTimeSeries(series)
+		if err != nil {
+			logger.Errorf("%v", err)
+		} else if config.latencyPlotSpec {
+			err = logger.LogLatencyPlotSpec()
+			if err != nil {
+				logger.Errorf("%v", err)
+			}
+		}
+	}
+
+	/* Check whether repeated identical queries return identical results */
+	if config.stabilityQueries > 0 && !interrupted {
+		summary.Stability, err = RunStabilityTest(
+			c,
+			searchParams,
+			config.jobGenParams,
+			config.stabilityQueries,
+			config.stabilityRepeats,
+		)
+		if err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+
+	/* Snapshot server-side statistics before the collection is dropped */
+	if config.collectServerStats {
+		summary.ServerStats, err = CollectServerStats(c, config.dbName, config.collection, logger)
+		if err != nil {
+			logger.Errorf("%v", err)
+		}
+	}
+
+	/* Cleanup, the recall calculation does not need Milvus anymore */
+	cleanup()
+
 	/* Enhance Results by calculating recall */
-	if (recallAfterBenchmark) {
-	logger.Log("Calculating recall...")
-		err = Collection(datasource, jobs, sessions)
+	if recallAfterBenchmark {
+		logger.Log("Calculating recall...")
+		if executionStats.SpilledSegments > 0 {
+			// Only the timing of spilled results is kept in memory
+			jobs, sessions, err = ReadSpilledJobsAndSessions()
+			if err != nil {
+				return fmt.Errorf("failed to read the spilled results: %w", err)
+			}
+		}
+		recallSummary, err := Collection(datasource, jobs, sessions, RecallOptions{
+			BatchSize:        config.recallBatchSize,
+			SplitRetries:     config.recallByRetries,
+			CacheGroundTruth: config.recallCache,
+			TieAware:         config.recallTieAware,
+			Unrolled:         config.recallUnrolled,
+			Metric:           config.indexParameters.distanceMetric,
+		})
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("recall calculation failed: %w", err)
 		}
+		summary.Recall = &recallSummary
+	} else if executionStats.SpilledSegments > 0 {
+		logger.Logf("Jobs and sessions were spilled to %d gob segments for offline recall calculation", executionStats.SpilledSegments)
 	} else {
 		logger.Log("Saving jobs and sessions in gob format for offline recall calculation...")
-		err = logger.LogJobsAndSessionsGob(jobs, sessions)
+		err = logger.LogJobsAndSessionsGob(jobs, sessions, config.indexParameters.distanceMetric)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
+	err = logger.LogSummary(&summary)
+	if err != nil {
+		return err
+	}
+
 	logger.Log("Benchmark finished.")
+	return nil
 }
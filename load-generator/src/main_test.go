@@ -0,0 +1,203 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgs_Flags(t *testing.T) {
+	args, err := parseArgs([]string{"-config", "1", "-dataset", "50", "-qps", "250", "-duration", "10m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.configId != 1 || args.dimId != 50 || !args.recallAfterBenchmark {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+
+	cfg := Config{concurrency: 50, jobGenParams: JobGenerationParameters{targetQPS: 100, benchmarkDuration: time.Hour, jobProbability: 0.85}}
+	args.applyOverrides(&cfg)
+	if cfg.jobGenParams.targetQPS != 250 || cfg.jobGenParams.benchmarkDuration != 10*time.Minute {
+		t.Errorf("Expected qps 250 and duration 10m, got %v and %v", cfg.jobGenParams.targetQPS, cfg.jobGenParams.benchmarkDuration)
+	}
+	if cfg.concurrency != 50 || cfg.jobGenParams.jobProbability != 0.85 {
+		t.Errorf("Expected flags that were not given to keep the configured values, got %+v", cfg)
+	}
+}
+
+func TestParseArgs_Positional(t *testing.T) {
+	args, err := parseArgs([]string{"-concurrency", "8", "-mode", "closed", "2", "100", "false"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.configId != 2 || args.dimId != 100 || args.recallAfterBenchmark || args.concurrency != 8 || args.mode != workloadModeClosed {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+}
+
+func TestParseArgs_Validate(t *testing.T) {
+	args, err := parseArgs([]string{"-validate", "1", "50"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !args.validate || args.configId != 1 || args.dimId != 50 {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+}
+
+func TestParseArgs_SkipPrepare(t *testing.T) {
+	args, err := parseArgs([]string{"-skip-prepare", "-config", "1", "-dataset", "50"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !args.skipPrepare || args.configId != 1 || args.dimId != 50 {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+}
+
+func TestParseArgs_Version(t *testing.T) {
+	args, err := parseArgs([]string{"-version"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !args.version {
+		t.Errorf("Unexpected arguments: %+v", args)
+	}
+}
+
+func TestParseArgs_SequentialMode(t *testing.T) {
+	args, err := parseArgs([]string{"-config", "1", "-dataset", "50", "-mode", "sequential"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := Config{workloadMode: workloadModePoisson}
+	args.applyOverrides(&cfg)
+	if cfg.workloadMode != workloadModeSequential {
+		t.Errorf("Expected mode %s, got %s", workloadModeSequential, cfg.workloadMode)
+	}
+}
+
+func TestParseArgs_Seed(t *testing.T) {
+	args, err := parseArgs([]string{"-config", "1", "-dataset", "50", "-seed", "0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var cfg Config
+	args.applyOverrides(&cfg)
+	if cfg.jobGenParams.seed != 0 {
+		t.Errorf("Expected the given seed 0, got %d", cfg.jobGenParams.seed)
+	}
+
+	// Without -seed, every run draws its own seed
+	first, err := parseArgs([]string{"-config", "1", "-dataset", "50"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(time.Microsecond)
+	second, err := parseArgs([]string{"-config", "1", "-dataset", "50"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.seed == second.seed {
+		t.Errorf("Expected fresh seeds, got %d twice", first.seed)
+	}
+}
+
+func TestParseArgs_Invalid(t *testing.T) {
+	for _, arguments := range [][]string{
+		{"1"},
+		{"0", "50"},
+		{"1", "dim"},
+		{"-config", "1", "-dataset", "50", "-qps", "0"},
+		{"-config", "1", "-dataset", "50", "-duration", "-1m"},
+		{"-config", "1", "-dataset", "50", "-job-probability", "1.5"},
+		{"-config", "1", "-dataset", "50", "extra"},
+		{"-config", "1", "-dataset", "50", "-mode", "open"},
+	} {
+		if _, err := parseArgs(arguments); err == nil {
+			t.Errorf("Expected an error for %v", arguments)
+		}
+	}
+}
+
+func TestGetMilvusAddr(t *testing.T) {
+	t.Setenv("MILVUS_IP", "10.0.0.1")
+	t.Setenv("MILVUS_PORT", "")
+	if addr := getMilvusAddr(); addr != "10.0.0.1:19530" {
+		t.Errorf("Expected the default port, got %s", addr)
+	}
+
+	t.Setenv("MILVUS_PORT", "29530")
+	if addr := getMilvusAddr(); addr != "10.0.0.1:29530" {
+		t.Errorf("Expected port 29530, got %s", addr)
+	}
+
+	// A port in MILVUS_IP takes precedence over MILVUS_PORT
+	t.Setenv("MILVUS_IP", "milvus.example.com:443")
+	if addr := getMilvusAddr(); addr != "milvus.example.com:443" {
+		t.Errorf("Expected the address as given, got %s", addr)
+	}
+}
+
+func TestCheckConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	defer func(previous string) { configDir = previous }(configDir)
+	configDir = dir
+	for _, name := range []string{"index-1.txt", "index-4.txt", "dim-50.txt", "dim-300.txt", "index-notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := checkConfigFiles(4, 300); err != nil {
+		t.Errorf("Expected added configurations to be accepted, got %v", err)
+	}
+	if err := checkConfigFiles(2, 50); err == nil || !strings.Contains(err.Error(), "available: [1 4]") {
+		t.Errorf("Expected the available index configurations, got %v", err)
+	}
+	if err := checkConfigFiles(1, 100); err == nil || !strings.Contains(err.Error(), "available: [50 300]") {
+		t.Errorf("Expected the available dimensionalities, got %v", err)
+	}
+}
+
+func TestLoadDimConfig_Generated(t *testing.T) {
+	dir := t.TempDir()
+	defer func(previous string) { configDir = previous }(configDir)
+	configDir = dir
+	for name, content := range map[string]string{
+		"dim-1.txt": "source = generated\nsize = 1000000\ndim = 128\nstdDev = 1.5\n",
+		"dim-2.txt": "source = generated\ndim = 128\n",
+		"dim-3.txt": "source = generated\nsize = -1\ndim = 128\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := Config{dataStdDev: 7.5}
+	if err := LoadDimConfig(1, &cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.dataSource != dataSourceGenerated || cfg.dataSize != 1000000 || cfg.dim != 128 || cfg.dataStdDev != 1.5 {
+		t.Errorf("Unexpected generated dataset configuration: %+v", cfg)
+	}
+	for _, id := range []int{2, 3} {
+		if err := LoadDimConfig(id, &Config{}); err == nil {
+			t.Errorf("dim-%d: expected an error for a missing or invalid size", id)
+		}
+	}
+}
+
+func TestParseArgs_OutDir(t *testing.T) {
+	t.Setenv("BENCHMARK_OUTDIR", "results")
+	args, err := parseArgs([]string{"1", "50"})
+	if err != nil || args.outDir != "results" {
+		t.Errorf("Expected the output root from the environment, got %q / %v", args.outDir, err)
+	}
+	args, err = parseArgs([]string{"-outdir", "results/2024-06-01", "1", "50"})
+	if err != nil || args.outDir != "results/2024-06-01" {
+		t.Errorf("Expected the output root of the flag, got %q / %v", args.outDir, err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+const runMetadataFile = "run-metadata.json"
+
+// version of the load generator, e.g. set with -ldflags "-X main.version=v1.2.0"
+var version = "dev"
+
+// BuildInfo identifies the build of the load generator, the commit is read from the VCS stamp of the Go toolchain.
+type BuildInfo struct {
+	Version    string
+	Commit     string `json:",omitempty"`
+	CommitTime string `json:",omitempty"`
+	Modified   bool   // the working tree had uncommitted changes at build time
+	GoVersion  string
+}
+
+func getBuildInfo() BuildInfo {
+	build := BuildInfo{Version: version}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return build
+	}
+	build.GoVersion = info.GoVersion
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Commit = setting.Value
+		case "vcs.time":
+			build.CommitTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+func (b BuildInfo) String() string {
+	commit := b.Commit
+	if commit == "" {
+		commit = "unknown"
+	}
+	if b.Modified {
+		commit += " (modified)"
+	}
+	return fmt.Sprintf("milvus-load-generator %s, commit %s, %s", b.Version, commit, b.GoVersion)
+}
+
+/**
+* RunMetadata records what produced the results of an output directory, so that runs can be compared across
+* configuration and code changes.
+ */
+type RunMetadata struct {
+	ConfigId        int
+	DimId           int
+	Start           time.Time
+	End             time.Time
+	Error           string `json:",omitempty"` // why the run failed, empty for a successful run
+	Hostname        string
+	Build           BuildInfo
+	Dim             int            // resolved dimension, e.g. detected from a Parquet dataset
+	IndexParameters map[string]any // resolved index configuration
+	Config          map[string]any // full resolved configuration without the password
+}
+
+func newRunMetadata(configId int, dimId int, start time.Time, config Config) RunMetadata {
+	hostname, _ := os.Hostname() // empty if unknown
+	redacted := config.redacted()
+	return RunMetadata{
+		ConfigId:        configId,
+		DimId:           dimId,
+		Start:           start,
+		Hostname:        hostname,
+		Build:           getBuildInfo(),
+		Dim:             redacted.dim,
+		IndexParameters: exportValue(reflect.ValueOf(redacted.indexParameters)).(map[string]any),
+		Config:          exportValue(reflect.ValueOf(redacted)).(map[string]any),
+	}
+}
+
+/**
+* exportValue converts a value into JSON-encodable types. The config fields are unexported and thus skipped by
+* encoding/json, structs are converted into maps by their field names and durations into strings like "1m30s".
+ */
+func exportValue(v reflect.Value) any {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return exportValue(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i] = exportValue(v.Index(i))
+		}
+		return values
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		values := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			values[fmt.Sprint(exportValue(iter.Key()))] = exportValue(iter.Value())
+		}
+		return values
+	case reflect.Struct:
+		values := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			values[v.Type().Field(i).Name] = exportValue(v.Field(i))
+		}
+		return values
+	default:
+		return v.Type().String()
+	}
+}
+
+// LogRunMetadata writes the metadata of the run as indented JSON.
+func (l *Logger) LogRunMetadata(metadata RunMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath(runMetadataFile), data, 0644)
+}
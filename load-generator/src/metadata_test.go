@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLogRunMetadata(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	cfg := Config{
+		dim:               100,
+		loadTimeout:       10 * time.Minute,
+		connection:        ConnectionConfig{username: "root", password: "secret"},
+		indexParameters:   ConstructionIndexParameters{indexType: indexTypeHNSW, M: 16},
+		scalarFields:      []ScalarField{{name: "category", dataType: scalarTypeInt64, max: 20}},
+		concurrencyStages: []ConcurrencyStage{{10, time.Minute}},
+	}
+	metadata := newRunMetadata(1, 100, time.Now(), cfg)
+	if err := logger.LogRunMetadata(metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(runMetadataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Dim             int
+		IndexParameters map[string]any
+		Config          map[string]any
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Dim != 100 || decoded.IndexParameters["indexType"] != indexTypeHNSW || decoded.IndexParameters["M"] != 16.0 {
+		t.Errorf("Unexpected resolved parameters: %+v", decoded)
+	}
+	if decoded.Config["loadTimeout"] != "10m0s" {
+		t.Errorf("Expected the duration as a string, got %v", decoded.Config["loadTimeout"])
+	}
+	connection := decoded.Config["connection"].(map[string]any)
+	if connection["password"] != "<redacted>" {
+		t.Errorf("Expected the password to be redacted, got %v", connection["password"])
+	}
+	if fields := decoded.Config["scalarFields"].([]any); len(fields) != 1 || fields[0].(map[string]any)["name"] != "category" {
+		t.Errorf("Unexpected scalar fields: %v", decoded.Config["scalarFields"])
+	}
+}
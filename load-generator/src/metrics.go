@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "milvus_benchmark"
+
+/**
+* benchmarkMetrics exposes the progress of a running benchmark in the Prometheus format, so that long runs can be
+* watched live instead of waiting for the final summary.
+* All methods are no-ops on a nil receiver, as used if no metrics address is configured.
+ */
+type benchmarkMetrics struct {
+	registry        *prometheus.Registry
+	latency         prometheus.Histogram
+	queries         prometheus.Counter
+	errors          prometheus.Counter
+	droppedWorkload prometheus.Counter
+	inFlight        prometheus.Gauge
+	server          *http.Server
+	addr            string // address the server listens on, e.g. with the port chosen for ":0"
+}
+
+func newBenchmarkMetrics() *benchmarkMetrics {
+	m := &benchmarkMetrics{
+		registry: prometheus.NewRegistry(),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "query_latency_seconds",
+			Help:      "Latency of the benchmark queries, including retries.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16), // 0.5ms to ~16s
+		}),
+		queries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "queries_total",
+			Help:      "Benchmark queries completed successfully, rate() yields the achieved QPS.",
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "query_errors_total",
+			Help:      "Benchmark queries that failed, including rate-limited queries.",
+		}),
+		droppedWorkload: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "dropped_workloads_total",
+			Help:      "Arrivals dropped because all workers were busy.",
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "inflight_workers",
+			Help:      "Workers currently executing a query.",
+		}),
+	}
+	m.registry.MustRegister(m.latency, m.queries, m.errors, m.droppedWorkload, m.inFlight)
+	return m
+}
+
+/**
+* startMetricsServer serves the metrics on /metrics of addr, e.g. ":2112", until shutdown is called.
+* The listener is opened before returning, so that an unavailable address fails the run early.
+ */
+func startMetricsServer(addr string, logger *Logger) (*benchmarkMetrics, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	m := newBenchmarkMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	m.addr = listener.Addr().String()
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	logger.Logf("Serving Prometheus metrics on http://%s/metrics", m.addr)
+	return m, nil
+}
+
+func (m *benchmarkMetrics) shutdown() error {
+	if m == nil || m.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return m.server.Shutdown(ctx)
+}
+
+// startQuery marks a worker as busy until the returned function records the outcome of its query.
+func (m *benchmarkMetrics) startQuery() func(latency time.Duration, err error) {
+	if m == nil {
+		return func(time.Duration, error) {}
+	}
+	m.inFlight.Inc()
+	return func(latency time.Duration, err error) {
+		m.inFlight.Dec()
+		switch {
+		case err == nil:
+			m.queries.Inc()
+			m.latency.Observe(latency.Seconds())
+		case !errors.Is(err, context.Canceled): // cancelled on benchmark end
+			m.errors.Inc()
+		}
+	}
+}
+
+func (m *benchmarkMetrics) recordDrop() {
+	if m == nil {
+		return
+	}
+	m.droppedWorkload.Inc()
+}
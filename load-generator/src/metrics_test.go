@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBenchmarkMetrics_RecordsQueries(t *testing.T) {
+	m := newBenchmarkMetrics()
+
+	finish := m.startQuery()
+	if inFlight := testutil.ToFloat64(m.inFlight); inFlight != 1 {
+		t.Errorf("Expected 1 in-flight worker, got %.0f", inFlight)
+	}
+	finish(5*time.Millisecond, nil)
+	m.startQuery()(time.Millisecond, errors.New("rate limit exceeded"))
+	m.startQuery()(time.Millisecond, context.Canceled)
+	m.recordDrop()
+
+	if inFlight := testutil.ToFloat64(m.inFlight); inFlight != 0 {
+		t.Errorf("Expected no in-flight workers, got %.0f", inFlight)
+	}
+	if queries := testutil.ToFloat64(m.queries); queries != 1 {
+		t.Errorf("Expected 1 query, got %.0f", queries)
+	}
+	// Cancellation on benchmark end is not an error
+	if errs := testutil.ToFloat64(m.errors); errs != 1 {
+		t.Errorf("Expected 1 error, got %.0f", errs)
+	}
+	if dropped := testutil.ToFloat64(m.droppedWorkload); dropped != 1 {
+		t.Errorf("Expected 1 dropped workload, got %.0f", dropped)
+	}
+	if count := testutil.CollectAndCount(m.latency); count != 1 {
+		t.Errorf("Expected a single latency histogram, got %d", count)
+	}
+}
+
+func TestBenchmarkMetrics_Nil(t *testing.T) {
+	var m *benchmarkMetrics
+	m.startQuery()(time.Millisecond, nil)
+	m.recordDrop()
+	if err := m.shutdown(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestStartMetricsServer(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	m, err := startMetricsServer("127.0.0.1:0", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.shutdown()
+	m.startQuery()(5*time.Millisecond, nil)
+
+	resp, err := http.Get("http://" + m.addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "milvus_benchmark_queries_total 1") {
+		t.Errorf("Expected the query counter in the metrics, got:\n%s", body)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+// Kinds of mutations
+const (
+	mutationKindDelete = "delete" // delete the row, searches stop returning it once the delete is applied
+	mutationKindUpsert = "upsert" // replace the vector of the row with a newly generated one
+	mutationKindMixed  = "mixed"  // deletes and upserts with equal probability
+)
+
+/**
+* checkMutationParameters fails early on a read/write mix that cannot be generated. Upserts into partitions need the
+* id assignment, since only then the partition a row was inserted into follows from its id.
+ */
+func checkMutationParameters(jobGenParams JobGenerationParameters, numPartitions int, partitionAssignment string) error {
+	if jobGenParams.mutationProbability < 0 || jobGenParams.mutationProbability > 1 {
+		return fmt.Errorf("mutationProbability must be between 0 and 1, got %f", jobGenParams.mutationProbability)
+	}
+	if jobGenParams.mutationProbability == 0 {
+		return nil
+	}
+	switch jobGenParams.mutationKind {
+	case mutationKindDelete, mutationKindUpsert, mutationKindMixed:
+	default:
+		return fmt.Errorf("unknown mutation kind %q (supported: %s, %s, %s)",
+			jobGenParams.mutationKind, mutationKindDelete, mutationKindUpsert, mutationKindMixed)
+	}
+	if jobGenParams.mutationMaxId <= 0 {
+		return fmt.Errorf("mutationMaxId must be positive, got %d", jobGenParams.mutationMaxId)
+	}
+	if jobGenParams.mutationKind != mutationKindDelete && numPartitions > 0 && partitionAssignment != partitionAssignmentId {
+		return fmt.Errorf("upserts into partitions require partitionAssignment %s, the partition of a row cannot be "+
+			"derived from its id with %s", partitionAssignmentId, partitionAssignment)
+	}
+	return nil
+}
+
+/**
+* MutationWorkload deletes or upserts a single random row while the searches run, to measure how concurrent writes
+* affect the search latency and recall. Mutations are recorded apart from the searches, see MutationStats.
+* The recall is computed against the dataset as inserted, so deleted and upserted rows still count as true neighbors.
+*
+* Ids of mutations are encoded as "M-{index}".
+ */
+type MutationWorkload struct {
+	Id              string
+	Kind            string // delete or upsert
+	RowId           int64
+	Vector          Vector // new vector of an upserted row, nil for deletes
+	Latency         time.Duration
+	StartTimestamp  time.Time
+	SchedulingDelay time.Duration
+	Stage           int
+	Phase           int
+	Failed          bool // Milvus rejected the mutation, the error is logged
+}
+
+/**
+* rowSchema holds the fields of the collection rows besides the vectors, so that mutations can address and upsert
+* complete rows.
+ */
+type rowSchema struct {
+	idFieldName         string
+	fieldName           string
+	scalarFields        []ScalarField
+	numPartitions       int
+	partitionAssignment string
+}
+
+func (ac *ArrivalController) generateMutation() *MutationWorkload {
+	kind := ac.jobGenParams.mutationKind
+	if kind == mutationKindMixed {
+		kind = mutationKindDelete
+		if ac.gen.Intn(2) == 0 {
+			kind = mutationKindUpsert
+		}
+	}
+	mutation := &MutationWorkload{
+		Id:    fmt.Sprintf("M-%d", ac.mutationCounter),
+		Kind:  kind,
+		RowId: ac.gen.Int63n(ac.jobGenParams.mutationMaxId),
+	}
+	ac.mutationCounter++
+	if kind == mutationKindUpsert {
+		// The queries follow the distribution of the dataset, so the upserted vector does as well
+		mutation.Vector = ac.jobGenParams.generateQuery(ac.gen, ac.dim)
+	}
+	return mutation
+}
+
+/**
+* Execute applies the mutation, a rejected mutation is returned with Failed set instead of an error.
+* Only a cancelled benchmark returns an error, the mutation is not recorded then.
+ */
+func (m *MutationWorkload) Execute(
+	ctx context.Context,
+	c *milvusclient.Client,
+	params *SearchParameters,
+	logger *Logger,
+	schedulingDelay time.Duration,
+	stage int,
+	phase int,
+) (Workload, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	m.SchedulingDelay = schedulingDelay
+	m.Stage = stage
+	m.Phase = phase
+	start := time.Now()
+	var err error
+	if m.Kind == mutationKindUpsert {
+		err = params.upsertRow(ctx, c, m.RowId, m.Vector)
+	} else {
+		option := milvusclient.NewDeleteOption(params.collection).WithInt64IDs(params.rows.idFieldName, []int64{m.RowId})
+		_, err = c.Delete(ctx, option)
+	}
+	m.Latency = time.Since(start)
+	m.StartTimestamp = start
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		m.Failed = true
+		logger.Errorf("Failed to %s row %d: %v", m.Kind, m.RowId, err)
+	}
+	return m, nil
+}
+
+/**
+* upsertRow replaces the row with the given vector, in the partition the row was assigned to when inserting, which
+* checkMutationParameters ensures is derived from the id. Generated scalar values are the ones the row was inserted with, the word is a placeholder.
+ */
+func (p *SearchParameters) upsertRow(ctx context.Context, c *milvusclient.Client, id int64, vector Vector) error {
+	row := []DataRow{{Id: id, Word: fmt.Sprintf("upsert-%d", id), Vector: vector}}
+	assignPartitions(row, 0, p.rows.numPartitions, p.rows.partitionAssignment)
+	if err := fillScalarFields(row, p.rows.scalarFields); err != nil {
+		return err
+	}
+	option := milvusclient.NewRowBasedInsertOption(p.collection, insertRowMap(
+		row[0],
+		p.rows.idFieldName,
+		p.vectorFields,
+		p.permutations,
+		p.rows.fieldName,
+		p.rerankFieldName,
+		p.vectorType,
+	))
+	if p.rows.numPartitions > 0 {
+		option.WithPartition(partitionName(row[0].Partition)) // sets the partition of the embedded option in place
+	}
+	_, err := c.Upsert(ctx, option)
+	return err
+}
+
+// mutationRecorder aggregates the executed mutations, only their latencies are kept.
+type mutationRecorder struct {
+	deletes   int
+	upserts   int
+	failed    int
+	latencies []time.Duration // of the successful mutations
+}
+
+func (r *mutationRecorder) record(m *MutationWorkload) {
+	if m.Kind == mutationKindUpsert {
+		r.upserts++
+	} else {
+		r.deletes++
+	}
+	if m.Failed {
+		r.failed++
+		return
+	}
+	r.latencies = append(r.latencies, m.Latency)
+}
+
+// stats returns nil if no mutation was executed.
+func (r *mutationRecorder) stats() *MutationStats {
+	if r.deletes+r.upserts == 0 {
+		return nil
+	}
+	return &MutationStats{
+		Deletes: r.deletes,
+		Upserts: r.upserts,
+		Failed:  r.failed,
+		Latency: ComputeLatencyStats(r.latencies),
+	}
+}
+
+// logMutations reports the executed mutations, if any.
+func logMutations(logger *Logger, stats *MutationStats) {
+	if stats == nil {
+		return
+	}
+	logger.Logf("Executed %d deletes and %d upserts (%d failed): mean latency %v, p99 latency %v",
+		stats.Deletes, stats.Upserts, stats.Failed, stats.Latency.Mean, stats.Latency.P99)
+}
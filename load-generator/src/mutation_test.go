@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckMutationParameters(t *testing.T) {
+	params := JobGenerationParameters{mutationProbability: 0.1, mutationKind: mutationKindMixed, mutationMaxId: 100}
+	if err := checkMutationParameters(params, 0, partitionAssignmentRoundRobin); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkMutationParameters(JobGenerationParameters{}, 0, partitionAssignmentRoundRobin); err != nil {
+		t.Errorf("Expected disabled mutations to be valid, got %v", err)
+	}
+	for name, invalid := range map[string]JobGenerationParameters{
+		"probability above 1": {mutationProbability: 1.5, mutationKind: mutationKindDelete, mutationMaxId: 100},
+		"unknown kind":        {mutationProbability: 0.1, mutationKind: "truncate", mutationMaxId: 100},
+		"no ids":              {mutationProbability: 0.1, mutationKind: mutationKindDelete},
+	} {
+		if err := checkMutationParameters(invalid, 0, partitionAssignmentRoundRobin); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	upserts := JobGenerationParameters{mutationProbability: 0.1, mutationKind: mutationKindUpsert, mutationMaxId: 100}
+	for _, assignment := range []string{partitionAssignmentRoundRobin, partitionAssignmentWord} {
+		if err := checkMutationParameters(upserts, 4, assignment); err == nil {
+			t.Errorf("Expected an error for upserts into partitions assigned by %s", assignment)
+		}
+	}
+	if err := checkMutationParameters(upserts, 4, partitionAssignmentId); err != nil {
+		t.Errorf("Unexpected error for upserts into partitions assigned by id: %v", err)
+	}
+	deletes := JobGenerationParameters{mutationProbability: 0.1, mutationKind: mutationKindDelete, mutationMaxId: 100}
+	if err := checkMutationParameters(deletes, 4, partitionAssignmentRoundRobin); err != nil {
+		t.Errorf("Expected deletes to be valid with any partition assignment, got %v", err)
+	}
+}
+
+func TestArrivalController_GenerateMutations(t *testing.T) {
+	params := testJobGenParams(100.0, 1.0, 5, 10)
+	params.mutationProbability = 0.25
+	params.mutationKind = mutationKindMixed
+	params.mutationMaxId = 50
+	ac := NewArrivalController(params, 8, 0, 42, 10)
+
+	kinds := make(map[string]int)
+	for range 1000 {
+		mutation, ok := ac.GenerateWorkload().(*MutationWorkload)
+		if !ok {
+			continue
+		}
+		kinds[mutation.Kind]++
+		if mutation.RowId < 0 || mutation.RowId >= 50 {
+			t.Fatalf("Row id %d out of range", mutation.RowId)
+		}
+		if (mutation.Kind == mutationKindUpsert) != (len(mutation.Vector) == 8) {
+			t.Fatalf("Expected a vector for upserts only, got %+v", mutation)
+		}
+	}
+	mutations := kinds[mutationKindDelete] + kinds[mutationKindUpsert]
+	if mutations < 200 || mutations > 300 {
+		t.Errorf("Expected about 250 mutations, got %d", mutations)
+	}
+	if kinds[mutationKindDelete] == 0 || kinds[mutationKindUpsert] == 0 {
+		t.Errorf("Expected deletes and upserts, got %v", kinds)
+	}
+}
+
+func TestResultCollector_Mutations(t *testing.T) {
+	collector := newResultCollector(0, metricL2, nil)
+	if stats := collector.mutationStats(); stats != nil {
+		t.Errorf("Expected no mutation stats, got %+v", stats)
+	}
+	collector.add(&MutationWorkload{Kind: mutationKindDelete, Latency: 2 * time.Millisecond})
+	collector.add(&MutationWorkload{Kind: mutationKindUpsert, Latency: 4 * time.Millisecond})
+	collector.add(&MutationWorkload{Kind: mutationKindUpsert, Latency: time.Second, Failed: true})
+
+	stats := collector.mutationStats()
+	if stats == nil || stats.Deletes != 1 || stats.Upserts != 2 || stats.Failed != 1 {
+		t.Fatalf("Unexpected mutation stats %+v", stats)
+	}
+	if stats.Latency.Count != 2 || stats.Latency.Mean != 3*time.Millisecond {
+		t.Errorf("Expected the latency of the 2 successful mutations, got %+v", stats.Latency)
+	}
+	if jobs, sessions, _ := collector.results(); len(jobs) != 0 || len(sessions) != 0 {
+		t.Errorf("Expected mutations to be kept apart from the searches, got %d jobs and %d sessions", len(jobs), len(sessions))
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Input formats of the dataset file
+const (
+	dataFormatText    = "text"    // space-separated lines as read by DataReader
+	dataFormatParquet = "parquet" // id, vector and word columns as read by ParquetDataReader
+)
+
+// Columns of a Parquet dataset, only vector is required, columns named like a scalar field provide its values
+const (
+	parquetIdColumn     = "id"
+	parquetVectorColumn = "vector"
+	parquetWordColumn   = "word"
+)
+
+/**
+* ParquetDataReader reads a dataset from a Parquet file.
+* Ids are taken from the id column if there is one and assigned by row number otherwise.
+* The vector column may be a list or a repeated field of float or double values.
+ */
+type ParquetDataReader struct {
+	sourceFile   string
+	duplicateIds string
+	scalarFields []ScalarField
+}
+
+// parquetColumns holds the leaf column indexes of the dataset columns, -1 if the file lacks the column.
+type parquetColumns struct {
+	id      int
+	vector  int
+	word    int
+	scalars map[int]string // scalar field names by column index, only for the fields present in the file
+}
+
+func lookupParquetColumns(schema *parquet.Schema, scalarFields []ScalarField) (parquetColumns, error) {
+	columns := parquetColumns{id: -1, vector: -1, word: -1, scalars: make(map[int]string)}
+	for i, path := range schema.Columns() {
+		for _, field := range scalarFields {
+			if path[0] == field.name {
+				columns.scalars[i] = field.name
+			}
+		}
+		// nested columns such as vector.list.element are matched by their top-level name
+		switch path[0] {
+		case parquetIdColumn:
+			columns.id = i
+		case parquetVectorColumn:
+			columns.vector = i
+		case parquetWordColumn:
+			columns.word = i
+		}
+	}
+	if columns.vector < 0 {
+		return columns, fmt.Errorf("parquet file has no %q column", parquetVectorColumn)
+	}
+	return columns, nil
+}
+
+/**
+* openParquetFile opens a Parquet file and returns a reader over its rows along with the dataset columns.
+* Parquet requires random access, so a gzip-compressed file is decompressed into memory.
+ */
+func openParquetFile(path string, scalarFields []ScalarField) (io.Closer, *parquet.Reader, parquetColumns, error) {
+	dataset, err := openDataset(path)
+	if err != nil {
+		return nil, nil, parquetColumns{}, err
+	}
+	var file io.Closer = dataset
+	var parquetFile *parquet.File
+	if dataset.gzip != nil {
+		data, err := io.ReadAll(dataset)
+		dataset.Close()
+		if err != nil {
+			return nil, nil, parquetColumns{}, err
+		}
+		file = io.NopCloser(nil)
+		parquetFile, err = parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, parquetColumns{}, err
+		}
+	} else {
+		info, err := dataset.file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, nil, parquetColumns{}, err
+		}
+		parquetFile, err = parquet.OpenFile(dataset.file, info.Size())
+		if err != nil {
+			file.Close()
+			return nil, nil, parquetColumns{}, err
+		}
+	}
+	columns, err := lookupParquetColumns(parquetFile.Schema(), scalarFields)
+	if err != nil {
+		file.Close()
+		return nil, nil, parquetColumns{}, err
+	}
+	return file, parquet.NewReader(parquetFile), columns, nil
+}
+
+// parseParquetRow converts a Parquet row into a data row, the id defaults to the row number.
+func parseParquetRow(row parquet.Row, columns parquetColumns, rowNumber int64) (DataRow, error) {
+	dataRow := DataRow{Id: rowNumber}
+	for _, value := range row {
+		if value.IsNull() {
+			continue
+		}
+		switch value.Column() {
+		case columns.id:
+			switch value.Kind() {
+			case parquet.Int64:
+				dataRow.Id = value.Int64()
+			case parquet.Int32:
+				dataRow.Id = int64(value.Int32())
+			default:
+				return dataRow, fmt.Errorf("unsupported type %v of column %q", value.Kind(), parquetIdColumn)
+			}
+		case columns.vector:
+			switch value.Kind() {
+			case parquet.Float:
+				dataRow.Vector = append(dataRow.Vector, value.Float())
+			case parquet.Double:
+				dataRow.Vector = append(dataRow.Vector, float32(value.Double()))
+			default:
+				return dataRow, fmt.Errorf("unsupported type %v of column %q", value.Kind(), parquetVectorColumn)
+			}
+		case columns.word:
+			dataRow.Word = string(value.ByteArray())
+		default:
+			name, ok := columns.scalars[value.Column()]
+			if !ok {
+				continue
+			}
+			if dataRow.Scalars == nil {
+				dataRow.Scalars = make(map[string]any, len(columns.scalars))
+			}
+			// The values are converted to the type of their field once the rows are inserted
+			switch value.Kind() {
+			case parquet.Int64:
+				dataRow.Scalars[name] = value.Int64()
+			case parquet.Int32:
+				dataRow.Scalars[name] = value.Int32()
+			case parquet.Float:
+				dataRow.Scalars[name] = value.Float()
+			case parquet.Double:
+				dataRow.Scalars[name] = value.Double()
+			case parquet.Boolean:
+				dataRow.Scalars[name] = value.Boolean()
+			default:
+				return dataRow, fmt.Errorf("unsupported type %v of column %q", value.Kind(), name)
+			}
+		}
+	}
+	return dataRow, nil
+}
+
+// StreamDataSet reads the Parquet file and passes it on in batches of at most batchSize rows.
+func (r ParquetDataReader) StreamDataSet(logger *Logger, batchSize int, yield func(batch []DataRow) error) error {
+	file, reader, columns, err := openParquetFile(r.sourceFile, r.scalarFields)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	defer reader.Close()
+
+	resolver := newDuplicateIdResolver(r.duplicateIds)
+	buffer := make([]parquet.Row, batchSize)
+	dim := -1
+	var rowNumber int64
+	for {
+		n, err := reader.ReadRows(buffer)
+		batch := make([]DataRow, 0, n)
+		for _, row := range buffer[:n] {
+			dataRow, parseErr := parseParquetRow(row, columns, rowNumber)
+			if parseErr != nil {
+				return fmt.Errorf("row %d: %w", rowNumber, parseErr)
+			}
+			if dim < 0 {
+				dim = len(dataRow.Vector)
+			}
+			if len(dataRow.Vector) != dim {
+				return fmt.Errorf("row %d has dimension %d, expected %d", rowNumber, len(dataRow.Vector), dim)
+			}
+			batch = append(batch, dataRow)
+			rowNumber++
+		}
+		if yieldErr := resolver.yield(batch, yield); yieldErr != nil {
+			return yieldErr
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if resolver.remapped > 0 {
+		logger.Logf("Reassigned %d duplicate ids", resolver.remapped)
+	}
+	return nil
+}
+
+func (r ParquetDataReader) GetDataSet(logger *Logger) ([]DataRow, error) {
+	return collectDataSet(r, logger)
+}
+
+func (r ParquetDataReader) ReadDataRows() ([]DataRow, error) {
+	return readPersistedDataRows()
+}
+
+// DetectParquetDimension returns the length of the first vector of a Parquet dataset.
+func DetectParquetDimension(path string) (int, error) {
+	file, reader, columns, err := openParquetFile(path, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	defer reader.Close()
+
+	buffer := make([]parquet.Row, 1)
+	n, err := reader.ReadRows(buffer)
+	if n == 0 {
+		if err == nil || errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("parquet file %s contains no rows", path)
+		}
+		return 0, err
+	}
+	row, err := parseParquetRow(buffer[0], columns, 0)
+	if err != nil {
+		return 0, err
+	}
+	return len(row.Vector), nil
+}
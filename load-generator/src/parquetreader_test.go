@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParquetDataReader_ListColumn(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	type row struct {
+		Id     int64     `parquet:"id"`
+		Vector []float32 `parquet:"vector,list"`
+		Word   string    `parquet:"word"`
+	}
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	err = parquet.WriteFile(path, []row{{Id: 7, Vector: []float32{1, 2, 3}, Word: "the"}, {Id: 9, Vector: []float32{4, 5, 6}, Word: "of"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ParquetDataReader{sourceFile: path, duplicateIds: duplicateIdsError}.GetDataSet(logger)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[1].Id != 9 || rows[1].Word != "of" || len(rows[1].Vector) != 3 || rows[1].Vector[2] != 6 {
+		t.Errorf("Unexpected rows %+v", rows)
+	}
+}
+
+func TestParquetDataReader_RepeatedDoublesWithoutIds(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	type row struct {
+		Vector []float64 `parquet:"vector"`
+	}
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := parquet.WriteFile(path, []row{{Vector: []float64{1, 2}}, {Vector: []float64{3, 4}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ParquetDataReader{sourceFile: path, duplicateIds: duplicateIdsError}.GetDataSet(logger)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Id != 0 || rows[1].Id != 1 || rows[1].Vector[0] != 3 {
+		t.Errorf("Expected sequential ids and converted vectors, got %+v", rows)
+	}
+
+	dim, err := DetectParquetDimension(path)
+	if err != nil || dim != 2 {
+		t.Errorf("Expected dimension 2, got %d / %v", dim, err)
+	}
+}
+
+func TestParquetDataReader_InconsistentDimension(t *testing.T) {
+	type row struct {
+		Vector []float32 `parquet:"vector,list"`
+	}
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := parquet.WriteFile(path, []row{{Vector: []float32{1, 2}}, {Vector: []float32{3}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (ParquetDataReader{sourceFile: path}).GetDataSet(nil); err == nil {
+		t.Error("Expected error for vectors of different dimensions")
+	}
+}
+
+func TestParquetDataReader_MissingVectorColumn(t *testing.T) {
+	type row struct {
+		Word string `parquet:"word"`
+	}
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := parquet.WriteFile(path, []row{{Word: "the"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DetectParquetDimension(path); err == nil {
+		t.Error("Expected error for a file without vector column")
+	}
+}
+
+func TestParquetDataReader_ScalarColumns(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	type row struct {
+		Vector   []float32 `parquet:"vector,list"`
+		Category int32     `parquet:"category"`
+		Score    float64   `parquet:"score"`
+	}
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := parquet.WriteFile(path, []row{{Vector: []float32{1, 2}, Category: 3, Score: 0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := ParseScalarFields("category:int64,score:float,flag:bool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ParquetDataReader{sourceFile: path, duplicateIds: duplicateIdsError, scalarFields: fields}.GetDataSet(logger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := fillScalarFields(rows, fields); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Provided columns are converted to the field type, the missing flag is generated
+	if rows[0].Scalars["category"] != int64(3) || rows[0].Scalars["score"] != float32(0.5) {
+		t.Errorf("Expected the values of the file, got %v", rows[0].Scalars)
+	}
+	if _, ok := rows[0].Scalars["flag"].(bool); !ok {
+		t.Errorf("Expected a generated flag, got %v", rows[0].Scalars)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+// How the rows are assigned to the partitions when inserting
+const (
+	partitionAssignmentRoundRobin = "roundrobin" // consecutive rows go to consecutive partitions, all partitions are equally large
+	partitionAssignmentId         = "id"         // by a hash of the primary key, independent of the order of the dataset
+	partitionAssignmentWord       = "word"       // by a hash of the word, rows sharing a word share a partition like a tenant key
+)
+
+// How the partitions searched by a query are chosen
+const (
+	partitionDistributionUniform = "uniform" // every partition is equally likely
+	partitionDistributionZipf    = "zipf"    // skewed towards low partition indexes, modelling a few hot tenants
+)
+
+// Skew of the Zipf distribution, larger values concentrate the queries on fewer partitions
+const partitionZipfSkew = 1.1
+
+func partitionName(partition int) string {
+	return fmt.Sprintf("partition_%d", partition)
+}
+
+func partitionNames(partitions []int) []string {
+	names := make([]string, len(partitions))
+	for i, partition := range partitions {
+		names[i] = partitionName(partition)
+	}
+	return names
+}
+
+// formatPartitions formats the partitions of a query for the job log, empty if it searched all partitions.
+func formatPartitions(partitions []int) string {
+	if partitions == nil {
+		return ""
+	}
+	return fmt.Sprint(partitions)
+}
+
+/**
+* assignPartitions distributes the rows over the partitions by the assignment, which is persisted with the rows.
+* firstRow is the position of the first row in the dataset, so that a streamed dataset is distributed round-robin
+* across batches.
+ */
+func assignPartitions(rows []DataRow, firstRow int, numPartitions int, assignment string) {
+	if numPartitions <= 0 {
+		return
+	}
+	for i := range rows {
+		switch assignment {
+		case partitionAssignmentId:
+			rows[i].Partition = partitionOfKey(strconv.FormatInt(rows[i].Id, 10), numPartitions)
+		case partitionAssignmentWord:
+			rows[i].Partition = partitionOfKey(rows[i].Word, numPartitions)
+		default:
+			rows[i].Partition = (firstRow + i) % numPartitions
+		}
+	}
+}
+
+func partitionOfKey(key string, numPartitions int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(numPartitions))
+}
+
+func rowsOfPartition(rows []DataRow, partition int) []DataRow {
+	var partitionRows []DataRow
+	for _, row := range rows {
+		if row.Partition == partition {
+			partitionRows = append(partitionRows, row)
+		}
+	}
+	return partitionRows
+}
+
+func createPartitions(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	numPartitions int,
+	assignment string,
+	logger *Logger,
+) error {
+	for partition := range numPartitions {
+		err := c.CreatePartition(ctx, milvusclient.NewCreatePartitionOption(collection, partitionName(partition)))
+		if err != nil {
+			return err
+		}
+	}
+	logger.Logf("Created %d partitions, rows are assigned by %s", numPartitions, assignment)
+	return nil
+}
+
+// checkPartitionParameters rejects partition selections that cannot be satisfied before the benchmark starts.
+func checkPartitionParameters(numPartitions int, assignment string, jobGenParams JobGenerationParameters) error {
+	assignments := []string{partitionAssignmentRoundRobin, partitionAssignmentId, partitionAssignmentWord}
+	if numPartitions > 0 && !slices.Contains(assignments, assignment) {
+		return fmt.Errorf("unknown partition assignment %q (supported: %s)", assignment, strings.Join(assignments, ", "))
+	}
+	if jobGenParams.partitionsPerQuery <= 0 {
+		return nil
+	}
+	if jobGenParams.partitionsPerQuery > numPartitions {
+		return fmt.Errorf("partitionsPerQuery %d exceeds the number of partitions %d",
+			jobGenParams.partitionsPerQuery, numPartitions)
+	}
+	switch jobGenParams.partitionDistribution {
+	case partitionDistributionUniform, partitionDistributionZipf:
+		return nil
+	default:
+		return fmt.Errorf("unknown partition distribution %q (supported: %s, %s)",
+			jobGenParams.partitionDistribution, partitionDistributionUniform, partitionDistributionZipf)
+	}
+}
+
+// partitionChooser picks the partitions searched by a query according to the configured distribution.
+type partitionChooser struct {
+	gen           *rand.Rand
+	zipf          *rand.Zipf // nil for the uniform distribution
+	numPartitions int
+	perQuery      int
+}
+
+// newPartitionChooser returns nil if queries search all partitions.
+func newPartitionChooser(gen *rand.Rand, numPartitions int, perQuery int, distribution string) *partitionChooser {
+	if numPartitions <= 0 || perQuery <= 0 {
+		return nil
+	}
+	chooser := &partitionChooser{gen: gen, numPartitions: numPartitions, perQuery: perQuery}
+	if distribution == partitionDistributionZipf && numPartitions > 1 {
+		chooser.zipf = rand.NewZipf(gen, partitionZipfSkew, 1, uint64(numPartitions-1))
+	}
+	return chooser
+}
+
+// choose draws perQuery distinct partitions in ascending order, or nil to search all partitions.
+func (pc *partitionChooser) choose() []int {
+	if pc == nil {
+		return nil
+	}
+	if pc.zipf == nil {
+		partitions := pc.gen.Perm(pc.numPartitions)[:pc.perQuery]
+		slices.Sort(partitions)
+		return partitions
+	}
+	partitions := make([]int, 0, pc.perQuery)
+	for len(partitions) < pc.perQuery {
+		partition := int(pc.zipf.Uint64())
+		if !slices.Contains(partitions, partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+	slices.Sort(partitions)
+	return partitions
+}
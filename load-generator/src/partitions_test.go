@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestAssignPartitions_RoundRobin(t *testing.T) {
+	rows := make([]DataRow, 5)
+	assignPartitions(rows, 0, 2, partitionAssignmentRoundRobin)
+	for i, row := range rows {
+		if row.Partition != i%2 {
+			t.Errorf("Row %d: expected partition %d, got %d", i, i%2, row.Partition)
+		}
+	}
+	if len(rowsOfPartition(rows, 1)) != 2 {
+		t.Errorf("Expected 2 rows in partition 1, got %d", len(rowsOfPartition(rows, 1)))
+	}
+}
+
+func TestAssignPartitions_ByKey(t *testing.T) {
+	rows := []DataRow{{Id: 1, Word: "a"}, {Id: 2, Word: "b"}, {Id: 3, Word: "a"}, {Id: 4, Word: "b"}}
+	assignPartitions(rows, 0, 4, partitionAssignmentWord)
+	if rows[0].Partition != rows[2].Partition || rows[1].Partition != rows[3].Partition {
+		t.Errorf("Expected rows sharing a word to share a partition, got %+v", rows)
+	}
+
+	// The partition of a row must not depend on its position in the dataset
+	first := []DataRow{{Id: 7}, {Id: 8}}
+	second := []DataRow{{Id: 8}, {Id: 7}}
+	assignPartitions(first, 0, 4, partitionAssignmentId)
+	assignPartitions(second, 10, 4, partitionAssignmentId)
+	if first[0].Partition != second[1].Partition || first[1].Partition != second[0].Partition {
+		t.Errorf("Expected the partition to follow the id, got %+v and %+v", first, second)
+	}
+	for _, row := range slices.Concat(rows, first) {
+		if row.Partition < 0 || row.Partition >= 4 {
+			t.Errorf("Partition out of range: %+v", row)
+		}
+	}
+}
+
+func TestFormatPartitions(t *testing.T) {
+	if got := formatPartitions(nil); got != "" {
+		t.Errorf("Expected an empty string for all partitions, got %q", got)
+	}
+	if got := formatPartitions([]int{0, 2}); got != "[0 2]" {
+		t.Errorf("Expected [0 2], got %q", got)
+	}
+}
+
+func TestPartitionChooser_DistinctSortedPartitions(t *testing.T) {
+	for _, distribution := range []string{partitionDistributionUniform, partitionDistributionZipf} {
+		chooser := newPartitionChooser(rand.New(rand.NewSource(42)), 8, 3, distribution)
+		for range 100 {
+			partitions := chooser.choose()
+			if len(partitions) != 3 || !slices.IsSorted(partitions) || len(slices.Compact(slices.Clone(partitions))) != 3 {
+				t.Fatalf("%s: expected 3 distinct sorted partitions, got %v", distribution, partitions)
+			}
+			if partitions[0] < 0 || partitions[2] >= 8 {
+				t.Fatalf("%s: partition out of range: %v", distribution, partitions)
+			}
+		}
+	}
+}
+
+func TestPartitionChooser_ZipfSkew(t *testing.T) {
+	chooser := newPartitionChooser(rand.New(rand.NewSource(42)), 10, 1, partitionDistributionZipf)
+	counts := make([]int, 10)
+	for range 1000 {
+		counts[chooser.choose()[0]]++
+	}
+	if counts[0] <= counts[9] {
+		t.Errorf("Expected the first partition to be queried more often than the last, got %v", counts)
+	}
+}
+
+func TestPartitionChooser_DisabledSearchesAllPartitions(t *testing.T) {
+	chooser := newPartitionChooser(rand.New(rand.NewSource(42)), 4, 0, partitionDistributionUniform)
+	if partitions := chooser.choose(); partitions != nil {
+		t.Errorf("Expected nil partitions, got %v", partitions)
+	}
+}
+
+func TestCheckPartitionParameters(t *testing.T) {
+	params := JobGenerationParameters{partitionsPerQuery: 3, partitionDistribution: partitionDistributionUniform}
+	if err := checkPartitionParameters(2, partitionAssignmentRoundRobin, params); err == nil {
+		t.Error("Expected an error for more partitions per query than partitions")
+	}
+	if err := checkPartitionParameters(4, partitionAssignmentRoundRobin, params); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkPartitionParameters(4, "range", params); err == nil {
+		t.Error("Expected an error for an unknown assignment")
+	}
+	params.partitionDistribution = "normal"
+	if err := checkPartitionParameters(4, partitionAssignmentRoundRobin, params); err == nil {
+		t.Error("Expected an error for an unknown distribution")
+	}
+}
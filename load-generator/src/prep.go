@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"github.com/milvus-io/milvus-proto/go-api/v2/commonpb"
 	"github.com/milvus-io/milvus/client/v2/entity"
 	"github.com/milvus-io/milvus/client/v2/index"
 	"github.com/milvus-io/milvus/client/v2/milvusclient"
@@ -15,77 +17,191 @@ func CreateCollection(
 	dbName string,
 	collection string,
 	idFieldName string,
-	vecFieldName string,
+	vectorFields []string,
 	dim int,
 	fieldName string,
+	rerankFieldName string,
+	scalarFields []ScalarField,
+	vectorType string,
 	logger *Logger,
 ) error {
 	/* Create database and schema */
 	logger.Log("Creating db...")
 	err := c.CreateDatabase(ctx, milvusclient.NewCreateDatabaseOption(dbName))
 	if err != nil {
-		logger.Log(err.Error())
+		// e.g. the database already exists, using it fails otherwise
+		logger.Warnf("%v", err)
 	}
 	err = c.UseDatabase(ctx, milvusclient.NewUseDatabaseOption(dbName))
 	if err != nil {
 		return err
 	}
 
+	/* A crashed run may have left its collection behind, its schema and data cannot be trusted */
+	exists, err := c.HasCollection(ctx, milvusclient.NewHasCollectionOption(collection))
+	if err != nil {
+		return err
+	}
+	if exists {
+		logger.Logf("Dropping collection %s left over from a previous run...", collection)
+		err = c.DropCollection(ctx, milvusclient.NewDropCollectionOption(collection))
+		if err != nil {
+			return fmt.Errorf("failed to drop the existing collection %s: %w", collection, err)
+		}
+	}
+
 	logger.Log("Creating Schema...")
+	// With re-ranking, the index is built on a quantized copy and the original vector is kept alongside
+	vecFieldType := vectorFieldType(vectorType)
+	if rerankFieldName != "" {
+		vecFieldType = entity.FieldTypeFloat16Vector
+	}
 	schema := entity.NewSchema().
 		WithField(entity.NewField().
 			WithName(idFieldName).
 			WithIsAutoID(false).
 			WithIsPrimaryKey(true).
 			WithDataType(entity.FieldTypeInt64),
-		).
-		WithField(entity.NewField().
+		)
+	for _, vecFieldName := range vectorFields {
+		schema = schema.WithField(entity.NewField().
 			WithName(vecFieldName).
+			WithDataType(vecFieldType).
+			WithDim(int64(dim)),
+		)
+	}
+	schema = schema.WithField(entity.NewField().
+		WithName(fieldName).
+		WithDataType(entity.FieldTypeVarChar).
+		WithMaxLength(128),
+	)
+	if rerankFieldName != "" {
+		schema = schema.WithField(entity.NewField().
+			WithName(rerankFieldName).
 			WithDataType(entity.FieldTypeFloatVector).
 			WithDim(int64(dim)),
-		).
-		WithField(entity.NewField().
-			WithName(fieldName).
-			WithDataType(entity.FieldTypeVarChar).
-			WithMaxLength(128),
 		)
+	}
+	for _, field := range scalarFields {
+		schema = schema.WithField(field.schemaField())
+	}
 	logger.Log("Creating collection...")
 	return c.CreateCollection(ctx, milvusclient.NewCreateCollectionOption(collection, schema))
 }
 
-func InsertDataset(
+/**
+* InsertBatch inserts a batch of the streamed dataset into the partitions assigned to its rows, batchSize rows per request.
+* Requests are split further so that their payload stays below maxBatchBytes (0 disables), which high dims would
+* otherwise exceed along with the gRPC message size limit of Milvus.
+* Every vector field after the first one receives the permuted copy of the vector, see vectorFieldPermutations.
+ */
+func InsertBatch(
 	c *milvusclient.Client,
 	ctx context.Context,
 	collection string,
 	idFieldName string,
-	vecFieldName string,
-	dim int,
+	vectorFields []string,
 	fieldName string,
+	rerankFieldName string,
+	vectorType string,
 	data []DataRow,
+	numPartitions int,
 	batchSize int,
-	logger *Logger,
+	maxBatchBytes int,
+	recorder *insertRecorder,
 ) error {
-	logger.Log("Inserting...")
-	for start := 0; start < len(data); start += batchSize {
-		end := min(start+batchSize, len(data))
-		rows := make([]any, 0, batchSize)
-		for _, r := range data[start:end] {
-			rowMap := map[string]any{
-				idFieldName:  r.Id,
-				vecFieldName: []float32(r.Vector),
-				fieldName:    r.Word,
-			}
-			rows = append(rows, rowMap)
+	if len(data) == 0 {
+		return nil
+	}
+	permutations := vectorFieldPermutations(vectorFields, len(data[0].Vector))
+	// Without partitions, all rows go into the default partition
+	for partition := range max(1, numPartitions) {
+		partitionData := data
+		if numPartitions > 0 {
+			partitionData = rowsOfPartition(data, partition)
 		}
-		_, err := c.Insert(ctx, milvusclient.NewRowBasedInsertOption(collection, rows...))
-		if err != nil {
-			return err
+		rowBytes := func(r DataRow) int { return insertRowBytes(r, len(vectorFields), vectorType, rerankFieldName != "") }
+		for start := 0; start < len(partitionData); {
+			end := start + nextInsertBatch(partitionData[start:], batchSize, maxBatchBytes, rowBytes)
+			rows := make([]any, 0, end-start)
+			for _, r := range partitionData[start:end] {
+				rows = append(rows, insertRowMap(r, idFieldName, vectorFields, permutations, fieldName, rerankFieldName, vectorType))
+			}
+			option := milvusclient.NewRowBasedInsertOption(collection, rows...)
+			if numPartitions > 0 {
+				option.WithPartition(partitionName(partition)) // sets the partition of the embedded option in place
+			}
+			requestStart := time.Now()
+			_, err := c.Insert(ctx, option)
+			if err != nil {
+				return err
+			}
+			recorder.record(requestStart, partition, len(rows))
+			start = end
 		}
 	}
-	logger.Log("Insert completed")
 	return nil
 }
 
+// insertRowMap builds a row of an insert or upsert request, with the permuted vector in every vector field.
+func insertRowMap(
+	r DataRow,
+	idFieldName string,
+	vectorFields []string,
+	permutations map[string][]int,
+	fieldName string,
+	rerankFieldName string,
+	vectorType string,
+) map[string]any {
+	rowMap := map[string]any{
+		idFieldName: r.Id,
+		fieldName:   r.Word,
+	}
+	for _, vecFieldName := range vectorFields {
+		rowMap[vecFieldName] = insertValue(permuteVector(r.Vector, permutations[vecFieldName]), vectorType)
+	}
+	if rerankFieldName != "" {
+		rowMap[rerankFieldName] = []float32(r.Vector)
+	}
+	for name, value := range r.Scalars {
+		rowMap[name] = value
+	}
+	return rowMap
+}
+
+// insertRowBytes approximates the payload of a row in an insert request, ignoring the encoding overhead.
+func insertRowBytes(row DataRow, numVectorFields int, vectorType string, rerank bool) int {
+	size := 8 + len(row.Word) + numVectorFields*vectorBytes(len(row.Vector), vectorType)
+	if rerank {
+		size += vectorBytes(len(row.Vector), vectorTypeFloat)
+	}
+	return size + 8*len(row.Scalars)
+}
+
+/**
+* nextInsertBatch returns the number of rows of the next insert request, at most batchSize rows and at most
+* maxBatchBytes of payload, 0 disables the limit. A single row above the limit is still inserted on its own.
+ */
+func nextInsertBatch(rows []DataRow, batchSize int, maxBatchBytes int, rowBytes func(DataRow) int) int {
+	n, size := 0, 0
+	for n < len(rows) && n < batchSize {
+		size += rowBytes(rows[n])
+		if maxBatchBytes > 0 && n > 0 && size > maxBatchBytes {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// effectiveInsertBatchSize returns the rows per insert request for rows of rowBytes, see nextInsertBatch.
+func effectiveInsertBatchSize(batchSize int, maxBatchBytes int, rowBytes int) int {
+	if maxBatchBytes <= 0 || rowBytes <= 0 {
+		return batchSize
+	}
+	return max(1, min(batchSize, maxBatchBytes/rowBytes))
+}
+
 func flushCollection(
 	c *milvusclient.Client,
 	ctx context.Context,
@@ -102,16 +218,179 @@ func flushCollection(
 	return nil
 }
 
+/**
+* LoadCollection loads the collection into memory and waits until it reached the loaded state.
+* Each attempt is bounded by loadTimeout, a stalled or failed load is retried up to loadRetries times.
+ */
+func LoadCollection(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	loadTimeout time.Duration,
+	loadRetries int,
+	logger *Logger,
+) error {
+	var err error
+	for attempt := range loadRetries + 1 {
+		if attempt > 0 {
+			logger.Logf("Retrying to load collection %s (attempt %d of %d)", collection, attempt+1, loadRetries+1)
+		}
+		startTime := time.Now()
+		err = awaitCollectionLoaded(c, ctx, collection, loadTimeout)
+		if err == nil {
+			logger.Logf("Collection %s loaded in %v", collection, time.Since(startTime))
+			return nil
+		}
+		logger.Warnf("Loading collection %s failed: %v", collection, err)
+	}
+	return fmt.Errorf("collection %s did not reach loaded state within %v after %d attempts: %w",
+		collection, loadTimeout, loadRetries+1, err)
+}
+
+// awaitCollectionLoaded issues a single load request and waits for it to finish within the timeout.
+func awaitCollectionLoaded(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	loadTimeout time.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	task, err := c.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(collection))
+	if err != nil {
+		return err
+	}
+	err = task.Await(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Sanity-Check the load state, Await only reports the loading progress
+	state, err := c.GetLoadState(ctx, milvusclient.NewGetLoadStateOption(collection))
+	if err != nil {
+		return err
+	}
+	if state.State != entity.LoadStateLoaded {
+		return fmt.Errorf("unexpected load state %v (progress %d%%)", state.State, state.Progress)
+	}
+	return nil
+}
+
+/**
+* validateSchemaDimensions asserts that the configured dim, used for all generated queries, matches the
+* dimensionality of the vector field in the collection schema, the dataset vectors are validated as they are inserted.
+* A mismatch otherwise only surfaces as cryptic per-query search errors during the benchmark.
+ */
+func validateSchemaDimensions(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	vecFieldName string,
+	dim int,
+) error {
+	description, err := c.DescribeCollection(ctx, milvusclient.NewDescribeCollectionOption(collection))
+	if err != nil {
+		return err
+	}
+	for _, field := range description.Schema.Fields {
+		if field.Name != vecFieldName {
+			continue
+		}
+		schemaDim, err := field.GetDim()
+		if err != nil {
+			return fmt.Errorf("failed to read the dimensionality of field %s: %w", vecFieldName, err)
+		}
+		if schemaDim != int64(dim) {
+			return fmt.Errorf("dimension mismatch: configured dim is %d but field %s of collection %s has dim %d",
+				dim, vecFieldName, collection, schemaDim)
+		}
+		return nil
+	}
+	return fmt.Errorf("vector field %s not found in collection %s", vecFieldName, collection)
+}
+
+// validateDatasetDimensions asserts that all dataset vectors have the configured dim.
+func validateDatasetDimensions(dim int, data []DataRow) error {
+	for _, row := range data {
+		if len(row.Vector) != dim {
+			return fmt.Errorf("dimension mismatch: configured dim is %d but dataset row with id %d (word %q) has dim %d",
+				dim, row.Id, row.Word, len(row.Vector))
+		}
+	}
+	return nil
+}
+
+// indexPollInterval is the time between two checks of the index build progress
+const indexPollInterval = 2 * time.Second
+
+/**
+* awaitIndexBuilt polls the build progress of the index on fieldName until all rows are indexed.
+* Awaiting the index task only covers the build task itself, while segments may still be indexed in the background.
+ */
+func awaitIndexBuilt(
+	c *milvusclient.Client,
+	ctx context.Context,
+	collection string,
+	fieldName string,
+	timeout time.Duration,
+	logger *Logger,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	indexName, err := indexNameOf(c, ctx, collection, fieldName)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(indexPollInterval)
+	defer ticker.Stop()
+	for {
+		description, err := c.DescribeIndex(ctx, milvusclient.NewDescribeIndexOption(collection, indexName))
+		if err != nil {
+			return err
+		}
+		if description.State == index.IndexState(commonpb.IndexState_Failed) {
+			return fmt.Errorf("building index %s failed", indexName)
+		}
+		if description.State == index.IndexState(commonpb.IndexState_Finished) &&
+			description.IndexedRows >= description.TotalRows {
+			logger.Logf("Index %s fully built: %d of %d rows indexed",
+				indexName, description.IndexedRows, description.TotalRows)
+			return nil
+		}
+		logger.Logf("Index %s: %d of %d rows indexed, %d pending",
+			indexName, description.IndexedRows, description.TotalRows, description.PendingIndexRows)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("index %s was not fully built within %v: %w", indexName, timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 func Prepare(
 	c *milvusclient.Client,
 	dbName string,
 	collection string,
 	idFieldName string,
-	vecFieldName string,
+	vectorFields []string,
 	dim int,
 	fieldName string,
+	rerankFieldName string,
+	scalarFields []ScalarField,
 	indexParams ConstructionIndexParameters,
 	insertBatchSize int,
+	insertBatchBytes int,
+	insertConcurrency int,
+	indexBuildTimeout time.Duration,
+	checkDimensions bool,
+	sharedDataRowsDir string,
+	numPartitions int,
+	partitionAssignment string,
+	insertStats bool,
 	datasource DataSource,
 ) error {
 	logger, err := NewLogger("prepare")
@@ -129,43 +408,84 @@ func Prepare(
 		dbName,
 		collection,
 		idFieldName,
-		vecFieldName,
+		vectorFields,
 		dim,
 		fieldName,
+		rerankFieldName,
+		scalarFields,
+		indexParams.vectorType,
 		logger,
 	)
 	if err != nil {
 		return err
 	}
 
-	/* Get Dataset */
-	data, err := datasource.GetDataSet()
-	if err != nil {
-		return err
+	/* Fail fast on a collection schema not matching the configured dim */
+	if checkDimensions {
+		for _, vecFieldName := range vectorFields {
+			err = validateSchemaDimensions(c, ctx, collection, vecFieldName, dim)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	/* Persist Data Rows for later recall calculation */
-	err = logger.LogDataRows(data)
-	if err != nil {
-		return err
+	if numPartitions > 0 {
+		err = createPartitions(c, ctx, collection, numPartitions, partitionAssignment, logger)
+		if err != nil {
+			return err
+		}
 	}
 
-	/* Insert Dataset */
-	err = InsertDataset(
-		c,
-		ctx,
-		collection,
-		idFieldName,
-		vecFieldName,
-		dim,
-		fieldName,
-		data,
-		insertBatchSize,
+	/* Insert the dataset as it is read, so that it never has to be resident at once */
+	// The words are left out, they are short compared to the vectors
+	rowBytes := insertRowBytes(DataRow{Vector: make(Vector, dim)}, len(vectorFields), indexParams.vectorType, rerankFieldName != "")
+	logger.Logf("Inserting in batches of %d rows (about %d bytes per row, insertBatchBytes %d)...",
+		effectiveInsertBatchSize(insertBatchSize, insertBatchBytes, rowBytes), rowBytes, insertBatchBytes)
+	recorder := newInsertRecorder(insertStats)
+	pool := newInsertPool(ctx, insertConcurrency, func(ctx context.Context, batch []DataRow) error {
+		return InsertBatch(
+			c,
+			ctx,
+			collection,
+			idFieldName,
+			vectorFields,
+			fieldName,
+			rerankFieldName,
+			indexParams.vectorType,
+			batch,
+			numPartitions,
+			insertBatchSize,
+			insertBatchBytes,
+			recorder,
+		)
+	})
+	// Each partition receives about insertBatchSize rows of a batch
+	_, err = persistDataRows(
 		logger,
+		datasource,
+		dim,
+		checkDimensions,
+		sharedDataRowsDir,
+		numPartitions,
+		partitionAssignment,
+		scalarFields,
+		insertBatchSize*max(1, numPartitions),
+		pool.submit,
 	)
+	// The workers are stopped either way, a failed insert surfaces through wait as well
+	if waitErr := pool.wait(); err == nil {
+		err = waitErr
+	}
 	if err != nil {
 		return err
 	}
+	recorder.logSummary(logger)
+	if insertStats {
+		if err := logger.LogInsertStats(recorder.requests); err != nil {
+			logger.Errorf("Failed to write the insert statistics: %v", err)
+		}
+	}
 
 	/* Flush data before indexing */
 	err = flushCollection(c, ctx, collection, logger)
@@ -176,23 +496,54 @@ func Prepare(
 	/* Create the index */
 	indexStartTime := time.Now()
 
-	indexTask, err := c.CreateIndex(ctx, milvusclient.NewCreateIndexOption(
-		collection,
-		vecFieldName,
-		index.NewHNSWIndex(
-			index.MetricType(indexParams.distanceMetric),
-			indexParams.efConstruction,
-			indexParams.M,
-		),
-	),
-	)
+	vecIndex, err := buildIndex(indexParams)
 	if err != nil {
 		return err
 	}
-	indexTask.Await(ctx)
+	for _, vecFieldName := range vectorFields {
+		indexTask, err := c.CreateIndex(ctx, milvusclient.NewCreateIndexOption(
+			collection,
+			vecFieldName,
+			vecIndex,
+		),
+		)
+		if err != nil {
+			return err
+		}
+		indexTask.Await(ctx)
+
+		/* Ensure searches run against a fully indexed collection */
+		if indexBuildTimeout > 0 {
+			err = awaitIndexBuilt(c, ctx, collection, vecFieldName, indexBuildTimeout, logger)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	indexConstructionTime := time.Since(indexStartTime)
 	logger.Logf("Index constructed in %v", indexConstructionTime)
 
+	for _, vecFieldName := range vectorFields {
+		err = logIndexType(c, ctx, collection, vecFieldName, indexParams, logger)
+		if err != nil {
+			logger.Errorf("Failed to verify the index type: %v", err)
+		}
+	}
+
+	/* Every vector field of a collection must be indexed before it can be loaded */
+	if rerankFieldName != "" {
+		rerankIndexTask, err := c.CreateIndex(ctx, milvusclient.NewCreateIndexOption(
+			collection,
+			rerankFieldName,
+			index.NewFlatIndex(index.MetricType(indexParams.distanceMetric)),
+		))
+		if err != nil {
+			return err
+		}
+		rerankIndexTask.Await(ctx)
+		logger.Logf("Created FLAT index on re-ranking field %s", rerankFieldName)
+	}
+
 	// Sanity-Check index Creation
 	indices, err := c.ListIndexes(ctx, milvusclient.NewListIndexOption(collection))
 	if err != nil {
@@ -202,3 +553,132 @@ func Prepare(
 
 	return nil
 }
+
+/**
+* persistDataRows streams the dataset and persists its rows for the recall calculation, along with the partition
+* and scalar values each row is inserted with. insert is called with every batch once it is persisted.
+* It returns the number of rows.
+ */
+func persistDataRows(
+	logger *Logger,
+	datasource DataSource,
+	dim int,
+	checkDimensions bool,
+	sharedDataRowsDir string,
+	numPartitions int,
+	partitionAssignment string,
+	scalarFields []ScalarField,
+	batchSize int,
+	insert func(batch []DataRow) error,
+) (int, error) {
+	dataRowsLog, err := logger.OpenDataRowsLog(sharedDataRowsDir)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	err = datasource.StreamDataSet(logger, batchSize, func(batch []DataRow) error {
+		/* Fail fast on mismatching dimensions before inserting */
+		if checkDimensions {
+			if err := validateDatasetDimensions(dim, batch); err != nil {
+				return err
+			}
+		}
+		/* Partition-aware ground truth requires the partition of each row */
+		assignPartitions(batch, rows, numPartitions, partitionAssignment)
+		if err := fillScalarFields(batch, scalarFields); err != nil {
+			return err
+		}
+		if err := dataRowsLog.Write(batch); err != nil {
+			return err
+		}
+		if err := insert(batch); err != nil {
+			return err
+		}
+		rows += len(batch)
+		return nil
+	})
+	if err != nil {
+		dataRowsLog.Abort()
+		return 0, err
+	}
+	return rows, dataRowsLog.Close()
+}
+
+/**
+* ReusePreparedCollection skips the preparation in favor of an existing collection, e.g. of a previous run with
+* keepCollection, when iterating on workload parameters against the same dataset.
+* The collection must match the configured dim and index, the dataset is only read to persist its rows for the
+* recall calculation, so it has to be the one the collection was prepared with.
+ */
+func ReusePreparedCollection(
+	c *milvusclient.Client,
+	dbName string,
+	collection string,
+	vectorFields []string,
+	dim int,
+	indexParams ConstructionIndexParameters,
+	checkDimensions bool,
+	sharedDataRowsDir string,
+	numPartitions int,
+	partitionAssignment string,
+	scalarFields []ScalarField,
+	datasource DataSource,
+) error {
+	logger, err := NewLogger("prepare")
+	if err != nil {
+		return err
+	}
+	defer logger.Close()
+
+	ctx := context.Background()
+	err = c.UseDatabase(ctx, milvusclient.NewUseDatabaseOption(dbName))
+	if err != nil {
+		return err
+	}
+	exists, err := c.HasCollection(ctx, milvusclient.NewHasCollectionOption(collection))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("collection %s does not exist in database %s, it has to be prepared first", collection, dbName)
+	}
+
+	/* The benchmark results are only meaningful for the configured collection */
+	for _, vecFieldName := range vectorFields {
+		err = validateSchemaDimensions(c, ctx, collection, vecFieldName, dim)
+		if err != nil {
+			return err
+		}
+		err = validateExistingIndex(c, ctx, collection, vecFieldName, indexParams)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := c.GetLoadState(ctx, milvusclient.NewGetLoadStateOption(collection))
+	if err != nil {
+		return err
+	}
+	if state.State != entity.LoadStateLoaded {
+		logger.Logf("Collection %s is not loaded yet (state %v), it is loaded before the warmup", collection, state.State)
+	}
+
+	/* Persist Data Rows for later recall calculation */
+	rows, err := persistDataRows(
+		logger,
+		datasource,
+		dim,
+		checkDimensions,
+		sharedDataRowsDir,
+		numPartitions,
+		partitionAssignment,
+		scalarFields,
+		collectBatchSize,
+		func(batch []DataRow) error { return nil },
+	)
+	if err != nil {
+		return err
+	}
+	logger.Logf("Reusing collection %s, persisted %d data rows without inserting them", collection, rows)
+	return nil
+}
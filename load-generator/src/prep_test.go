@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestValidateDatasetDimensions_Matching(t *testing.T) {
+	data := []DataRow{{Id: 0, Vector: Vector{1, 2, 3}}, {Id: 1, Vector: Vector{4, 5, 6}}}
+
+	if err := validateDatasetDimensions(3, data); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestValidateDatasetDimensions_Mismatch(t *testing.T) {
+	data := []DataRow{{Id: 0, Vector: Vector{1, 2, 3}}, {Id: 1, Word: "short", Vector: Vector{4, 5}}}
+
+	if err := validateDatasetDimensions(3, data); err == nil {
+		t.Error("Expected error for a dataset row with a different dim")
+	}
+}
+
+func TestNextInsertBatch_SplitsByPayload(t *testing.T) {
+	rows := make([]DataRow, 10)
+	rowBytes := func(DataRow) int { return 100 }
+
+	if n := nextInsertBatch(rows, 4, 0, rowBytes); n != 4 {
+		t.Errorf("Expected the row limit of 4 without a payload limit, got %d", n)
+	}
+	if n := nextInsertBatch(rows, 4, 250, rowBytes); n != 2 {
+		t.Errorf("Expected 2 rows within 250 bytes, got %d", n)
+	}
+	if n := nextInsertBatch(rows, 4, 50, rowBytes); n != 1 {
+		t.Errorf("Expected an oversized row to be inserted on its own, got %d", n)
+	}
+	if n := nextInsertBatch(rows[9:], 4, 250, rowBytes); n != 1 {
+		t.Errorf("Expected the remaining row, got %d", n)
+	}
+}
+
+func TestEffectiveInsertBatchSize(t *testing.T) {
+	// 1536 dims of float32 are about 6KB per row
+	rowBytes := insertRowBytes(DataRow{Vector: make(Vector, 1536)}, 1, vectorTypeFloat, false)
+
+	if size := effectiveInsertBatchSize(1000, 1<<20, rowBytes); size != (1<<20)/rowBytes {
+		t.Errorf("Expected the payload limit to cap the batch, got %d", size)
+	}
+	if size := effectiveInsertBatchSize(1000, 0, rowBytes); size != 1000 {
+		t.Errorf("Expected the row limit without a payload limit, got %d", size)
+	}
+	if size := effectiveInsertBatchSize(100, 8<<20, rowBytes); size != 100 {
+		t.Errorf("Expected the row limit as an upper bound, got %d", size)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// Parameters of the adaptive rate, which follows an additive-increase/multiplicative-decrease scheme
+const (
+	rateBackoffFactor  = 0.75            // the rate is reduced to this fraction on rate-limit errors
+	rateRecoveryStep   = 0.05            // fraction of targetQPS added back after a window without rate limiting
+	rateMinFactor      = 0.01            // lower bound, so that arrivals never stop entirely
+	rateAdjustInterval = 5 * time.Second // minimum time between two adjustments
+)
+
+// RateLimitStats reports how the arrival rate adapted to the rate limits enforced by the cluster.
+type RateLimitStats struct {
+	RateLimitedQueries int
+	Backoffs           int
+	FinalFactor        float64 // fraction of targetQPS the arrivals ended with
+	SustainableQPS     float64 // targetQPS * FinalFactor
+}
+
+/**
+* adaptiveRate scales the arrival rate down when Milvus rejects queries due to rate limits or quotas,
+* and slowly back up while queries succeed. It converges towards the rate the cluster sustains.
+ */
+type adaptiveRate struct {
+	mu                 sync.Mutex
+	factor             float64
+	lastAdjustment     time.Time
+	rateLimited        bool // whether a rate-limit error occurred since the last adjustment
+	rateLimitedQueries int
+	backoffs           int
+}
+
+func newAdaptiveRate() *adaptiveRate {
+	return &adaptiveRate{factor: 1, lastAdjustment: time.Now()}
+}
+
+// isRateLimitError reports whether Milvus rejected the request due to a rate limit or quota.
+func isRateLimitError(err error) bool {
+	return errors.Is(err, merr.ErrServiceRateLimit) || errors.Is(err, merr.ErrServiceQuotaExceeded)
+}
+
+// Factor returns the fraction of targetQPS arrivals are currently generated with.
+func (r *adaptiveRate) Factor() float64 {
+	if r == nil {
+		return 1
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.factor
+}
+
+// record adjusts the rate based on the outcome of a query, it returns true if the rate was reduced.
+func (r *adaptiveRate) record(err error, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if isRateLimitError(err) {
+		r.rateLimitedQueries++
+		r.rateLimited = true
+	}
+	if now.Sub(r.lastAdjustment) < rateAdjustInterval {
+		return false
+	}
+
+	backoff := r.rateLimited
+	if backoff {
+		r.factor = max(rateMinFactor, r.factor*rateBackoffFactor)
+		r.backoffs++
+	} else {
+		r.factor = min(1, r.factor+rateRecoveryStep)
+	}
+	r.rateLimited = false
+	r.lastAdjustment = now
+	return backoff
+}
+
+func (r *adaptiveRate) stats(targetQPS float64) RateLimitStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RateLimitStats{
+		RateLimitedQueries: r.rateLimitedQueries,
+		Backoffs:           r.backoffs,
+		FinalFactor:        r.factor,
+		SustainableQPS:     targetQPS * r.factor,
+	}
+}
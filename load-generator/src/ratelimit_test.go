@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+func TestIsRateLimitError(t *testing.T) {
+	if !isRateLimitError(fmt.Errorf("search failed: %w", merr.ErrServiceRateLimit)) {
+		t.Error("Expected wrapped rate limit error to be detected")
+	}
+	if !isRateLimitError(merr.ErrServiceQuotaExceeded) {
+		t.Error("Expected quota exceeded error to be detected")
+	}
+	if isRateLimitError(errors.New("connection refused")) || isRateLimitError(nil) {
+		t.Error("Expected other errors not to be detected as rate limit errors")
+	}
+}
+
+func TestAdaptiveRate_BackoffAndRecovery(t *testing.T) {
+	rate := newAdaptiveRate()
+	start := rate.lastAdjustment
+
+	// Adjustments only happen once per interval
+	if rate.record(merr.ErrServiceRateLimit, start.Add(time.Second)) {
+		t.Error("Expected no adjustment within the adjustment interval")
+	}
+	if !rate.record(nil, start.Add(rateAdjustInterval)) {
+		t.Error("Expected backoff after a rate-limited interval")
+	}
+	if rate.Factor() != rateBackoffFactor {
+		t.Errorf("Expected factor %.2f, got %.2f", rateBackoffFactor, rate.Factor())
+	}
+
+	rate.record(nil, start.Add(2*rateAdjustInterval))
+	if rate.Factor() != rateBackoffFactor+rateRecoveryStep {
+		t.Errorf("Expected factor %.2f after recovery, got %.2f", rateBackoffFactor+rateRecoveryStep, rate.Factor())
+	}
+
+	stats := rate.stats(100)
+	if stats.RateLimitedQueries != 1 || stats.Backoffs != 1 || stats.SustainableQPS != 100*rate.Factor() {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestAdaptiveRate_NilFactor(t *testing.T) {
+	var rate *adaptiveRate
+	if rate.Factor() != 1 {
+		t.Errorf("Expected factor 1 without adaptive rate, got %.2f", rate.Factor())
+	}
+}
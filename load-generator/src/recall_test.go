@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
+	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -41,6 +44,89 @@ func TestEuclideanDistance_NegativeValues(t *testing.T) {
 	}
 }
 
+func TestEuclideanDistance_MismatchedLengths(t *testing.T) {
+	a := []float32{1.0, 2.0, 3.0}
+	b := []float32{1.0, 2.0}
+
+	for _, metric := range []string{metricL2, metricIP, metricCosine, metricHamming} {
+		distance := distanceFunc(metric)
+		if dist := distance(a, b); dist != mismatchedDistance {
+			t.Errorf("%s: expected the mismatched distance, got %f", metric, dist)
+		}
+		if dist := distance(b, a); dist != mismatchedDistance {
+			t.Errorf("%s: expected the mismatched distance, got %f", metric, dist)
+		}
+	}
+}
+
+func TestEnhanceJobResults_MismatchedDimensions(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{0.0}}, // e.g. a truncated line
+		{Id: 3, Vector: Vector{2.0, 0.0}},
+	}
+	jobs := []Job{{Id: "0", QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1, 3}}}
+
+	dim, rowIds, jobIds := checkDimensions(rawData, jobs)
+	if dim != 2 || !slices.Equal(rowIds, []int64{2}) || len(jobIds) != 0 {
+		t.Errorf("Expected row 2 to mismatch dimension 2, got dim %d, rows %v, jobs %v", dim, rowIds, jobIds)
+	}
+
+	// The mismatched row is never a true neighbor
+	for _, tieAware := range []bool{false, true} {
+		options := DefaultRecallOptions()
+		options.TieAware = tieAware
+		results := EnhanceJobResults(rawData, jobs, options)
+		if results[0].Recall != 1.0 {
+			t.Errorf("tieAware=%v: expected recall 1.0, got %f", tieAware, results[0].Recall)
+		}
+	}
+}
+
+func TestUnrolledDistanceFunc_MatchesScalar(t *testing.T) {
+	generator := rand.New(rand.NewSource(3))
+	// Dimensions that are no multiple of 4 exercise the remainder loop
+	for _, dim := range []int{1, 3, 4, 7, 50, 100, 129, 200} {
+		for _, metric := range []string{metricL2, metricIP, metricCosine, metricHamming} {
+			scalar, unrolled := distanceFunc(metric), unrolledDistanceFunc(metric)
+			for range 20 {
+				a := GenerateVector(generator, dim, 1.0, 0.0)
+				b := GenerateVector(generator, dim, 1.0, 0.0)
+				expected, got := scalar(a, b), unrolled(a, b)
+				if math.Abs(float64(expected-got)) > 1e-4*max(1, math.Abs(float64(expected))) {
+					t.Errorf("%s, dim %d: expected distance %f, got %f", metric, dim, expected, got)
+				}
+			}
+			if got := unrolled(make([]float32, dim), make([]float32, dim+1)); got != mismatchedDistance {
+				t.Errorf("%s, dim %d: expected the mismatched distance, got %f", metric, dim, got)
+			}
+		}
+	}
+}
+
+// BenchmarkDistance compares the scalar and the unrolled distance functions at common dimensions.
+func BenchmarkDistance(b *testing.B) {
+	generator := rand.New(rand.NewSource(1))
+	for _, dim := range []int{50, 100, 200} {
+		x := GenerateVector(generator, dim, 1.0, 0.0)
+		y := GenerateVector(generator, dim, 1.0, 0.0)
+		for _, metric := range []string{metricL2, metricIP} {
+			for name, distance := range map[string]func(a, b []float32) float32{
+				"scalar":   distanceFunc(metric),
+				"unrolled": unrolledDistanceFunc(metric),
+			} {
+				b.Run(fmt.Sprintf("%s/dim=%d/%s", metric, dim, name), func(b *testing.B) {
+					var sum float32
+					for range b.N {
+						sum += distance(x, y)
+					}
+					_ = sum
+				})
+			}
+		}
+	}
+}
+
 func TestEuclideanDistance_HighDimension(t *testing.T) {
 	dim := 50
 	a := make([]float32, dim)
@@ -161,6 +247,22 @@ func TestSortedNeighborsInsertSorted_AppendWhenLengthLowerK(t *testing.T) {
 	}
 }
 
+func TestSortedNeighborsInsertSorted_SpareCapacity(t *testing.T) {
+	for _, k := range []int{3, 4, 8} {
+		h := make(sortedNeighbors, 3, 3+5)
+		h[0] = neighbor{id: 1, distance: 10.0}
+		h[1] = neighbor{id: 2, distance: 20.0}
+		h[2] = neighbor{id: 3, distance: 30.0}
+
+		h = h.InsertSorted(neighbor{id: 4, distance: 5.0}, k)
+
+		expected := sortedNeighbors{{4, 5.0}, {1, 10.0}, {2, 20.0}, {3, 30.0}}[:min(k, 4)]
+		if !slices.Equal(h, expected) {
+			t.Errorf("k=%d: expected %v, got %v", k, expected, h)
+		}
+	}
+}
+
 func TestSortedNeighborsInsertSorted_EqualDistance(t *testing.T) {
 	h := sortedNeighbors{
 		{id: 1, distance: 10.0},
@@ -178,6 +280,55 @@ func TestSortedNeighborsInsertSorted_EqualDistance(t *testing.T) {
 	}
 }
 
+func TestNeighborHeap_MatchesInsertSorted(t *testing.T) {
+	generator := rand.New(rand.NewSource(11))
+	for trial := range 200 {
+		k := generator.Intn(40)
+		n := generator.Intn(300)
+		// Few distinct distances force many ties, also at the k-th neighbor
+		distinct := 1 + generator.Intn(20)
+
+		reference := make(sortedNeighbors, 0, k)
+		nearest := newNeighborHeap(k)
+		for id := range n {
+			candidate := neighbor{id: int64(id), distance: float32(generator.Intn(distinct))}
+			reference = reference.InsertSorted(candidate, k)
+			nearest.insert(candidate)
+		}
+		if got := nearest.sorted(); !slices.Equal(got, reference) {
+			t.Fatalf("trial %d (k=%d, n=%d): expected %v, got %v", trial, k, n, reference, got)
+		}
+	}
+}
+
+// BenchmarkNearestNeighbors compares the insertion-sorted list with the heap for growing k.
+func BenchmarkNearestNeighbors(b *testing.B) {
+	generator := rand.New(rand.NewSource(1))
+	candidates := make([]neighbor, 100000)
+	for i := range candidates {
+		candidates[i] = neighbor{id: int64(i), distance: generator.Float32()}
+	}
+	for _, k := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("k=%d/sorted", k), func(b *testing.B) {
+			for range b.N {
+				sorted := make(sortedNeighbors, 0, k)
+				for _, n := range candidates {
+					sorted = sorted.InsertSorted(n, k)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("k=%d/heap", k), func(b *testing.B) {
+			for range b.N {
+				nearest := newNeighborHeap(k)
+				for _, n := range candidates {
+					nearest.insert(n)
+				}
+				nearest.sorted()
+			}
+		})
+	}
+}
+
 func TestSortedNeighborsInsertSorted_InverseInsertOrder(t *testing.T) {
 	h := make(sortedNeighbors, 0)
 
@@ -555,7 +706,7 @@ func TestEnhanceJobResults_SingleJob(t *testing.T) {
 		},
 	}
 
-	results := EnhanceJobResults(rawData, jobs)
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
 
 	if len(results) != 1 {
 		t.Errorf("Expected 1 result, got %d", len(results))
@@ -587,7 +738,7 @@ func TestEnhanceJobResults_MultipleJobs(t *testing.T) {
 		},
 	}
 
-	results := EnhanceJobResults(rawData, jobs)
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
 
 	if len(results) != 3 {
 		t.Errorf("Expected 3 results, got %d", len(results))
@@ -607,7 +758,7 @@ func TestEnhanceJobResults_EmptyJobs(t *testing.T) {
 	}
 	jobs := []Job{}
 
-	results := EnhanceJobResults(rawData, jobs)
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
 
 	if len(results) != 0 {
 		t.Errorf("Expected 0 results for empty jobs, got %d", len(results))
@@ -626,7 +777,7 @@ func TestEnhanceJobResults_PreservesJobData(t *testing.T) {
 		},
 	}
 
-	results := EnhanceJobResults(rawData, jobs)
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
 
 	if len(results) != 1 {
 		t.Fatalf("Expected 1 result, got %d", len(results))
@@ -639,3 +790,432 @@ func TestEnhanceJobResults_PreservesJobData(t *testing.T) {
 		t.Errorf("ResultIds not preserved")
 	}
 }
+
+func TestEnhanceJobResults_FirstStageRecall(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{2.0, 0.0}},
+		{Id: 3, Vector: Vector{3.0, 0.0}},
+		{Id: 4, Vector: Vector{4.0, 0.0}},
+	}
+	jobs := []Job{
+		{
+			QueryVector:  Vector{0.0, 0.0},
+			ResultIds:    []int64{1, 2},       // re-ranking recovered the true neighbors
+			CandidateIds: []int64{3, 1, 4, 2}, // the approximate top 2 only contain one of them
+		},
+		{
+			QueryVector: Vector{0.0, 0.0},
+			ResultIds:   []int64{1, 2}, // without candidates, no first-stage recall
+		},
+	}
+
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
+
+	if results[0].Recall != 1.0 || results[0].FirstStageRecall != 0.5 {
+		t.Errorf("Expected recall 1.0 and first-stage recall 0.5, got %f / %f",
+			results[0].Recall, results[0].FirstStageRecall)
+	}
+	if results[1].Recall != 1.0 || results[1].FirstStageRecall != -1.0 {
+		t.Errorf("Expected recall 1.0 and first-stage recall -1, got %f / %f",
+			results[1].Recall, results[1].FirstStageRecall)
+	}
+}
+
+func TestNearestNeighborsBatch_MatchesSingleQueries(t *testing.T) {
+	generator := rand.New(rand.NewSource(7))
+	rawData := make([]DataRow, 500)
+	for i := range rawData {
+		rawData[i] = DataRow{Id: int64(i), Vector: GenerateVector(generator, 8, 1.0, 0.0)}
+	}
+	queries := []Vector{
+		GenerateVector(generator, 8, 1.0, 0.0),
+		GenerateVector(generator, 8, 1.0, 0.0),
+		GenerateVector(generator, 8, 1.0, 0.0),
+	}
+	ks := []int{10, 5, 1}
+
+	batch := nearestNeighborsBatch(queries, ks, make([][]int, len(queries)), make([]*idFilter, len(queries)), rawData, euclideanDistance)
+
+	for q, query := range queries {
+		expected := nearestNeighbors(query, rawData, ks[q])
+		if len(batch[q]) != len(expected) {
+			t.Fatalf("Query %d: expected %d neighbors, got %d", q, len(expected), len(batch[q]))
+		}
+		for i := range expected {
+			if batch[q][i] != expected[i] {
+				t.Errorf("Query %d: expected neighbors %v, got %v", q, expected, batch[q])
+				break
+			}
+		}
+	}
+}
+
+func TestEnhanceJobResults_BatchSizeDoesNotChangeRecall(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{2.0, 0.0}},
+		{Id: 3, Vector: Vector{3.0, 0.0}},
+		{Id: 4, Vector: Vector{4.0, 0.0}},
+	}
+	jobs := []Job{
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1, 3}},
+		{QueryVector: Vector{4.0, 0.0}, ResultIds: []int64{4}},
+		{QueryVector: Vector{2.0, 0.0}, ResultIds: []int64{2, 1, 3}},
+		{QueryVector: Vector{0.0, 0.0}}, // no results
+	}
+
+	unbatched := EnhanceJobResults(rawData, jobs, RecallOptions{BatchSize: 1})
+	batched := EnhanceJobResults(rawData, jobs, RecallOptions{BatchSize: 3})
+
+	for i := range jobs {
+		if unbatched[i].Recall != batched[i].Recall {
+			t.Errorf("Job %d: expected recall %f, got %f with batching", i, unbatched[i].Recall, batched[i].Recall)
+		}
+	}
+	if batched[3].Recall != -1.0 {
+		t.Errorf("Expected recall -1 for a job without results, got %f", batched[3].Recall)
+	}
+}
+
+func TestSummarizeRecall_ByQueryKind(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{2.0, 0.0}},
+		{Id: 3, Vector: Vector{3.0, 0.0}},
+	}
+	jobs := []Job{
+		{Id: "J-0", QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1}},    // recall 1
+		{Id: "J-1", QueryVector: Vector{0.0, 0.0}},                           // no results, not counted
+		{Id: "S-0-0", QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{3}},  // recall 0
+		{Id: "S-0-1", QueryVector: Vector{3.0, 0.0}, ResultIds: []int64{3}},  // recall 1
+		{Id: "S-0-2", QueryVector: Vector{3.0, 0.0}, ResultIds: []int64{1}},  // recall 0
+		{Id: "S-12-0", QueryVector: Vector{2.0, 0.0}, ResultIds: []int64{2}}, // recall 1
+	}
+
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
+	if results[3].QueryKind != queryKindSessionFollowUp || results[3].Step != 1 {
+		t.Errorf("Expected follow-up query at step 1, got %s at step %d", results[3].QueryKind, results[3].Step)
+	}
+	if results[0].Step != -1 {
+		t.Errorf("Expected step -1 for an independent job, got %d", results[0].Step)
+	}
+
+	summary := SummarizeRecall(results, RecallOptions{})
+	expected := RecallSummary{
+		K:               1,
+		Overall:         RecallGroupStats{Count: 5, MeanRecall: 0.6, MinRecall: 0, MaxRecall: 1.0},
+		Independent:     RecallGroupStats{Count: 1, MeanRecall: 1.0, MinRecall: 1.0, MaxRecall: 1.0},
+		SessionFirst:    RecallGroupStats{Count: 2, MeanRecall: 0.5, MinRecall: 0, MaxRecall: 1.0},
+		SessionFollowUp: RecallGroupStats{Count: 2, MeanRecall: 0.5, MinRecall: 0, MaxRecall: 1.0},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestSummarizeRecall_BySearchEffort(t *testing.T) {
+	results := []EnhancedJobResult{
+		{Job: Job{Id: "J-0", SearchEffort: 16}, Recall: 0.5},
+		{Job: Job{Id: "J-1", SearchEffort: 64}, Recall: 1.0},
+		{Job: Job{Id: "J-2", SearchEffort: 16}, Recall: 0.7},
+	}
+
+	summary := SummarizeRecall(results, RecallOptions{})
+
+	low, high := summary.BySearchEffort[16], summary.BySearchEffort[64]
+	if len(summary.BySearchEffort) != 2 || low.Count != 2 || math.Abs(low.MeanRecall-0.6) > 1e-9 || high.MeanRecall != 1.0 {
+		t.Errorf("Unexpected recall by search effort: %v / %v", low, high)
+	}
+	if unswept := SummarizeRecall(results[:0], RecallOptions{}); unswept.BySearchEffort != nil {
+		t.Errorf("Expected no breakdown without a sweep, got %v", unswept.BySearchEffort)
+	}
+}
+
+func TestMergeRecallSummaries(t *testing.T) {
+	first := SummarizeRecall([]EnhancedJobResult{
+		{Job: Job{Id: "J-0", ResultIds: []int64{1, 2}, SearchEffort: 16}, Recall: 0.5, QueryKind: queryKindIndependent},
+		{Job: Job{Id: "J-1", ResultIds: []int64{1, 2}, Retries: 1}, Recall: 1.0, QueryKind: queryKindIndependent},
+	}, RecallOptions{SplitRetries: true})
+	second := SummarizeRecall([]EnhancedJobResult{
+		{Job: Job{Id: "J-0", ResultIds: []int64{1}, SearchEffort: 16}, Recall: 0.2, QueryKind: queryKindIndependent},
+		{Job: Job{Id: "S-0-0", ResultIds: []int64{1}}, Recall: 0.0, QueryKind: queryKindSessionFirst},
+		{Job: Job{Id: "S-0-1", ResultIds: []int64{1}}, Recall: 1.0, QueryKind: queryKindSessionFollowUp},
+	}, RecallOptions{})
+
+	merged := MergeRecallSummaries(first, second)
+
+	overall := merged.Overall
+	if overall.Count != 5 || math.Abs(overall.MeanRecall-0.54) > 1e-9 || overall.MinRecall != 0 || overall.MaxRecall != 1.0 {
+		t.Errorf("Unexpected overall recall %+v", overall)
+	}
+	if merged.K != 2 || merged.Independent.Count != 3 || merged.SessionFirst.Count != 1 {
+		t.Errorf("Unexpected merged summary %+v", merged)
+	}
+	if merged.Retried == nil || merged.Retried.Count != 1 {
+		t.Errorf("Expected the retried job of the first summary, got %v", merged.Retried)
+	}
+	if effort := merged.BySearchEffort[16]; effort == nil || effort.Count != 2 || math.Abs(effort.MeanRecall-0.35) > 1e-9 {
+		t.Errorf("Unexpected recall at search effort 16: %v", effort)
+	}
+}
+
+func TestSummarizeRecall_SplitRetries(t *testing.T) {
+	results := []EnhancedJobResult{
+		{Job: Job{Id: "J-0"}, Recall: 1.0},
+		{Job: Job{Id: "J-1", Retries: 2}, Recall: 0.5},
+		{Job: Job{Id: "J-2", Retries: 1}, Recall: 0.0},
+		{Job: Job{Id: "J-3", Retries: 1}, Recall: -1.0}, // no results
+	}
+
+	summary := SummarizeRecall(results, RecallOptions{SplitRetries: true})
+
+	if summary.FirstTry == nil || *summary.FirstTry != (RecallGroupStats{Count: 1, MeanRecall: 1.0, MinRecall: 1.0, MaxRecall: 1.0}) {
+		t.Errorf("Unexpected first-try recall: %+v", summary.FirstTry)
+	}
+	if summary.Retried == nil || *summary.Retried != (RecallGroupStats{Count: 2, MeanRecall: 0.25, MinRecall: 0, MaxRecall: 0.5}) {
+		t.Errorf("Unexpected retried recall: %+v", summary.Retried)
+	}
+	if unsplit := SummarizeRecall(results, RecallOptions{}); unsplit.FirstTry != nil || unsplit.Retried != nil {
+		t.Error("Expected no retry breakdown without SplitRetries")
+	}
+}
+
+func TestEnhanceJobResults_PartitionAwareGroundTruth(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}, Partition: 0},
+		{Id: 2, Vector: Vector{2.0, 0.0}, Partition: 1},
+		{Id: 3, Vector: Vector{3.0, 0.0}, Partition: 0},
+		{Id: 4, Vector: Vector{4.0, 0.0}, Partition: 1},
+	}
+	jobs := []Job{
+		// The closest rows of partition 1 are 2 and 4, although 1 is closer overall
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{2, 4}, Partitions: []int{1}},
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{2, 4}},
+	}
+
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
+
+	if results[0].Recall != 1.0 {
+		t.Errorf("Expected recall 1.0 within partition 1, got %f", results[0].Recall)
+	}
+	if results[1].Recall != 0.5 {
+		t.Errorf("Expected recall 0.5 over all partitions, got %f", results[1].Recall)
+	}
+}
+
+func TestDistanceFunc_SimilarityMetricsAreNegated(t *testing.T) {
+	a, b := []float32{1.0, 2.0}, []float32{3.0, 4.0}
+	if d := distanceFunc(metricIP)(a, b); d != -11.0 {
+		t.Errorf("Expected negative inner product -11, got %f", d)
+	}
+	if d := distanceFunc(metricCosine)([]float32{1.0, 0.0}, []float32{2.0, 0.0}); d != -1.0 {
+		t.Errorf("Expected negative cosine similarity -1 for parallel vectors, got %f", d)
+	}
+	if d := distanceFunc(metricL2)(a, b); d != 8.0 {
+		t.Errorf("Expected squared euclidean distance 8, got %f", d)
+	}
+}
+
+func TestDistanceFunc_HammingCountsDifferingSigns(t *testing.T) {
+	a, b := []float32{0.3, -1.0, 0.0, 2.0}, []float32{5.0, 1.0, -2.0, 0.0}
+	// Binarized, a is 1001 and b is 1100
+	if d := distanceFunc(metricHamming)(a, b); d != 2.0 {
+		t.Errorf("Expected Hamming distance 2, got %f", d)
+	}
+}
+
+func TestNormalizeVector_UnitLength(t *testing.T) {
+	normalized := normalizeVector(Vector{3.0, 4.0})
+	if math.Abs(float64(normalized[0])-0.6) > 1e-6 || math.Abs(float64(normalized[1])-0.8) > 1e-6 {
+		t.Errorf("Expected [0.6 0.8], got %v", normalized)
+	}
+	if zero := normalizeVector(Vector{0.0, 0.0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("Expected the zero vector to stay zero, got %v", zero)
+	}
+}
+
+func TestEnhanceJobResults_MetricChangesGroundTruth(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.1}},  // closest in L2 and same direction as the query
+		{Id: 2, Vector: Vector{10.0, 5.0}}, // largest inner product
+	}
+	jobs := []Job{{QueryVector: Vector{1.0, 0.0}, ResultIds: []int64{1}}}
+
+	for metric, expected := range map[string]float64{metricL2: 1.0, metricIP: 0.0, metricCosine: 1.0} {
+		options := DefaultRecallOptions()
+		options.Metric = metric
+		results := EnhanceJobResults(rawData, jobs, options)
+		if results[0].Recall != expected {
+			t.Errorf("%s: expected recall %f, got %f", metric, expected, results[0].Recall)
+		}
+	}
+}
+
+func TestEnhanceJobResults_TiedDistances(t *testing.T) {
+	// Rows 2 and 3 are tied for the second nearest neighbor, row 4 duplicates row 1
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{0.0, 2.0}},
+		{Id: 3, Vector: Vector{0.0, -2.0}},
+		{Id: 4, Vector: Vector{1.0, 0.0}},
+		{Id: 5, Vector: Vector{3.0, 0.0}},
+	}
+	tests := []struct {
+		name      string
+		resultIds []int64
+		tieAware  float64
+	}{
+		{"either tied row", []int64{1, 4, 3}, 1.0},
+		{"duplicate vector", []int64{4, 1, 2}, 1.0},
+		{"beyond the k-th distance", []int64{1, 4, 5}, 2.0 / 3.0},
+		{"unknown id", []int64{1, 4, 99}, 2.0 / 3.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := []Job{{QueryVector: Vector{0.0, 0.0}, ResultIds: tt.resultIds}}
+			results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
+			if math.Abs(results[0].Recall-tt.tieAware) > 0.0001 {
+				t.Errorf("Expected tie-aware recall %f, got %f", tt.tieAware, results[0].Recall)
+			}
+		})
+	}
+
+	// Without tie-awareness, at least one of the tied results is not part of the ground truth
+	options := DefaultRecallOptions()
+	options.TieAware = false
+	jobs := []Job{
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1, 4, 2}},
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1, 4, 3}},
+	}
+	results := EnhanceJobResults(rawData, jobs, options)
+	if results[0].Recall == 1.0 && results[1].Recall == 1.0 {
+		t.Errorf("Expected the id-based recall to penalize one of the tied rows, got %f and %f",
+			results[0].Recall, results[1].Recall)
+	}
+}
+
+func TestEnhanceJobResults_FilterAwareGroundTruth(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{2.0, 0.0}},
+		{Id: 3, Vector: Vector{3.0, 0.0}},
+	}
+	jobs := []Job{
+		// Only rows 2 and 3 pass the filter, although 1 is closest
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{2, 3}, Filter: "id > 1"},
+		{QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{2, 3}},
+	}
+
+	results := EnhanceJobResults(rawData, jobs, DefaultRecallOptions())
+
+	if results[0].Recall != 1.0 {
+		t.Errorf("Expected recall 1.0 for the filtered query, got %f", results[0].Recall)
+	}
+	if results[1].Recall != 0.5 {
+		t.Errorf("Expected recall 0.5 for the unfiltered query, got %f", results[1].Recall)
+	}
+}
+
+func TestParseIdFilter(t *testing.T) {
+	cases := map[string][]bool{ // matches of ids 4, 5 and 6
+		"id > 5":  {false, false, true},
+		"id >= 5": {false, true, true},
+		" id<5 ":  {true, false, false},
+		"id <= 5": {true, true, false},
+		"id == 5": {false, true, false},
+		"id != 5": {true, false, true},
+		"":        {true, true, true},
+	}
+	for expr, expected := range cases {
+		filter, err := parseIdFilter(expr)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", expr, err)
+		}
+		for i, id := range []int64{4, 5, 6} {
+			if filter.matches(id) != expected[i] {
+				t.Errorf("%q: expected match of id %d to be %t", expr, id, expected[i])
+			}
+		}
+	}
+
+	for _, expr := range []string{"word == 'the'", "id > x", "id in [1, 2]"} {
+		if _, err := parseIdFilter(expr); err == nil {
+			t.Errorf("%q: expected error for unsupported filter", expr)
+		}
+	}
+}
+
+func TestGroupIdenticalQueries(t *testing.T) {
+	jobs := []Job{
+		{QueryVector: Vector{1, 0}, ResultIds: []int64{1}},
+		{QueryVector: Vector{1, 0}, ResultIds: []int64{2}},
+		{QueryVector: Vector{1, 0}, ResultIds: []int64{1, 2}},                       // different k
+		{QueryVector: Vector{1, 0}, ResultIds: []int64{1}, Filter: "id > 1"},        // different filter
+		{QueryVector: Vector{1, 0}, ResultIds: []int64{1}, Partitions: []int{0, 1}}, // different partitions
+	}
+
+	queryJobs, sharing := groupIdenticalQueries(jobs, true)
+
+	if len(queryJobs) != 4 || len(sharing[0]) != 2 || sharing[0][1] != 1 {
+		t.Errorf("Expected only the first two jobs to share their ground truth, got %v", sharing)
+	}
+	if queryJobs, _ := groupIdenticalQueries(jobs, false); len(queryJobs) != len(jobs) {
+		t.Errorf("Expected every job to compute its ground truth without deduplication, got %d", len(queryJobs))
+	}
+}
+
+func TestEnhanceJobResults_SkipsJobsWithoutResults(t *testing.T) {
+	rawData := []DataRow{
+		{Id: 1, Vector: Vector{1.0, 0.0}},
+		{Id: 2, Vector: Vector{2.0, 0.0}},
+		{Id: 3, Vector: Vector{3.0, 0.0}},
+	}
+	jobs := []Job{
+		{Id: "S-1-0", QueryVector: Vector{0.0, 0.0}, ResultIds: []int64{1, 2}},
+		{Id: "S-1-1", QueryVector: Vector{0.1, -0.1}}, // never executed, the query is the drift offset
+		{Id: "J-1", QueryVector: Vector{0.0, 0.0}},    // failed
+		{Id: "J-2", QueryVector: Vector{4.0, 0.0}, ResultIds: []int64{1, 3}},
+	}
+	if executed, indexes := jobsWithResults(jobs); len(executed) != 2 || !slices.Equal(indexes, []int{0, 3}) {
+		t.Fatalf("Expected jobs 0 and 3 to have results, got %v", indexes)
+	}
+
+	for _, cache := range []bool{false, true} {
+		options := DefaultRecallOptions()
+		options.CacheGroundTruth = cache
+		results := EnhanceJobResults(rawData, jobs, options)
+		recalls := []float64{results[0].Recall, results[1].Recall, results[2].Recall, results[3].Recall}
+		if !slices.Equal(recalls, []float64{1.0, -1.0, -1.0, 0.5}) {
+			t.Errorf("cache=%v: unexpected recalls %v", cache, recalls)
+		}
+		if results[1].Id != "S-1-1" || results[1].QueryKind != queryKindSessionFollowUp {
+			t.Errorf("cache=%v: expected the job without results to keep its data, got %+v", cache, results[1])
+		}
+	}
+}
+
+func TestEnhanceJobResults_CacheMatchesFullScan(t *testing.T) {
+	gen := rand.New(rand.NewSource(42))
+	rawData := make([]DataRow, 200)
+	for i := range rawData {
+		rawData[i] = DataRow{Id: int64(i), Vector: GenerateVector(gen, 8, 1.0, 0.0)}
+	}
+	var jobs []Job
+	for i := range 30 {
+		query := GenerateVector(gen, 8, 1.0, 0.0)
+		// Each query is repeated with different results, e.g. by the stability test
+		for repeat := range 3 {
+			jobs = append(jobs, Job{QueryVector: query, ResultIds: []int64{int64(i + repeat), int64(i * 2)}})
+		}
+	}
+
+	cached := EnhanceJobResults(rawData, jobs, RecallOptions{BatchSize: 4, CacheGroundTruth: true})
+	scanned := EnhanceJobResults(rawData, jobs, RecallOptions{BatchSize: 4})
+
+	for i := range jobs {
+		if cached[i].Recall != scanned[i].Recall || !slices.Equal(cached[i].ResultIds, jobs[i].ResultIds) {
+			t.Errorf("Job %d: expected recall %f, got %f with the cache", i, scanned[i].Recall, cached[i].Recall)
+		}
+	}
+}
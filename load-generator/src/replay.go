@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+/**
+* LoadReplayWorkloads reads the jobs and sessions of a previous run from its output directory, either from
+* jobs-sessions.gob or from its spilled segments, and turns them into workloads issuing the same queries again.
+* The workloads are ordered by their original start, so that a replay issues the queries in the original order.
+ */
+func LoadReplayWorkloads(dir string) ([]Workload, error) {
+	paths := []string{filepath.Join(dir, jobsSessionsFile)}
+	if _, err := os.Stat(paths[0]); os.IsNotExist(err) {
+		paths, err = filepath.Glob(filepath.Join(dir, jobsSessionsSegmentGlob))
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no %s or spilled segments in %s", jobsSessionsFile, dir)
+		}
+	}
+	jobs, sessions, err := readJobsAndSessions(paths)
+	if err != nil {
+		return nil, err
+	}
+	return replayWorkloads(jobs, sessions), nil
+}
+
+// replayWorkloads converts recorded jobs and sessions into workloads, skipping sessions without an executed step.
+func replayWorkloads(jobs []Job, sessions []UserSession) []Workload {
+	type replayed struct {
+		work  Workload
+		start time.Time
+	}
+	all := make([]replayed, 0, len(jobs)+len(sessions))
+	for _, job := range jobs {
+		start := job.StartTimestamp
+		job.resetForReplay()
+		if strings.HasPrefix(job.Id, "H-") {
+			all = append(all, replayed{&HybridJob{Job: job}, start})
+		} else {
+			all = append(all, replayed{&job, start})
+		}
+	}
+	for _, session := range sessions {
+		// Only the executed steps are replayed, their queries are already known
+		var steps []Job
+		for _, job := range session.Jobs {
+			if !job.StartTimestamp.IsZero() {
+				job.resetForReplay()
+				steps = append(steps, job)
+			}
+		}
+		if len(steps) == 0 {
+			continue
+		}
+		all = append(all, replayed{
+			&UserSession{SessionId: session.SessionId, Jobs: steps, replayed: true},
+			session.StartTimestamp,
+		})
+	}
+	slices.SortStableFunc(all, func(a, b replayed) int { return a.start.Compare(b.start) })
+
+	workloads := make([]Workload, len(all))
+	for i, r := range all {
+		workloads[i] = r.work
+	}
+	return workloads
+}
+
+func isHybridJob(work Workload) bool {
+	_, ok := work.(*HybridJob)
+	return ok
+}
+
+// resetForReplay drops the outcome of the recorded search, keeping everything that defines the query.
+func (j *Job) resetForReplay() {
+	*j = Job{
+		Id:           j.Id,
+		QueryVector:  j.QueryVector,
+		Partitions:   j.Partitions,
+		Filter:       j.Filter,
+		VectorField:  j.VectorField,
+		SearchEffort: j.SearchEffort,
+	}
+	// The vector field of a hybrid job is set again when it is executed
+	if strings.HasPrefix(j.Id, "H-") {
+		j.VectorField = ""
+	}
+}
+
+/**
+* replayQueue hands out the workloads of a previous run in place of generated ones, see LoadReplayWorkloads.
+* Once all workloads are issued, only the continuations of replayed sessions remain.
+ */
+type replayQueue struct {
+	workloads []Workload
+	next      int
+}
+
+func newReplayQueue(workloads []Workload) *replayQueue {
+	if len(workloads) == 0 {
+		return nil
+	}
+	return &replayQueue{workloads: workloads}
+}
+
+// pop returns the next replayed workload, nil if all were issued.
+func (q *replayQueue) pop() Workload {
+	if q.next >= len(q.workloads) {
+		return nil
+	}
+	work := q.workloads[q.next]
+	q.next++
+	return work
+}
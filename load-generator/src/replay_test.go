@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadReplayWorkloads(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+	jobs := []Job{
+		{Id: "J-0", QueryVector: Vector{1, 2}, StartTimestamp: start.Add(2 * time.Second), ResultIds: []int64{7}, Latency: time.Millisecond},
+		{Id: "H-0", QueryVector: Vector{3, 4}, StartTimestamp: start, VectorField: "vector+title", SearchEffort: 32},
+	}
+	sessions := []UserSession{{
+		SessionId:      0,
+		StartTimestamp: start.Add(time.Second),
+		Jobs: []Job{
+			{Id: "S-0-0", QueryVector: Vector{5, 6}, StartTimestamp: start.Add(time.Second), Filter: "id > 3"},
+			{Id: "S-0-1", QueryVector: Vector{7, 8}, StartTimestamp: start.Add(2 * time.Second)},
+			{Id: "S-0-2", QueryVector: Vector{0.1, 0.1}}, // never executed, only the drift offset is known
+		},
+	}}
+	if err := writeJobsAndSessions(filepath.Join(dir, jobsSessionsFile), jobs, sessions, metricL2); err != nil {
+		t.Fatal(err)
+	}
+
+	workloads, err := LoadReplayWorkloads(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads) != 3 {
+		t.Fatalf("Expected 3 workloads, got %d", len(workloads))
+	}
+
+	// Replayed in the original order of their start
+	hybrid, ok := workloads[0].(*HybridJob)
+	if !ok || hybrid.Id != "H-0" || hybrid.SearchEffort != 32 || hybrid.VectorField != "" {
+		t.Errorf("Expected the hybrid job first, got %+v", workloads[0])
+	}
+	session, ok := workloads[1].(*UserSession)
+	if !ok || !session.replayed || len(session.Jobs) != 2 || session.Jobs[0].Filter != "id > 3" {
+		t.Fatalf("Expected the executed steps of the session second, got %+v", workloads[1])
+	}
+	if !slices.Equal(session.Jobs[1].QueryVector, Vector{7, 8}) || !session.Jobs[1].StartTimestamp.IsZero() {
+		t.Errorf("Expected the recorded query without its outcome, got %+v", session.Jobs[1])
+	}
+	job, ok := workloads[2].(*Job)
+	if !ok || job.Id != "J-0" || job.ResultIds != nil || job.Latency != 0 || !slices.Equal(job.QueryVector, Vector{1, 2}) {
+		t.Errorf("Expected the job last without its results, got %+v", workloads[2])
+	}
+}
+
+func TestLoadReplayWorkloads_Missing(t *testing.T) {
+	if _, err := LoadReplayWorkloads(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory without jobs and sessions")
+	}
+}
+
+func TestArrivalController_ReplaysWorkloads(t *testing.T) {
+	ac := NewArrivalController(testJobGenParams(100, 0.5, 2, 4), 2, 0, 42, 1)
+	session := &UserSession{SessionId: 3, Jobs: []Job{{Id: "S-3-0"}}, replayed: true}
+	ac.replay = newReplayQueue([]Workload{&Job{Id: "J-5"}, session})
+
+	if job, ok := ac.GenerateWorkload().(*Job); !ok || job.Id != "J-5" {
+		t.Errorf("Expected the replayed job, got %+v", job)
+	}
+	if ac.GenerateWorkload() != session || session.continuationChan != ac.continuationChan {
+		t.Error("Expected the replayed session to continue through the arrival controller")
+	}
+	if work := ac.GenerateWorkload(); work != nil {
+		t.Errorf("Expected no further workloads, got %+v", work)
+	}
+}
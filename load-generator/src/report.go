@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/**
+* FormatWrkSummary renders the overall statistics in the style of wrk2, so that the end-of-run
+* output is familiar to anyone who has used HTTP load generators.
+ */
+func FormatWrkSummary(stats ThroughputStats, workers int, targetQPS float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Running %s test @ milvus, target %.2f QPS\n", formatWrkDuration(stats.Duration), targetQPS)
+	fmt.Fprintf(&b, "  %d workers\n", workers)
+	fmt.Fprintf(&b, "  Query Stats   %8s %8s %8s\n", "Avg", "Stdev", "Max")
+	fmt.Fprintf(&b, "    Latency     %8s %8s %8s\n",
+		formatWrkDuration(stats.Latency.Mean), formatWrkDuration(stats.Latency.StdDev), formatWrkDuration(stats.Latency.Max))
+	b.WriteString("  Latency Distribution\n")
+	for _, p := range []struct {
+		percent float64
+		latency time.Duration
+	}{
+		{50, stats.Latency.P50},
+		{75, stats.Latency.P75},
+		{90, stats.Latency.P90},
+		{99, stats.Latency.P99},
+		{99.9, stats.Latency.P999},
+		{100, stats.Latency.Max},
+	} {
+		fmt.Fprintf(&b, "  %7.3f%%  %8s\n", p.percent, formatWrkDuration(p.latency))
+	}
+	fmt.Fprintf(&b, "  %d requests (%d queries) in %s\n", stats.Requests, stats.Queries, formatWrkDuration(stats.Duration))
+	fmt.Fprintf(&b, "Requests/sec: %10.2f\n", stats.RequestsPerSecond)
+	fmt.Fprintf(&b, "Queries/sec:  %10.2f\n", stats.QueriesPerSecond)
+	return b.String()
+}
+
+// formatWrkDuration prints a duration with two decimals in the largest fitting unit, e.g. 1.23ms.
+func formatWrkDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		return fmt.Sprintf("%.2fm", d.Minutes())
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.2fus", float64(d)/float64(time.Microsecond))
+	}
+}
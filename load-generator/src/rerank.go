@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"google.golang.org/protobuf/proto"
+)
+
+func (p *SearchParameters) rerankEnabled() bool {
+	return p.rerankFieldName != ""
+}
+
+// vectorOutputField returns the field holding the full-precision vectors of the results.
+func (p *SearchParameters) vectorOutputField() string {
+	if p.rerankEnabled() {
+		return p.rerankFieldName
+	}
+	return p.vecFieldName
+}
+
+// searchVector converts the query into the representation of the searched vector field.
+func (p *SearchParameters) searchVector(query Vector, field string) entity.Vector {
+	if p.rerankEnabled() {
+		return entity.FloatVector(query).ToFloat16Vector()
+	}
+	return encodeVector(permuteVector(query, p.permutations[field]), p.vectorType)
+}
+
+// outputVectorType returns the vector type of the result vectors, re-ranking returns the full-precision copy.
+func (p *SearchParameters) outputVectorType() string {
+	if p.rerankEnabled() {
+		return vectorTypeFloat
+	}
+	return p.vectorType
+}
+
+// Handling of a search limit above the top-k limit of the server
+const (
+	topKPolicyClamp = "clamp" // reduce k (and the re-ranking candidates) to the limit with a warning
+	topKPolicyError = "error" // refuse to run the benchmark
+)
+
+// searchLimit returns the number of results requested from Milvus per search.
+func (p *SearchParameters) searchLimit() int {
+	if p.rerankEnabled() {
+		return max(p.k, p.rerankCandidates)
+	}
+	return p.k
+}
+
+/**
+* CheckTopK verifies the search limit against the top-k limit of the server before any search is issued.
+* Milvus does not expose its configured limit (common.topKLimit) through the SDK, so maxTopK has to match the server configuration.
+* Otherwise every single search of the benchmark fails.
+ */
+func CheckTopK(params *SearchParameters, maxTopK int, policy string, logger *Logger) error {
+	if params.searchLimit() <= maxTopK {
+		return nil
+	}
+	if policy != topKPolicyClamp {
+		return fmt.Errorf("search limit %d (k=%d, rerankCandidates=%d) exceeds the server top-k limit of %d",
+			params.searchLimit(), params.k, params.rerankCandidates, maxTopK)
+	}
+
+	logger.Warnf("Warning: search limit %d exceeds the server top-k limit of %d, clamping k=%d and rerankCandidates=%d",
+		params.searchLimit(), maxTopK, params.k, params.rerankCandidates)
+	params.k = min(params.k, maxTopK)
+	params.rerankCandidates = min(params.rerankCandidates, maxTopK)
+	return nil
+}
+
+/**
+* newSearchOption builds the search request for a single query.
+* With re-ranking enabled, rerankCandidates results are requested along with their full-precision vectors.
+* withVectors requests the result vectors even without re-ranking, e.g. to compute follow-up queries.
+* The configured filter and output fields are applied to every search, including the warmup.
+* partitions restricts the search to these partitions, nil searches all partitions.
+* filter is combined with the configured filter, empty applies the configured filter only.
+* field is the vector field to search, empty searches vecFieldName. The result vectors are always read from
+* vecFieldName, which holds the unpermuted vectors.
+* effort replaces ef, nprobe or itopkSize of the index-specific search parameters, 0 keeps the configured value.
+ */
+func (p *SearchParameters) newSearchOption(
+	query Vector,
+	field string,
+	effort int,
+	withVectors bool,
+	partitions []int,
+	filter string,
+) milvusclient.SearchOption {
+	if field == "" {
+		field = p.vecFieldName
+	}
+	option := milvusclient.NewSearchOption(
+		p.collection,
+		p.searchLimit(),
+		[]entity.Vector{p.searchVector(query, field)},
+	).WithANNSField(field)
+	if annParam := p.annParamFor(effort); annParam != nil {
+		option = option.WithAnnParam(annParam)
+	}
+	if len(partitions) > 0 {
+		option = option.WithPartitions(partitionNames(partitions)...)
+	}
+	if expr := combineFilters(p.filterExpr, filter); expr != "" {
+		option = option.WithFilter(expr)
+	}
+	outputFields := p.outputFields
+	if withVectors || p.rerankEnabled() {
+		outputFields = append(slices.Clone(outputFields), p.vectorOutputField())
+	}
+	if len(outputFields) > 0 {
+		option = option.WithOutputFields(outputFields...)
+	}
+	return option
+}
+
+/**
+* processResult stores the result ids and scores of a result set in the job and re-ranks them if enabled.
+* After re-ranking, the scores are still the ones Milvus reported for the re-ranked ids.
+* With recordCandidates, the first-stage candidate ids are kept to measure the recall before re-ranking.
+* The vectors of the results are returned in result order if the result set contains the vector output field.
+ */
+func (p *SearchParameters) processResult(job *Job, resultSet milvusclient.ResultSet) (resultVectors []Vector, err error) {
+	ids, stringIds, err := extractResultIds(resultSet.IDs)
+	if err != nil {
+		return nil, err
+	}
+	job.PayloadBytes = payloadBytes(resultSet.Fields)
+
+	var vectors []Vector
+	if column := resultSet.GetColumn(p.vectorOutputField()); column != nil {
+		// Don't ask why but this concatenates all the vectors so we must slice them
+		vectors = decodeVectors(column.FieldData().GetVectors(), p.outputVectorType(), p.dim)
+	}
+
+	scores := resultSet.Scores
+	if p.rerankEnabled() {
+		if len(vectors) != len(ids) {
+			return nil, fmt.Errorf("cannot re-rank %d candidates with %d full-precision vectors",
+				len(ids), len(vectors))
+		}
+		if p.recordCandidates {
+			job.CandidateIds = ids
+		}
+		scoresById := make(map[int64]float32, len(scores))
+		for i, score := range scores {
+			scoresById[ids[i]] = score
+		}
+		ids, vectors = rerankCandidates(job.QueryVector, ids, vectors, p.k, distanceFunc(p.metric))
+		scores = make([]float32, len(ids))
+		for i, id := range ids {
+			scores[i] = scoresById[id]
+		}
+	}
+
+	job.ResultIds, job.ResultStringIds, job.ResultScores = ids, stringIds, scores
+	return vectors, nil
+}
+
+// payloadBytes returns the encoded size of the output field columns, i.e. what the results add to the response.
+func payloadBytes(fields []column.Column) int {
+	size := 0
+	for _, field := range fields {
+		size += proto.Size(field.FieldData())
+	}
+	return size
+}
+
+// splitVectors slices the concatenated vectors of a result column into single vectors.
+func splitVectors(data []float32, dim int) []Vector {
+	vectors := make([]Vector, 0, len(data)/dim)
+	for start := 0; start+dim <= len(data); start += dim {
+		vectors = append(vectors, data[start:start+dim])
+	}
+	return vectors
+}
+
+/**
+* rerankCandidates orders the candidates by their exact distance to the query under the index metric and keeps the k closest.
+* The returned vectors belong to the returned ids.
+ */
+func rerankCandidates(
+	query Vector,
+	ids []int64,
+	vectors []Vector,
+	k int,
+	distance func(a []float32, b []float32) float32,
+) ([]int64, []Vector) {
+	sorted := make(sortedNeighbors, 0, k)
+	vectorsById := make(map[int64]Vector, len(ids))
+	for i, id := range ids {
+		vectorsById[id] = vectors[i]
+		sorted = sorted.InsertSorted(neighbor{id: id, distance: distance(query, vectors[i])}, k)
+	}
+
+	rerankedIds := make([]int64, len(sorted))
+	rerankedVectors := make([]Vector, len(sorted))
+	for i, n := range sorted {
+		rerankedIds[i] = n.id
+		rerankedVectors[i] = vectorsById[n.id]
+	}
+	return rerankedIds, rerankedVectors
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/milvus-io/milvus/client/v2/entity"
+)
+
+// Data types of the additional scalar fields of the collection
+const (
+	scalarTypeInt64 = "int64" // e.g. a category, generated uniformly from [0, max)
+	scalarTypeFloat = "float" // e.g. a score, generated uniformly from [0, 1)
+	scalarTypeBool  = "bool"  // e.g. a flag, generated as true for half of the rows
+)
+
+const defaultScalarMax = 10
+
+/**
+* ScalarField describes an additional scalar field of the collection, e.g. to benchmark filtered search on it.
+* Values are taken from the dataset if it provides them (a Parquet column of the same name) and generated
+* deterministically from the row id otherwise, so that every run inserts the same values.
+ */
+type ScalarField struct {
+	name     string
+	dataType string
+	max      int // upper bound of generated int64 values
+}
+
+/**
+* ParseScalarFields parses a comma-separated list of field definitions in the format name:type[:max], e.g.
+* "category:int64:20,score:float,flag:bool".
+ */
+func ParseScalarFields(spec string) ([]ScalarField, error) {
+	var fields []ScalarField
+	seen := make(map[string]bool)
+	for _, definition := range strings.Split(spec, ",") {
+		definition = strings.TrimSpace(definition)
+		if definition == "" {
+			continue
+		}
+		parts := strings.Split(definition, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid scalar field %q, expected name:type[:max]", definition)
+		}
+		field := ScalarField{name: parts[0], dataType: parts[1], max: defaultScalarMax}
+		switch field.dataType {
+		case scalarTypeInt64:
+			if len(parts) == 3 {
+				max, err := strconv.Atoi(parts[2])
+				if err != nil || max <= 0 {
+					return nil, fmt.Errorf("invalid max of scalar field %q", definition)
+				}
+				field.max = max
+			}
+		case scalarTypeFloat, scalarTypeBool:
+			if len(parts) == 3 {
+				return nil, fmt.Errorf("scalar field %q of type %s takes no max", definition, field.dataType)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported type of scalar field %q, expected %s, %s or %s",
+				definition, scalarTypeInt64, scalarTypeFloat, scalarTypeBool)
+		}
+		if seen[field.name] {
+			return nil, fmt.Errorf("duplicate scalar field %q", field.name)
+		}
+		seen[field.name] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// schemaField returns the collection schema field of the scalar field.
+func (f ScalarField) schemaField() *entity.Field {
+	dataType := entity.FieldTypeInt64
+	switch f.dataType {
+	case scalarTypeFloat:
+		dataType = entity.FieldTypeFloat
+	case scalarTypeBool:
+		dataType = entity.FieldTypeBool
+	}
+	return entity.NewField().WithName(f.name).WithDataType(dataType)
+}
+
+// convert coerces a value read from the dataset to the Go type Milvus expects for the field.
+func (f ScalarField) convert(value any) (any, error) {
+	switch f.dataType {
+	case scalarTypeInt64:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		}
+	case scalarTypeFloat:
+		switch v := value.(type) {
+		case float32:
+			return v, nil
+		case float64:
+			return float32(v), nil
+		}
+	case scalarTypeBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("value %v of type %T does not fit scalar field %s of type %s", value, value, f.name, f.dataType)
+}
+
+// generate derives the value of the field for a row from its id.
+func (f ScalarField) generate(id int64, fieldIndex int) any {
+	h := mixScalarSeed(uint64(id)*31 + uint64(fieldIndex))
+	switch f.dataType {
+	case scalarTypeFloat:
+		return float32(h>>40) / (1 << 24)
+	case scalarTypeBool:
+		return h&1 == 1
+	default:
+		return int64(h % uint64(f.max))
+	}
+}
+
+// mixScalarSeed is the splitmix64 finalizer, it spreads consecutive ids over the whole value range.
+func mixScalarSeed(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+/**
+* fillScalarFields completes the scalar values of the rows, values provided by the dataset are converted to the
+* type of their field and missing ones are generated.
+ */
+func fillScalarFields(rows []DataRow, fields []ScalarField) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	for i := range rows {
+		if rows[i].Scalars == nil {
+			rows[i].Scalars = make(map[string]any, len(fields))
+		}
+		for fieldIndex, field := range fields {
+			value, ok := rows[i].Scalars[field.name]
+			if !ok {
+				rows[i].Scalars[field.name] = field.generate(rows[i].Id, fieldIndex)
+				continue
+			}
+			converted, err := field.convert(value)
+			if err != nil {
+				return fmt.Errorf("row with id %d: %w", rows[i].Id, err)
+			}
+			rows[i].Scalars[field.name] = converted
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseScalarFields(t *testing.T) {
+	fields, err := ParseScalarFields("category:int64:20, score:float,flag:bool")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []ScalarField{
+		{name: "category", dataType: scalarTypeInt64, max: 20},
+		{name: "score", dataType: scalarTypeFloat, max: defaultScalarMax},
+		{name: "flag", dataType: scalarTypeBool, max: defaultScalarMax},
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d fields, got %+v", len(expected), fields)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("Field %d: expected %+v, got %+v", i, expected[i], fields[i])
+		}
+	}
+}
+
+func TestParseScalarFields_Invalid(t *testing.T) {
+	for _, spec := range []string{"category", "category:string", "category:int64:0", "flag:bool:2", "a:bool,a:float"} {
+		if _, err := ParseScalarFields(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestFillScalarFields_Deterministic(t *testing.T) {
+	fields, err := ParseScalarFields("category:int64:5,score:float,flag:bool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := []DataRow{{Id: 1}, {Id: 2}, {Id: 3}}
+	second := []DataRow{{Id: 3}, {Id: 1}}
+	if err := fillScalarFields(first, fields); err != nil {
+		t.Fatal(err)
+	}
+	if err := fillScalarFields(second, fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// The values only depend on the row id, not on the batch
+	for _, name := range []string{"category", "score", "flag"} {
+		if first[2].Scalars[name] != second[0].Scalars[name] || first[0].Scalars[name] != second[1].Scalars[name] {
+			t.Errorf("Expected the same %s for the same id", name)
+		}
+	}
+	for _, row := range first {
+		category := row.Scalars["category"].(int64)
+		score := row.Scalars["score"].(float32)
+		if category < 0 || category >= 5 || score < 0 || score >= 1 {
+			t.Errorf("Generated values out of range: %v", row.Scalars)
+		}
+	}
+}
+
+func TestFillScalarFields_MismatchingType(t *testing.T) {
+	fields := []ScalarField{{name: "flag", dataType: scalarTypeBool}}
+	rows := []DataRow{{Id: 1, Scalars: map[string]any{"flag": int64(1)}}}
+
+	if err := fillScalarFields(rows, fields); err == nil {
+		t.Error("Expected an error for an int value of a bool field")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Categories of failed searches, in the order they are checked
+const (
+	searchErrorDeadline    = "deadline_exceeded" // the query timeout or a gRPC deadline expired
+	searchErrorRateLimited = "rate_limited"      // Milvus rejected the search due to a rate limit or quota
+	searchErrorConnection  = "connection"        // the connection was refused or reset, or Milvus was unavailable
+	searchErrorOther       = "other"
+)
+
+var searchErrorCategories = []string{searchErrorDeadline, searchErrorRateLimited, searchErrorConnection, searchErrorOther}
+
+// classifySearchError returns the category of a failed search.
+func classifySearchError(err error) string {
+	var netErr net.Error
+	switch {
+	case isQueryTimeout(err), errors.Is(err, context.DeadlineExceeded), status.Code(err) == codes.DeadlineExceeded:
+		return searchErrorDeadline
+	case isRateLimitError(err), status.Code(err) == codes.ResourceExhausted:
+		return searchErrorRateLimited
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF),
+		errors.Is(err, merr.ErrServiceNotReady), errors.Is(err, merr.ErrServiceUnavailable),
+		status.Code(err) == codes.Unavailable, errors.As(err, &netErr):
+		return searchErrorConnection
+	default:
+		return searchErrorOther
+	}
+}
+
+/**
+* searchErrorCounter counts the failed searches of the benchmark by category, it is safe for concurrent use.
+* Searches failing once the benchmark context ended were cancelled by the end of the benchmark and are not counted.
+ */
+type searchErrorCounter struct {
+	counts map[string]*atomic.Int64 // fixed set of categories, only the counters change
+}
+
+func newSearchErrorCounter() *searchErrorCounter {
+	counts := make(map[string]*atomic.Int64, len(searchErrorCategories))
+	for _, category := range searchErrorCategories {
+		counts[category] = &atomic.Int64{}
+	}
+	return &searchErrorCounter{counts: counts}
+}
+
+func (c *searchErrorCounter) record(ctx context.Context, err error) {
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	c.counts[classifySearchError(err)].Add(1)
+}
+
+// byCategory returns the number of failed searches per category, nil if no search failed.
+func (c *searchErrorCounter) byCategory() map[string]int {
+	var counts map[string]int
+	for category, count := range c.counts {
+		if n := count.Load(); n > 0 {
+			if counts == nil {
+				counts = make(map[string]int)
+			}
+			counts[category] = int(n)
+		}
+	}
+	return counts
+}
+
+// logSearchErrors reports the failed searches by category, if any.
+func logSearchErrors(logger *Logger, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+	total := 0
+	parts := make([]string, 0, len(counts))
+	for _, category := range searchErrorCategories {
+		if counts[category] > 0 {
+			total += counts[category]
+			parts = append(parts, fmt.Sprintf("%s: %d", category, counts[category]))
+		}
+	}
+	logger.Warnf("Warning: %d searches failed (%s)", total, strings.Join(parts, ", "))
+}
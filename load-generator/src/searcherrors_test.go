@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifySearchError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{errQueryTimeout, searchErrorDeadline},
+		{fmt.Errorf("search: %w", context.DeadlineExceeded), searchErrorDeadline},
+		{status.Error(codes.DeadlineExceeded, "deadline"), searchErrorDeadline},
+		{merr.ErrServiceRateLimit, searchErrorRateLimited},
+		{merr.ErrServiceQuotaExceeded, searchErrorRateLimited},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), searchErrorConnection},
+		{status.Error(codes.Unavailable, "connection refused"), searchErrorConnection},
+		{merr.ErrServiceNotReady, searchErrorConnection},
+		{errors.New("collection not loaded"), searchErrorOther},
+	}
+	for _, tt := range tests {
+		if got := classifySearchError(tt.err); got != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestSearchErrorCounter(t *testing.T) {
+	counter := newSearchErrorCounter()
+	if counts := counter.byCategory(); counts != nil {
+		t.Errorf("Expected no failed searches, got %v", counts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	counter.record(ctx, nil)
+	counter.record(ctx, merr.ErrServiceRateLimit)
+	counter.record(ctx, merr.ErrServiceRateLimit)
+	counter.record(ctx, errors.New("unexpected"))
+	// Searches cancelled by the end of the benchmark are no failures
+	cancel()
+	counter.record(ctx, context.Canceled)
+	counter.record(ctx, errors.New("unexpected"))
+
+	expected := map[string]int{searchErrorRateLimited: 2, searchErrorOther: 1}
+	if counts := counter.byCategory(); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected %v, got %v", expected, counts)
+	}
+}
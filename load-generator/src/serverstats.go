@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/milvuspb"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// systemInfoRequest is the GetMetrics payload asking every node for its system information.
+const systemInfoRequest = `{"metric_type":"system_info"}`
+
+// serverStatsTimeout bounds the collection of the server stats, a hanging server must not block the report.
+const serverStatsTimeout = time.Minute
+
+/**
+* ServerStats is a snapshot of server-side collection internals, taken after the benchmark.
+* It bridges client-observed latency with the segment layout that served the queries.
+* Note: Milvus does not expose cache hit rates through the SDK, the system metrics are recorded
+* as returned by the server so that any cache-related fields of the deployed version are kept.
+ */
+type ServerStats struct {
+	CollectedAt        time.Time
+	NumSegments        int   // number of segments loaded on the query nodes
+	NumRows            int64 // rows in the loaded segments
+	MemSizeBytes       int64 // memory used by the loaded segments
+	PersistentSegments []PersistentSegmentStats
+	QuerySegments      []QuerySegmentStats
+	SystemMetrics      string // raw JSON response of the system_info metrics request
+}
+
+// PersistentSegmentStats describes a segment as persisted in object storage.
+type PersistentSegmentStats struct {
+	SegmentId   int64
+	PartitionId int64
+	NumRows     int64
+	State       string
+}
+
+// QuerySegmentStats describes a segment as loaded on the query nodes, i.e. as searched.
+type QuerySegmentStats struct {
+	SegmentId    int64
+	PartitionId  int64
+	NumRows      int64
+	MemSizeBytes int64
+	IndexName    string
+	State        string
+	NodeIds      []int64
+}
+
+// CollectServerStats queries segment and system information of the collection from the server.
+func CollectServerStats(
+	c *milvusclient.Client,
+	dbName string,
+	collection string,
+	logger *Logger,
+) (*ServerStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverStatsTimeout)
+	defer cancel()
+	stats := &ServerStats{CollectedAt: time.Now()}
+
+	/* Persistent segments */
+	segments, err := c.GetPersistentSegmentInfo(ctx, milvusclient.NewGetPersistentSegmentInfoOption(collection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persistent segment info: %w", err)
+	}
+	for _, segment := range segments {
+		stats.PersistentSegments = append(stats.PersistentSegments, PersistentSegmentStats{
+			SegmentId:   segment.ID,
+			PartitionId: segment.ParititionID,
+			NumRows:     segment.NumRows,
+			State:       segment.State.String(),
+		})
+	}
+
+	/* Loaded segments - the SDK has no wrapper for this, so the raw service is used */
+	resp, err := c.GetService().GetQuerySegmentInfo(ctx, &milvuspb.GetQuerySegmentInfoRequest{
+		DbName:         dbName,
+		CollectionName: collection,
+	})
+	// The raw service reports failures in the status of the response, e.g. for a collection that is not loaded
+	if err := merr.CheckRPCCall(resp, err); err != nil {
+		return nil, fmt.Errorf("failed to get query segment info: %w", err)
+	}
+	for _, info := range resp.GetInfos() {
+		stats.QuerySegments = append(stats.QuerySegments, QuerySegmentStats{
+			SegmentId:    info.GetSegmentID(),
+			PartitionId:  info.GetPartitionID(),
+			NumRows:      info.GetNumRows(),
+			MemSizeBytes: info.GetMemSize(),
+			IndexName:    info.GetIndexName(),
+			State:        info.GetState().String(),
+			NodeIds:      info.GetNodeIds(),
+		})
+		stats.NumRows += info.GetNumRows()
+		stats.MemSizeBytes += info.GetMemSize()
+	}
+	stats.NumSegments = len(stats.QuerySegments)
+
+	/* System metrics are best-effort, not every deployment allows querying them */
+	metrics, err := c.GetService().GetMetrics(ctx, &milvuspb.GetMetricsRequest{Request: systemInfoRequest})
+	if err := merr.CheckRPCCall(metrics, err); err != nil {
+		logger.Errorf("Failed to get system metrics: %v", err)
+	} else {
+		stats.SystemMetrics = metrics.GetResponse()
+	}
+
+	logger.Logf("Server stats: %d loaded segments (%d persistent), %d rows, %d bytes in memory",
+		stats.NumSegments, len(stats.PersistentSegments), stats.NumRows, stats.MemSizeBytes)
+	return stats, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	jobsSessionsFile        = "jobs-sessions.gob"
+	jobsSessionsSegmentGlob = "jobs-sessions-*.gob" // spilled segments, written instead of jobsSessionsFile
+)
+
+func jobsSessionsSegmentFile(segment int) string {
+	return fmt.Sprintf("jobs-sessions-%04d.gob", segment)
+}
+
+/**
+* resultCollector gathers the jobs and sessions completed by the workers.
+* With a spillThreshold, the completed results are written to a gob segment whenever spillThreshold of them
+* are pending. Afterwards only what the statistics of the run need is kept in memory, see resultTiming, so that
+* the memory stays small on long runs at high QPS. Segments are written outside of the lock, so that spilling
+* does not block the other workers.
+ */
+type resultCollector struct {
+	mu              sync.Mutex
+	jobs            []Job           // pending, i.e. not spilled yet
+	sessions        []UserSession   // likewise
+	spilledJobs     []resultTiming  // timing of the jobs in the segments
+	spilledSessions []sessionTiming // likewise
+	spillThreshold  int             // 0 keeps all results in memory
+	metric          string
+	nextSegment     int // number of the next segment file, failed segments leave a gap
+	segments        int // successfully written segments
+	spilling        sync.WaitGroup
+	logger          *Logger
+	mutations       mutationRecorder // executed mutations, they are neither spilled nor evaluated for recall
+}
+
+func newResultCollector(spillThreshold int, metric string, logger *Logger) *resultCollector {
+	return &resultCollector{spillThreshold: spillThreshold, metric: metric, logger: logger}
+}
+
+// add collects the result of a completed workload, it is safe for concurrent use.
+func (rc *resultCollector) add(res Workload) {
+	rc.mu.Lock()
+	switch r := res.(type) {
+	case *Job:
+		rc.jobs = append(rc.jobs, *r)
+	case *HybridJob:
+		rc.jobs = append(rc.jobs, r.Job)
+	case *UserSession:
+		rc.sessions = append(rc.sessions, *r)
+	case *MutationWorkload:
+		rc.mutations.record(r)
+	}
+	if rc.spillThreshold == 0 || len(rc.jobs)+len(rc.sessions) < rc.spillThreshold {
+		rc.mu.Unlock()
+		return
+	}
+	jobs, sessions, segment := rc.takePending()
+	rc.mu.Unlock()
+	rc.spill(jobs, sessions, segment)
+}
+
+// takePending hands the pending results to a spill, the caller must hold mu.
+func (rc *resultCollector) takePending() ([]Job, []UserSession, int) {
+	jobs, sessions, segment := rc.jobs, rc.sessions, rc.nextSegment
+	rc.jobs, rc.sessions = nil, nil
+	rc.nextSegment++
+	rc.spilling.Add(1)
+	return jobs, sessions, segment
+}
+
+// spill writes the results to the segment and keeps their timing, the caller must not hold mu.
+func (rc *resultCollector) spill(jobs []Job, sessions []UserSession, segment int) {
+	defer rc.spilling.Done()
+	path := outputPath(jobsSessionsSegmentFile(segment))
+	err := writeJobsAndSessions(path, jobs, sessions, rc.metric)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if err != nil {
+		// Keep the results pending and retry with the next spill, a partially written segment would break reading
+		os.Remove(path)
+		rc.logger.Errorf("Failed to spill %d jobs and %d sessions: %v", len(jobs), len(sessions), err)
+		rc.jobs = append(jobs, rc.jobs...)
+		rc.sessions = append(sessions, rc.sessions...)
+		return
+	}
+	rc.segments++
+	for _, job := range jobs {
+		rc.spilledJobs = append(rc.spilledJobs, newResultTiming(job))
+	}
+	for _, session := range sessions {
+		rc.spilledSessions = append(rc.spilledSessions, newSessionTiming(session))
+	}
+}
+
+// mutationStats summarizes the collected mutations, nil if none were executed.
+func (rc *resultCollector) mutationStats() *MutationStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.mutations.stats()
+}
+
+/**
+* results returns all collected jobs and sessions once the workers are done.
+* If results were spilled, the remaining ones are spilled as well, so that the segments hold the complete run.
+* The spilled results only hold what the statistics need then, see resultTiming.
+ */
+func (rc *resultCollector) results() ([]Job, []UserSession, int) {
+	rc.spilling.Wait()
+	rc.mu.Lock()
+	if rc.segments > 0 && len(rc.jobs)+len(rc.sessions) > 0 {
+		jobs, sessions, segment := rc.takePending()
+		rc.mu.Unlock()
+		rc.spill(jobs, sessions, segment)
+		rc.mu.Lock()
+	}
+	defer rc.mu.Unlock()
+
+	jobs := make([]Job, 0, len(rc.spilledJobs)+len(rc.jobs))
+	for _, timing := range rc.spilledJobs {
+		jobs = append(jobs, timing.job())
+	}
+	sessions := make([]UserSession, 0, len(rc.spilledSessions)+len(rc.sessions))
+	for _, timing := range rc.spilledSessions {
+		sessions = append(sessions, timing.session())
+	}
+	return append(jobs, rc.jobs...), append(sessions, rc.sessions...), rc.segments
+}
+
+/**
+* resultTiming keeps what the statistics of the run read of a spilled job, a fraction of the size of a Job.
+* The vectors, result ids and ids are only in the segments.
+ */
+type resultTiming struct {
+	start        time.Time
+	latency      time.Duration
+	stage        int
+	phase        int
+	payloadBytes int
+	filter       string // only compared against empty, see ComputeFilterStats
+}
+
+func newResultTiming(job Job) resultTiming {
+	return resultTiming{
+		start:        job.StartTimestamp,
+		latency:      job.Latency,
+		stage:        job.Stage,
+		phase:        job.Phase,
+		payloadBytes: job.PayloadBytes,
+		filter:       job.Filter,
+	}
+}
+
+func (t resultTiming) job() Job {
+	return Job{
+		StartTimestamp: t.start,
+		Latency:        t.latency,
+		Stage:          t.stage,
+		Phase:          t.phase,
+		PayloadBytes:   t.payloadBytes,
+		Filter:         t.filter,
+	}
+}
+
+// sessionTiming is the resultTiming of a spilled session, it only keeps the executed steps.
+type sessionTiming struct {
+	start     time.Time
+	duration  time.Duration
+	truncated bool
+	dropped   bool
+	steps     []resultTiming
+}
+
+func newSessionTiming(session UserSession) sessionTiming {
+	timing := sessionTiming{
+		start:     session.StartTimestamp,
+		duration:  session.Duration,
+		truncated: session.Truncated,
+		dropped:   session.Dropped,
+	}
+	for _, job := range session.Jobs {
+		if !job.StartTimestamp.IsZero() {
+			timing.steps = append(timing.steps, newResultTiming(job))
+		}
+	}
+	return timing
+}
+
+func (t sessionTiming) session() UserSession {
+	session := UserSession{StartTimestamp: t.start, Duration: t.duration, Truncated: t.truncated, Dropped: t.dropped}
+	for _, step := range t.steps {
+		session.Jobs = append(session.Jobs, step.job())
+	}
+	return session
+}
+
+func writeJobsAndSessions(path string, jobs []Job, sessions []UserSession, metric string) error {
+	gobFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer gobFile.Close()
+
+	encoder := gob.NewEncoder(gobFile)
+	return encoder.Encode(struct {
+		Jobs     []Job
+		Sessions []UserSession
+		Metric   string
+	}{
+		Jobs:     jobs,
+		Sessions: sessions,
+		Metric:   metric,
+	})
+}
+
+// ReadSpilledJobsAndSessions reads all segments spilled by this run back into memory, e.g. for the recall calculation.
+func ReadSpilledJobsAndSessions() ([]Job, []UserSession, error) {
+	// The zero-padded segment numbers sort in the order the segments were written
+	paths, err := filepath.Glob(outputPath(jobsSessionsSegmentGlob))
+	if err != nil {
+		return nil, nil, err
+	}
+	return readJobsAndSessions(paths)
+}
+
+// readJobsAndSessions decodes the jobs and sessions of all given gob files in order.
+func readJobsAndSessions(paths []string) ([]Job, []UserSession, error) {
+	var jobs []Job
+	var sessions []UserSession
+	for _, path := range paths {
+		gobFile, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var decoded struct {
+			Jobs     []Job
+			Sessions []UserSession
+		}
+		err = gob.NewDecoder(gobFile).Decode(&decoded)
+		gobFile.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read segment %s: %w", path, err)
+		}
+		jobs = append(jobs, decoded.Jobs...)
+		sessions = append(sessions, decoded.Sessions...)
+	}
+	return jobs, sessions, nil
+}
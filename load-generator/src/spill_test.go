@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResultCollector_SpillsAndStripsResults(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	collector := newResultCollector(2, metricL2, logger)
+	start := time.Now()
+	for i := range 5 {
+		collector.add(&Job{Id: fmt.Sprintf("J-%d", i), QueryVector: Vector{1, 2}, ResultIds: []int64{3}, Latency: time.Millisecond,
+			StartTimestamp: start, Stage: 1, Filter: "id > 1"})
+	}
+	if len(collector.jobs) != 1 || len(collector.spilledJobs) != 4 {
+		t.Errorf("Expected the spilled jobs to leave the pending ones, got %d pending", len(collector.jobs))
+	}
+	collector.add(&UserSession{SessionId: 0, Truncated: true, StartTimestamp: start,
+		Jobs: []Job{{Id: "S-0-0", QueryVector: Vector{1, 2}, StartTimestamp: start, Latency: time.Millisecond}, {Id: "S-0-1"}}})
+
+	jobs, sessions, segments := collector.results()
+
+	if segments != 3 {
+		t.Errorf("Expected 3 segments, got %d", segments)
+	}
+	if len(jobs) != 5 || len(sessions) != 1 {
+		t.Fatalf("Expected 5 jobs and 1 session in memory, got %d and %d", len(jobs), len(sessions))
+	}
+	if jobs[0].QueryVector != nil || sessions[0].Jobs[0].QueryVector != nil || jobs[0].Latency != time.Millisecond {
+		t.Errorf("Expected spilled results to keep only their timing, got %+v", jobs[0])
+	}
+	if jobs[4].Stage != 1 || jobs[4].Filter == "" || !jobs[4].StartTimestamp.Equal(start) {
+		t.Errorf("Expected spilled jobs to keep what the statistics need, got %+v", jobs[4])
+	}
+	if stats := ComputeSessionStats(sessions); stats.Truncated != 1 || stats.StepLatency.Count != 1 {
+		t.Errorf("Expected the spilled session to keep its executed step, got %+v", stats)
+	}
+
+	spilledJobs, spilledSessions, err := ReadSpilledJobsAndSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spilledJobs) != 5 || len(spilledSessions) != 1 || spilledJobs[4].Id != "J-4" || len(spilledJobs[4].QueryVector) != 2 {
+		t.Errorf("Expected all results in the segments, got %d jobs and %d sessions", len(spilledJobs), len(spilledSessions))
+	}
+}
+
+func TestResultCollector_KeepsResultsWithoutThreshold(t *testing.T) {
+	collector := newResultCollector(0, metricL2, nil)
+	collector.add(&Job{Id: "J-0", QueryVector: Vector{1, 2}})
+
+	jobs, _, segments := collector.results()
+
+	if segments != 0 || len(jobs) != 1 || jobs[0].QueryVector == nil {
+		t.Errorf("Expected the job to stay in memory, got %d segments and %+v", segments, jobs)
+	}
+}
+
+func TestResultCollector_ConcurrentSpills(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	collector := newResultCollector(3, metricL2, logger)
+	var wg sync.WaitGroup
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				collector.add(&Job{Id: fmt.Sprintf("J-%d-%d", worker, i), QueryVector: Vector{1}, StartTimestamp: time.Now()})
+			}
+		}()
+	}
+	wg.Wait()
+
+	jobs, _, segments := collector.results()
+	spilledJobs, _, err := ReadSpilledJobsAndSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 400 || len(spilledJobs) != 400 || segments == 0 {
+		t.Errorf("Expected all 400 jobs in memory and in the segments, got %d and %d in %d segments",
+			len(jobs), len(spilledJobs), segments)
+	}
+}
+
+func TestResultCollector_KeepsResultsIfSpillFails(t *testing.T) {
+	dir := t.TempDir()
+	SetOutputDir(dir)
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	SetOutputDir(filepath.Join(dir, "missing")) // the segment cannot be created
+	collector := newResultCollector(1, metricL2, logger)
+	collector.add(&Job{Id: "J-0", QueryVector: Vector{1, 2}})
+
+	jobs, _, segments := collector.results()
+
+	if segments != 0 || len(jobs) != 1 || jobs[0].QueryVector == nil {
+		t.Errorf("Expected the job to stay in memory, got %d segments and %+v", segments, jobs)
+	}
+}
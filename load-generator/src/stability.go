@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+)
+
+// stabilitySeed offsets the seed of the stability queries from JobGenerationParameters.seed
+const stabilitySeed = 9012
+
+// StabilityStats reports how consistently the index answers repeated identical queries.
+type StabilityStats struct {
+	Queries        int
+	Repeats        int
+	StableFraction float64 // fraction of queries that returned identical ids in the same order for every repeat
+	MeanJaccard    float64 // Jaccard similarity of the result sets, averaged over all pairs of repeats and queries
+}
+
+/**
+* RunStabilityTest issues each query of a fixed query set repeatedly and compares the returned ids.
+* Results may differ due to concurrent segment changes or non-deterministic tie-breaking,
+* which makes this a consistency diagnostic independent of recall.
+ */
+func RunStabilityTest(
+	c *milvusclient.Client,
+	params *SearchParameters,
+	jobGenParams JobGenerationParameters,
+	numQueries int,
+	repeats int,
+) (*StabilityStats, error) {
+	logger, err := NewLogger("stability")
+	if err != nil {
+		return nil, err
+	}
+	defer logger.Close()
+	logger.Logf("Running stability test: %d queries, %d repeats each", numQueries, repeats)
+
+	ctx := context.Background()
+	generator := rand.New(rand.NewSource(jobGenParams.seed + stabilitySeed))
+	results := make([][][]int64, numQueries)
+	for i := range numQueries {
+		query := jobGenParams.generateQuery(generator, params.dim)
+		results[i] = make([][]int64, repeats)
+		for r := range repeats {
+			job := &Job{Id: fmt.Sprintf("ST-%d-%d", i, r), QueryVector: query}
+			searchRes, err := c.Search(ctx, params.newSearchOption(query, "", 0, false, nil, ""))
+			if err != nil {
+				return nil, err
+			}
+			for _, resultSet := range searchRes {
+				if _, err = params.processResult(job, resultSet); err != nil {
+					return nil, err
+				}
+			}
+			results[i][r] = job.ResultIds
+		}
+	}
+
+	stats := computeStability(results)
+	logger.Logf("Stability: %.2f%% of queries returned identical results, mean Jaccard similarity %.4f",
+		stats.StableFraction*100, stats.MeanJaccard)
+	return &stats, nil
+}
+
+// computeStability evaluates the result ids of each query (first dimension) over all repeats (second dimension).
+func computeStability(results [][][]int64) StabilityStats {
+	stats := StabilityStats{Queries: len(results)}
+	if len(results) == 0 {
+		return stats
+	}
+	stats.Repeats = len(results[0])
+
+	stable := 0
+	var jaccardSum float64
+	pairs := 0
+	for _, repeats := range results {
+		isStable := true
+		for i := range repeats {
+			if !slices.Equal(repeats[0], repeats[i]) {
+				isStable = false
+			}
+			for j := i + 1; j < len(repeats); j++ {
+				jaccardSum += jaccard(repeats[i], repeats[j])
+				pairs++
+			}
+		}
+		if isStable {
+			stable++
+		}
+	}
+
+	stats.StableFraction = float64(stable) / float64(len(results))
+	stats.MeanJaccard = 1
+	if pairs > 0 {
+		stats.MeanJaccard = jaccardSum / float64(pairs)
+	}
+	return stats
+}
+
+// jaccard returns the size of the intersection divided by the size of the union of both id sets.
+func jaccard(a []int64, b []int64) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inA := make(map[int64]bool, len(a))
+	for _, id := range a {
+		inA[id] = true
+	}
+	intersection := 0
+	union := len(inA)
+	seenB := make(map[int64]bool, len(b))
+	for _, id := range b {
+		if seenB[id] {
+			continue
+		}
+		seenB[id] = true
+		if inA[id] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	return float64(intersection) / float64(union)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJaccard(t *testing.T) {
+	if j := jaccard([]int64{1, 2, 3}, []int64{3, 2, 1}); j != 1 {
+		t.Errorf("Expected 1 for identical sets, got %f", j)
+	}
+	if j := jaccard([]int64{1, 2}, []int64{2, 3}); j != 1.0/3.0 {
+		t.Errorf("Expected 1/3, got %f", j)
+	}
+	if j := jaccard(nil, nil); j != 1 {
+		t.Errorf("Expected 1 for empty sets, got %f", j)
+	}
+}
+
+func TestComputeStability(t *testing.T) {
+	results := [][][]int64{
+		{{1, 2}, {1, 2}, {1, 2}}, // stable
+		{{1, 2}, {2, 1}, {1, 2}}, // same set, different order
+		{{1, 2}, {1, 3}, {1, 2}}, // different set
+	}
+
+	stats := computeStability(results)
+
+	if stats.Queries != 3 || stats.Repeats != 3 {
+		t.Errorf("Expected 3 queries with 3 repeats, got %d / %d", stats.Queries, stats.Repeats)
+	}
+	if stats.StableFraction != 1.0/3.0 {
+		t.Errorf("Expected stable fraction 1/3, got %f", stats.StableFraction)
+	}
+	// 7 of 9 pairs are identical sets, 2 pairs of the last query have a Jaccard similarity of 1/3
+	expected := (7 + 2.0/3.0) / 9
+	if diff := stats.MeanJaccard - expected; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Expected mean Jaccard %f, got %f", expected, stats.MeanJaccard)
+	}
+}
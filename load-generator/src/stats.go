@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Summary collects the aggregate results of a benchmark run and is written to summary.json.
+type Summary struct {
+	Overall     ThroughputStats
+	Warmup      *WarmupStats // only set if warmupTranche is configured
+	Execution   ExecutionStats
+	ServerStats *ServerStats       // only set if collectServerStats is enabled
+	Stages      []StageStats       // only set if concurrencyStages are configured
+	Phases      []PhaseStats       // only set if benchmark phases are configured
+	Filters     *FilterStats       // only set if per-query filters are configured
+	Sessions    *SessionStats      // only set if user sessions were executed
+	Payload     *PayloadStats      // only set if outputFields are configured
+	Stability   *StabilityStats    // only set if the stability test is enabled
+	Drift       *LatencyDriftStats // only set if driftThreshold and timeSeriesInterval are configured
+	Recall      *RecallSummary     // only set if recall is calculated after the benchmark
+}
+
+// ExecutionStats holds the statistics gathered while executing the workload.
+type ExecutionStats struct {
+	Arrivals     *ArrivalStats      // only set if reportArrivalStats is enabled
+	RateLimit    *RateLimitStats    // only set if adaptToRateLimits is enabled
+	LoadShedding *LoadSheddingStats // only set if sheddingThreshold is configured
+	// Number of gob segments the results were spilled to, 0 if they were kept in memory
+	SpilledSegments int
+	// Number of arrivals dropped because the work channel was full, always 0 with the block overload policy
+	DroppedWorkloads int
+	// Number of searches that exceeded the query timeout, included in the latency stats with the timeout as latency
+	TimedOutQueries int
+	// Number of sessions the end of the benchmark interrupted, recorded with the steps they executed
+	TruncatedSessions int
+	// Number of sessions issued as jobs because maxInFlightSessions sessions were in flight
+	CappedSessions int
+	// Number of failed searches by category, e.g. connection or rate_limited, nil if no search failed.
+	// Timed-out searches are counted here as well as in TimedOutQueries.
+	SearchErrors map[string]int
+	// Deletes and upserts executed alongside the searches, nil if no mutations were generated
+	Mutations *MutationStats
+}
+
+// MutationStats summarizes the mutation workloads, their latency is not part of the search latency.
+type MutationStats struct {
+	Deletes int
+	Upserts int
+	Failed  int          // mutations Milvus rejected, included in Deletes and Upserts
+	Latency LatencyStats // of the successful mutations
+}
+
+/**
+* ArrivalStats compares the realized arrival process with the targeted Poisson process.
+* For a Poisson process, the inter-arrival times are exponentially distributed, so their
+* coefficient of variation (CV = stddev / mean) is 1.
+ */
+type ArrivalStats struct {
+	Arrivals         int
+	TargetQPS        float64
+	MeasuredQPS      float64
+	MeanInterArrival time.Duration
+	CV               float64
+	Note             string
+}
+
+// Tolerances of the goodness-of-fit note, beyond these the arrival process is flagged as deviating.
+const (
+	arrivalRateTolerance = 0.05
+	arrivalCVTolerance   = 0.1
+)
+
+// arrivalRecorder accumulates inter-arrival times without retaining them.
+type arrivalRecorder struct {
+	lastArrival time.Time
+	arrivals    int
+	count       int     // number of recorded intervals
+	sum         float64 // seconds
+	sumSquares  float64 // seconds^2
+}
+
+func (r *arrivalRecorder) record(arrival time.Time) {
+	r.arrivals++
+	if !r.lastArrival.IsZero() {
+		interval := arrival.Sub(r.lastArrival).Seconds()
+		r.count++
+		r.sum += interval
+		r.sumSquares += interval * interval
+	}
+	r.lastArrival = arrival
+}
+
+func (r *arrivalRecorder) stats(targetQPS float64) ArrivalStats {
+	stats := ArrivalStats{Arrivals: r.arrivals, TargetQPS: targetQPS}
+	if r.count == 0 || r.sum == 0 {
+		stats.Note = "not enough arrivals to measure the arrival rate"
+		return stats
+	}
+	mean := r.sum / float64(r.count)
+	variance := max(0, r.sumSquares/float64(r.count)-mean*mean)
+	stats.MeanInterArrival = time.Duration(mean * float64(time.Second))
+	stats.MeasuredQPS = 1 / mean
+	stats.CV = math.Sqrt(variance) / mean
+
+	rateDeviation := (stats.MeasuredQPS - targetQPS) / targetQPS
+	if math.Abs(rateDeviation) > arrivalRateTolerance || math.Abs(stats.CV-1) > arrivalCVTolerance {
+		stats.Note = fmt.Sprintf("arrivals deviate from the target Poisson process: rate off by %.1f%%, CV %.2f (expected 1)",
+			rateDeviation*100, stats.CV)
+	} else {
+		stats.Note = fmt.Sprintf("arrivals match the target Poisson process: rate off by %.1f%%, CV %.2f (expected 1)",
+			rateDeviation*100, stats.CV)
+	}
+	return stats
+}
+
+// LatencyStats summarizes a latency distribution.
+type LatencyStats struct {
+	Count  int
+	Mean   time.Duration
+	StdDev time.Duration
+	P50    time.Duration
+	P75    time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	P999   time.Duration
+	Max    time.Duration
+}
+
+/**
+* ThroughputStats reports the achieved throughput over the whole benchmark.
+* A request is a single work unit (job or session), whereas every search within a session counts as a query.
+ */
+type ThroughputStats struct {
+	Requests          int
+	Queries           int
+	Duration          time.Duration // from the first query start to the last query completion
+	RequestsPerSecond float64
+	QueriesPerSecond  float64
+	Latency           LatencyStats
+}
+
+// PhaseStats reports the targeted workload and the achieved throughput and latency of a single benchmark phase.
+type PhaseStats struct {
+	Phase          int
+	Name           string
+	Duration       time.Duration
+	TargetQPS      float64
+	JobProbability float64
+	Queries        int
+	QPS            float64
+	Latency        LatencyStats
+}
+
+// StageStats reports the achieved throughput and latency of a single concurrency stage.
+type StageStats struct {
+	Stage    int
+	Workers  int
+	Duration time.Duration
+	Queries  int
+	QPS      float64
+	Latency  LatencyStats
+}
+
+/**
+* percentile returns the p-th percentile (0-100) of the sorted latencies using the nearest-rank method.
+ */
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+// ComputeLatencyStats summarizes the given latencies, the slice is sorted in place.
+func ComputeLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	slices.Sort(latencies)
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	mean := total / time.Duration(len(latencies))
+
+	var squaredDeviations float64
+	for _, latency := range latencies {
+		deviation := float64(latency - mean)
+		squaredDeviations += deviation * deviation
+	}
+
+	return LatencyStats{
+		Count:  len(latencies),
+		Mean:   mean,
+		StdDev: time.Duration(math.Sqrt(squaredDeviations / float64(len(latencies)))),
+		P50:    percentile(latencies, 50),
+		P75:    percentile(latencies, 75),
+		P90:    percentile(latencies, 90),
+		P95:    percentile(latencies, 95),
+		P99:    percentile(latencies, 99),
+		P999:   percentile(latencies, 99.9),
+		Max:    latencies[len(latencies)-1],
+	}
+}
+
+// ComputeOverallStats summarizes throughput and latency of all executed queries, including session steps.
+func ComputeOverallStats(jobs []Job, sessions []UserSession) ThroughputStats {
+	var stats ThroughputStats
+	var latencies []time.Duration
+	var firstStart, lastEnd time.Time
+	collect := func(job Job) {
+		if job.StartTimestamp.IsZero() {
+			return
+		}
+		latencies = append(latencies, job.Latency)
+		if firstStart.IsZero() || job.StartTimestamp.Before(firstStart) {
+			firstStart = job.StartTimestamp
+		}
+		if end := job.StartTimestamp.Add(job.Latency); end.After(lastEnd) {
+			lastEnd = end
+		}
+	}
+	for _, job := range jobs {
+		if !job.StartTimestamp.IsZero() {
+			stats.Requests++
+		}
+		collect(job)
+	}
+	for _, session := range sessions {
+		if !session.StartTimestamp.IsZero() {
+			stats.Requests++
+		}
+		for _, job := range session.Jobs {
+			collect(job)
+		}
+	}
+
+	stats.Queries = len(latencies)
+	stats.Latency = ComputeLatencyStats(latencies)
+	if stats.Queries > 0 {
+		stats.Duration = lastEnd.Sub(firstStart)
+	}
+	if stats.Duration > 0 {
+		stats.RequestsPerSecond = float64(stats.Requests) / stats.Duration.Seconds()
+		stats.QueriesPerSecond = float64(stats.Queries) / stats.Duration.Seconds()
+	}
+	return stats
+}
+
+// groupLatencies groups the latencies of all executed queries, including session steps, by the given group index.
+func groupLatencies(jobs []Job, sessions []UserSession, groups int, group func(Job) int) [][]time.Duration {
+	latencies := make([][]time.Duration, groups)
+	collect := func(job Job) {
+		if g := group(job); g < groups && !job.StartTimestamp.IsZero() {
+			latencies[g] = append(latencies[g], job.Latency)
+		}
+	}
+	for _, job := range jobs {
+		collect(job)
+	}
+	for _, session := range sessions {
+		for _, job := range session.Jobs {
+			collect(job)
+		}
+	}
+	return latencies
+}
+
+// ComputeStageStats groups all executed queries, including session steps, by their concurrency stage.
+func ComputeStageStats(jobs []Job, sessions []UserSession, stages []ConcurrencyStage) []StageStats {
+	latencies := groupLatencies(jobs, sessions, len(stages), func(job Job) int { return job.Stage })
+
+	stats := make([]StageStats, len(stages))
+	for i, stage := range stages {
+		stats[i] = StageStats{
+			Stage:    i,
+			Workers:  stage.workers,
+			Duration: stage.duration,
+			Queries:  len(latencies[i]),
+			QPS:      float64(len(latencies[i])) / stage.duration.Seconds(),
+			Latency:  ComputeLatencyStats(latencies[i]),
+		}
+	}
+	return stats
+}
+
+// FilterStats compares the latency of queries with and without a per-query filter.
+type FilterStats struct {
+	Filtered   LatencyStats
+	Unfiltered LatencyStats
+}
+
+// ComputeFilterStats groups all executed queries, including session steps, by whether they carried a filter.
+func ComputeFilterStats(jobs []Job, sessions []UserSession) FilterStats {
+	latencies := groupLatencies(jobs, sessions, 2, func(job Job) int {
+		if job.Filter != "" {
+			return 1
+		}
+		return 0
+	})
+	return FilterStats{
+		Unfiltered: ComputeLatencyStats(latencies[0]),
+		Filtered:   ComputeLatencyStats(latencies[1]),
+	}
+}
+
+// PayloadStats summarizes the size of the output fields returned with the results.
+type PayloadStats struct {
+	Queries    int
+	TotalBytes int64
+	MeanBytes  float64
+	MaxBytes   int
+}
+
+// ComputePayloadStats aggregates the payload of all executed queries, including session steps.
+func ComputePayloadStats(jobs []Job, sessions []UserSession) PayloadStats {
+	var stats PayloadStats
+	collect := func(job Job) {
+		if job.StartTimestamp.IsZero() {
+			return
+		}
+		stats.Queries++
+		stats.TotalBytes += int64(job.PayloadBytes)
+		stats.MaxBytes = max(stats.MaxBytes, job.PayloadBytes)
+	}
+	for _, job := range jobs {
+		collect(job)
+	}
+	for _, session := range sessions {
+		for _, job := range session.Jobs {
+			collect(job)
+		}
+	}
+	if stats.Queries > 0 {
+		stats.MeanBytes = float64(stats.TotalBytes) / float64(stats.Queries)
+	}
+	return stats
+}
+
+// ComputePhaseStats groups all executed queries, including session steps, by their benchmark phase.
+func ComputePhaseStats(jobs []Job, sessions []UserSession, phases []BenchmarkPhase) []PhaseStats {
+	latencies := groupLatencies(jobs, sessions, len(phases), func(job Job) int { return job.Phase })
+
+	stats := make([]PhaseStats, len(phases))
+	for i, phase := range phases {
+		stats[i] = PhaseStats{
+			Phase:          i,
+			Name:           phase.name,
+			Duration:       phase.duration,
+			TargetQPS:      phase.targetQPS,
+			JobProbability: phase.jobProbability,
+			Queries:        len(latencies[i]),
+			QPS:            float64(len(latencies[i])) / phase.duration.Seconds(),
+			Latency:        ComputeLatencyStats(latencies[i]),
+		}
+	}
+	return stats
+}
+
+/**
+* SessionStats characterizes the executed user sessions, whose steps depend on each other unlike independent jobs.
+* Only completed sessions enter the length histogram and the durations, truncated sessions are merely counted.
+ */
+type SessionStats struct {
+	Completed int
+	Truncated int // interrupted by the end of the benchmark, see UserSession.Truncated
+	Dropped   int // ended early because the continuation backlog was full, see UserSession.Dropped
+	// Number of completed sessions by their number of steps
+	Lengths     map[int]int
+	MeanLength  float64
+	Duration    LatencyStats // total duration of the completed sessions, from the first step start to the last step end
+	StepLatency LatencyStats // latency of the executed steps of all sessions, including truncated ones
+}
+
+// ComputeSessionStats summarizes the sessions with at least one executed step.
+func ComputeSessionStats(sessions []UserSession) SessionStats {
+	stats := SessionStats{Lengths: make(map[int]int)}
+	var durations, stepLatencies []time.Duration
+	totalSteps := 0
+	for _, session := range sessions {
+		steps := 0
+		for _, job := range session.Jobs {
+			if !job.StartTimestamp.IsZero() {
+				steps++
+				stepLatencies = append(stepLatencies, job.Latency)
+			}
+		}
+		switch {
+		case steps == 0:
+			continue
+		case session.Truncated:
+			stats.Truncated++
+		case session.Dropped:
+			stats.Dropped++
+		default:
+			stats.Completed++
+			stats.Lengths[steps]++
+			totalSteps += steps
+			durations = append(durations, session.Duration)
+		}
+	}
+	if stats.Completed > 0 {
+		stats.MeanLength = float64(totalSteps) / float64(stats.Completed)
+	}
+	stats.Duration = ComputeLatencyStats(durations)
+	stats.StepLatency = ComputeLatencyStats(stepLatencies)
+	return stats
+}
+
+// formatSessionLengths renders the length histogram in ascending length, e.g. "3 steps: 10, 4 steps: 12".
+func formatSessionLengths(lengths map[int]int) string {
+	parts := make([]string, 0, len(lengths))
+	for _, length := range slices.Sorted(maps.Keys(lengths)) {
+		parts = append(parts, fmt.Sprintf("%d steps: %d", length, lengths[length]))
+	}
+	return strings.Join(parts, ", ")
+}
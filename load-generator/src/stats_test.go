@@ -0,0 +1,310 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile_Empty(t *testing.T) {
+	if p := percentile(nil, 50); p != 0 {
+		t.Errorf("Expected 0 for empty latencies, got %v", p)
+	}
+}
+
+func TestPercentile_NearestRank(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	cases := map[float64]time.Duration{
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+	for p, expected := range cases {
+		if actual := percentile(sorted, p); actual != expected {
+			t.Errorf("Expected p%.0f to be %v, got %v", p, expected, actual)
+		}
+	}
+}
+
+func TestComputeLatencyStats_Unsorted(t *testing.T) {
+	latencies := []time.Duration{3 * time.Millisecond, 1 * time.Millisecond, 2 * time.Millisecond}
+
+	stats := ComputeLatencyStats(latencies)
+
+	if stats.Count != 3 {
+		t.Errorf("Expected count 3, got %d", stats.Count)
+	}
+	if stats.Mean != 2*time.Millisecond {
+		t.Errorf("Expected mean 2ms, got %v", stats.Mean)
+	}
+	if stats.P50 != 2*time.Millisecond {
+		t.Errorf("Expected p50 2ms, got %v", stats.P50)
+	}
+	if stats.Max != 3*time.Millisecond {
+		t.Errorf("Expected max 3ms, got %v", stats.Max)
+	}
+}
+
+func TestComputeStageStats_GroupsJobsAndSessionSteps(t *testing.T) {
+	now := time.Now()
+	stages := []ConcurrencyStage{
+		{workers: 10, duration: 10 * time.Second},
+		{workers: 20, duration: 5 * time.Second},
+	}
+	jobs := []Job{
+		{Id: "J-0", Stage: 0, StartTimestamp: now, Latency: time.Millisecond},
+		{Id: "J-1", Stage: 1, StartTimestamp: now, Latency: 3 * time.Millisecond},
+	}
+	sessions := []UserSession{{
+		SessionId: 0,
+		Jobs: []Job{
+			{Id: "S-0-0", Stage: 1, StartTimestamp: now, Latency: 5 * time.Millisecond},
+			{Id: "S-0-1"}, // never executed
+		},
+	}}
+
+	stats := ComputeStageStats(jobs, sessions, stages)
+
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 stages, got %d", len(stats))
+	}
+	if stats[0].Queries != 1 || stats[1].Queries != 2 {
+		t.Errorf("Expected 1 and 2 queries per stage, got %d and %d", stats[0].Queries, stats[1].Queries)
+	}
+	if stats[1].QPS != 0.4 {
+		t.Errorf("Expected 0.4 QPS in stage 1, got %f", stats[1].QPS)
+	}
+	if stats[1].Workers != 20 {
+		t.Errorf("Expected 20 workers in stage 1, got %d", stats[1].Workers)
+	}
+	if stats[1].Latency.Mean != 4*time.Millisecond {
+		t.Errorf("Expected mean latency 4ms in stage 1, got %v", stats[1].Latency.Mean)
+	}
+}
+
+func TestArrivalRecorder_ConstantIntervals(t *testing.T) {
+	var recorder arrivalRecorder
+	start := time.Now()
+	for i := range 11 {
+		recorder.record(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+
+	stats := recorder.stats(10.0)
+
+	if stats.Arrivals != 11 {
+		t.Errorf("Expected 11 arrivals, got %d", stats.Arrivals)
+	}
+	if math.Abs(stats.MeasuredQPS-10.0) > 0.0001 {
+		t.Errorf("Expected measured rate of 10 QPS, got %f", stats.MeasuredQPS)
+	}
+	// Constant intervals are not Poisson distributed
+	if stats.CV > 0.0001 {
+		t.Errorf("Expected CV of 0 for constant intervals, got %f", stats.CV)
+	}
+}
+
+func TestArrivalRecorder_ExponentialIntervals(t *testing.T) {
+	params := testJobGenParams(100.0, 1.0, 5, 10)
+	ac := NewArrivalController(params, 50, 0, 42, 10)
+
+	var recorder arrivalRecorder
+	arrival := time.Now()
+	for range 20000 {
+		arrival = arrival.Add(ac.NextSleepDuration())
+		recorder.record(arrival)
+	}
+
+	stats := recorder.stats(100.0)
+
+	if math.Abs(stats.MeasuredQPS-100.0) > 100.0*arrivalRateTolerance {
+		t.Errorf("Expected measured rate close to 100 QPS, got %f", stats.MeasuredQPS)
+	}
+	if math.Abs(stats.CV-1) > arrivalCVTolerance {
+		t.Errorf("Expected CV close to 1 for exponential intervals, got %f", stats.CV)
+	}
+}
+
+func TestArrivalRecorder_NoArrivals(t *testing.T) {
+	var recorder arrivalRecorder
+
+	stats := recorder.stats(100.0)
+
+	if stats.Arrivals != 0 || stats.MeasuredQPS != 0 {
+		t.Errorf("Expected empty stats without arrivals, got %+v", stats)
+	}
+}
+
+func TestComputeOverallStats_CountsRequestsAndQueries(t *testing.T) {
+	now := time.Now()
+	jobs := []Job{
+		{Id: "J-0", StartTimestamp: now, Latency: time.Second},
+		{Id: "J-1"}, // never executed
+	}
+	sessions := []UserSession{{
+		StartTimestamp: now.Add(time.Second),
+		Jobs: []Job{
+			{Id: "S-0-0", StartTimestamp: now.Add(time.Second), Latency: time.Second},
+			{Id: "S-0-1", StartTimestamp: now.Add(2 * time.Second), Latency: 2 * time.Second},
+		},
+	}}
+
+	stats := ComputeOverallStats(jobs, sessions)
+
+	if stats.Requests != 2 || stats.Queries != 3 {
+		t.Errorf("Expected 2 requests and 3 queries, got %d / %d", stats.Requests, stats.Queries)
+	}
+	if stats.Duration != 4*time.Second {
+		t.Errorf("Expected duration 4s, got %v", stats.Duration)
+	}
+	if stats.QueriesPerSecond != 0.75 {
+		t.Errorf("Expected 0.75 queries/sec, got %f", stats.QueriesPerSecond)
+	}
+}
+
+func TestFormatWrkSummary(t *testing.T) {
+	stats := ThroughputStats{
+		Requests:          10,
+		Queries:           20,
+		Duration:          2 * time.Second,
+		RequestsPerSecond: 5,
+		QueriesPerSecond:  10,
+		Latency:           LatencyStats{P999: 1500 * time.Microsecond},
+	}
+
+	summary := FormatWrkSummary(stats, 4, 10)
+
+	for _, expected := range []string{"4 workers", " 99.900%    1.50ms", "Requests/sec:       5.00", "Queries/sec:       10.00"} {
+		if !strings.Contains(summary, expected) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", expected, summary)
+		}
+	}
+}
+
+func TestComputePhaseStats_GroupsByPhase(t *testing.T) {
+	now := time.Now()
+	phases := []BenchmarkPhase{
+		{name: "read-heavy", duration: 10 * time.Second, targetQPS: 100, jobProbability: 0.9},
+		{name: "sessions", duration: 10 * time.Second, targetQPS: 50, jobProbability: 0.1},
+	}
+	jobs := []Job{
+		{Id: "J-0", Phase: 0, StartTimestamp: now, Latency: time.Millisecond},
+		{Id: "J-1", Phase: 1, StartTimestamp: now, Latency: 3 * time.Millisecond},
+	}
+	sessions := []UserSession{{Jobs: []Job{
+		{Id: "S-0-0", Phase: 1, StartTimestamp: now, Latency: 5 * time.Millisecond},
+	}}}
+
+	stats := ComputePhaseStats(jobs, sessions, phases)
+
+	if stats[0].Queries != 1 || stats[1].Queries != 2 {
+		t.Errorf("Expected 1 and 2 queries, got %d and %d", stats[0].Queries, stats[1].Queries)
+	}
+	if stats[1].Name != "sessions" || stats[1].Latency.Mean != 4*time.Millisecond {
+		t.Errorf("Unexpected stats for phase 1: %+v", stats[1])
+	}
+}
+
+func TestMeanTargetQPS_WeightedByDuration(t *testing.T) {
+	phases := []BenchmarkPhase{
+		{duration: 30 * time.Second, targetQPS: 100},
+		{duration: 10 * time.Second, targetQPS: 200},
+	}
+
+	if mean := meanTargetQPS(JobGenerationParameters{phases: phases}); mean != 125 {
+		t.Errorf("Expected mean target 125 QPS, got %.2f", mean)
+	}
+}
+
+func TestStageAt_FollowsStageBoundaries(t *testing.T) {
+	stages := []ConcurrencyStage{{workers: 1, duration: 10 * time.Second}, {workers: 2, duration: 5 * time.Second}}
+
+	for elapsed, expected := range map[time.Duration]int{
+		0:                0,
+		9 * time.Second:  0,
+		10 * time.Second: 1,
+		20 * time.Second: 1, // past the end, e.g. for a query still running at the deadline
+	} {
+		if stage := stageAt(stages, elapsed); stage != expected {
+			t.Errorf("After %v: expected stage %d, got %d", elapsed, expected, stage)
+		}
+	}
+}
+
+func TestComputeFilterStats_SplitsByFilter(t *testing.T) {
+	now := time.Now()
+	jobs := []Job{
+		{Id: "J-0", StartTimestamp: now, Latency: time.Millisecond},
+		{Id: "J-1", StartTimestamp: now, Latency: 3 * time.Millisecond, Filter: "id > 5"},
+	}
+	sessions := []UserSession{{Jobs: []Job{
+		{Id: "S-0-0", StartTimestamp: now, Latency: 5 * time.Millisecond, Filter: "id > 7"},
+	}}}
+
+	stats := ComputeFilterStats(jobs, sessions)
+
+	if stats.Unfiltered.Count != 1 || stats.Filtered.Count != 2 {
+		t.Errorf("Expected 1 unfiltered and 2 filtered queries, got %d and %d", stats.Unfiltered.Count, stats.Filtered.Count)
+	}
+	if stats.Filtered.Mean != 4*time.Millisecond {
+		t.Errorf("Expected mean filtered latency 4ms, got %v", stats.Filtered.Mean)
+	}
+}
+
+func TestComputePayloadStats(t *testing.T) {
+	now := time.Now()
+	jobs := []Job{
+		{StartTimestamp: now, PayloadBytes: 100},
+		{StartTimestamp: now, PayloadBytes: 300},
+		{PayloadBytes: 1000}, // never executed
+	}
+	sessions := []UserSession{{Jobs: []Job{{StartTimestamp: now, PayloadBytes: 200}, {}}}}
+
+	stats := ComputePayloadStats(jobs, sessions)
+
+	expected := PayloadStats{Queries: 3, TotalBytes: 600, MeanBytes: 200, MaxBytes: 300}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestComputeSessionStats(t *testing.T) {
+	now := time.Now()
+	step := func(latency time.Duration) Job { return Job{StartTimestamp: now, Latency: latency} }
+	sessions := []UserSession{
+		{StartTimestamp: now, Duration: 10 * time.Millisecond, Jobs: []Job{step(time.Millisecond), step(3 * time.Millisecond)}},
+		{StartTimestamp: now, Duration: 20 * time.Millisecond, Jobs: []Job{step(time.Millisecond), step(time.Millisecond)}},
+		{StartTimestamp: now, Duration: 30 * time.Millisecond, Jobs: []Job{step(time.Millisecond), step(time.Millisecond), step(time.Millisecond)}},
+		// Truncated after its first step, the second step was never executed
+		{StartTimestamp: now, Duration: 5 * time.Millisecond, Truncated: true, Jobs: []Job{step(2 * time.Millisecond), {}}},
+		// Never started
+		{Jobs: []Job{{}, {}}},
+	}
+
+	stats := ComputeSessionStats(sessions)
+
+	if stats.Completed != 3 || stats.Truncated != 1 {
+		t.Errorf("Expected 3 completed and 1 truncated session, got %d and %d", stats.Completed, stats.Truncated)
+	}
+	if !reflect.DeepEqual(stats.Lengths, map[int]int{2: 2, 3: 1}) {
+		t.Errorf("Expected lengths {2: 2, 3: 1}, got %v", stats.Lengths)
+	}
+	if math.Abs(stats.MeanLength-7.0/3.0) > 1e-9 {
+		t.Errorf("Expected mean length 7/3, got %f", stats.MeanLength)
+	}
+	if stats.Duration.Count != 3 || stats.Duration.Mean != 20*time.Millisecond {
+		t.Errorf("Expected 3 durations with mean 20ms, got %d with mean %v", stats.Duration.Count, stats.Duration.Mean)
+	}
+	if stats.StepLatency.Count != 8 || stats.StepLatency.Mean != 11*time.Millisecond/8 {
+		t.Errorf("Expected 8 steps with mean 1.375ms, got %d with mean %v", stats.StepLatency.Count, stats.StepLatency.Mean)
+	}
+	if got := formatSessionLengths(stats.Lengths); got != "2 steps: 2, 3 steps: 1" {
+		t.Errorf("Unexpected length histogram %q", got)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const throughputFile = "throughput.csv"
+
+// ThroughputBucket counts the arrivals and queries of one window of the benchmark.
+type ThroughputBucket struct {
+	Start     time.Time
+	TargetQPS float64 // targetQPS of the benchmark phase, before rate-limit adaptation and load shedding
+	Arrivals  int     // scheduled workloads, including session continuations
+	Dropped   int     // arrivals dropped because all workers were busy
+	Completed int     // successful queries by their start time, including session steps
+}
+
+/**
+* throughputRecorder buckets the arrivals and completed queries of a Poisson benchmark into windows, so that the
+* achieved QPS can be compared with the target over time, e.g. to spot the warmup ramp or when work was dropped.
+* It is safe for concurrent use.
+ */
+type throughputRecorder struct {
+	mu      sync.Mutex
+	start   time.Time
+	window  time.Duration
+	buckets []ThroughputBucket
+}
+
+// newThroughputRecorder returns nil for a zero window, which disables all recording.
+func newThroughputRecorder(start time.Time, window time.Duration) *throughputRecorder {
+	if window <= 0 {
+		return nil
+	}
+	return &throughputRecorder{start: start, window: window}
+}
+
+// bucket returns the bucket of t, the caller must hold mu.
+func (r *throughputRecorder) bucket(t time.Time) *ThroughputBucket {
+	index := max(0, int(t.Sub(r.start)/r.window))
+	for len(r.buckets) <= index {
+		r.buckets = append(r.buckets, ThroughputBucket{Start: r.start.Add(time.Duration(len(r.buckets)) * r.window)})
+	}
+	return &r.buckets[index]
+}
+
+func (r *throughputRecorder) recordArrival(t time.Time, targetQPS float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bucket := r.bucket(t)
+	bucket.Arrivals++
+	bucket.TargetQPS = targetQPS
+}
+
+func (r *throughputRecorder) recordDrop(t time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bucket(t).Dropped++
+}
+
+func (r *throughputRecorder) recordCompletion(start time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bucket(start).Completed++
+}
+
+// series returns the buckets, windows without arrivals keep the target of the previous window.
+func (r *throughputRecorder) series() []ThroughputBucket {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series := make([]ThroughputBucket, len(r.buckets))
+	copy(series, r.buckets)
+	for i := 1; i < len(series); i++ {
+		if series[i].Arrivals == 0 {
+			series[i].TargetQPS = series[i-1].TargetQPS
+		}
+	}
+	return series
+}
+
+func (l *Logger) LogThroughput(series []ThroughputBucket, window time.Duration) error {
+	var b strings.Builder
+	b.WriteString("timestamp,offset_s,target_qps,arrival_qps,achieved_qps,dropped\n")
+	for _, bucket := range series {
+		fmt.Fprintf(&b, "%s,%.3f,%.2f,%.2f,%.2f,%d\n",
+			formatTimestamp(bucket.Start),
+			bucket.Start.Sub(series[0].Start).Seconds(),
+			bucket.TargetQPS,
+			float64(bucket.Arrivals)/window.Seconds(),
+			float64(bucket.Completed)/window.Seconds(),
+			bucket.Dropped,
+		)
+	}
+	return os.WriteFile(outputPath(throughputFile), []byte(b.String()), 0644)
+}
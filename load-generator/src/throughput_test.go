@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThroughputRecorder_Buckets(t *testing.T) {
+	start := time.Now()
+	r := newThroughputRecorder(start, time.Second)
+
+	r.recordArrival(start.Add(100*time.Millisecond), 10)
+	r.recordArrival(start.Add(900*time.Millisecond), 10)
+	r.recordCompletion(start.Add(200 * time.Millisecond))
+	r.recordDrop(start.Add(900 * time.Millisecond))
+	r.recordCompletion(start.Add(2500 * time.Millisecond)) // second window has no arrivals
+
+	series := r.series()
+
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 windows, got %d", len(series))
+	}
+	if series[0].Arrivals != 2 || series[0].Completed != 1 || series[0].Dropped != 1 || series[0].TargetQPS != 10 {
+		t.Errorf("Unexpected first window %+v", series[0])
+	}
+	// Windows without arrivals keep the target of the previous window
+	if series[1].TargetQPS != 10 || series[2].TargetQPS != 10 || series[2].Completed != 1 {
+		t.Errorf("Unexpected later windows %+v", series[1:])
+	}
+}
+
+func TestThroughputRecorder_DisabledIsNil(t *testing.T) {
+	r := newThroughputRecorder(time.Now(), 0)
+	r.recordArrival(time.Now(), 10)
+	r.recordCompletion(time.Now())
+	if r.series() != nil {
+		t.Error("Expected no series without a window")
+	}
+}
+
+func TestLogThroughput(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	start := time.Now()
+	series := []ThroughputBucket{
+		{Start: start, TargetQPS: 100, Arrivals: 50, Completed: 40, Dropped: 2},
+		{Start: start.Add(500 * time.Millisecond), TargetQPS: 100, Arrivals: 50, Completed: 50},
+	}
+	if err := logger.LogThroughput(series, 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(outputPath(throughputFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], ",0.000,100.00,100.00,80.00,2") ||
+		!strings.HasSuffix(lines[2], ",0.500,100.00,100.00,100.00,0") {
+		t.Errorf("Unexpected throughput CSV:\n%s", data)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	latencyTimeSeriesFile = "latency-timeseries.csv"
+	latencyPlotSpecFile   = "latency-timeseries.vl.json"
+)
+
+// Columns of the latency time series, latencies are in milliseconds
+var (
+	latencyTimeSeriesColumns = []string{"offset_s", "queries", "qps", "mean_ms", "p50_ms", "p95_ms", "p99_ms", "max_ms"}
+	plottedLatencyColumns    = []string{"mean_ms", "p50_ms", "p95_ms", "p99_ms"}
+)
+
+// LatencyBucket summarizes the queries that started within one interval of the benchmark.
+type LatencyBucket struct {
+	Offset  time.Duration // start of the interval relative to the first query
+	Queries int
+	QPS     float64
+	Latency LatencyStats
+}
+
+// ComputeLatencyTimeSeries groups all executed queries, including session steps, into intervals by their start time.
+func ComputeLatencyTimeSeries(jobs []Job, sessions []UserSession, interval time.Duration) []LatencyBucket {
+	var firstStart, lastStart time.Time
+	observe := func(job Job) {
+		if job.StartTimestamp.IsZero() {
+			return
+		}
+		if firstStart.IsZero() || job.StartTimestamp.Before(firstStart) {
+			firstStart = job.StartTimestamp
+		}
+		if job.StartTimestamp.After(lastStart) {
+			lastStart = job.StartTimestamp
+		}
+	}
+	for _, job := range jobs {
+		observe(job)
+	}
+	for _, session := range sessions {
+		for _, job := range session.Jobs {
+			observe(job)
+		}
+	}
+	if firstStart.IsZero() {
+		return nil
+	}
+
+	buckets := int(lastStart.Sub(firstStart)/interval) + 1
+	latencies := groupLatencies(jobs, sessions, buckets, func(job Job) int {
+		return int(job.StartTimestamp.Sub(firstStart) / interval)
+	})
+
+	series := make([]LatencyBucket, buckets)
+	for i := range series {
+		series[i] = LatencyBucket{
+			Offset:  time.Duration(i) * interval,
+			Queries: len(latencies[i]),
+			QPS:     float64(len(latencies[i])) / interval.Seconds(),
+			Latency: ComputeLatencyStats(latencies[i]),
+		}
+	}
+	return series
+}
+
+func (l *Logger) LogLatencyTimeSeries(series []LatencyBucket) error {
+	var b strings.Builder
+	b.WriteString(strings.Join(latencyTimeSeriesColumns, ",") + "\n")
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	for _, bucket := range series {
+		fmt.Fprintf(&b, "%.3f,%d,%.2f,%.3f,%.3f,%.3f,%.3f,%.3f\n",
+			bucket.Offset.Seconds(),
+			bucket.Queries,
+			bucket.QPS,
+			ms(bucket.Latency.Mean),
+			ms(bucket.Latency.P50),
+			ms(bucket.Latency.P95),
+			ms(bucket.Latency.P99),
+			ms(bucket.Latency.Max),
+		)
+	}
+	return os.WriteFile(outputPath(latencyTimeSeriesFile), []byte(b.String()), 0644)
+}
+
+/**
+* latencyPlotSpec builds a Vega-Lite specification charting the latency over time from the time series CSV.
+* The CSV is referenced relative to the spec, so both have to stay in the same directory.
+ */
+func latencyPlotSpec() map[string]any {
+	parse := make(map[string]string, len(latencyTimeSeriesColumns))
+	for _, column := range latencyTimeSeriesColumns {
+		parse[column] = "number"
+	}
+	return map[string]any{
+		"$schema":     "https://vega.github.io/schema/vega-lite/v5.json",
+		"description": "Query latency over the course of the benchmark",
+		"width":       800,
+		"height":      400,
+		"data": map[string]any{
+			"url":    latencyTimeSeriesFile,
+			"format": map[string]any{"type": "csv", "parse": parse},
+		},
+		"transform": []any{
+			map[string]any{"fold": plottedLatencyColumns, "as": []string{"statistic", "latency_ms"}},
+		},
+		"mark": map[string]any{"type": "line", "interpolate": "step-after"},
+		"encoding": map[string]any{
+			"x":     map[string]any{"field": "offset_s", "type": "quantitative", "title": "Time since start (s)"},
+			"y":     map[string]any{"field": "latency_ms", "type": "quantitative", "title": "Latency (ms)"},
+			"color": map[string]any{"field": "statistic", "type": "nominal", "title": "Statistic"},
+		},
+	}
+}
+
+// LogLatencyPlotSpec writes a Vega-Lite specification rendering the latency time series, e.g. with the Vega editor or vl2png.
+func (l *Logger) LogLatencyPlotSpec() error {
+	data, err := json.MarshalIndent(latencyPlotSpec(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outputPath(latencyPlotSpecFile), data, 0644)
+}
+
+/**
+* LatencyDriftStats reports the linear trend of the mean latency over the course of the benchmark.
+* A slow upward drift, e.g. due to memory growth, a compaction backlog or cache eviction,
+* is invisible in the aggregate percentiles but shows up as a positive slope.
+ */
+type LatencyDriftStats struct {
+	SlopePerMinute   time.Duration // change of the mean latency per minute of benchmark
+	StartLatency     time.Duration // trend line at the first interval
+	EndLatency       time.Duration // trend line at the last interval
+	RelativeIncrease float64       // (EndLatency - StartLatency) relative to the mean latency over all intervals
+	Degraded         bool          // the relative increase exceeds the drift threshold
+	Note             string
+}
+
+// ComputeLatencyDrift fits a least-squares line to the mean latency of all non-empty intervals.
+func ComputeLatencyDrift(series []LatencyBucket, threshold float64) LatencyDriftStats {
+	var n, sumX, sumY, sumXY, sumXX float64
+	var first, last float64
+	for _, bucket := range series {
+		if bucket.Queries == 0 {
+			continue
+		}
+		x, y := bucket.Offset.Seconds(), float64(bucket.Latency.Mean)
+		if n == 0 {
+			first = x
+		}
+		last = x
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	if n < 2 || n*sumXX == sumX*sumX {
+		return LatencyDriftStats{Note: "not enough intervals with queries to fit a trend"}
+	}
+
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX) // latency per second
+	intercept := (sumY - slope*sumX) / n
+	stats := LatencyDriftStats{
+		SlopePerMinute: time.Duration(slope * 60),
+		StartLatency:   time.Duration(intercept + slope*first),
+		EndLatency:     time.Duration(intercept + slope*last),
+	}
+	stats.RelativeIncrease = float64(stats.EndLatency-stats.StartLatency) / (sumY / n)
+	stats.Degraded = stats.RelativeIncrease > threshold
+	if stats.Degraded {
+		stats.Note = fmt.Sprintf("performance degradation over time: mean latency trends from %v to %v (+%.1f%%)",
+			stats.StartLatency, stats.EndLatency, stats.RelativeIncrease*100)
+	} else {
+		stats.Note = fmt.Sprintf("no significant latency drift: mean latency trends from %v to %v (%+.1f%%)",
+			stats.StartLatency, stats.EndLatency, stats.RelativeIncrease*100)
+	}
+	return stats
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeLatencyTimeSeries_Buckets(t *testing.T) {
+	start := time.Now()
+	jobs := []Job{
+		{StartTimestamp: start, Latency: 10 * time.Millisecond},
+		{StartTimestamp: start.Add(500 * time.Millisecond), Latency: 30 * time.Millisecond},
+		{StartTimestamp: start.Add(2500 * time.Millisecond), Latency: 50 * time.Millisecond},
+		{Latency: time.Second}, // never executed
+	}
+	sessions := []UserSession{{Jobs: []Job{
+		{StartTimestamp: start.Add(2 * time.Second), Latency: 70 * time.Millisecond},
+	}}}
+
+	series := ComputeLatencyTimeSeries(jobs, sessions, time.Second)
+
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 buckets, got %d", len(series))
+	}
+	if series[0].Queries != 2 || series[0].Latency.Mean != 20*time.Millisecond {
+		t.Errorf("Unexpected first bucket: %+v", series[0])
+	}
+	if series[1].Queries != 0 || series[1].QPS != 0 {
+		t.Errorf("Expected an empty second bucket, got %+v", series[1])
+	}
+	if series[2].Offset != 2*time.Second || series[2].Queries != 2 || series[2].Latency.Max != 70*time.Millisecond {
+		t.Errorf("Unexpected third bucket: %+v", series[2])
+	}
+}
+
+func TestComputeLatencyTimeSeries_NoQueries(t *testing.T) {
+	if series := ComputeLatencyTimeSeries(nil, nil, time.Second); series != nil {
+		t.Errorf("Expected no buckets, got %+v", series)
+	}
+}
+
+func TestLogLatencyTimeSeries_HeaderMatchesPlotSpec(t *testing.T) {
+	SetOutputDir(t.TempDir())
+	defer SetOutputDir("output")
+	logger, err := NewLogger("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	err = logger.LogLatencyTimeSeries([]LatencyBucket{{Queries: 1, QPS: 1, Latency: LatencyStats{Mean: time.Millisecond}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputPath(latencyTimeSeriesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[1] != "0.000,1,1.00,1.000,0.000,0.000,0.000,0.000" {
+		t.Errorf("Unexpected time series: %q", lines)
+	}
+
+	header := strings.Split(lines[0], ",")
+	for _, column := range plottedLatencyColumns {
+		if !slices.Contains(header, column) {
+			t.Errorf("Plotted column %s missing in the CSV header %v", column, header)
+		}
+	}
+}
+
+func TestComputeLatencyDrift_Degradation(t *testing.T) {
+	// Latency grows by 1ms per second, from 10ms to 19ms
+	series := make([]LatencyBucket, 10)
+	for i := range series {
+		series[i] = LatencyBucket{
+			Offset:  time.Duration(i) * time.Second,
+			Queries: 1,
+			Latency: LatencyStats{Mean: time.Duration(10+i) * time.Millisecond},
+		}
+	}
+	series[5].Queries = 0 // empty intervals are skipped
+
+	drift := ComputeLatencyDrift(series, 0.2)
+
+	if drift.SlopePerMinute != 60*time.Millisecond {
+		t.Errorf("Expected a slope of 60ms per minute, got %v", drift.SlopePerMinute)
+	}
+	if drift.StartLatency != 10*time.Millisecond || drift.EndLatency != 19*time.Millisecond {
+		t.Errorf("Unexpected trend from %v to %v", drift.StartLatency, drift.EndLatency)
+	}
+	if !drift.Degraded {
+		t.Errorf("Expected degradation to be flagged: %+v", drift)
+	}
+}
+
+func TestComputeLatencyDrift_Stable(t *testing.T) {
+	series := []LatencyBucket{
+		{Offset: 0, Queries: 1, Latency: LatencyStats{Mean: 10 * time.Millisecond}},
+		{Offset: time.Second, Queries: 1, Latency: LatencyStats{Mean: 11 * time.Millisecond}},
+		{Offset: 2 * time.Second, Queries: 1, Latency: LatencyStats{Mean: 10 * time.Millisecond}},
+	}
+	if drift := ComputeLatencyDrift(series, 0.2); drift.Degraded || drift.SlopePerMinute != 0 {
+		t.Errorf("Expected no drift, got %+v", drift)
+	}
+}
+
+func TestComputeLatencyDrift_TooFewIntervals(t *testing.T) {
+	series := []LatencyBucket{{Queries: 1, Latency: LatencyStats{Mean: time.Millisecond}}}
+	if drift := ComputeLatencyDrift(series, 0.2); drift.Degraded || drift.Note == "" {
+		t.Errorf("Expected a note without a trend, got %+v", drift)
+	}
+}
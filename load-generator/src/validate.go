@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/**
+* ValidateConfig checks the resolved configuration and the dataset without connecting to Milvus, so that typos in
+* the config files surface before any cluster time is spent.
+* The dimension of a Parquet dataset without a configured dim is detected and stored in the config.
+ */
+func ValidateConfig(config *Config) error {
+	// A generated dataset has the configured dim by construction
+	if config.dataSource != dataSourceGenerated {
+		if err := checkDataFile(config); err != nil {
+			return err
+		}
+	}
+
+	err := checkVectorType(
+		config.indexParameters.vectorType,
+		config.dim,
+		config.indexParameters.distanceMetric,
+		config.indexParameters.indexType,
+		config.rerankFieldName != "",
+	)
+	if err != nil {
+		return err
+	}
+	if err := checkPartitionParameters(config.numPartitions, config.partitionAssignment, config.jobGenParams); err != nil {
+		return err
+	}
+	if err := checkFilterParameters(config.jobGenParams); err != nil {
+		return err
+	}
+	searchParams := SearchParameters{k: config.k, rerankFieldName: config.rerankFieldName, rerankCandidates: config.rerankCandidates}
+	if err := checkSearchEffort(config.indexParameters.indexType, config.indexSearchParams, searchParams.searchLimit()); err != nil {
+		return err
+	}
+	if err := checkVectorFields(config.vectorFields(), config.rerankFieldName); err != nil {
+		return err
+	}
+	if err := checkHybridParameters(config.jobGenParams, config.vectorFields()); err != nil {
+		return err
+	}
+	if err := checkMutationParameters(config.jobGenParams, config.numPartitions, config.partitionAssignment); err != nil {
+		return err
+	}
+	if err := checkDriftParameters(config.jobGenParams); err != nil {
+		return err
+	}
+	if config.jobGenParams.hybridProbability > 0 {
+		_, err = newHybridReranker(config.hybridReranker, config.hybridRRFK, config.hybridWeights, len(config.vectorFields()))
+		if err != nil {
+			return err
+		}
+	}
+	if config.jobGenParams.loadSchedule != nil {
+		if err := checkLoadSchedule(*config.jobGenParams.loadSchedule); err != nil {
+			return err
+		}
+	}
+	if err := checkWorkloadMode(config.workloadMode, config.jobGenParams); err != nil {
+		return err
+	}
+	if config.warmupSource != warmupSourceRandom && config.warmupSource != warmupSourceDataset {
+		return fmt.Errorf("unknown warmup query source %q", config.warmupSource)
+	}
+	if config.overloadPolicy != overloadPolicyDrop && config.overloadPolicy != overloadPolicyBlock {
+		return fmt.Errorf("unknown overload policy %q", config.overloadPolicy)
+	}
+	return nil
+}
+
+// checkFirstRowDimension compares the dimension of the first row of a text dataset with the configured dim.
+func checkFirstRowDimension(path string, idSource string, dim int) error {
+	actual, err := detectTextDimension(path, idSource)
+	if err != nil {
+		return fmt.Errorf("failed to read the dimension of %s: %w", path, err)
+	}
+	if actual != dim {
+		return fmt.Errorf("dimension mismatch: configured dim is %d but the first row of %s has dim %d", dim, path, actual)
+	}
+	return nil
+}
+
+// detectTextDimension returns the number of vector values on the first non-empty line of a text dataset.
+func detectTextDimension(path string, idSource string) (int, error) {
+	file, err := openDataset(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		// Same layout as read by DataReader: [<id>] <word> <v...>
+		parts := strings.Fields(line)
+		fields := 1
+		if idSource == idSourceField {
+			fields = 2
+		}
+		if len(parts) <= fields {
+			return 0, fmt.Errorf("first line has no vector values")
+		}
+		return len(parts) - fields, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("file contains no rows")
+}
+
+// checkDataFile checks that the data file exists and matches the configured dim, which is detected if not configured.
+func checkDataFile(config *Config) error {
+	if _, err := os.Stat(config.dataFile); err != nil {
+		return fmt.Errorf("data file: %w", err)
+	}
+
+	var dim int
+	var err error
+	if config.dataFormat == dataFormatParquet {
+		dim, err = DetectParquetDimension(config.dataFile)
+	} else {
+		dim, err = detectTextDimension(config.dataFile, config.idSource)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the dimension of %s: %w", config.dataFile, err)
+	}
+	if config.dim == 0 {
+		config.dim = dim
+	} else if dim != config.dim {
+		return fmt.Errorf("dimension mismatch: configured dim is %d but the first row of %s has dim %d",
+			config.dim, config.dataFile, dim)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeValidateDataset(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func validConfig(dataFile string, dim int) Config {
+	return Config{
+		dataFile:        dataFile,
+		dataFormat:      dataFormatText,
+		idSource:        idSourceSequential,
+		dim:             dim,
+		overloadPolicy:  overloadPolicyDrop,
+		warmupSource:    warmupSourceRandom,
+		jobGenParams:    JobGenerationParameters{sessionDrift: driftAdditive},
+		indexParameters: ConstructionIndexParameters{indexType: indexTypeHNSW, distanceMetric: metricL2, vectorType: vectorTypeFloat},
+	}
+}
+
+func TestDetectTextDimension(t *testing.T) {
+	path := writeValidateDataset(t, "\nthe 0.1 0.2 0.3\nof 0.4 0.5 0.6\n")
+	if dim, err := detectTextDimension(path, idSourceSequential); err != nil || dim != 3 {
+		t.Errorf("Expected dim 3, got %d / %v", dim, err)
+	}
+
+	withIds := writeValidateDataset(t, "7 the 0.1 0.2 0.3\n")
+	if dim, err := detectTextDimension(withIds, idSourceField); err != nil || dim != 3 {
+		t.Errorf("Expected dim 3 with an id field, got %d / %v", dim, err)
+	}
+}
+
+func TestCheckFirstRowDimension(t *testing.T) {
+	path := writeValidateDataset(t, "the 0.1 0.2 0.3\n")
+	if err := checkFirstRowDimension(path, idSourceSequential, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkFirstRowDimension(path, idSourceSequential, 50); err == nil {
+		t.Error("Expected an error for a dataset with a different dim")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	path := writeValidateDataset(t, "the 0.1 0.2 0.3\n")
+
+	valid := validConfig(path, 3)
+	if err := ValidateConfig(&valid); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	mismatch := validConfig(path, 50)
+	if err := ValidateConfig(&mismatch); err == nil {
+		t.Error("Expected an error for a dimension mismatch")
+	}
+
+	missing := validConfig(filepath.Join(t.TempDir(), "missing.txt"), 3)
+	if err := ValidateConfig(&missing); err == nil {
+		t.Error("Expected an error for a missing data file")
+	}
+
+	generated := validConfig("", 3)
+	generated.dataSource = dataSourceGenerated
+	if err := ValidateConfig(&generated); err != nil {
+		t.Errorf("Expected a generated dataset without data file to be valid, got %v", err)
+	}
+
+	binary := validConfig(path, 3)
+	binary.indexParameters.vectorType = vectorTypeBinary
+	if err := ValidateConfig(&binary); err == nil {
+		t.Error("Expected an error for binary vectors with L2")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// vectorFields returns all vector fields of the collection, vecFieldName first.
+func (c Config) vectorFields() []string {
+	return append([]string{c.vecFieldName}, c.extraVectorFields...)
+}
+
+/**
+* vectorFieldPermutations returns the dimension permutation of every additional vector field.
+* Additional vector fields hold copies of the dataset vectors with their dimensions permuted, while the first field
+* holds the unpermuted vectors. A permutation preserves every supported distance, so that all fields share the ground
+* truth of vecFieldName, while Milvus still stores, indexes and searches different data for every field.
+* The permutation of a field only depends on its position.
+ */
+func vectorFieldPermutations(vectorFields []string, dim int) map[string][]int {
+	permutations := make(map[string][]int, len(vectorFields))
+	for i, field := range vectorFields[min(1, len(vectorFields)):] {
+		permutations[field] = rand.New(rand.NewSource(int64(i + 1))).Perm(dim)
+	}
+	return permutations
+}
+
+// permuteVector moves dimension i of the vector to permutation[i], nil keeps the vector as is.
+func permuteVector(v Vector, permutation []int) Vector {
+	if permutation == nil {
+		return v
+	}
+	permuted := make(Vector, len(v))
+	for i, x := range v {
+		permuted[permutation[i]] = x
+	}
+	return permuted
+}
+
+// checkVectorFields fails early on duplicate vector fields and on combinations that only support a single one.
+func checkVectorFields(vectorFields []string, rerankFieldName string) error {
+	seen := make(map[string]bool, len(vectorFields))
+	for _, field := range vectorFields {
+		if seen[field] {
+			return fmt.Errorf("duplicate vector field %s", field)
+		}
+		seen[field] = true
+	}
+	if len(vectorFields) > 1 && rerankFieldName != "" {
+		return fmt.Errorf("re-ranking is only supported with a single vector field")
+	}
+	return nil
+}
+
+/**
+* vectorFieldChooser picks the vector field each job searches uniformly at random.
+* A nil chooser, as used for a single vector field, returns an empty field, i.e. vecFieldName.
+ */
+type vectorFieldChooser struct {
+	gen    *rand.Rand
+	fields []string
+}
+
+// newVectorFieldChooser returns nil unless there are several vector fields to choose from.
+func newVectorFieldChooser(gen *rand.Rand, fields []string) *vectorFieldChooser {
+	if len(fields) <= 1 {
+		return nil
+	}
+	return &vectorFieldChooser{gen: gen, fields: fields}
+}
+
+func (vc *vectorFieldChooser) choose() string {
+	if vc == nil {
+		return ""
+	}
+	return vc.fields[vc.gen.Intn(len(vc.fields))]
+}
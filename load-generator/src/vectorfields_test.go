@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/milvus-io/milvus/client/v2/entity"
+)
+
+func TestVectorFieldPermutations_PreserveDistances(t *testing.T) {
+	permutations := vectorFieldPermutations([]string{"vector", "title", "body"}, 16)
+	if _, ok := permutations["vector"]; ok {
+		t.Error("Expected the first vector field to be unpermuted")
+	}
+	if len(permutations["title"]) != 16 || len(permutations["body"]) != 16 {
+		t.Fatalf("Expected permutations of both additional fields, got %v", permutations)
+	}
+
+	gen := rand.New(rand.NewSource(1))
+	a, b := GenerateVector(gen, 16, 1, 0), GenerateVector(gen, 16, 1, 0)
+	for _, field := range []string{"title", "body"} {
+		pa, pb := permuteVector(a, permutations[field]), permuteVector(b, permutations[field])
+		for _, metric := range []string{metricL2, metricIP, metricHamming} {
+			distance := distanceFunc(metric)
+			// The summation order differs, so the distances may only differ by rounding
+			if math.Abs(float64(distance(a, b)-distance(pa, pb))) > 1e-4 {
+				t.Errorf("Expected field %s to preserve the %s distance", field, metric)
+			}
+		}
+	}
+	if slices.Equal(permuteVector(a, permutations["title"]), permuteVector(a, permutations["body"])) {
+		t.Error("Expected different permutations per field")
+	}
+}
+
+func TestCheckVectorFields(t *testing.T) {
+	if err := checkVectorFields([]string{"vector", "title"}, ""); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := checkVectorFields([]string{"vector", "vector"}, ""); err == nil {
+		t.Error("Expected error for a duplicate vector field")
+	}
+	if err := checkVectorFields([]string{"vector", "title"}, "vector_full"); err == nil {
+		t.Error("Expected error for re-ranking with several vector fields")
+	}
+}
+
+func TestVectorFieldChooser(t *testing.T) {
+	if chooser := newVectorFieldChooser(rand.New(rand.NewSource(1)), []string{"vector"}); chooser.choose() != "" {
+		t.Error("Expected a single vector field to search vecFieldName")
+	}
+
+	chooser := newVectorFieldChooser(rand.New(rand.NewSource(1)), []string{"vector", "title", "body"})
+	chosen := make(map[string]int)
+	for range 300 {
+		chosen[chooser.choose()]++
+	}
+	if len(chosen) != 3 {
+		t.Errorf("Expected every field to be chosen, got %v", chosen)
+	}
+}
+
+func TestSearchParameters_SearchesChosenField(t *testing.T) {
+	fields := []string{"vector", "title"}
+	params := &SearchParameters{
+		collection:   "c",
+		vecFieldName: "vector",
+		dim:          4,
+		k:            10,
+		vectorFields: fields,
+		permutations: vectorFieldPermutations(fields, 4),
+	}
+	query := Vector{1, 2, 3, 4}
+
+	searched := params.searchVector(query, "title").(entity.FloatVector)
+	if !slices.Equal(Vector(searched), permuteVector(query, params.permutations["title"])) {
+		t.Errorf("Expected the permuted query, got %v", searched)
+	}
+	if primary := params.searchVector(query, "vector").(entity.FloatVector); !slices.Equal(Vector(primary), query) {
+		t.Errorf("Expected the unpermuted query on vecFieldName, got %v", primary)
+	}
+	request, err := params.newSearchOption(query, "title", 0, false, nil, "").Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, param := range request.GetSearchParams() {
+		if param.GetKey() == "anns_field" && param.GetValue() != "title" {
+			t.Errorf("Expected search on field title, got %s", param.GetValue())
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+	"github.com/milvus-io/milvus/client/v2/entity"
+)
+
+/**
+* Data types of the vector field.
+* The dataset, the queries and the ground truth always use float32 vectors, which are only converted to the
+* vector type when they are sent to Milvus and converted back when result vectors are read.
+ */
+const (
+	vectorTypeFloat   = "float"   // FloatVector, 32 bit per dimension
+	vectorTypeFloat16 = "float16" // Float16Vector, the ground truth is computed on the unquantized vectors
+	vectorTypeBinary  = "binary"  // BinaryVector, one bit per dimension that is set for positive values
+)
+
+/**
+* checkVectorType fails early on combinations Milvus would only reject when creating the index or searching.
+* Binary vectors are packed into bytes and need a binary index with the Hamming distance.
+ */
+func checkVectorType(vectorType string, dim int, metric string, indexType string, rerank bool) error {
+	switch vectorType {
+	case vectorTypeFloat:
+		if metric == metricHamming {
+			return fmt.Errorf("distance metric %s requires vectorType %s", metricHamming, vectorTypeBinary)
+		}
+	case vectorTypeFloat16:
+		if metric == metricHamming {
+			return fmt.Errorf("distance metric %s requires vectorType %s", metricHamming, vectorTypeBinary)
+		}
+		if rerank {
+			return fmt.Errorf("re-ranking requires vectorType %s, it already indexes a float16 copy", vectorTypeFloat)
+		}
+	case vectorTypeBinary:
+		if dim%8 != 0 {
+			return fmt.Errorf("binary vectors require a dim divisible by 8, got %d", dim)
+		}
+		if metric != metricHamming {
+			return fmt.Errorf("binary vectors require distance metric %s, got %s", metricHamming, metric)
+		}
+		if indexType != indexTypeBinIvfFlat {
+			return fmt.Errorf("binary vectors require indexType %s, got %s", indexTypeBinIvfFlat, indexType)
+		}
+		if rerank {
+			return fmt.Errorf("re-ranking requires vectorType %s", vectorTypeFloat)
+		}
+	default:
+		return fmt.Errorf("unsupported vectorType %q", vectorType)
+	}
+	return nil
+}
+
+// vectorFieldType returns the schema type of a vector field holding vectors of the vector type.
+func vectorFieldType(vectorType string) entity.FieldType {
+	switch vectorType {
+	case vectorTypeFloat16:
+		return entity.FieldTypeFloat16Vector
+	case vectorTypeBinary:
+		return entity.FieldTypeBinaryVector
+	default:
+		return entity.FieldTypeFloatVector
+	}
+}
+
+// vectorBytes returns the size of a vector of the vector type as it is sent to Milvus.
+func vectorBytes(dim int, vectorType string) int {
+	switch vectorType {
+	case vectorTypeFloat16:
+		return 2 * dim
+	case vectorTypeBinary:
+		return (dim + 7) / 8
+	default:
+		return 4 * dim
+	}
+}
+
+// encodeVector converts a vector into the vector type for searching.
+func encodeVector(v Vector, vectorType string) entity.Vector {
+	switch vectorType {
+	case vectorTypeFloat16:
+		return entity.FloatVector(v).ToFloat16Vector()
+	case vectorTypeBinary:
+		return binarizeVector(v)
+	default:
+		return entity.FloatVector(v)
+	}
+}
+
+// insertValue converts a vector into the value the row-based insert expects for the vector type.
+func insertValue(v Vector, vectorType string) any {
+	switch vectorType {
+	case vectorTypeFloat16:
+		return entity.FloatVector(v).ToFloat16Vector().Serialize()
+	case vectorTypeBinary:
+		return []byte(binarizeVector(v))
+	default:
+		return []float32(v)
+	}
+}
+
+// binarizeVector packs the vector into bits, most significant bit first, a bit is set for a positive value.
+func binarizeVector(v Vector) entity.BinaryVector {
+	packed := make(entity.BinaryVector, (len(v)+7)/8)
+	for i, x := range v {
+		if x > 0 {
+			packed[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return packed
+}
+
+// decodeVectors splits the concatenated result vectors of the vector type into float32 vectors of length dim.
+func decodeVectors(vectors *schemapb.VectorField, vectorType string, dim int) []Vector {
+	switch vectorType {
+	case vectorTypeFloat16:
+		data := vectors.GetFloat16Vector()
+		bytesPerVector := 2 * dim
+		decoded := make([]Vector, 0, len(data)/bytesPerVector)
+		for start := 0; start+bytesPerVector <= len(data); start += bytesPerVector {
+			decoded = append(decoded, Vector(entity.Float16Vector(data[start:start+bytesPerVector]).ToFloat32Vector()))
+		}
+		return decoded
+	case vectorTypeBinary:
+		data := vectors.GetBinaryVector()
+		bytesPerVector := dim / 8
+		decoded := make([]Vector, 0, len(data)/bytesPerVector)
+		for start := 0; start+bytesPerVector <= len(data); start += bytesPerVector {
+			vector := make(Vector, dim)
+			for i := range vector {
+				if data[start+i/8]&(1<<(7-i%8)) != 0 {
+					vector[i] = 1
+				}
+			}
+			decoded = append(decoded, vector)
+		}
+		return decoded
+	default:
+		return splitVectors(vectors.GetFloatVector().GetData(), dim)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/milvus-io/milvus-proto/go-api/v2/schemapb"
+)
+
+func TestBinarizeVector(t *testing.T) {
+	v := Vector{1, -1, 0, 0.5, 0, 0, 0, 2, -3, 4}
+
+	packed := binarizeVector(v)
+
+	// Most significant bit first, only positive values are set, the last byte is padded
+	if len(packed) != 2 || packed[0] != 0b10010001 || packed[1] != 0b01000000 {
+		t.Errorf("Unexpected packed vector %08b", packed)
+	}
+}
+
+func TestDecodeVectors_BinaryRoundTrip(t *testing.T) {
+	first := Vector{1, -1, 0, 0.5, 0, 0, 0, 2, -3, 4, 0, 0, 1, 0, 0, 1}
+	second := Vector{-1, -1, -1, -1, -1, -1, -1, -1, 1, 1, 1, 1, 1, 1, 1, 1}
+	data := append(binarizeVector(first), binarizeVector(second)...)
+	vectors := &schemapb.VectorField{Dim: 16, Data: &schemapb.VectorField_BinaryVector{BinaryVector: data}}
+
+	decoded := decodeVectors(vectors, vectorTypeBinary, 16)
+
+	if len(decoded) != 2 {
+		t.Fatalf("Expected 2 vectors, got %d", len(decoded))
+	}
+	for i, original := range []Vector{first, second} {
+		// The decoded bits have no Hamming distance to the vector they were packed from
+		if dist := hammingDistance(decoded[i], original); dist != 0 {
+			t.Errorf("Vector %d: expected Hamming distance 0, got %v (%v)", i, dist, decoded[i])
+		}
+	}
+}
+
+func TestDecodeVectors_Float16RoundTrip(t *testing.T) {
+	original := Vector{0.5, -2, 1.25}
+	data := insertValue(original, vectorTypeFloat16).([]byte)
+	vectors := &schemapb.VectorField{Dim: 3, Data: &schemapb.VectorField_Float16Vector{Float16Vector: data}}
+
+	decoded := decodeVectors(vectors, vectorTypeFloat16, 3)
+
+	// The values are exactly representable in float16
+	if len(decoded) != 1 || decoded[0][0] != 0.5 || decoded[0][1] != -2 || decoded[0][2] != 1.25 {
+		t.Errorf("Unexpected decoded vectors %v", decoded)
+	}
+}
+
+func TestCheckVectorType(t *testing.T) {
+	valid := []struct {
+		vectorType, metric, indexType string
+		dim                           int
+	}{
+		{vectorTypeFloat, metricL2, indexTypeHNSW, 50},
+		{vectorTypeFloat16, metricCosine, indexTypeHNSW, 50},
+		{vectorTypeBinary, metricHamming, indexTypeBinIvfFlat, 64},
+	}
+	for _, c := range valid {
+		if err := checkVectorType(c.vectorType, c.dim, c.metric, c.indexType, false); err != nil {
+			t.Errorf("%s: unexpected error %v", c.vectorType, err)
+		}
+	}
+
+	invalid := []struct {
+		vectorType, metric, indexType string
+		dim                           int
+		rerank                        bool
+	}{
+		{vectorTypeBinary, metricHamming, indexTypeBinIvfFlat, 50, false}, // dim not divisible by 8
+		{vectorTypeBinary, metricL2, indexTypeBinIvfFlat, 64, false},
+		{vectorTypeBinary, metricHamming, indexTypeHNSW, 64, false},
+		{vectorTypeFloat, metricHamming, indexTypeHNSW, 64, false},
+		{vectorTypeFloat16, metricL2, indexTypeHNSW, 64, true},
+		{"int8", metricL2, indexTypeHNSW, 64, false},
+	}
+	for _, c := range invalid {
+		if err := checkVectorType(c.vectorType, c.dim, c.metric, c.indexType, c.rerank); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
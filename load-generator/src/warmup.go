@@ -5,83 +5,212 @@ import (
 	"fmt"
 	"math/rand"
 	"sync"
+	"time"
 
-	"github.com/milvus-io/milvus/client/v2/entity"
 	"github.com/milvus-io/milvus/client/v2/milvusclient"
 )
 
+// Where the warmup queries come from
+const (
+	warmupSourceRandom  = "random"  // Gaussian vectors, e.g. for experiments on synthetic data
+	warmupSourceDataset = "dataset" // vectors sampled from the dataset, which warm the parts of the index the benchmark queries hit
+)
+
+// warmupSeed offsets the seed of the warmup queries from JobGenerationParameters.seed
+const warmupSeed = 420
+
+/**
+* Warmup loads the collection and runs numberWarmupQueries closed-loop queries with the given number of workers.
+* Random warmup queries follow the query distribution of the benchmark workload in jobGenParams.
+ */
 func Warmup(
 	c *milvusclient.Client,
 	numberWarmupQueries int,
-	dim int,
-	collection string,
-	vecFieldName string,
-	k int,
-) error {
+	params *SearchParameters,
+	loadTimeout time.Duration,
+	loadRetries int,
+	tranche float64,
+	source string,
+	jitter float64,
+	datasource DataSource,
+	concurrency int,
+	jobGenParams JobGenerationParameters,
+) (*WarmupStats, error) {
 	ctx := context.Background()
 	logger, err := NewLogger("warmup")
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer logger.Close()
 	logger.Log("Warming up...")
 
 	/* Load Collection */
-	task, err := c.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(collection))
+	err = LoadCollection(c, ctx, params.collection, loadTimeout, loadRetries, logger)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	task.Await(ctx)
 
-	/* Generate Random Warmup Queries */
-	warmupJobs := generateWarmupJobs(
-		rand.New(rand.NewSource(420)),
-		dim,
-		10.0,
-		100.0,
-		numberWarmupQueries,
-	)
+	/* Generate Warmup Queries */
+	generator := rand.New(rand.NewSource(jobGenParams.seed + warmupSeed))
+	var warmupJobs []Vector
+	switch source {
+	case warmupSourceDataset:
+		warmupJobs, err = sampleWarmupQueries(generator, datasource, logger, numberWarmupQueries, jitter)
+		if err != nil {
+			return nil, err
+		}
+		logger.Logf("Sampled %d warmup queries from the dataset (jitter %.3f)", len(warmupJobs), jitter)
+	case warmupSourceRandom:
+		warmupJobs = generateWarmupJobs(generator, params.dim, jobGenParams, numberWarmupQueries)
+	default:
+		return nil, fmt.Errorf("unknown warmup query source %q, expected %q or %q",
+			source, warmupSourceRandom, warmupSourceDataset)
+	}
 
 	/* Execute Warmup Queries - closed-loop, as fast as possible */
-	executeWarmup(
+	warmupStart := time.Now()
+	latencies := executeWarmup(
 		warmupJobs,
 		c,
-		collection,
-		vecFieldName,
-		k,
+		params,
 		logger,
-		7, // number of workers
+		concurrency,
 	)
+	logger.Logf("Warmup took %v with %d workers", time.Since(warmupStart), concurrency)
+
+	/* Compare the latency at the beginning and the end of the warmup */
+	if tranche <= 0 {
+		return nil, nil
+	}
+	stats := computeWarmupStats(latencies, tranche)
+	if stats.Note != "" {
+		logger.Warnf("Warning: %s", stats.Note)
+	} else {
+		logger.Logf("Warmup reduced the mean latency by %.1f%% (%v in the first %d queries, %v in the last %d queries)",
+			stats.Reduction*100, stats.FirstTrancheMean, stats.TrancheQueries, stats.LastTrancheMean, stats.TrancheQueries)
+	}
+	return &stats, nil
+}
+
+/**
+* WarmupStats compares the mean latency of the first and the last tranche of warmup queries.
+* A warmup that does not reduce the latency is either ineffective or the collection was already warm.
+ */
+type WarmupStats struct {
+	TrancheQueries   int
+	FirstTrancheMean time.Duration
+	LastTrancheMean  time.Duration
+	Reduction        float64 // relative to the first tranche, negative if the latency increased
+	Note             string  // set if the warmup did not reduce the latency
+}
+
+// computeWarmupStats compares the first and last fraction of the latencies, failed queries (0) are skipped.
+func computeWarmupStats(latencies []time.Duration, tranche float64) WarmupStats {
+	size := int(float64(len(latencies)) * min(tranche, 0.5))
+	stats := WarmupStats{TrancheQueries: size}
+	if size == 0 {
+		stats.Note = fmt.Sprintf("too few warmup queries (%d) to measure the warmup efficacy", len(latencies))
+		return stats
+	}
 
-	return nil
+	stats.FirstTrancheMean = meanLatency(latencies[:size])
+	stats.LastTrancheMean = meanLatency(latencies[len(latencies)-size:])
+	if stats.FirstTrancheMean > 0 {
+		stats.Reduction = 1 - float64(stats.LastTrancheMean)/float64(stats.FirstTrancheMean)
+	}
+	if stats.Reduction <= 0 {
+		stats.Note = fmt.Sprintf("warmup did not reduce the mean latency (%v in the first %d queries, %v in the last %d queries)",
+			stats.FirstTrancheMean, size, stats.LastTrancheMean, size)
+	}
+	return stats
+}
+
+func meanLatency(latencies []time.Duration) time.Duration {
+	var total time.Duration
+	var count int
+	for _, latency := range latencies {
+		if latency > 0 {
+			total += latency
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
 }
 
 // generateWarmupJobs creates simple warmup jobs (without full Job struct overhead)
-func generateWarmupJobs(
-	generator *rand.Rand,
-	dim int,
-	stdDev float32,
-	mean float32,
-	numJobs int,
-) []Vector {
+func generateWarmupJobs(generator *rand.Rand, dim int, jobGenParams JobGenerationParameters, numJobs int) []Vector {
 	jobs := make([]Vector, numJobs)
 	for i := range numJobs {
-		jobs[i] = GenerateVector(generator, dim, stdDev, mean)
+		jobs[i] = jobGenParams.generateQuery(generator, dim)
 	}
 	return jobs
 }
 
-// executeWarmup runs warmup queries as fast as possible (closed-loop, no timing)
+/**
+* sampleWarmupQueries draws numQueries vectors uniformly from the dataset while streaming it, so that the dataset
+* never has to be resident at once. Each dimension of a sampled vector is shifted by Gaussian noise with the
+* standard deviation jitter, so that the warmup does not only query vectors that are in the index, 0 disables it.
+* Datasets with fewer rows than numQueries are sampled with repetition.
+ */
+func sampleWarmupQueries(
+	generator *rand.Rand,
+	datasource DataSource,
+	logger *Logger,
+	numQueries int,
+	jitter float64,
+) ([]Vector, error) {
+	// Reservoir sampling
+	reservoir := make([]Vector, 0, numQueries)
+	seen := 0
+	err := datasource.StreamDataSet(logger, collectBatchSize, func(batch []DataRow) error {
+		for _, row := range batch {
+			seen++
+			if len(reservoir) < numQueries {
+				reservoir = append(reservoir, row.Vector)
+			} else if j := generator.Intn(seen); j < numQueries {
+				reservoir[j] = row.Vector
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(reservoir) == 0 {
+		return nil, fmt.Errorf("cannot sample warmup queries from an empty dataset")
+	}
+
+	queries := make([]Vector, numQueries)
+	for i := range queries {
+		sample := reservoir[i%len(reservoir)]
+		query := make(Vector, len(sample))
+		for d, x := range sample {
+			query[d] = x
+			if jitter > 0 {
+				query[d] += float32(generator.NormFloat64() * jitter)
+			}
+		}
+		queries[i] = query
+	}
+	return queries, nil
+}
+
+/**
+* executeWarmup runs warmup queries as fast as possible (closed-loop) and returns their latencies in query order.
+* Failed queries have a latency of 0.
+ */
 func executeWarmup(
 	queries []Vector,
 	c *milvusclient.Client,
-	collection string,
-	vecFieldName string,
-	k int,
+	params *SearchParameters,
 	logger *Logger,
 	numWorkers int,
-) {
-	workChan := make(chan Vector, numWorkers*2)
+) []time.Duration {
+	workChan := make(chan int, numWorkers*2)
+	latencies := make([]time.Duration, len(queries))
 
 	var wg sync.WaitGroup
 	for i := range numWorkers {
@@ -90,26 +219,25 @@ func executeWarmup(
 			defer wg.Done()
 			ctx := context.Background()
 			for query := range workChan {
-				_, err := c.Search(ctx,
-					milvusclient.NewSearchOption(
-						collection,
-						k,
-						[]entity.Vector{entity.FloatVector(query)},
-					).WithANNSField(vecFieldName),
-				)
+				// Same search options as the benchmark, so that the filter path is warm as well
+				start := time.Now()
+				_, err := c.Search(ctx, params.newSearchOption(queries[query], "", 0, false, nil, ""))
 				if err != nil {
-					logger.Logf("Warmup worker %d: error: %v", workerId, err)
+					logger.Errorf("Warmup worker %d: error: %v", workerId, err)
+					continue
 				}
+				latencies[query] = time.Since(start)
 			}
 		}(i)
 	}
 
 	// Feed queries to workers
-	for _, query := range queries {
+	for query := range queries {
 		workChan <- query
 	}
 	close(workChan)
 
 	wg.Wait()
 	logger.Log(fmt.Sprintf("Warmup completed: %d queries executed", len(queries)))
+	return latencies
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeWarmupStats_Reduction(t *testing.T) {
+	latencies := []time.Duration{
+		40 * time.Millisecond, 0, // failed queries are skipped
+		20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond,
+		10 * time.Millisecond, 10 * time.Millisecond,
+	}
+
+	stats := computeWarmupStats(latencies, 0.25)
+
+	if stats.TrancheQueries != 2 {
+		t.Errorf("Expected tranches of 2 queries, got %d", stats.TrancheQueries)
+	}
+	if stats.FirstTrancheMean != 40*time.Millisecond || stats.LastTrancheMean != 10*time.Millisecond {
+		t.Errorf("Unexpected tranche means: %v, %v", stats.FirstTrancheMean, stats.LastTrancheMean)
+	}
+	if stats.Reduction != 0.75 || stats.Note != "" {
+		t.Errorf("Expected a reduction of 75%% without a note, got %+v", stats)
+	}
+}
+
+func TestComputeWarmupStats_NoReduction(t *testing.T) {
+	latencies := []time.Duration{10 * time.Millisecond, 12 * time.Millisecond, 11 * time.Millisecond, 12 * time.Millisecond}
+
+	stats := computeWarmupStats(latencies, 0.5)
+
+	if stats.Reduction >= 0 || stats.Note == "" {
+		t.Errorf("Expected a warning for an increased latency, got %+v", stats)
+	}
+}
+
+func TestComputeWarmupStats_TooFewQueries(t *testing.T) {
+	stats := computeWarmupStats([]time.Duration{time.Millisecond}, 0.1)
+	if stats.TrancheQueries != 0 || stats.Note == "" {
+		t.Errorf("Expected a note for too few queries, got %+v", stats)
+	}
+}
+
+func TestSampleWarmupQueries_FromDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("a 1 1\nb 2 2\nc 3 3\nd 4 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := DataReader{sourceFile: path, idSource: idSourceSequential, duplicateIds: duplicateIdsError}
+
+	queries, err := sampleWarmupQueries(rand.New(rand.NewSource(1)), source, nil, 3, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(queries) != 3 {
+		t.Fatalf("Expected 3 queries, got %d", len(queries))
+	}
+	sampled := make(map[float32]bool)
+	for _, query := range queries {
+		// Without jitter, every query is a distinct dataset vector
+		if len(query) != 2 || query[0] != query[1] || query[0] < 1 || query[0] > 4 || sampled[query[0]] {
+			t.Errorf("Unexpected query %v", query)
+		}
+		sampled[query[0]] = true
+	}
+}
+
+func TestSampleWarmupQueries_JitterAndRepetition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("a 1 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := DataReader{sourceFile: path, idSource: idSourceSequential, duplicateIds: duplicateIdsError}
+
+	queries, err := sampleWarmupQueries(rand.New(rand.NewSource(1)), source, nil, 2, 0.01)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The single row is repeated, each time with its own small noise
+	if len(queries) != 2 || queries[0][0] == queries[1][0] {
+		t.Errorf("Expected two differently jittered queries, got %v", queries)
+	}
+	for _, query := range queries {
+		if query[0] < 0.9 || query[0] > 1.1 {
+			t.Errorf("Expected a small jitter around 1, got %v", query)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/**
+* compare prints the recall and latency of two output directories side by side, e.g. to answer whether a change of
+* the index configuration helped. Both directories need their enhanced-results.parquet, i.e. the recall must have been
+* calculated after the benchmark or by a previous run of this tool.
+ */
+func compare(baseline string, candidate string) error {
+	var runs [2]runComparison
+	for i, dir := range []string{baseline, candidate} {
+		results, err := parquet.ReadFile[EnhancedJobResult](filepath.Join(dir, "enhanced-results.parquet"))
+		if err != nil {
+			return fmt.Errorf("failed to read the enhanced results of %s: %w", dir, err)
+		}
+		runs[i] = newRunComparison(results)
+	}
+	printComparison(os.Stdout, filepath.Base(baseline), filepath.Base(candidate), runs[0], runs[1])
+	return nil
+}
+
+/**
+* runComparison holds the samples of a run that are compared. Session steps that never ran are left out, and so are the
+* recalls of queries without results.
+ */
+type runComparison struct {
+	k         int
+	recalls   map[string][]float64 // by query kind, "overall" for all queries
+	latencies []float64            // in milliseconds, sorted
+}
+
+func newRunComparison(results []EnhancedJobResult) runComparison {
+	run := runComparison{recalls: make(map[string][]float64)}
+	for _, result := range results {
+		if !executed(result) {
+			continue
+		}
+		run.latencies = append(run.latencies, float64(result.Latency)/float64(time.Millisecond))
+		if result.Recall < 0 {
+			continue
+		}
+		run.k = max(run.k, len(result.ResultIds))
+		run.recalls["overall"] = append(run.recalls["overall"], result.Recall)
+		run.recalls[result.QueryKind] = append(run.recalls[result.QueryKind], result.Recall)
+	}
+	slices.Sort(run.latencies)
+	return run
+}
+
+/**
+* executed reports whether a query ran, session steps that never ran have no start timestamp. Parquet stores the zero
+* time as an overflowed nanosecond timestamp, which is read back as a time before the Unix epoch.
+ */
+func executed(result EnhancedJobResult) bool {
+	return !result.StartTimestamp.IsZero() && result.StartTimestamp.After(time.Unix(0, 0))
+}
+
+func printComparison(out io.Writer, baselineName string, candidateName string, baseline runComparison, candidate runComparison) {
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(table, "metric\t%s\t%s\tdelta\tdelta %%\tsignificant\t\n", baselineName, candidateName)
+	row := func(name string, a float64, b float64, significance string) {
+		relative := "-"
+		if a != 0 {
+			relative = fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+		}
+		fmt.Fprintf(table, "%s\t%.4f\t%.4f\t%+.4f\t%s\t%s\t\n", name, a, b, b-a, relative, significance)
+	}
+
+	fmt.Fprintf(table, "k\t%d\t%d\t\t\t\t\n", baseline.k, candidate.k)
+	fmt.Fprintf(table, "queries\t%d\t%d\t\t\t\t\n", len(baseline.latencies), len(candidate.latencies))
+	for _, kind := range []string{"overall", queryKindIndependent, queryKindSessionFirst, queryKindSessionFollowUp} {
+		a, b := baseline.recalls[kind], candidate.recalls[kind]
+		if len(a) == 0 && len(b) == 0 {
+			continue
+		}
+		row(fmt.Sprintf("recall@%d %s", max(baseline.k, candidate.k), kind), mean(a), mean(b), significance(a, b))
+	}
+	row("latency mean (ms)", mean(baseline.latencies), mean(candidate.latencies), significance(baseline.latencies, candidate.latencies))
+	for _, p := range []float64{50, 90, 95, 99} {
+		// Percentiles are compared without a test, only the means are
+		row(fmt.Sprintf("latency p%g (ms)", p), percentile(baseline.latencies, p), percentile(candidate.latencies, p), "")
+	}
+	table.Flush()
+	fmt.Fprintln(out, "significant: * at p < 0.05, ** at p < 0.01 (Welch's t-test of the means)")
+}
+
+func mean(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, sample := range samples {
+		sum += sample
+	}
+	return sum / float64(len(samples))
+}
+
+// percentile uses the nearest rank like the load generator, the samples must be sorted.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
+
+/**
+* significance tests whether the means of two samples differ with Welch's t-test. Benchmark runs have thousands
+* of queries, so the t-distribution is approximated by the normal distribution.
+ */
+func significance(a []float64, b []float64) string {
+	if len(a) < 2 || len(b) < 2 {
+		return ""
+	}
+	standardError := math.Sqrt(variance(a)/float64(len(a)) + variance(b)/float64(len(b)))
+	if standardError == 0 {
+		return ""
+	}
+	z := math.Abs(mean(a)-mean(b)) / standardError
+	switch {
+	case z > 2.576:
+		return "**"
+	case z > 1.960:
+		return "*"
+	default:
+		return ""
+	}
+}
+
+// variance is the unbiased sample variance.
+func variance(samples []float64) float64 {
+	m := mean(samples)
+	var squaredDeviations float64
+	for _, sample := range samples {
+		squaredDeviations += (sample - m) * (sample - m)
+	}
+	return squaredDeviations / float64(len(samples)-1)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSignificance(t *testing.T) {
+	// Both samples have a variance of 2, so the standard error is sqrt(2) and z is the difference of the means / 1.414
+	cases := map[string]struct {
+		a, b     []float64
+		expected string
+	}{
+		"z 2.76":          {[]float64{0, 2}, []float64{3.9, 5.9}, "**"},
+		"z 2.47":          {[]float64{0, 2}, []float64{3.5, 5.5}, "*"},
+		"z 1.41":          {[]float64{0, 2}, []float64{2, 4}, ""},
+		"negative z 2.76": {[]float64{3.9, 5.9}, []float64{0, 2}, "**"},
+		"identical":       {[]float64{1, 1}, []float64{1, 1}, ""},
+		"single sample":   {[]float64{0}, []float64{10, 11}, ""},
+		"no samples":      {nil, []float64{10, 11}, ""},
+	}
+	for name, c := range cases {
+		if significance := significance(c.a, c.b); significance != c.expected {
+			t.Errorf("%s: expected %q, got %q", name, c.expected, significance)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	cases := []struct {
+		samples  []float64
+		p        float64
+		expected float64
+	}{
+		{sorted, 0, 1},
+		{sorted, 50, 5},
+		{sorted, 90, 9},
+		{sorted, 95, 10},
+		{sorted, 99, 10},
+		{sorted, 100, 10},
+		{[]float64{7}, 50, 7},
+		{nil, 50, 0},
+	}
+	for _, c := range cases {
+		if percentile := percentile(c.samples, c.p); percentile != c.expected {
+			t.Errorf("p%g of %v: expected %g, got %g", c.p, c.samples, c.expected, percentile)
+		}
+	}
+}
+
+func TestVariance(t *testing.T) {
+	if variance := variance([]float64{2, 4, 4, 4, 5, 5, 7, 9}); variance != 32.0/7 {
+		t.Errorf("Expected the unbiased variance 32/7, got %g", variance)
+	}
+}
+
+func TestNewRunComparison(t *testing.T) {
+	start := time.Now()
+	results := []EnhancedJobResult{
+		{Job: Job{StartTimestamp: start, ResultIds: make([]int64, 10), Latency: 3 * time.Millisecond}, Recall: 0.8, QueryKind: queryKindIndependent},
+		{Job: Job{StartTimestamp: start, ResultIds: make([]int64, 10), Latency: time.Millisecond}, Recall: 1.0, QueryKind: queryKindSessionFirst},
+		{Job: Job{StartTimestamp: start, Latency: 2 * time.Millisecond, TimedOut: true}, Recall: -1, QueryKind: queryKindIndependent},
+		// Steps of a truncated session that never ran, as created and as read back from parquet
+		{Recall: -1, QueryKind: queryKindSessionFollowUp},
+		{Job: Job{StartTimestamp: time.Unix(0, time.Time{}.UnixNano())}, Recall: -1, QueryKind: queryKindSessionFollowUp},
+	}
+
+	run := newRunComparison(results)
+
+	if run.k != 10 || !slices.Equal(run.latencies, []float64{1, 2, 3}) {
+		t.Errorf("Expected k 10 and the sorted latencies of all executed queries, got %d and %v", run.k, run.latencies)
+	}
+	if !slices.Equal(run.recalls["overall"], []float64{0.8, 1.0}) || !slices.Equal(run.recalls[queryKindIndependent], []float64{0.8}) {
+		t.Errorf("Expected the recalls of the queries with results by kind, got %v", run.recalls)
+	}
+}
+
+func TestPrintComparison(t *testing.T) {
+	baseline := runComparison{
+		k:         10,
+		recalls:   map[string][]float64{"overall": {0.9, 0.9}, queryKindIndependent: {0.9, 0.9}},
+		latencies: []float64{1, 2, 3, 4},
+	}
+	candidate := runComparison{
+		k:         10,
+		recalls:   map[string][]float64{"overall": {0.95, 0.95}, queryKindIndependent: {0.95, 0.95}},
+		latencies: []float64{3, 5, 7, 9}, // z = 3.5 / 1.443 = 2.43
+	}
+
+	var out bytes.Buffer
+	printComparison(&out, "config1", "config2", baseline, candidate)
+
+	expected := "" +
+		"                 metric  config1  config2    delta  delta %  significant\n" +
+		"                      k       10       10                               \n" +
+		"                queries        4        4                               \n" +
+		"      recall@10 overall   0.9000   0.9500  +0.0500    +5.6%             \n" +
+		"  recall@10 independent   0.9000   0.9500  +0.0500    +5.6%             \n" +
+		"      latency mean (ms)   2.5000   6.0000  +3.5000  +140.0%            *\n" +
+		"       latency p50 (ms)   2.0000   5.0000  +3.0000  +150.0%             \n" +
+		"       latency p90 (ms)   4.0000   9.0000  +5.0000  +125.0%             \n" +
+		"       latency p95 (ms)   4.0000   9.0000  +5.0000  +125.0%             \n" +
+		"       latency p99 (ms)   4.0000   9.0000  +5.0000  +125.0%             \n" +
+		"significant: * at p < 0.05, ** at p < 0.01 (Welch's t-test of the means)\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected comparison:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
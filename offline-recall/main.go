@@ -3,8 +3,23 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
+	"math"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"text/tabwriter"
+	"slices"
+	"maps"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/parquet-go/parquet-go"
 )
@@ -12,18 +27,31 @@ import (
 type Vector []float32
 
 type DataRow struct {
-	Id     int64
-	Vector Vector
-	Word   string
+	Id        int64
+	Vector    Vector
+	Word      string
+	Partition int // index of the partition the row is inserted into, 0 without partitions
+	Scalars   map[string]any // values of the additional scalar fields by field name, nil without scalar fields
 }
 
 type Job struct {
 	Id              string // Unique identifier (for independent jobs: "J-{index}", for session jobs: "S-{sessionId}-{step}")
 	QueryVector     Vector
 	ResultIds       []int64
+	ResultStringIds []string // Only set if the collection uses VarChar primary keys, recall requires int keys
+	ResultScores    []float32 // Distances or similarities reported by Milvus, in the order of the result ids
 	Latency         time.Duration
 	StartTimestamp  time.Time
 	SchedulingDelay time.Duration // Time between scheduled arrival and actual execution start
+	Stage           int           // Index of the concurrency stage the job was executed in
+	Phase           int           // Index of the benchmark phase the job was executed in
+	CandidateIds    []int64       // First-stage ids in approximate order, only set with re-ranking and rerankRecall
+	Retries         int           // Number of failed attempts before the search succeeded, included in the latency
+	Partitions      []int         // Partitions the search is restricted to, nil searches all partitions
+	Filter          string        // Scalar filter of this search on top of the configured filterExpr, empty if unfiltered
+	VectorField     string        // Vector field the search runs on, empty for vecFieldName, joined by "+" for hybrid jobs
+	SearchEffort    int           // ef, nprobe or itopkSize of a swept search, 0 if the configured value applies
+	TimedOut        bool          // the search exceeded the query timeout, the latency is the timeout and there are no results
 }
 
 type UserSession struct {
@@ -31,13 +59,28 @@ type UserSession struct {
 	Jobs            []Job
 	StartTimestamp  time.Time
 	Duration        time.Duration
-	SchedulingDelay time.Duration // Time between scheduled arrival and actual execution start
+	SchedulingDelay time.Duration // Sum of the scheduling delays of all executed steps, see Job.SchedulingDelay for each step
+	Truncated       bool          // the benchmark ended before all steps were executed, only the executed steps have results
 
 	currentStep      int
 	continuationChan chan *UserSession
 }
 
 func main() {
+	// recall-calc compare <baseline dir> <candidate dir> compares the enhanced results of two runs
+	if (len(os.Args) > 1 && os.Args[1] == "compare") {
+		if (len(os.Args) != 4) {
+			fmt.Println("usage: recall-calc compare <baseline dir> <candidate dir>")
+			os.Exit(2)
+		}
+		err := compare(os.Args[2], os.Args[3])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	basePath := os.Args[1]
 	if (basePath == "") {
 		panic(fmt.Errorf("basePath is required"))
@@ -48,33 +91,169 @@ func main() {
 		panic(err)
 	}
 
+	// Every directory already calculates its recall on all CPUs, running a few at once mainly overlaps their I/O
+	parallelism := max(1, runtime.NumCPU()/4)
+	if (len(os.Args) > 2) {
+		parallelism, err = strconv.Atoi(os.Args[2])
+		if err != nil || parallelism < 1 {
+			panic(fmt.Errorf("parallelism must be a positive number, got %q", os.Args[2]))
+		}
+	}
+
+	var mu sync.Mutex
+	summaries := make(map[string]RecallSummary)
+	var failed []string
+	skipped := 0
+	dirs := make(chan os.DirEntry)
+	var wg sync.WaitGroup
+	for range parallelism {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range dirs {
+				// A failing directory is reported at the end instead of aborting the others
+				summary, outcome := recall(basePath, entry)
+				mu.Lock()
+				switch outcome {
+				case recallDone:
+					summaries[entry.Name()] = summary
+				case recallFailed:
+					failed = append(failed, entry.Name())
+					skipped++
+				default:
+					skipped++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
 	for _, entry := range entries {
-		recall(basePath, entry)
+		if (entry.IsDir()) {
+			dirs <- entry
+		}
+	}
+	close(dirs)
+	wg.Wait()
+
+	if (len(summaries) == 0) {
+		// Most likely the wrong base path, which a script should not mistake for success
+		fmt.Printf("no directory of %s was processed, %d skipped\n", basePath, skipped)
+		os.Exit(1)
+	}
+
+	// The combined summary answers which of the processed runs recalled best at a glance
+	combined := RecallSummaries{
+		Directories: summaries,
+		Combined:    MergeRecallSummaries(slices.Collect(maps.Values(summaries))...),
+	}
+	printRecallTable(combined)
+	err = writeRecallSummary(filepath.Join(basePath, "recall-summary.json"), combined)
+	if err != nil {
+		fmt.Printf("failed to write the combined recall-summary.json: %v\n", err)
+	}
+	if (len(failed) > 0) {
+		slices.Sort(failed)
+		fmt.Printf("failed to process %d directories: %s\n", len(failed), strings.Join(failed, ", "))
+		os.Exit(1)
 	}
+}
 
+// RecallSummaries is written to recall-summary.json in the base path, next to the per-directory summaries.
+type RecallSummaries struct {
+	Directories map[string]RecallSummary
+	Combined    RecallSummary
 }
 
-func recall(basePath string, entry os.DirEntry) {
-	if (!entry.IsDir()) {
-		return
+func printRecallTable(summaries RecallSummaries) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "directory\tk\tqueries\tmean recall\tmin recall\tmax recall\t")
+	row := func(name string, summary RecallSummary) {
+		overall := summary.Overall
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.4f\t%.4f\t%.4f\t\n", name, summary.K, overall.Count,
+			overall.MeanRecall, overall.MinRecall, overall.MaxRecall)
+	}
+	for _, name := range slices.Sorted(maps.Keys(summaries.Directories)) {
+		row(name, summaries.Directories[name])
+	}
+	row("combined", summaries.Combined)
+	table.Flush()
+}
+
+func writeRecallSummary(path string, summary any) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+type recallOutcome int
+
+// Outcomes of processing an output directory, every outcome but recallDone skips the directory
+const (
+	recallDone          recallOutcome = iota
+	recallExisting                    // the recall was calculated after the benchmark, no jobs were persisted
+	recallMissingInputs               // the data rows or the jobs and sessions were never written
+	recallFailed                      // the inputs exist but could not be read
+)
+
+// recall writes the enhanced results and the recall summary of an output directory.
+func recall(basePath string, entry os.DirEntry) (RecallSummary, recallOutcome) {
+	dir := filepath.Join(basePath, entry.Name())
+	segments, _ := filepath.Glob(filepath.Join(dir, "jobs-sessions-*.gob"))
+	if (!exists(filepath.Join(dir, "jobs-sessions.gob")) && len(segments) == 0) {
+		if (exists(filepath.Join(dir, "enhanced-results.parquet"))) {
+			fmt.Printf("%s: skipped, the recall was already calculated after the benchmark\n", entry.Name())
+			return RecallSummary{}, recallExisting
+		}
+		fmt.Printf("%s: skipped, missing jobs-sessions.gob\n", entry.Name())
+		return RecallSummary{}, recallMissingInputs
 	}
+	if (!exists(filepath.Join(dir, "data-rows.gob")) && !exists(filepath.Join(dir, "data-rows.ref.json"))) {
+		fmt.Printf("%s: skipped, missing data-rows.gob\n", entry.Name())
+		return RecallSummary{}, recallMissingInputs
+	}
+
 	dataRows, err:= readDataRows(basePath, entry)
 	if err != nil {
-		return
+		fmt.Printf("%s: skipped, failed to read the data rows: %v\n", entry.Name(), err)
+		return RecallSummary{}, recallFailed
 	}
-	jobs, sessions, err := readJobsAndSessions(basePath, entry)
+	jobs, sessions, metric, err := readJobsAndSessions(basePath, entry)
 	if err != nil {
-		return
+		fmt.Printf("%s: skipped, failed to read the jobs and sessions: %v\n", entry.Name(), err)
+		return RecallSummary{}, recallFailed
 	}
 
 	sessionJobs := mapSessionsToJobs(sessions)
 	allJobs := append(jobs, sessionJobs...)
 
-	enhancedResults := EnhanceJobResults(dataRows, allJobs)
+	options := DefaultRecallOptions()
+	if (metric != "") { // runs persisted before the metric was recorded used L2
+		options.Metric = metric
+	}
+	enhancedResults := EnhanceJobResults(dataRows, allJobs, options)
+	summary := SummarizeRecall(enhancedResults, options)
+	fmt.Printf("%s: mean recall overall=%.4f, independent=%.4f, session-first=%.4f, session-follow-up=%.4f\n", entry.Name(),
+		summary.Overall.MeanRecall, summary.Independent.MeanRecall, summary.SessionFirst.MeanRecall, summary.SessionFollowUp.MeanRecall)
+	if (summary.Retried.Count > 0) {
+		fmt.Printf("%s: mean recall first-try=%.4f, retried=%.4f (%d retried jobs)\n", entry.Name(),
+			summary.FirstTry.MeanRecall, summary.Retried.MeanRecall, summary.Retried.Count)
+	}
 	err = parquet.WriteFile(fmt.Sprintf("%s/%s/enhanced-results.parquet", basePath, entry.Name()), enhancedResults)
 	if err != nil {
 		fmt.Printf("failed to write enhanced-results.parquet for %s: %v\n", entry.Name(), err)
 	}
+	err = writeRecallSummary(fmt.Sprintf("%s/%s/recall-summary.json", basePath, entry.Name()), summary)
+	if err != nil {
+		fmt.Printf("failed to write recall-summary.json for %s: %v\n", entry.Name(), err)
+	}
+	return summary, recallDone
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 func mapSessionsToJobs(sessions []UserSession) (jobs []Job) {
@@ -85,29 +264,102 @@ func mapSessionsToJobs(sessions []UserSession) (jobs []Job) {
 }
 
 func readDataRows(basePath string, entry os.DirEntry) ([]DataRow, error) {
-	dataRows, err := os.Open(fmt.Sprintf("%s/%s/data-rows.gob", basePath, entry.Name()))
+	path := fmt.Sprintf("%s/%s/data-rows.gob", basePath, entry.Name())
+	// Runs with shared data rows only keep a reference to them
+	var ref struct {
+		Path        string
+		Fingerprint string
+	}
+	refData, err := os.ReadFile(fmt.Sprintf("%s/%s/data-rows.ref.json", basePath, entry.Name()))
+	if err == nil {
+		err = json.Unmarshal(refData, &ref)
+		if err != nil {
+			fmt.Printf("invalid data-rows.ref.json for %s: %v\n", entry.Name(), err)
+			return nil, err
+		}
+		path = ref.Path
+	}
+
+	dataRows, err := os.Open(path)
 	if err != nil {
-		fmt.Printf("failed to open data-rows.gob for %s: %v\n", entry.Name(), err)
 		return nil, err
 	}
 	defer dataRows.Close()
+	// The rows are persisted as a sequence of batches
 	decoder := gob.NewDecoder(dataRows)
 	var rows []DataRow
-	err = decoder.Decode(&rows)
+	for {
+		var batch []DataRow
+		err = decoder.Decode(&batch)
+		if (err != nil) {
+			break
+		}
+		rows = append(rows, batch...)
+	}
+	if (errors.Is(err, io.EOF)) {
+		err = nil
+	}
+	if err == nil && ref.Fingerprint != "" && fingerprintDataRows(rows) != ref.Fingerprint {
+		err = fmt.Errorf("shared data rows %s do not match the dataset of %s", path, entry.Name())
+		fmt.Println(err)
+	}
 	return rows, err
 }
 
-func readJobsAndSessions(basePath string, entry os.DirEntry) ([]Job, []UserSession, error) {
-	gobFile, err := os.Open(fmt.Sprintf("%s/%s/jobs-sessions.gob", basePath, entry.Name()))
+// fingerprintDataRows must match the fingerprint of the load generator.
+func fingerprintDataRows(rows []DataRow) string {
+	hash := sha256.New()
+	buf := make([]byte, 8)
+	for _, row := range rows {
+		binary.LittleEndian.PutUint64(buf, uint64(row.Id))
+		hash.Write(buf)
+		binary.LittleEndian.PutUint64(buf, uint64(len(row.Word)))
+		hash.Write(buf)
+		hash.Write([]byte(row.Word))
+		binary.LittleEndian.PutUint64(buf, uint64(row.Partition))
+		hash.Write(buf)
+		for _, v := range row.Vector {
+			binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(v))
+			hash.Write(buf[:4])
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func readJobsAndSessions(basePath string, entry os.DirEntry) ([]Job, []UserSession, string, error) {
+	paths := []string{fmt.Sprintf("%s/%s/jobs-sessions.gob", basePath, entry.Name())}
+	// Long runs may have spilled their results to several segments instead
+	segments, err := filepath.Glob(fmt.Sprintf("%s/%s/jobs-sessions-*.gob", basePath, entry.Name()))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", err
+	}
+	if (len(segments) > 0) {
+		paths = segments
 	}
 
-	var decoded struct {
-		Jobs     []Job
-		Sessions []UserSession
+	var jobs []Job
+	var sessions []UserSession
+	var metric string
+	for _, path := range paths {
+		gobFile, err := os.Open(path)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		var decoded struct {
+			Jobs     []Job
+			Sessions []UserSession
+			Metric   string
+		}
+		decoder := gob.NewDecoder(gobFile)
+		err = decoder.Decode(&decoded)
+		gobFile.Close()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		jobs = append(jobs, decoded.Jobs...)
+		sessions = append(sessions, decoded.Sessions...)
+		metric = decoded.Metric
 	}
-	decoder := gob.NewDecoder(gobFile)
-	err = decoder.Decode(&decoded)
-	return decoded.Jobs, decoded.Sessions, err
+	return jobs, sessions, metric, nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// outputDir creates an output directory with the given files and returns its entry in basePath.
+func outputDir(t *testing.T, basePath string, name string, files map[string][]byte) os.DirEntry {
+	t.Helper()
+	dir := filepath.Join(basePath, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return entry
+		}
+	}
+	t.Fatalf("Directory %s not found", name)
+	return nil
+}
+
+// gobFile encodes the values one after another, like the load generator persists its outputs.
+func gobFile(t *testing.T, values ...any) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file.gob")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := gob.NewEncoder(file)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRecall_Outcomes(t *testing.T) {
+	basePath := t.TempDir()
+	rows := gobFile(t, []DataRow{{Id: 1, Vector: Vector{1, 0}}, {Id: 2, Vector: Vector{2, 0}}})
+	jobsAndSessions := gobFile(t, struct {
+		Jobs     []Job
+		Sessions []UserSession
+		Metric   string
+	}{
+		Jobs:   []Job{{Id: "J-0", QueryVector: Vector{0, 0}, ResultIds: []int64{1}, Latency: time.Millisecond}},
+		Metric: metricL2,
+	})
+
+	cases := map[string]struct {
+		files    map[string][]byte
+		expected recallOutcome
+	}{
+		"done":             {map[string][]byte{"data-rows.gob": rows, "jobs-sessions.gob": jobsAndSessions}, recallDone},
+		"existing":         {map[string][]byte{"enhanced-results.parquet": {}}, recallExisting},
+		"missing jobs":     {map[string][]byte{"data-rows.gob": rows}, recallMissingInputs},
+		"missing rows":     {map[string][]byte{"jobs-sessions.gob": jobsAndSessions}, recallMissingInputs},
+		"unreadable rows":  {map[string][]byte{"data-rows.gob": []byte("garbage"), "jobs-sessions.gob": jobsAndSessions}, recallFailed},
+		"unreadable jobs":  {map[string][]byte{"data-rows.gob": rows, "jobs-sessions.gob": []byte("garbage")}, recallFailed},
+		"empty directory":  {nil, recallMissingInputs},
+		"spilled segments": {map[string][]byte{"data-rows.gob": rows, "jobs-sessions-0000.gob": jobsAndSessions}, recallDone},
+	}
+	for name, c := range cases {
+		summary, outcome := recall(basePath, outputDir(t, basePath, name, c.files))
+		if outcome != c.expected {
+			t.Errorf("%s: expected outcome %d, got %d", name, c.expected, outcome)
+		}
+		if outcome != recallDone {
+			continue
+		}
+		if summary.Overall.Count != 1 || summary.Overall.MeanRecall != 1.0 {
+			t.Errorf("%s: expected the recall of the single job, got %+v", name, summary.Overall)
+		}
+		for _, file := range []string{"enhanced-results.parquet", "recall-summary.json"} {
+			if !exists(filepath.Join(basePath, name, file)) {
+				t.Errorf("%s: expected %s to be written", name, file)
+			}
+		}
+	}
+}
@@ -1,17 +1,122 @@
 package main
 
 import (
+	"cmp"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// EnhancedJobResult extends Job with the calculated recall metric.
+// EnhancedJobResult extends Job with the calculated recall metrics.
 type EnhancedJobResult struct {
 	Job
-	Recall float64
+	Recall           float64
+	FirstStageRecall float64 // recall of the top candidates before re-ranking, -1 without candidates
+	QueryKind        string  // independent, session-first or session-follow-up
+	Step             int     // index of the query within its session, -1 for independent jobs
+}
+
+// Kinds of queries that are summarized separately, since session follow-ups drift from the previous result
+const (
+	queryKindIndependent     = "independent"
+	queryKindSessionFirst    = "session-first"
+	queryKindSessionFollowUp = "session-follow-up"
+)
+
+// queryKind classifies a job by its Id, session jobs are encoded as "S-{sessionId}-{step}".
+func queryKind(job Job) (kind string, step int) {
+	if !strings.HasPrefix(job.Id, "S-") {
+		return queryKindIndependent, -1
+	}
+	step, err := strconv.Atoi(job.Id[strings.LastIndex(job.Id, "-")+1:])
+	if err != nil {
+		return queryKindIndependent, -1
+	}
+	if step == 0 {
+		return queryKindSessionFirst, step
+	}
+	return queryKindSessionFollowUp, step
+}
+
+// Distance metrics supported by the ground-truth computation, named like the Milvus metric types
+const (
+	metricL2      = "L2"
+	metricIP      = "IP"
+	metricCosine  = "COSINE"
+	metricHamming = "HAMMING" // of binary vectors, a dimension is set if its float value is positive
+)
+
+/**
+* distanceFunc returns the distance function of the metric, for all metrics a smaller distance is closer.
+* Similarities (IP, COSINE) are negated to fit the ascending order of sortedNeighbors.
+ */
+func distanceFunc(metric string) func(a []float32, b []float32) float32 {
+	switch metric {
+	case metricIP:
+		return negativeInnerProduct
+	case metricCosine:
+		return negativeCosineSimilarity
+	case metricHamming:
+		return hammingDistance
+	default:
+		return euclideanDistance
+	}
+}
+
+/**
+* mismatchedDistance is the distance of vectors of different lengths under every metric, e.g. after a parsing bug.
+* Such rows are never neighbors instead of reading out of bounds, see checkDimensions for the offending ids.
+ */
+var mismatchedDistance = float32(math.Inf(1))
+
+func negativeInnerProduct(a []float32, b []float32) (dist float32) {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
+	for i := range a {
+		dist -= a[i] * b[i]
+	}
+	return
+}
+
+func negativeCosineSimilarity(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(-dot / math.Sqrt(normA*normB))
+}
+
+// normalizeVector returns a copy of the vector scaled to unit length, so that the inner product equals the cosine similarity.
+func normalizeVector(v Vector) Vector {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	normalized := make(Vector, len(v))
+	if norm == 0 {
+		return normalized
+	}
+	scale := 1 / math.Sqrt(norm)
+	for i, x := range v {
+		normalized[i] = float32(float64(x) * scale)
+	}
+	return normalized
 }
 
 /**
@@ -19,6 +124,9 @@ type EnhancedJobResult struct {
 * However, since we only care about relative distances, we may omit the square root for performance
  */
 func euclideanDistance(a []float32, b []float32) (dist float32) {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
 	for i := range a {
 		diff := a[i] - b[i]
 		dist += diff * diff
@@ -26,6 +134,77 @@ func euclideanDistance(a []float32, b []float32) (dist float32) {
 	return
 }
 
+/**
+* unrolledDistanceFunc returns distance functions processing four dimensions per iteration with independent
+* accumulators, which the CPU pipelines instead of waiting for every addition of the scalar loop.
+* The summation order differs from distanceFunc, so distances may differ in the last bits and break ties differently.
+* Metrics without an unrolled implementation fall back to distanceFunc.
+ */
+func unrolledDistanceFunc(metric string) func(a []float32, b []float32) float32 {
+	switch metric {
+	case metricIP:
+		return negativeInnerProductUnrolled
+	case metricCosine, metricHamming:
+		return distanceFunc(metric)
+	default:
+		return euclideanDistanceUnrolled
+	}
+}
+
+func euclideanDistanceUnrolled(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
+	var s0, s1, s2, s3 float32
+	// Fixed-size subslices let the compiler drop the bounds checks
+	for len(a) >= 4 {
+		a4, b4 := a[:4:4], b[:4:4]
+		d0, d1, d2, d3 := a4[0]-b4[0], a4[1]-b4[1], a4[2]-b4[2], a4[3]-b4[3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+		a, b = a[4:], b[4:]
+	}
+	for i := range a {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+	return (s0 + s1) + (s2 + s3)
+}
+
+func negativeInnerProductUnrolled(a []float32, b []float32) float32 {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
+	var s0, s1, s2, s3 float32
+	for len(a) >= 4 {
+		a4, b4 := a[:4:4], b[:4:4]
+		s0 += a4[0] * b4[0]
+		s1 += a4[1] * b4[1]
+		s2 += a4[2] * b4[2]
+		s3 += a4[3] * b4[3]
+		a, b = a[4:], b[4:]
+	}
+	for i := range a {
+		s0 += a[i] * b[i]
+	}
+	return -((s0 + s1) + (s2 + s3))
+}
+
+// hammingDistance counts the dimensions that differ once both vectors are binarized like the binary vector field.
+func hammingDistance(a []float32, b []float32) (dist float32) {
+	if len(a) != len(b) {
+		return mismatchedDistance
+	}
+	for i := range a {
+		if (a[i] > 0) != (b[i] > 0) {
+			dist++
+		}
+	}
+	return
+}
+
 type neighbor struct {
 	id       int64
 	distance float32
@@ -40,11 +219,12 @@ type sortedNeighbors []neighbor
 func (h sortedNeighbors) InsertSorted(n neighbor, k int) sortedNeighbors {
 	for i := range len(h) {
 		if n.distance < h[i].distance {
-			h = append(h[:i+1], h[i:]...)
-			h[i] = n
-			if len(h) > k {
-				h = h[:k]
+			if len(h) < k {
+				h = append(h, neighbor{})
 			}
+			// Shift the farther neighbors back by one, a full list drops its last neighbor
+			copy(h[i+1:], h[i:])
+			h[i] = n
 			return h
 		}
 	}
@@ -55,16 +235,196 @@ func (h sortedNeighbors) InsertSorted(n neighbor, k int) sortedNeighbors {
 	return h
 }
 
+/**
+* neighborHeap collects the k closest neighbors like sortedNeighbors, but as a bounded max-heap of the farthest
+* neighbor so far, which takes O(log k) per insert instead of shifting the list.
+* Of neighbors with equal distances, the first inserted is kept and ordered first, exactly like InsertSorted.
+ */
+type neighborHeap struct {
+	k     int
+	items []heapNeighbor
+	seq   int // insertion counter to break ties like InsertSorted
+}
+
+type heapNeighbor struct {
+	neighbor
+	seq int
+}
+
+func newNeighborHeap(k int) *neighborHeap {
+	return &neighborHeap{k: k, items: make([]heapNeighbor, 0, k)}
+}
+
+// farther orders the heap, the root is the neighbor InsertSorted would drop first.
+func (h *neighborHeap) farther(i, j int) bool {
+	if h.items[i].distance != h.items[j].distance {
+		return h.items[i].distance > h.items[j].distance
+	}
+	return h.items[i].seq > h.items[j].seq
+}
+
+func (h *neighborHeap) insert(n neighbor) {
+	h.seq++
+	if len(h.items) < h.k {
+		h.items = append(h.items, heapNeighbor{n, h.seq})
+		h.up(len(h.items) - 1)
+		return
+	}
+	if h.k == 0 || n.distance >= h.items[0].distance {
+		return
+	}
+	h.items[0] = heapNeighbor{n, h.seq}
+	h.down(0)
+}
+
+func (h *neighborHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.farther(i, parent) {
+			return
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *neighborHeap) down(i int) {
+	for {
+		largest := i
+		if left := 2*i + 1; left < len(h.items) && h.farther(left, largest) {
+			largest = left
+		}
+		if right := 2*i + 2; right < len(h.items) && h.farther(right, largest) {
+			largest = right
+		}
+		if largest == i {
+			return
+		}
+		h.items[i], h.items[largest] = h.items[largest], h.items[i]
+		i = largest
+	}
+}
+
+// sorted returns the collected neighbors closest first, the heap must not be used afterwards.
+func (h *neighborHeap) sorted() sortedNeighbors {
+	slices.SortFunc(h.items, func(a, b heapNeighbor) int {
+		if a.distance != b.distance {
+			return cmp.Compare(a.distance, b.distance)
+		}
+		return a.seq - b.seq
+	})
+	sorted := make(sortedNeighbors, len(h.items))
+	for i, n := range h.items {
+		sorted[i] = n.neighbor
+	}
+	return sorted
+}
+
 // nearestNeighborsSequential performs brute-force k-NN search sequentially (used for small datasets).
 func nearestNeighborsSequential(query Vector, rawData []DataRow, k int) sortedNeighbors {
-	sorted := make(sortedNeighbors, 0, k)
+	nearest := newNeighborHeap(k)
 	for _, row := range rawData {
 		dist := euclideanDistance(query, row.Vector)
-		sorted = sorted.InsertSorted(neighbor{id: row.Id, distance: dist}, k)
+		if dist == mismatchedDistance {
+			continue
+		}
+		nearest.insert(neighbor{id: row.Id, distance: dist})
+	}
+	return nearest.sorted()
+}
+
+/**
+* nearestNeighborsBatchSequential finds the nearest neighbors of several queries in a single pass over the data.
+* Each data row is compared with all queries while it is in the cache, which amortizes the scan over the batch.
+* A query with partitions only considers the rows of these partitions, like the partition-restricted search.
+* Likewise, a query with a filter only considers the rows matching it.
+ */
+func nearestNeighborsBatchSequential(
+	queries []Vector,
+	ks []int,
+	partitions [][]int,
+	filters []*idFilter,
+	rawData []DataRow,
+	distance func(a []float32, b []float32) float32,
+) []sortedNeighbors {
+	nearest := make([]*neighborHeap, len(queries))
+	for i := range queries {
+		nearest[i] = newNeighborHeap(ks[i])
+	}
+	for _, row := range rawData {
+		for i, query := range queries {
+			if len(partitions[i]) > 0 && !slices.Contains(partitions[i], row.Partition) {
+				continue
+			}
+			if !filters[i].matches(row.Id) {
+				continue
+			}
+			dist := distance(query, row.Vector)
+			if dist == mismatchedDistance {
+				continue
+			}
+			nearest[i].insert(neighbor{id: row.Id, distance: dist})
+		}
+	}
+	sorted := make([]sortedNeighbors, len(queries))
+	for i := range nearest {
+		sorted[i] = nearest[i].sorted()
 	}
 	return sorted
 }
 
+/**
+* idFilter evaluates a filter of the form "id <op> <integer>" on the data rows, as the ground truth of a filtered
+* search must only contain rows the search can return. Other filter expressions are not supported.
+ */
+type idFilter struct {
+	op    string
+	value int64
+}
+
+// idFilterOps lists the two-character operators first, so that ">=" is not mistaken for ">"
+var idFilterOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// parseIdFilter parses a filter expression, an empty expression yields a nil filter that matches all rows.
+func parseIdFilter(expr string) (*idFilter, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+	for _, op := range idFilterOps {
+		field, value, found := strings.Cut(expr, op)
+		if !found {
+			continue
+		}
+		parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if strings.TrimSpace(field) != "id" || err != nil {
+			break
+		}
+		return &idFilter{op: op, value: parsed}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter %q, only \"id <op> <integer>\" can be evaluated", expr)
+}
+
+func (f *idFilter) matches(id int64) bool {
+	if f == nil {
+		return true
+	}
+	switch f.op {
+	case ">=":
+		return id >= f.value
+	case "<=":
+		return id <= f.value
+	case "==":
+		return id == f.value
+	case "!=":
+		return id != f.value
+	case ">":
+		return id > f.value
+	default:
+		return id < f.value
+	}
+}
+
 // mergeNeighbors merges multiple sorted neighbor lists into a single sorted list of k nearest.
 func mergeNeighbors(lists []sortedNeighbors, k int) sortedNeighbors {
 	merged := make(sortedNeighbors, 0, k)
@@ -112,6 +472,78 @@ func nearestNeighbors(query Vector, rawData []DataRow, k int) []int64 {
 	return resultIds
 }
 
+// nearestNeighborsBatch performs a parallel brute-force k-NN search for a batch of queries with their own k, partitions and filter.
+func nearestNeighborsBatch(
+	queries []Vector,
+	ks []int,
+	partitions [][]int,
+	filters []*idFilter,
+	rawData []DataRow,
+	distance func(a []float32, b []float32) float32,
+) [][]int64 {
+	neighbors := nearestNeighborsBatchWithDistances(queries, ks, partitions, filters, rawData, distance)
+	resultIds := make([][]int64, len(queries))
+	for q := range neighbors {
+		resultIds[q] = neighbors[q].ids()
+	}
+	return resultIds
+}
+
+// nearestNeighborsBatchWithDistances is nearestNeighborsBatch keeping the distance of every neighbor.
+func nearestNeighborsBatchWithDistances(
+	queries []Vector,
+	ks []int,
+	partitions [][]int,
+	filters []*idFilter,
+	rawData []DataRow,
+	distance func(a []float32, b []float32) float32,
+) []sortedNeighbors {
+	numWorkers := runtime.NumCPU()
+	dataLen := len(rawData)
+
+	// Split data into chunks for parallel processing
+	chunkSize := (dataLen + numWorkers - 1) / numWorkers
+	results := make([][]sortedNeighbors, numWorkers)
+	var wg sync.WaitGroup
+
+	for i := range numWorkers {
+		start := i * chunkSize
+		if start >= dataLen {
+			break
+		}
+		end := min(start+chunkSize, dataLen)
+
+		wg.Add(1)
+		go func(workerIdx int, chunk []DataRow) {
+			defer wg.Done()
+			results[workerIdx] = nearestNeighborsBatchSequential(queries, ks, partitions, filters, chunk, distance)
+		}(i, rawData[start:end])
+	}
+
+	wg.Wait()
+
+	// Merge the results of all workers per query
+	merged := make([]sortedNeighbors, len(queries))
+	for q := range queries {
+		lists := make([]sortedNeighbors, 0, numWorkers)
+		for _, result := range results {
+			if result != nil {
+				lists = append(lists, result[q])
+			}
+		}
+		merged[q] = mergeNeighbors(lists, ks[q])
+	}
+	return merged
+}
+
+func (h sortedNeighbors) ids() []int64 {
+	ids := make([]int64, len(h))
+	for i := range h {
+		ids[i] = h[i].id
+	}
+	return ids
+}
+
 func calculateRecall(queryVector Vector, resultIds []int64, rawData []DataRow) float64 {
 	// Avoid divide by zero
 	if len(resultIds) == 0 {
@@ -119,6 +551,31 @@ func calculateRecall(queryVector Vector, resultIds []int64, rawData []DataRow) f
 	}
 
 	trueNeighbors := nearestNeighbors(queryVector, rawData, len(resultIds))
+	return recallAgainst(resultIds, trueNeighbors)
+}
+
+/**
+* enhanceJobResult computes the recall metrics of a job with recall, e.g. against the true neighbors of its query.
+* The first-stage recall considers as many candidates (in approximate order) as results were returned,
+* so that the difference between both quantifies how much the re-ranking recovers.
+ */
+func enhanceJobResult(job Job, recall func(resultIds []int64) float64) EnhancedJobResult {
+	result := EnhancedJobResult{Job: job, Recall: -1.0, FirstStageRecall: -1.0}
+	result.QueryKind, result.Step = queryKind(job)
+	// Avoid divide by zero
+	if len(job.ResultIds) == 0 {
+		return result
+	}
+	result.Recall = recall(job.ResultIds)
+	if len(job.CandidateIds) > 0 {
+		candidates := job.CandidateIds[:min(len(job.CandidateIds), len(job.ResultIds))]
+		result.FirstStageRecall = recall(candidates)
+	}
+	return result
+}
+
+// recallAgainst returns the fraction of resultIds that are among the true neighbors.
+func recallAgainst(resultIds []int64, trueNeighbors []int64) float64 {
 	trueNeighborMap := make(map[int64]bool)
 	for _, id := range trueNeighbors {
 		trueNeighborMap[id] = true
@@ -134,18 +591,203 @@ func calculateRecall(queryVector Vector, resultIds []int64, rawData []DataRow) f
 	return float64(matches) / float64(len(resultIds))
 }
 
+/**
+* recallWithinDistance returns the fraction of resultIds that are at most as far from the query as the k-th true
+* neighbor. Unlike recallAgainst, a result tied with the k-th true neighbor counts as correct, since which of the
+* tied rows make it into the ground truth only depends on the order of the data, e.g. for duplicate vectors.
+ */
+func recallWithinDistance(
+	query Vector,
+	resultIds []int64,
+	trueNeighbors sortedNeighbors,
+	vectors map[int64]Vector,
+	distance func(a []float32, b []float32) float32,
+) float64 {
+	if len(trueNeighbors) == 0 {
+		return 0
+	}
+	threshold := trueNeighbors[len(trueNeighbors)-1].distance
+	matches := 0
+	for _, id := range resultIds {
+		// Unknown ids cannot be correct
+		if vector, ok := vectors[id]; ok && threshold != mismatchedDistance && distance(query, vector) <= threshold {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(resultIds))
+}
+
+// RecallOptions configures the ground-truth computation of EnhanceJobResults.
+type RecallOptions struct {
+	// Number of consecutive queries whose ground truth is computed in one pass over the data, 1 disables batching.
+	// Consecutive session queries are close in vector space, so batching them exploits their locality.
+	BatchSize int
+	// Additionally summarize the recall of retried and first-try jobs, as retried jobs may return different results.
+	SplitRetries bool
+	// Distance metric of the index (L2, IP or COSINE), the ground truth must be computed with the same metric.
+	Metric string
+	// Compute the ground truth of identical queries only once, e.g. for repeated queries or retried sessions.
+	// Space-partitioning trees are no alternative, they degrade to a full scan at the dimensionality of embeddings.
+	CacheGroundTruth bool
+	// Count a result as correct if it is as close as the k-th true neighbor instead of requiring its id in the ground
+	// truth, so that ties at the k-th distance do not lower the recall of a perfect search.
+	TieAware bool
+	// Compute L2 and IP distances with unrolled loops, see unrolledDistanceFunc.
+	Unrolled bool
+}
+
+func DefaultRecallOptions() RecallOptions {
+	return RecallOptions{BatchSize: 8, SplitRetries: true, Metric: metricL2, CacheGroundTruth: true, TieAware: true}
+}
+
+// groundTruthKey identifies the ground truth of a job by everything it depends on: query, k, partitions and filter.
+func groundTruthKey(job Job) string {
+	var key strings.Builder
+	buf := make([]byte, 4)
+	for _, v := range job.QueryVector {
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(v))
+		key.Write(buf)
+	}
+	fmt.Fprintf(&key, "|%d|%v|%s", len(job.ResultIds), job.Partitions, job.Filter)
+	return key.String()
+}
+
+// jobsWithResults returns the jobs with results along with their indexes in jobs.
+func jobsWithResults(jobs []Job) (executed []Job, indexes []int) {
+	for i, job := range jobs {
+		if len(job.ResultIds) > 0 {
+			executed = append(executed, job)
+			indexes = append(indexes, i)
+		}
+	}
+	return executed, indexes
+}
+
+/**
+* groupIdenticalQueries returns the jobs whose ground truth has to be computed along with the indexes of the jobs sharing it.
+* Without deduplication, every job computes its own ground truth. Otherwise the first job of each group represents it,
+* which keeps consecutive session queries together for batching.
+ */
+func groupIdenticalQueries(jobs []Job, deduplicate bool) ([]Job, [][]int) {
+	queryJobs := make([]Job, 0, len(jobs))
+	sharing := make([][]int, 0, len(jobs))
+	groupOf := make(map[string]int)
+	for i, job := range jobs {
+		if deduplicate {
+			key := groundTruthKey(job)
+			if group, ok := groupOf[key]; ok {
+				sharing[group] = append(sharing[group], i)
+				continue
+			}
+			groupOf[key] = len(queryJobs)
+		}
+		queryJobs = append(queryJobs, job)
+		sharing = append(sharing, []int{i})
+	}
+	return queryJobs, sharing
+}
+
+/**
+* checkDimensions returns the ids of the rows and jobs whose vectors differ in length from the first row.
+* Their distances are mismatchedDistance, so without this check they would silently drop out of the recall.
+ */
+func checkDimensions(rawData []DataRow, jobs []Job) (dim int, rowIds []int64, jobIds []string) {
+	if len(rawData) == 0 {
+		return 0, nil, nil
+	}
+	dim = len(rawData[0].Vector)
+	for _, row := range rawData {
+		if len(row.Vector) != dim {
+			rowIds = append(rowIds, row.Id)
+		}
+	}
+	for _, job := range jobs {
+		if len(job.QueryVector) != dim {
+			jobIds = append(jobIds, job.Id)
+		}
+	}
+	return dim, rowIds, jobIds
+}
+
+// maxLoggedIds bounds the ids listed in a warning
+const maxLoggedIds = 10
+
 // EnhanceJobResults calculates recall for all jobs concurrently and returns enhanced results.
-func EnhanceJobResults(rawData []DataRow, jobs []Job) []EnhancedJobResult {
+func EnhanceJobResults(rawData []DataRow, jobs []Job, options RecallOptions) []EnhancedJobResult {
 	numJobs := len(jobs)
+	if dim, rowIds, jobIds := checkDimensions(rawData, jobs); len(rowIds) > 0 || len(jobIds) > 0 {
+		fmt.Printf("Warning: %d rows (e.g. %v) and %d queries (e.g. %v) do not have dimension %d and are never neighbors\n",
+			len(rowIds), rowIds[:min(len(rowIds), maxLoggedIds)], len(jobIds), jobIds[:min(len(jobIds), maxLoggedIds)], dim)
+	}
 	enhancedResults := make([]EnhancedJobResult, numJobs)
+	batchSize := max(1, options.BatchSize)
+
+	// For cosine, the data is normalized once so that the scan only computes inner products
+	metric := options.Metric
+	normalize := metric == metricCosine
+	if normalize {
+		normalizedData := make([]DataRow, len(rawData))
+		for i, row := range rawData {
+			normalizedData[i] = row
+			normalizedData[i].Vector = normalizeVector(row.Vector)
+		}
+		rawData = normalizedData
+		metric = metricIP
+	}
+	distance := distanceFunc(metric)
+	if options.Unrolled {
+		distance = unrolledDistanceFunc(metric)
+	}
+	var vectors map[int64]Vector // vectors of the rows by id, only needed for tie-aware recall
+	if options.TieAware {
+		vectors = make(map[int64]Vector, len(rawData))
+		for _, row := range rawData {
+			vectors[row.Id] = row.Vector
+		}
+	}
 
-	// Use a worker pool to process jobs concurrently (based on number of CPU cores)
-	numWorkers := min(runtime.NumCPU(), numJobs)
-	jobChan := make(chan int, numJobs)
+	// Jobs without results have no recall, e.g. failed, timed-out or never executed session steps, so their ground
+	// truth is not computed. The query vector of a never executed step is not even a query but the drift offset.
+	executed, executedIndexes := jobsWithResults(jobs)
+	for i, job := range jobs {
+		if len(job.ResultIds) == 0 {
+			enhancedResults[i] = enhanceJobResult(job, nil)
+		}
+	}
+
+	// Jobs with identical queries share a single ground-truth computation
+	queryJobs, sharing := groupIdenticalQueries(executed, options.CacheGroundTruth)
+	for _, group := range sharing {
+		for k, i := range group {
+			group[k] = executedIndexes[i]
+		}
+	}
+	numQueries := len(queryJobs)
+
+	// The ground truth of a filtered query only contains rows matching the filter
+	filters := make([]*idFilter, numQueries)
+	unsupportedFilters := 0
+	for i, job := range queryJobs {
+		filter, err := parseIdFilter(job.Filter)
+		if err != nil {
+			unsupportedFilters += len(sharing[i])
+		}
+		filters[i] = filter
+	}
+	if unsupportedFilters > 0 {
+		fmt.Printf("Warning: the filters of %d jobs are not supported by the recall calculation and are ignored\n",
+			unsupportedFilters)
+	}
+
+	// Use a worker pool to process batches of consecutive jobs concurrently (based on number of CPU cores)
+	numBatches := (numQueries + batchSize - 1) / batchSize
+	numWorkers := min(runtime.NumCPU(), numBatches)
+	batchChan := make(chan int, numBatches)
 	var wg sync.WaitGroup
 
 	// Progress tracking
 	var completedCount atomic.Int64
+	completedCount.Add(int64(numJobs - len(executed)))
 	done := make(chan struct{})
 
 	// Progress logging goroutine - logs every 5 minutes
@@ -169,24 +811,175 @@ func EnhanceJobResults(rawData []DataRow, jobs []Job) []EnhancedJobResult {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for idx := range jobChan {
-				job := jobs[idx]
-				recall := calculateRecall(job.QueryVector, job.ResultIds, rawData)
-				enhancedResults[idx] = EnhancedJobResult{Job: job, Recall: recall}
-				completedCount.Add(1)
+			for start := range batchChan {
+				batch := queryJobs[start:min(start+batchSize, numQueries)]
+				queries := make([]Vector, len(batch))
+				ks := make([]int, len(batch))
+				partitions := make([][]int, len(batch))
+				batchFilters := filters[start : start+len(batch)]
+				for i, job := range batch {
+					queries[i] = job.QueryVector
+					if normalize {
+						queries[i] = normalizeVector(job.QueryVector)
+					}
+					ks[i] = len(job.ResultIds)
+					partitions[i] = job.Partitions
+				}
+				trueNeighbors := nearestNeighborsBatchWithDistances(queries, ks, partitions, batchFilters, rawData, distance)
+				for i := range batch {
+					recall := func(resultIds []int64) float64 { return recallAgainst(resultIds, trueNeighbors[i].ids()) }
+					if options.TieAware {
+						recall = func(resultIds []int64) float64 {
+							return recallWithinDistance(queries[i], resultIds, trueNeighbors[i], vectors, distance)
+						}
+					}
+					for _, j := range sharing[start+i] {
+						enhancedResults[j] = enhanceJobResult(jobs[j], recall)
+					}
+					completedCount.Add(int64(len(sharing[start+i])))
+				}
 			}
 		}()
 	}
 
-	// Send jobs to workers
-	for i := range jobs {
-		jobChan <- i
+	// Send batches to workers
+	for start := 0; start < numQueries; start += batchSize {
+		batchChan <- start
 	}
-	close(jobChan)
+	close(batchChan)
 
 	wg.Wait()
 	close(done) // Stop progress logging goroutine
 
-	fmt.Printf("Recall calculation complete: %d / %d jobs processed\n", numJobs, numJobs)
+	fmt.Printf("Recall calculation complete: %d / %d jobs processed, %d distinct queries\n", numJobs, numJobs, numQueries)
 	return enhancedResults
 }
+
+// RecallGroupStats holds the mean recall of a group of queries, queries without results are not counted.
+type RecallGroupStats struct {
+	Count      int
+	MeanRecall float64
+	MinRecall  float64
+	MaxRecall  float64
+}
+
+// add counts a query, MeanRecall holds the sum of the recalls until it is divided by the count.
+func (g *RecallGroupStats) add(recall float64) {
+	if g.Count == 0 || recall < g.MinRecall {
+		g.MinRecall = recall
+	}
+	if g.Count == 0 || recall > g.MaxRecall {
+		g.MaxRecall = recall
+	}
+	g.Count++
+	g.MeanRecall += recall
+}
+
+// merge combines the stats of two disjoint groups of queries.
+func (g RecallGroupStats) merge(other RecallGroupStats) RecallGroupStats {
+	if g.Count == 0 {
+		return other
+	}
+	if other.Count == 0 {
+		return g
+	}
+	count := g.Count + other.Count
+	return RecallGroupStats{
+		Count:      count,
+		MeanRecall: (g.MeanRecall*float64(g.Count) + other.MeanRecall*float64(other.Count)) / float64(count),
+		MinRecall:  min(g.MinRecall, other.MinRecall),
+		MaxRecall:  max(g.MaxRecall, other.MaxRecall),
+	}
+}
+
+// RecallSummary breaks down the mean recall by the kind of query.
+type RecallSummary struct {
+	K               int // number of results the recall is computed at, the largest one if it differs between queries
+	Overall         RecallGroupStats
+	Independent     RecallGroupStats
+	SessionFirst    RecallGroupStats
+	SessionFollowUp RecallGroupStats
+	FirstTry        *RecallGroupStats // only set if SplitRetries is enabled
+	Retried         *RecallGroupStats // only set if SplitRetries is enabled
+	// Recall by the search effort of swept searches, e.g. for a recall curve over ef, only set with a sweep
+	BySearchEffort map[int]*RecallGroupStats `json:",omitempty"`
+}
+
+func SummarizeRecall(results []EnhancedJobResult, options RecallOptions) RecallSummary {
+	var summary RecallSummary
+	if options.SplitRetries {
+		summary.FirstTry, summary.Retried = &RecallGroupStats{}, &RecallGroupStats{}
+	}
+	groups := map[string]*RecallGroupStats{
+		queryKindIndependent:     &summary.Independent,
+		queryKindSessionFirst:    &summary.SessionFirst,
+		queryKindSessionFollowUp: &summary.SessionFollowUp,
+	}
+	for _, result := range results {
+		if result.Recall < 0 {
+			continue
+		}
+		summary.K = max(summary.K, len(result.ResultIds))
+		retryGroup := summary.FirstTry
+		if result.Retries > 0 {
+			retryGroup = summary.Retried
+		}
+		var effortGroup *RecallGroupStats
+		if result.SearchEffort > 0 {
+			if summary.BySearchEffort == nil {
+				summary.BySearchEffort = make(map[int]*RecallGroupStats)
+			}
+			if summary.BySearchEffort[result.SearchEffort] == nil {
+				summary.BySearchEffort[result.SearchEffort] = &RecallGroupStats{}
+			}
+			effortGroup = summary.BySearchEffort[result.SearchEffort]
+		}
+		for _, group := range []*RecallGroupStats{&summary.Overall, groups[result.QueryKind], retryGroup, effortGroup} {
+			if group == nil {
+				continue
+			}
+			group.add(result.Recall)
+		}
+	}
+	for _, group := range []*RecallGroupStats{&summary.Overall, &summary.Independent, &summary.SessionFirst, &summary.SessionFollowUp, summary.FirstTry, summary.Retried} {
+		if group != nil && group.Count > 0 {
+			group.MeanRecall /= float64(group.Count)
+		}
+	}
+	for _, group := range summary.BySearchEffort {
+		group.MeanRecall /= float64(group.Count)
+	}
+	return summary
+}
+
+/**
+* MergeRecallSummaries combines the summaries of several runs as if their queries were summarized together,
+* e.g. for the combined recall of all runs processed by the offline recall calculation.
+ */
+func MergeRecallSummaries(summaries ...RecallSummary) RecallSummary {
+	var merged RecallSummary
+	for _, summary := range summaries {
+		merged.K = max(merged.K, summary.K)
+		merged.Overall = merged.Overall.merge(summary.Overall)
+		merged.Independent = merged.Independent.merge(summary.Independent)
+		merged.SessionFirst = merged.SessionFirst.merge(summary.SessionFirst)
+		merged.SessionFollowUp = merged.SessionFollowUp.merge(summary.SessionFollowUp)
+		if summary.FirstTry != nil {
+			if merged.FirstTry == nil {
+				merged.FirstTry, merged.Retried = &RecallGroupStats{}, &RecallGroupStats{}
+			}
+			*merged.FirstTry = merged.FirstTry.merge(*summary.FirstTry)
+			*merged.Retried = merged.Retried.merge(*summary.Retried)
+		}
+		for effort, group := range summary.BySearchEffort {
+			if merged.BySearchEffort == nil {
+				merged.BySearchEffort = make(map[int]*RecallGroupStats)
+			}
+			if merged.BySearchEffort[effort] == nil {
+				merged.BySearchEffort[effort] = &RecallGroupStats{}
+			}
+			*merged.BySearchEffort[effort] = merged.BySearchEffort[effort].merge(*group)
+		}
+	}
+	return merged
+}